@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	switch {
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unarchive"):
+		err = email.Unarchive(ctx, awsclient.New(cfg), messageID)
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/archive"):
+		err = email.Archive(ctx, awsclient.New(cfg), messageID)
+	default:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, platform.ErrNotFound):
+			return apiutil.NewErrorResponse(http.StatusNotFound, "email not found"), nil
+		case errors.Is(err, platform.ErrInvalidInput):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "email is not received"), nil
+		case errors.Is(err, &platform.AlreadyArchivedError{Type: "email"}):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "email is already archived"), nil
+		case errors.Is(err, &platform.NotArchivedError{Type: "email"}):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "email is not archived"), nil
+		case errors.Is(err, platform.ErrTooManyRequests):
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("dynamodb archive failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -35,6 +35,8 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 	month := req.QueryStringParameters["month"]
 	order := req.QueryStringParameters["order"]
 	showTrash := req.QueryStringParameters["showTrash"]
+	showArchived := req.QueryStringParameters["showArchived"]
+	showSnoozed := req.QueryStringParameters["showSnoozed"]
 	pageSizeStr := req.QueryStringParameters["pageSize"]
 	nextCursor := req.QueryStringParameters["nextCursor"]
 
@@ -58,13 +60,15 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		emailType, year, month, order, pageSizeStr, nextCursor)
 
 	result, err := email.List(ctx, dynamodb.NewFromConfig(cfg), email.ListInput{
-		Type:       emailType,
-		Year:       year,
-		Month:      month,
-		Order:      order,
-		ShowTrash:  showTrash,
-		PageSize:   pageSize,
-		NextCursor: cursor,
+		Type:         emailType,
+		Year:         year,
+		Month:        month,
+		Order:        order,
+		ShowTrash:    showTrash,
+		ShowArchived: showArchived,
+		ShowSnoozed:  showSnoozed,
+		PageSize:     pageSize,
+		NextCursor:   cursor,
 	})
 	if err != nil {
 		if err == platform.ErrInvalidInput {
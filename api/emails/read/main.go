@@ -10,7 +10,7 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
@@ -45,7 +45,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
 	}
 
-	err = email.Read(ctx, dynamodb.NewFromConfig(cfg), messageID, action)
+	err = email.Read(ctx, awsclient.New(cfg), messageID, action)
 	if err != nil {
 		if err == platform.ErrTooManyRequests {
 			fmt.Println("too many requests")
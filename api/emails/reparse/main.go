@@ -9,27 +9,13 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
 )
 
-type reparseClient struct {
-	dynamodbSvc *dynamodb.Client
-	s3Svc       *s3.Client
-}
-
-func (c *reparseClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
-	return c.s3Svc.GetObject(ctx, params, optFns...)
-}
-
-func (c *reparseClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-	return c.dynamodbSvc.UpdateItem(ctx, params, optFns...)
-}
-
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
@@ -48,10 +34,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
 	}
 
-	client := &reparseClient{
-		dynamodbSvc: dynamodb.NewFromConfig(cfg),
-		s3Svc:       s3.NewFromConfig(cfg),
-	}
+	client := awsclient.New(cfg)
 
 	err = email.Reparse(ctx, client, messageID)
 	if err != nil {
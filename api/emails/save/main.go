@@ -9,44 +9,14 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
 )
 
-type saveClient struct {
-	dynamodbSvc *dynamodb.Client
-	sesv2Svc    *sesv2.Client
-}
-
-func (c saveClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-	return c.dynamodbSvc.GetItem(ctx, params, optFns...)
-}
-
-func (c saveClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
-	return c.dynamodbSvc.PutItem(ctx, params, optFns...)
-}
-
-func (c saveClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-	return c.dynamodbSvc.TransactWriteItems(ctx, params, optFns...)
-}
-
-func (c saveClient) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
-	return c.sesv2Svc.SendEmail(ctx, params, optFns...)
-}
-
-func newSaveClient(cfg aws.Config) saveClient {
-	return saveClient{
-		dynamodbSvc: dynamodb.NewFromConfig(cfg),
-		sesv2Svc:    sesv2.NewFromConfig(cfg),
-	}
-}
-
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
@@ -83,7 +53,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 	}
 
 	input.MessageID = messageID
-	client := newSaveClient(cfg)
+	client := awsclient.New(cfg)
 	result, err := email.Save(ctx, client, input)
 	if err != nil {
 		if err == platform.ErrInvalidInput {
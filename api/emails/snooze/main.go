@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+// snoozeInput is the request body of snooze, with the time in RFC3339 format
+type snoozeInput struct {
+	Until time.Time `json:"until"`
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	switch {
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unsnooze"):
+		err = email.Unsnooze(ctx, awsclient.New(cfg), messageID)
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/snooze"):
+		input := snoozeInput{}
+		if err = json.Unmarshal([]byte(req.Body), &input); err != nil {
+			fmt.Printf("invalid input: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+		if !input.Until.After(time.Now()) {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: until must be in the future"), nil
+		}
+		err = email.Snooze(ctx, awsclient.New(cfg), messageID, input.Until)
+	default:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, platform.ErrNotFound):
+			return apiutil.NewErrorResponse(http.StatusNotFound, "email not found"), nil
+		case errors.Is(err, platform.ErrInvalidInput):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "email is trashed or not received"), nil
+		case errors.Is(err, &platform.NotSnoozedError{Type: "email"}):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "email is not snoozed"), nil
+		case errors.Is(err, platform.ErrTooManyRequests):
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("dynamodb snooze failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
@@ -36,7 +36,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
 	}
 
-	err = email.Trash(ctx, dynamodb.NewFromConfig(cfg), messageID)
+	err = email.Trash(ctx, awsclient.New(cfg), messageID)
 	if err != nil {
 		if errors.Is(err, &platform.AlreadyTrashedError{Type: "email"}) {
 			fmt.Printf("dynamodb trash failed: %v\n", err)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/export"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	exportID := req.PathParameters["exportID"]
+	fmt.Printf("request params: [exportID] %s\n", exportID)
+
+	if exportID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid exportID"), nil
+	}
+
+	result, err := export.GetJob(ctx, dynamodb.NewFromConfig(cfg), exportID)
+	if err != nil {
+		if errors.Is(err, export.ErrJobNotFound) {
+			fmt.Println("export not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "export not found"), nil
+		}
+		if errors.Is(err, platform.ErrTooManyRequests) {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("export get failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	fmt.Println("invoke successful")
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/harryzcy/mailbox/internal/push"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+func handler(_ context.Context, _ events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	fmt.Println("request received")
+
+	publicKey, err := push.PublicKey()
+	if err != nil {
+		if errors.Is(err, push.ErrNotConfigured) {
+			return apiutil.NewErrorResponse(http.StatusNotFound, "web push is not configured"), nil
+		}
+		fmt.Printf("failed to get VAPID public key: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(map[string]string{"publicKey": publicKey})
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	fmt.Println("invoke successful")
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/push"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	subscriptionID := req.PathParameters["subscriptionID"]
+	fmt.Printf("request params: [subscriptionID] %s\n", subscriptionID)
+
+	if subscriptionID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid subscriptionID"), nil
+	}
+
+	err = push.Unsubscribe(ctx, dynamodb.NewFromConfig(cfg), subscriptionID)
+	if err != nil {
+		if errors.Is(err, push.ErrSubscriptionNotFound) {
+			fmt.Println("push subscription not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "push subscription not found"), nil
+		}
+		if errors.Is(err, platform.ErrTooManyRequests) {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("push unsubscribe failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	fmt.Println("invoke successful")
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
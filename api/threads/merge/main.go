@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+// mergeInput is the request body, with the ID of the thread to merge from
+type mergeInput struct {
+	ThreadID string `json:"threadID"`
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	threadID := req.PathParameters["threadID"]
+	fmt.Printf("request params: [threadID] %s\n", threadID)
+	if threadID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid threadID"), nil
+	}
+
+	input := mergeInput{}
+	err = json.Unmarshal([]byte(req.Body), &input)
+	if err != nil || input.ThreadID == "" {
+		fmt.Printf("invalid input: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+	}
+
+	result, err := thread.Merge(ctx, awsclient.New(cfg), threadID, input.ThreadID)
+	if err != nil {
+		switch {
+		case errors.Is(err, platform.ErrNotFound):
+			return apiutil.NewErrorResponse(http.StatusNotFound, "thread not found"), nil
+		case errors.Is(err, platform.ErrInvalidInput):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: cannot merge a thread into itself"), nil
+		case errors.Is(err, platform.ErrThreadTrashed), errors.Is(err, platform.ErrTooManyEmails), errors.Is(err, platform.ErrMultipleDrafts):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, err.Error()), nil
+		case errors.Is(err, platform.ErrConflict):
+			fmt.Println("thread changed during the merge")
+			return apiutil.NewErrorResponse(http.StatusConflict, "thread is changed, please try again"), nil
+		case errors.Is(err, platform.ErrTooManyRequests):
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("dynamodb merge thread failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	fmt.Println("invoke successful")
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+// muteInput is the optional request body of mute, with the action applied to new emails
+type muteInput struct {
+	Action string `json:"action"`
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	threadID := req.PathParameters["threadID"]
+	fmt.Printf("request params: [threadID] %s\n", threadID)
+	if threadID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid threadID"), nil
+	}
+
+	switch {
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unmute"):
+		err = thread.Unmute(ctx, awsclient.New(cfg), threadID)
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/mute"):
+		input := muteInput{Action: thread.MuteActionRead}
+		if req.Body != "" {
+			if err = json.Unmarshal([]byte(req.Body), &input); err != nil {
+				fmt.Printf("invalid input: %v\n", err)
+				return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+			}
+		}
+		err = thread.Mute(ctx, awsclient.New(cfg), threadID, input.Action)
+	default:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, platform.ErrNotFound):
+			fmt.Println("thread not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "thread not found"), nil
+		case errors.Is(err, platform.ErrInvalidInput):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: action must be read or trash"), nil
+		case errors.Is(err, platform.ErrTooManyRequests):
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("dynamodb mute thread failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
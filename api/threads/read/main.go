@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	threadID := req.PathParameters["threadID"]
+	fmt.Printf("request params: [threadID] %s\n", threadID)
+	if threadID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid threadID"), nil
+	}
+
+	var action string
+	switch {
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unread"):
+		action = email.ActionUnread
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/read"):
+		action = email.ActionRead
+	default:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
+	}
+
+	err = thread.Read(ctx, awsclient.New(cfg), threadID, action)
+	if err != nil {
+		if err == platform.ErrNotFound {
+			fmt.Println("thread not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "thread not found"), nil
+		}
+		if err == platform.ErrReadActionFailed {
+			fmt.Println("thread changed during the read action")
+			return apiutil.NewErrorResponse(http.StatusConflict, "thread is changed, please try again"), nil
+		}
+		if err == platform.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+
+		fmt.Printf("dynamodb read thread failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
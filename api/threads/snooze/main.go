@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+// snoozeInput is the request body of snooze, with the time in RFC3339 format
+type snoozeInput struct {
+	Until time.Time `json:"until"`
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	threadID := req.PathParameters["threadID"]
+	fmt.Printf("request params: [threadID] %s\n", threadID)
+	if threadID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid threadID"), nil
+	}
+
+	switch {
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unsnooze"):
+		err = thread.Unsnooze(ctx, awsclient.New(cfg), threadID)
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/snooze"):
+		input := snoozeInput{}
+		if err = json.Unmarshal([]byte(req.Body), &input); err != nil {
+			fmt.Printf("invalid input: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+		err = thread.Snooze(ctx, awsclient.New(cfg), threadID, input.Until)
+	default:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, platform.ErrNotFound):
+			fmt.Println("thread not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "thread not found"), nil
+		case errors.Is(err, platform.ErrInvalidInput):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: until must be in the future"), nil
+		case errors.Is(err, platform.ErrThreadTrashed):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "thread is trashed"), nil
+		case errors.Is(err, &platform.NotSnoozedError{Type: "thread"}):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "thread is not snoozed"), nil
+		case errors.Is(err, platform.ErrConflict):
+			fmt.Println("thread changed during the snooze action")
+			return apiutil.NewErrorResponse(http.StatusConflict, "thread is changed, please try again"), nil
+		case errors.Is(err, platform.ErrTooManyRequests):
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("dynamodb snooze thread failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
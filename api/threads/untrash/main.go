@@ -10,7 +10,7 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/harryzcy/mailbox/internal/thread"
@@ -36,12 +36,20 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid threadID"), nil
 	}
 
-	err = thread.Untrash(ctx, dynamodb.NewFromConfig(cfg), threadID)
+	err = thread.Untrash(ctx, awsclient.New(cfg), threadID)
 	if err != nil {
 		if errors.Is(err, &platform.NotTrashedError{Type: "thread"}) {
 			fmt.Printf("dynamodb untrash failed: %v\n", err)
 			return apiutil.NewErrorResponse(http.StatusBadRequest, "thread already not trashed"), nil
 		}
+		if err == platform.ErrNotFound {
+			fmt.Println("thread not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "thread not found"), nil
+		}
+		if err == platform.ErrConflict {
+			fmt.Println("thread changed during untrash")
+			return apiutil.NewErrorResponse(http.StatusConflict, "thread is changed, please try again"), nil
+		}
 		if err == platform.ErrTooManyRequests {
 			fmt.Println("too many requests")
 			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
@@ -0,0 +1,101 @@
+// Command export exports emails as mbox files or a Maildir tree, to a local directory or S3.
+//
+// Progress is saved to a file after each month, so an interrupted export
+// continues where it stopped when the same command is run again.
+//
+//	export -start 2023-01 -end 2023-12 -format maildir -out ./mail
+//	export -start 2023-01 -types inbox -out s3://bucket/prefix
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/export"
+)
+
+// state is saved to the progress file
+type state struct {
+	Input    export.Input    `json:"input"`
+	Progress export.Progress `json:"progress"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var s state
+	var types, out, progressFile string
+	flag.StringVar(&types, "types", "", "comma separated email types: inbox, sent, draft (default inbox,sent)")
+	flag.StringVar(&s.Input.Start, "start", "", "first month to export, in YYYY-MM")
+	flag.StringVar(&s.Input.End, "end", "", "last month to export, in YYYY-MM (default current month)")
+	flag.StringVar(&s.Input.Format, "format", export.FormatMbox, "mbox or maildir")
+	flag.BoolVar(&s.Input.IncludeTrash, "include-trash", false, "export trashed emails")
+	flag.StringVar(&out, "out", "", "local directory or s3://bucket/prefix")
+	flag.StringVar(&progressFile, "progress", "export-progress.json", "file to save progress to")
+	flag.Parse()
+
+	if out == "" {
+		return errors.New("-out is required")
+	}
+	if types != "" {
+		s.Input.Types = strings.Split(types, ",")
+	}
+
+	if data, err := os.ReadFile(progressFile); err == nil {
+		// resuming, the saved input takes precedence
+		s = state{}
+		if err = json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("invalid progress file: %w", err)
+		}
+		fmt.Printf("resuming from %s, %d/%d months done\n", progressFile, s.Progress.Completed, s.Progress.Total)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := s.Input.Validate(); err != nil {
+		return fmt.Errorf("invalid input: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	client := awsclient.New(cfg)
+
+	err = export.Run(ctx, client, export.ParseDestination(out, client), s.Input, &s.Progress, func(*export.Progress) error {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(progressFile, data, 0o600)
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("interrupted, run again to resume: %w", err)
+		}
+		return err
+	}
+
+	fmt.Printf("%d emails exported\n", s.Progress.Exported)
+	if len(s.Progress.Failed) > 0 {
+		fmt.Printf("%d emails failed: %s\n", len(s.Progress.Failed), strings.Join(s.Progress.Failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Command import imports emails from mbox files, .eml files, or directories of .eml files (e.g. Maildir).
+//
+// Messages are imported in the order of their Date header, so that conversations are threaded,
+// and messages whose Message-ID is already in the mailbox are skipped, so an import can be run again safely.
+//
+//	import -address me@example.com mail.mbox
+//	import -address me@example.com ./eml-directory message.eml
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/jhillyerd/enmime/v2"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/importer"
+)
+
+type message struct {
+	source string
+	raw    []byte
+	date   time.Time
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var addresses string
+	var opts importer.Options
+	flag.StringVar(&addresses, "address", "", "comma separated addresses of the mailbox owner, messages from them are imported as sent")
+	flag.BoolVar(&opts.Unread, "unread", false, "mark imported inbox emails as unread, unless they have a Status header")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		return errors.New("no mbox or .eml file is given")
+	}
+	if addresses != "" {
+		opts.Addresses = strings.Split(addresses, ",")
+	}
+
+	var messages []message
+	for _, path := range flag.Args() {
+		found, err := readMessages(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		messages = append(messages, found...)
+	}
+	slices.SortStableFunc(messages, func(a, b message) int {
+		return a.date.Compare(b.date)
+	})
+	fmt.Printf("%d messages found\n", len(messages))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	client := awsclient.New(cfg)
+
+	imported, duplicates, failed := 0, 0, 0
+	for _, msg := range messages {
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted, run again to resume: %w", err)
+		}
+
+		result, err := importer.Import(ctx, client, msg.raw, opts)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "failed to import message from %s: %v\n", msg.source, err)
+			failed++
+		case result.Duplicate:
+			duplicates++
+		default:
+			imported++
+		}
+	}
+
+	fmt.Printf("%d imported, %d duplicates skipped, %d failed\n", imported, duplicates, failed)
+	if failed > 0 {
+		return errors.New("some messages failed to import")
+	}
+	return nil
+}
+
+// readMessages reads the messages of a mbox file, an .eml file, or the files in a directory
+func readMessages(path string) ([]message, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		var messages []message
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return err
+			}
+			found, err := readMessages(p)
+			messages = append(messages, found...)
+			return err
+		})
+		return messages, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("From ")) {
+		return []message{newMessage(path, data)}, nil
+	}
+
+	var messages []message
+	err = importer.ReadMbox(bytes.NewReader(data), func(raw []byte) error {
+		messages = append(messages, newMessage(fmt.Sprintf("%s#%d", path, len(messages)+1), raw))
+		return nil
+	})
+	return messages, err
+}
+
+func newMessage(source string, raw []byte) message {
+	msg := message{source: source, raw: raw}
+	if envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw)); err == nil {
+		msg.date = importer.MessageDate(envelope)
+	}
+	return msg
+}
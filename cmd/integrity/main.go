@@ -0,0 +1,74 @@
+// Command integrity checks that threads and their emails are consistent, and repairs them.
+//
+// Every thread and email in the table is scanned, and problems such as dangling email IDs,
+// multiple or missing latest emails, unreferenced drafts and wrong TimeUpdated are reported.
+// Use -repair to fix them.
+//
+//	integrity -report report.json
+//	integrity -repair
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/thread"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var opts thread.CheckOptions
+	var reportFile string
+	flag.BoolVar(&opts.Repair, "repair", false, "repair the problems found")
+	flag.StringVar(&reportFile, "report", "", "file to write the report to, in JSON")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	client := awsclient.New(cfg)
+
+	report, err := thread.Check(ctx, client, opts)
+	if err != nil {
+		return err
+	}
+
+	if reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(reportFile, data, 0o600); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range report.Problems {
+			fmt.Printf("%s %s %s %s\n", problem.Kind, problem.ThreadID, problem.MessageID, problem.Detail)
+		}
+	}
+
+	fmt.Printf("%d threads, %d emails scanned, %d problems, %d threads repaired, %d failed\n",
+		report.Threads, report.Emails, len(report.Problems), report.Repaired, report.Failed)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d threads failed to repair, please run again", report.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Command restore rebuilds the emails in DynamoDB from the raw emails in storage.
+//
+// Every email in the bucket (or the storage directory) is compared with the table,
+// and missing or incomplete emails are written and linked to their threads.
+// Use -mode dry-run to see which emails would change, or -mode diff to see the changed attributes.
+//
+//	restore -mode diff -report report.json
+//	restore -address me@example.com
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/restore"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var opts restore.Options
+	var addresses, reportFile string
+	flag.StringVar(&opts.Mode, "mode", restore.ModeApply, "apply, dry-run (report changed emails) or diff (report changed attributes)")
+	flag.StringVar(&addresses, "address", "", "comma separated addresses of the mailbox owner, used to import missing imported emails again")
+	flag.StringVar(&reportFile, "report", "", "file to write the report to, in JSON")
+	flag.Parse()
+
+	if addresses != "" {
+		opts.Addresses = strings.Split(addresses, ",")
+	}
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("invalid mode: %s", opts.Mode)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	client := awsclient.New(cfg)
+
+	report, runErr := restore.All(ctx, client, opts)
+	if report == nil {
+		return runErr
+	}
+
+	if reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(reportFile, data, 0o600); err != nil {
+			return err
+		}
+	} else {
+		for _, entry := range report.Entries {
+			fmt.Printf("%s %s %s\n", entry.Action, entry.MessageID, entry.Reason)
+			for _, change := range entry.Changes {
+				fmt.Printf("  %s: %q -> %q\n", change.Attribute, change.Old, change.New)
+			}
+		}
+	}
+
+	fmt.Printf("%s: %d scanned, %d created, %d updated, %d unchanged, %d skipped, %d failed\n",
+		report.Mode, report.Scanned, report.Created, report.Updated, report.Unchanged, report.Skipped, report.Failed)
+	return runErr
+}
@@ -0,0 +1,24 @@
+// Command vapid generates a VAPID key pair for Web Push notifications.
+//
+// The private key is configured as VAPID_PRIVATE_KEY, and the public key is
+// the applicationServerKey browsers use to subscribe.
+//
+//	vapid
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/harryzcy/mailbox/internal/push"
+)
+
+func main() {
+	public, private, err := push.GenerateVAPIDKeys()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("VAPID_PRIVATE_KEY=" + private)
+	fmt.Println("public key: " + public)
+}
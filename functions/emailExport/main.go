@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/export"
+)
+
+// deadlineMargin is the time reserved before the Lambda deadline, to save the progress of a paused export
+const deadlineMargin = 30 * time.Second
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return events.SQSEventResponse{}, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	client := awsclient.New(cfg)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-deadlineMargin))
+		defer cancel()
+	}
+
+	failures := make([]events.SQSBatchItemFailure, 0)
+	for _, message := range sqsEvent.Records {
+		fmt.Println("running export job:", message.Body)
+		err := export.RunJob(ctx, client, message.Body)
+		if err != nil {
+			fmt.Printf("export job %s failed: %v\n", message.Body, err)
+			failures = append(failures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
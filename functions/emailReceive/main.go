@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -11,14 +12,15 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/push"
 	"github.com/harryzcy/mailbox/internal/thread"
 	"github.com/harryzcy/mailbox/internal/util/format"
 )
@@ -28,10 +30,16 @@ func main() {
 }
 
 func handler(ctx context.Context, sesEvent events.SimpleEmailEvent) error {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	client := awsclient.New(cfg)
+
 	for _, record := range sesEvent.Records {
 		ses := record.SES
 		fmt.Printf("[%s - %s] Mail = %+v, Receipt = %+v \n", record.EventVersion, record.EventSource, ses.Mail, ses.Receipt)
-		err := receiveEmail(ctx, record.SES)
+		err := receiveEmail(ctx, client, record.SES)
 		if err != nil {
 			log.Println(err)
 			return err
@@ -42,19 +50,32 @@ func handler(ctx context.Context, sesEvent events.SimpleEmailEvent) error {
 
 const StatusPass = "PASS"
 
-func receiveEmail(ctx context.Context, ses events.SimpleEmailService) error {
+func receiveEmail(ctx context.Context, client platform.ReceiveEmailAPI, ses events.SimpleEmailService) error {
 	if _, printErr := fmt.Fprintf(os.Stdout, "received an email from %s\n", ses.Mail.Source); printErr != nil {
 		return printErr
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	// events of the email and its thread are sent to SQS together
+	ctx = hook.WithBatch(ctx, ses.Mail.MessageID)
+
+	// the same message can be delivered to several addresses, which is stored once
+	existingID, err := email.RecordDelivery(ctx, client, email.Delivery{
+		MessageID:         ses.Mail.MessageID,
+		OriginalMessageID: ses.Mail.CommonHeaders.MessageID,
+		Destination:       ses.Mail.Destination,
+		From:              ses.Mail.CommonHeaders.From,
+		Subject:           ses.Mail.CommonHeaders.Subject,
+		DateSent:          format.Date(ses.Mail.CommonHeaders.Date),
+		TimeReceived:      ses.Mail.Timestamp,
+	})
 	if err != nil {
-		if _, printErr := fmt.Fprintln(os.Stderr, "unable to load SDK config, ", err); printErr != nil {
-			return printErr
-		}
+		return fmt.Errorf("failed to check duplicate deliveries, %w", err)
+	}
+	if existingID != "" {
+		fmt.Printf("email is already received as %s\n", existingID)
+		return nil
 	}
 
 	item := make(map[string]dynamodbTypes.AttributeValue)
@@ -81,7 +102,7 @@ func receiveEmail(ctx context.Context, ses events.SimpleEmailService) error {
 	item["Verdict"] = &dynamodbTypes.AttributeValueMemberM{Value: map[string]dynamodbTypes.AttributeValue{
 		"Spam":  &dynamodbTypes.AttributeValueMemberBOOL{Value: ses.Receipt.SpamVerdict.Status == StatusPass},
 		"DKIM":  &dynamodbTypes.AttributeValueMemberBOOL{Value: ses.Receipt.DKIMVerdict.Status == StatusPass},
-		"DMARC": &dynamodbTypes.AttributeValueMemberBOOL{Value: ses.Receipt.DKIMVerdict.Status == StatusPass},
+		"DMARC": &dynamodbTypes.AttributeValueMemberBOOL{Value: ses.Receipt.DMARCVerdict.Status == StatusPass},
 		"SPF":   &dynamodbTypes.AttributeValueMemberBOOL{Value: ses.Receipt.SPFVerdict.Status == StatusPass},
 		"Virus": &dynamodbTypes.AttributeValueMemberBOOL{Value: ses.Receipt.VirusVerdict.Status == StatusPass},
 	}}
@@ -102,7 +123,7 @@ func receiveEmail(ctx context.Context, ses events.SimpleEmailService) error {
 		}
 	}
 
-	emailResult, err := storage.S3.GetEmail(ctx, s3.NewFromConfig(cfg), ses.Mail.MessageID)
+	emailResult, err := storage.S3.GetEmail(ctx, client, ses.Mail.MessageID)
 	if err != nil {
 		if _, printErr := fmt.Fprintf(os.Stderr, "failed to get object, %v\n", err); printErr != nil {
 			return printErr
@@ -116,33 +137,57 @@ func receiveEmail(ctx context.Context, ses events.SimpleEmailService) error {
 
 	fmt.Printf("subject: %v", ses.Mail.CommonHeaders.Subject)
 
-	thread.StoreEmail(ctx, dynamodb.NewFromConfig(cfg), &thread.StoreEmailInput{
+	err = thread.StoreEmail(ctx, client, &thread.StoreEmailInput{
 		Item:         item,
 		InReplyTo:    inReplyTo,
 		References:   references,
 		TimeReceived: format.RFC3399(ses.Mail.Timestamp),
 	})
-
-	err = hook.SendSQS(ctx, sqs.NewFromConfig(cfg), hook.EmailReceipt{
-		MessageID: ses.Mail.MessageID,
-		Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
-	})
 	if err != nil {
-		if _, printErr := fmt.Fprintf(os.Stderr, "failed to send email receipt to SQS, %v\n", err); printErr != nil {
-			return printErr
-		}
+		return errors.Join(err, flushEvents(ctx, client))
 	}
 
-	err = hook.SendWebhook(ctx, &hook.Hook{
-		Event:  hook.EventEmail,
-		Action: hook.ActionReceived,
+	if _, muted := item["MutedByThread"]; muted {
+		fmt.Println("thread is muted, notifications are skipped")
+		return flushEvents(ctx, client)
+	}
+
+	receipt := &hook.Hook{
+		Event:     hook.EventEmail,
+		Action:    hook.ActionReceived,
+		Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
 		Email: hook.Email{
 			ID: ses.Mail.MessageID,
 		},
-		Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
+	}
+	if threadID, ok := item["ThreadID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+		receipt.Email.ThreadID = threadID.Value
+	}
+
+	// push notifications are best effort, since the email is already stored
+	pushed, err := push.NotifyReceived(ctx, client, hook.Email{
+		ID:       receipt.Email.ID,
+		ThreadID: receipt.Email.ThreadID,
+		Subject:  ses.Mail.CommonHeaders.Subject,
+		From:     ses.Mail.CommonHeaders.From,
 	})
 	if err != nil {
-		err = fmt.Errorf("failed to send webhook, %v", err)
+		fmt.Printf("failed to send push notifications, %v\n", err)
+	} else if pushed.Sent > 0 || pushed.Pruned > 0 {
+		fmt.Printf("push notifications sent: %d, expired subscriptions: %d\n", pushed.Sent, pushed.Pruned)
 	}
-	return err
+
+	err = hook.Publish(ctx, client, receipt)
+	if err != nil {
+		err = fmt.Errorf("failed to publish email receipt, %w", err)
+	}
+	return errors.Join(err, flushEvents(ctx, client))
+}
+
+// flushEvents sends the events collected during receiveEmail to SQS
+func flushEvents(ctx context.Context, client platform.SQSSendMessageBatchAPI) error {
+	if err := hook.Flush(ctx, client); err != nil {
+		return fmt.Errorf("failed to send events to SQS, %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEnv() {
+	env.Region = "us-west-2"
+	env.TableName = "table-for-receive"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiOriginalIndexName = "OriginalMessageIDIndex"
+	env.S3Bucket = "bucket-for-receive"
+	env.QueueName = "queue-for-receive"
+	env.WebhookURL = ""
+}
+
+// deliver stores the raw email in S3 and calls receiveEmail, like SES does
+func deliver(t *testing.T, client *memory.Client, messageID, originalMessageID, inReplyTo string, timestamp time.Time) {
+	t.Helper()
+
+	headers := []events.SimpleEmailHeader{
+		{Name: "From", Value: "sender@example.com"},
+		{Name: "To", Value: "me@example.com"},
+		{Name: "Subject", Value: "Subject of " + originalMessageID},
+		{Name: "Message-ID", Value: originalMessageID},
+		{Name: "Date", Value: timestamp.Format(time.RFC1123Z)},
+	}
+	if inReplyTo != "" {
+		headers = append(headers,
+			events.SimpleEmailHeader{Name: "In-Reply-To", Value: inReplyTo},
+			events.SimpleEmailHeader{Name: "References", Value: inReplyTo},
+		)
+	}
+
+	raw := strings.Builder{}
+	for _, header := range headers {
+		raw.WriteString(header.Name + ": " + header.Value + "\r\n")
+	}
+	raw.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\nBody of " + originalMessageID + "\r\n")
+
+	_, err := client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(env.S3Bucket),
+		Key:    aws.String(messageID),
+		Body:   strings.NewReader(raw.String()),
+	})
+	assert.Nil(t, err)
+
+	err = receiveEmail(context.TODO(), client, events.SimpleEmailService{
+		Mail: events.SimpleEmailMessage{
+			MessageID:   messageID,
+			Source:      "sender@example.com",
+			Timestamp:   timestamp,
+			Destination: []string{"me@example.com"},
+			Headers:     headers,
+			CommonHeaders: events.SimpleEmailCommonHeaders{
+				From:      []string{"sender@example.com"},
+				To:        []string{"me@example.com"},
+				MessageID: originalMessageID,
+				Date:      timestamp.Format(time.RFC1123Z),
+				Subject:   "Subject of " + originalMessageID,
+			},
+		},
+		Receipt: events.SimpleEmailReceipt{
+			SpamVerdict: events.SimpleEmailVerdict{Status: StatusPass},
+		},
+	})
+	assert.Nil(t, err)
+}
+
+func TestReceiveEmail(t *testing.T) {
+	setupEnv()
+	ctx := context.TODO()
+	client := memory.NewClient()
+	timestamp := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deliver(t, client, "ses-1", "<1@example.com>", "", timestamp)
+
+	result, err := email.Get(ctx, client, "ses-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "<1@example.com>", result.OriginalMessageID)
+	assert.Equal(t, "Subject of <1@example.com>", result.Subject)
+	assert.Contains(t, result.Text, "Body of <1@example.com>")
+	assert.Equal(t, "2023-01-01T00:00:00Z", result.TimeReceived)
+	assert.True(t, *result.Unread)
+	assert.True(t, result.Verdict.Spam)
+	assert.Empty(t, result.ThreadID)
+
+	messages := client.Messages(env.QueueName)
+	assert.Len(t, messages, 1)
+	assert.Contains(t, *messages[0].Body, "ses-1")
+}
+
+func TestReceiveEmail_Duplicate(t *testing.T) {
+	setupEnv()
+	ctx := context.TODO()
+	client := memory.NewClient()
+	timestamp := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the same message is delivered twice, e.g. to two addresses
+	deliver(t, client, "ses-1", "<1@example.com>", "", timestamp)
+	deliver(t, client, "ses-2", "<1@example.com>", "", timestamp)
+	deliver(t, client, "ses-2", "<1@example.com>", "", timestamp) // retried
+
+	result, err := email.Get(ctx, client, "ses-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ses-2"}, result.Deliveries)
+	_, err = email.Get(ctx, client, "ses-2")
+	assert.Equal(t, platform.ErrNotFound, err)
+	assert.Len(t, client.Messages(env.QueueName), 1, "only the first delivery is published")
+
+	// a later message reusing the Message-ID is stored as a new email
+	deliver(t, client, "ses-3", "<1@example.com>", "", timestamp.Add(48*time.Hour))
+	_, err = email.Get(ctx, client, "ses-3")
+	assert.Nil(t, err)
+
+	assert.Nil(t, email.Trash(ctx, client, "ses-1"))
+	assert.Nil(t, email.Delete(ctx, client, "ses-1"))
+	for _, id := range []string{"ses-1", "ses-2"} {
+		_, err = storage.S3.GetEmailRaw(ctx, client, id)
+		assert.NotNil(t, err, "raw email of every delivery is deleted")
+	}
+}
+
+func TestReceiveEmail_Muted(t *testing.T) {
+	setupEnv()
+	ctx := context.TODO()
+	client := memory.NewClient()
+	timestamp := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deliver(t, client, "ses-1", "<1@example.com>", "", timestamp)
+	deliver(t, client, "ses-2", "<2@example.com>", "<1@example.com>", timestamp.Add(time.Hour))
+	second, err := email.Get(ctx, client, "ses-2")
+	assert.Nil(t, err)
+	assert.Nil(t, thread.Mute(ctx, client, second.ThreadID, thread.MuteActionTrash))
+	published := len(client.Messages(env.QueueName))
+
+	// replies to a muted thread are stored as read and trashed, without events
+	deliver(t, client, "ses-3", "<3@example.com>", "<2@example.com>", timestamp.Add(2*time.Hour))
+	third, err := email.Get(ctx, client, "ses-3")
+	assert.Nil(t, err)
+	assert.Equal(t, second.ThreadID, third.ThreadID)
+	assert.False(t, *third.Unread)
+	assert.True(t, third.MutedByThread)
+	assert.NotEmpty(t, third.TrashedTime)
+	th, err := thread.GetThread(ctx, client, second.ThreadID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ses-1", "ses-2", "ses-3"}, th.EmailIDs)
+	assert.Equal(t, 2, th.UnreadCount)
+	assert.Len(t, client.Messages(env.QueueName), published)
+
+	assert.Nil(t, thread.Unmute(ctx, client, second.ThreadID))
+	deliver(t, client, "ses-4", "<4@example.com>", "<3@example.com>", timestamp.Add(3*time.Hour))
+	fourth, err := email.Get(ctx, client, "ses-4")
+	assert.Nil(t, err)
+	assert.True(t, *fourth.Unread)
+	assert.False(t, fourth.MutedByThread)
+	assert.Empty(t, fourth.TrashedTime)
+	assert.Len(t, client.Messages(env.QueueName), published+3, "thread.unmuted, thread.updated and email.received")
+}
+
+func TestReceiveEmail_FIFO(t *testing.T) {
+	setupEnv()
+	env.QueueName = "queue-for-receive.fifo"
+	defer setupEnv()
+	client := memory.NewClient()
+	timestamp := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deliver(t, client, "ses-1", "<1@example.com>", "", timestamp)
+	deliver(t, client, "ses-2", "<2@example.com>", "<1@example.com>", timestamp.Add(time.Hour))
+
+	second, err := email.Get(context.TODO(), client, "ses-2")
+	assert.Nil(t, err)
+
+	var groups, events []string
+	for _, message := range client.Messages(env.QueueName) {
+		groups = append(groups, message.Attributes["MessageGroupId"])
+		events = append(events, *message.MessageAttributes["Event"].StringValue+"."+*message.MessageAttributes["Action"].StringValue)
+	}
+	assert.Equal(t, []string{"email.received", "thread.created", "email.received"}, events)
+	assert.Equal(t, []string{"ses-1", second.ThreadID, second.ThreadID}, groups, "events of a thread are in the same group")
+}
+
+func TestReceiveEmail_EndToEnd(t *testing.T) {
+	setupEnv()
+	ctx := context.TODO()
+	client := memory.NewClient()
+	timestamp := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// a reply to a received email creates a thread
+	deliver(t, client, "ses-1", "<1@example.com>", "", timestamp)
+	deliver(t, client, "ses-2", "<2@example.com>", "<1@example.com>", timestamp.Add(time.Hour))
+
+	second, err := email.Get(ctx, client, "ses-2")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, second.ThreadID)
+	assert.True(t, second.IsThreadLatest)
+
+	th, err := thread.GetThread(ctx, client, second.ThreadID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ses-1", "ses-2"}, th.EmailIDs)
+	assert.Equal(t, 2, th.UnreadCount, "both received emails are unread")
+
+	// replying to the thread sends the email and appends it to the thread
+	created, err := email.Create(ctx, client, email.CreateInput{
+		Input: email.Input{
+			Subject: "Re: Subject",
+			From:    []string{"me@example.com"},
+			To:      []string{"sender@example.com"},
+			ReplyTo: []string{"me@example.com"},
+			Text:    "reply",
+		},
+		ReplyEmailID: "ses-2",
+		Send:         true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, second.ThreadID, created.ThreadID)
+
+	sent := client.SentEmails()
+	assert.Len(t, sent, 1)
+	assert.Equal(t, sent[0].MessageID, created.MessageID)
+	assert.Contains(t, string(sent[0].Input.Content.Raw.Data), "In-Reply-To: <2@example.com>")
+
+	th, err = thread.GetThreadWithEmails(ctx, client, second.ThreadID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ses-1", "ses-2", created.MessageID}, th.EmailIDs)
+	assert.Len(t, th.Emails, 3)
+	assert.Empty(t, th.DraftID)
+	assert.Equal(t, 2, th.UnreadCount, "sent emails are not unread")
+
+	err = thread.Trash(ctx, client, second.ThreadID)
+	assert.Nil(t, err)
+	th, err = thread.GetThread(ctx, client, second.ThreadID)
+	assert.Nil(t, err)
+	assert.NotNil(t, th.TrashedTime)
+
+	// an unrelated email can be trashed and deleted, including its raw object
+	deliver(t, client, "ses-3", "<3@example.com>", "", timestamp.Add(2*time.Hour))
+	err = email.Delete(ctx, client, "ses-3")
+	assert.NotNil(t, err, "untrashed email cannot be deleted")
+
+	err = email.Trash(ctx, client, "ses-3")
+	assert.Nil(t, err)
+	list, err := email.List(ctx, client, email.ListInput{Type: "inbox", Year: "2023", Month: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, list.Count, "emails of the trashed thread are trashed too")
+
+	err = email.Delete(ctx, client, "ses-3")
+	assert.Nil(t, err)
+	assert.Nil(t, client.Item(env.TableName, "ses-3"))
+	_, ok := client.Object(env.S3Bucket, "ses-3")
+	assert.False(t, ok)
+
+	assert.IsType(t, &dynamodbTypes.AttributeValueMemberS{}, client.Item(env.TableName, "ses-1")["ThreadID"])
+
+	// every change is published
+	var events []string
+	for _, message := range client.Messages(env.QueueName) {
+		events = append(events, *message.MessageAttributes["Event"].StringValue+"."+*message.MessageAttributes["Action"].StringValue)
+	}
+	assert.Equal(t, []string{
+		"email.received",
+		"thread.created", "email.received",
+		"thread.updated", "email.sent", "thread.updated",
+		"thread.trashed",
+		"email.received", "email.trashed", "email.deleted",
+	}, events)
+	assert.Contains(t, *client.Messages(env.QueueName)[2].Body, `"threadID":"`+second.ThreadID+`"`)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/thread"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler wakes the snoozed emails and threads that are due, and is invoked on a schedule
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config, %w", err)
+	}
+
+	now := time.Now()
+	if !event.Time.IsZero() {
+		now = event.Time
+	}
+	result, err := thread.Wake(ctx, awsclient.New(cfg), now)
+	if err != nil {
+		return fmt.Errorf("failed to wake snoozed emails, %w", err)
+	}
+	fmt.Printf("woken: %d, failed: %d\n", len(result.Woken), len(result.Failed))
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/purge"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// input is the payload of a manual invocation, and is empty on a schedule
+type input struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// handler deletes the emails and threads past their retention, and is invoked on a schedule
+func handler(ctx context.Context, in input) (*purge.Report, error) {
+	policy, err := purge.LoadPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+
+	report, err := purge.Run(ctx, awsclient.New(cfg), policy, purge.Options{
+		DryRun: in.DryRun,
+		Now:    time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge emails, %w", err)
+	}
+	for _, candidate := range report.Candidates {
+		fmt.Printf("%s %s: %s since %s\n", candidate.Reason, candidate.Type, candidate.MessageID, candidate.Time)
+	}
+	fmt.Printf("candidates: %d, deleted: %d, failed: %d, dry run: %t\n",
+		len(report.Candidates), report.Deleted, len(report.Failed), report.DryRun)
+	return report, nil
+}
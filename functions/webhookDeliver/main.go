@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler delivers the webhooks whose delivery IDs are the bodies of the SQS messages.
+// Failed deliveries are enqueued again by hook.Deliver, so only unexpected errors are reported as failures.
+func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	if err != nil {
+		return events.SQSEventResponse{}, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	client := awsclient.New(cfg)
+
+	failures := make([]events.SQSBatchItemFailure, 0)
+	for _, message := range sqsEvent.Records {
+		fmt.Println("delivering webhook:", message.Body)
+		err := hook.Deliver(ctx, client, message.Body)
+		if err != nil {
+			fmt.Printf("webhook delivery %s failed: %v\n", message.Body, err)
+			failures = append(failures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
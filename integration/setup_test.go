@@ -10,15 +10,19 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/awsclient"
 	"github.com/harryzcy/mailbox/internal/env"
 )
 
 var (
 	client *dynamodb.Client
+	// storeClient uses the local DynamoDB, events are not published since SQS and webhooks aren't configured
+	storeClient *awsclient.Client
 )
 
 func TestMain(m *testing.M) {
 	client = newLocalClient()
+	storeClient = &awsclient.Client{DynamoDB: client}
 	createTableIfNotExists(client)
 	deleteAllItems()
 
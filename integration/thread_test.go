@@ -29,7 +29,7 @@ func TestStoreEmails_NoThread(t *testing.T) {
 	}
 
 	// first email
-	thread.StoreEmail(context.TODO(), client, &thread.StoreEmailInput{
+	thread.StoreEmail(context.TODO(), storeClient, &thread.StoreEmailInput{
 		Item: map[string]dynamodbTypes.AttributeValue{
 			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: "1"},
 			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1@example.com"},
@@ -39,7 +39,7 @@ func TestStoreEmails_NoThread(t *testing.T) {
 		TimeReceived: "2023-02-01T00:00:00Z",
 	})
 	// second email, no In-Reply-To or References
-	thread.StoreEmail(context.TODO(), client, &thread.StoreEmailInput{
+	thread.StoreEmail(context.TODO(), storeClient, &thread.StoreEmailInput{
 		Item: map[string]dynamodbTypes.AttributeValue{
 			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: "2"},
 			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "2@example.com"},
@@ -49,7 +49,7 @@ func TestStoreEmails_NoThread(t *testing.T) {
 		TimeReceived: "2023-02-01T00:00:00Z",
 	})
 	// third email, with In-Reply-To and References, but they don't exist
-	thread.StoreEmail(context.TODO(), client, &thread.StoreEmailInput{
+	thread.StoreEmail(context.TODO(), storeClient, &thread.StoreEmailInput{
 		Item: map[string]dynamodbTypes.AttributeValue{
 			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: "3"},
 			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "3@example.com"},
@@ -71,7 +71,7 @@ func TestStoreEmails_BasicThread(t *testing.T) {
 		return
 	}
 
-	thread.StoreEmail(context.TODO(), client, &thread.StoreEmailInput{
+	thread.StoreEmail(context.TODO(), storeClient, &thread.StoreEmailInput{
 		Item: map[string]dynamodbTypes.AttributeValue{
 			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: "1"},
 			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1@example.com"},
@@ -85,7 +85,7 @@ func TestStoreEmails_BasicThread(t *testing.T) {
 	testItemNoAttribute(t, "1", "IsThreadLatest") // no thread yet
 
 	// should create a new thread
-	thread.StoreEmail(context.TODO(), client, &thread.StoreEmailInput{
+	thread.StoreEmail(context.TODO(), storeClient, &thread.StoreEmailInput{
 		Item: map[string]dynamodbTypes.AttributeValue{
 			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: "2"},
 			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "2@example.com"},
@@ -102,7 +102,7 @@ func TestStoreEmails_BasicThread(t *testing.T) {
 	testItemHasAttribute(t, "2", "IsThreadLatest", &dynamodbTypes.AttributeValueMemberBOOL{Value: true})
 
 	// should add to the same thread
-	thread.StoreEmail(context.TODO(), client, &thread.StoreEmailInput{
+	thread.StoreEmail(context.TODO(), storeClient, &thread.StoreEmailInput{
 		Item: map[string]dynamodbTypes.AttributeValue{
 			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: "3"},
 			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "3@example.com"},
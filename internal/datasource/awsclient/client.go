@@ -0,0 +1,113 @@
+// Package awsclient combines the AWS service clients into a single client,
+// which implements every API required by mailbox.
+package awsclient
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Client implements every API required by mailbox
+var (
+	_ platform.GetEmailAPI           = (*Client)(nil)
+	_ platform.DeleteEmailAPI        = (*Client)(nil)
+	_ platform.CreateAndSendEmailAPI = (*Client)(nil)
+	_ platform.SaveAndSendEmailAPI   = (*Client)(nil)
+	_ platform.ReparseEmailAPI       = (*Client)(nil)
+	_ platform.ReceiveEmailAPI       = (*Client)(nil)
+	_ platform.DeleteThreadAPI       = (*Client)(nil)
+	_ platform.RunExportAPI          = (*Client)(nil)
+	_ platform.ReplayWebhookAPI      = (*Client)(nil)
+	_ platform.CheckThreadsAPI       = (*Client)(nil)
+)
+
+// Client forwards each call to the client of the corresponding AWS service
+type Client struct {
+	DynamoDB *dynamodb.Client
+	S3       *s3.Client
+	SES      *sesv2.Client
+	SQS      *sqs.Client
+}
+
+// New returns a Client with clients created from cfg
+func New(cfg aws.Config) *Client {
+	return &Client{
+		DynamoDB: dynamodb.NewFromConfig(cfg),
+		S3:       s3.NewFromConfig(cfg),
+		SES:      sesv2.NewFromConfig(cfg),
+		SQS:      sqs.NewFromConfig(cfg),
+	}
+}
+
+func (c *Client) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return c.DynamoDB.Scan(ctx, params, optFns...)
+}
+
+func (c *Client) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return c.DynamoDB.Query(ctx, params, optFns...)
+}
+
+func (c *Client) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return c.DynamoDB.GetItem(ctx, params, optFns...)
+}
+
+func (c *Client) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return c.DynamoDB.BatchGetItem(ctx, params, optFns...)
+}
+
+func (c *Client) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return c.DynamoDB.PutItem(ctx, params, optFns...)
+}
+
+func (c *Client) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return c.DynamoDB.UpdateItem(ctx, params, optFns...)
+}
+
+func (c *Client) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return c.DynamoDB.DeleteItem(ctx, params, optFns...)
+}
+
+func (c *Client) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return c.DynamoDB.TransactWriteItems(ctx, params, optFns...)
+}
+
+func (c *Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return c.S3.GetObject(ctx, params, optFns...)
+}
+
+func (c *Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return c.S3.PutObject(ctx, params, optFns...)
+}
+
+func (c *Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return c.S3.DeleteObject(ctx, params, optFns...)
+}
+
+func (c *Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return c.S3.ListObjectsV2(ctx, params, optFns...)
+}
+
+func (c *Client) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	return c.SES.SendEmail(ctx, params, optFns...)
+}
+
+//revive:disable:var-naming
+func (c *Client) GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return c.SQS.GetQueueUrl(ctx, params, optFns...)
+}
+
+//revive:enable:var-naming
+
+func (c *Client) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	return c.SQS.SendMessage(ctx, params, optFns...)
+}
+
+func (c *Client) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	return c.SQS.SendMessageBatch(ctx, params, optFns...)
+}
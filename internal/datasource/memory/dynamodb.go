@@ -0,0 +1,683 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Service limits of DynamoDB
+const (
+	MaxTransactItems = 100
+	MaxBatchGetKeys  = 100
+)
+
+func validationError(format string, args ...any) error {
+	return &smithy.GenericAPIError{
+		Code:    "ValidationException",
+		Message: fmt.Sprintf(format, args...),
+		Fault:   smithy.FaultClient,
+	}
+}
+
+func conditionalCheckFailed() error {
+	return &dynamodbTypes.ConditionalCheckFailedException{
+		Message: aws.String("The conditional request failed"),
+	}
+}
+
+// keyOf returns the partition key of a key or an item
+func keyOf(key item) (string, error) {
+	value, ok := key[KeyName].(*dynamodbTypes.AttributeValueMemberS)
+	if !ok || value.Value == "" {
+		return "", validationError("one or more parameter values were invalid: missing the key %s in the item", KeyName)
+	}
+	return value.Value, nil
+}
+
+func (c *Client) table(tableName *string) (map[string]item, error) {
+	if tableName == nil || *tableName == "" {
+		return nil, validationError("1 validation error detected: value null at 'tableName' failed to satisfy constraint: member must not be null")
+	}
+	t, ok := c.tables[*tableName]
+	if !ok {
+		t = make(map[string]item)
+		c.tables[*tableName] = t
+	}
+	return t, nil
+}
+
+// request holds the parsed expressions shared by a single request
+type request struct {
+	*expressionContext
+	condition condition
+}
+
+func parseRequest(conditionExpression *string, names map[string]string, values map[string]dynamodbTypes.AttributeValue) (*request, error) {
+	r := &request{expressionContext: newExpressionContext(names, values)}
+	if conditionExpression != nil {
+		var err error
+		r.condition, err = r.parseCondition(*conditionExpression)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *request) parseCondition(expr string) (condition, error) {
+	p, err := newParser(r.expressionContext, expr)
+	if err != nil {
+		return nil, validationError("invalid expression: %v", err)
+	}
+	c, err := p.parseCondition()
+	if err == nil {
+		err = p.expectEOF()
+	}
+	if err != nil {
+		return nil, validationError("invalid expression: %v", err)
+	}
+	return c, nil
+}
+
+func (r *request) parseUpdate(expr string) ([]updateAction, error) {
+	p, err := newParser(r.expressionContext, expr)
+	if err != nil {
+		return nil, validationError("invalid UpdateExpression: %v", err)
+	}
+	actions, err := p.parseUpdate()
+	if err != nil {
+		return nil, validationError("invalid UpdateExpression: %v", err)
+	}
+	return actions, nil
+}
+
+func (r *request) parseProjection(expr *string) ([]path, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	p, err := newParser(r.expressionContext, *expr)
+	if err != nil {
+		return nil, validationError("invalid ProjectionExpression: %v", err)
+	}
+	paths, err := p.parseProjection()
+	if err != nil {
+		return nil, validationError("invalid ProjectionExpression: %v", err)
+	}
+	return paths, nil
+}
+
+func (r *request) done() error {
+	if err := r.checkUnused(); err != nil {
+		return validationError("%v", err)
+	}
+	return nil
+}
+
+// check evaluates the condition of the request against an item, which may be nil
+func (r *request) check(existing item) error {
+	if r.condition == nil {
+		return nil
+	}
+	if existing == nil {
+		existing = item{}
+	}
+	ok, err := r.condition(existing)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	if !ok {
+		return conditionalCheckFailed()
+	}
+	return nil
+}
+
+// write is a change to a single item that is not applied yet
+type write struct {
+	table map[string]item
+	key   string
+	old   item
+	new   item // nil if the item is deleted
+}
+
+func (w write) apply() {
+	if w.new == nil {
+		delete(w.table, w.key)
+		return
+	}
+	w.table[w.key] = w.new
+}
+
+func (c *Client) preparePut(tableName *string, newItem item, r *request) (write, error) {
+	t, err := c.table(tableName)
+	if err != nil {
+		return write{}, err
+	}
+	key, err := keyOf(newItem)
+	if err != nil {
+		return write{}, err
+	}
+	if err = r.done(); err != nil {
+		return write{}, err
+	}
+	existing := t[key]
+	if err = r.check(existing); err != nil {
+		return write{}, err
+	}
+	return write{table: t, key: key, old: existing, new: copyItem(newItem)}, nil
+}
+
+func (c *Client) prepareUpdate(tableName *string, keyItem item, updateExpression *string, r *request) (write, error) {
+	t, err := c.table(tableName)
+	if err != nil {
+		return write{}, err
+	}
+	key, err := keyOf(keyItem)
+	if err != nil {
+		return write{}, err
+	}
+	if updateExpression == nil {
+		return write{}, validationError("UpdateExpression is required")
+	}
+	actions, err := r.parseUpdate(*updateExpression)
+	if err != nil {
+		return write{}, err
+	}
+	if err = r.done(); err != nil {
+		return write{}, err
+	}
+	for _, action := range actions {
+		if action.target[0] == KeyName {
+			return write{}, validationError("cannot update attribute %s. This attribute is part of the key", KeyName)
+		}
+	}
+
+	existing := t[key]
+	if err = r.check(existing); err != nil {
+		return write{}, err
+	}
+
+	// UpdateItem creates the item if it doesn't exist
+	base := existing
+	if base == nil {
+		base = item{KeyName: &dynamodbTypes.AttributeValueMemberS{Value: key}}
+	}
+	updated, err := applyUpdate(base, actions)
+	if err != nil {
+		return write{}, validationError("%v", err)
+	}
+	return write{table: t, key: key, old: existing, new: updated}, nil
+}
+
+func (c *Client) prepareDelete(tableName *string, keyItem item, r *request) (write, error) {
+	t, err := c.table(tableName)
+	if err != nil {
+		return write{}, err
+	}
+	key, err := keyOf(keyItem)
+	if err != nil {
+		return write{}, err
+	}
+	if err = r.done(); err != nil {
+		return write{}, err
+	}
+	existing := t[key]
+	if err = r.check(existing); err != nil {
+		return write{}, err
+	}
+	return write{table: t, key: key, old: existing}, nil
+}
+
+func (c *Client) prepareConditionCheck(tableName *string, keyItem item, r *request) (write, error) {
+	w, err := c.prepareDelete(tableName, keyItem, r)
+	if err != nil {
+		return write{}, err
+	}
+	// a condition check doesn't change the item
+	w.new = w.old
+	return w, nil
+}
+
+func returnValues(option dynamodbTypes.ReturnValue, w write) item {
+	switch option {
+	case dynamodbTypes.ReturnValueAllOld, dynamodbTypes.ReturnValueUpdatedOld:
+		return copyItem(w.old)
+	case dynamodbTypes.ReturnValueAllNew, dynamodbTypes.ReturnValueUpdatedNew:
+		return copyItem(w.new)
+	}
+	return nil
+}
+
+// GetItem implements the DynamoDB GetItem API
+func (c *Client) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	r, err := parseRequest(nil, params.ExpressionAttributeNames, nil)
+	if err != nil {
+		return nil, err
+	}
+	projection, err := r.parseProjection(params.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.done(); err != nil {
+		return nil, err
+	}
+
+	existing, ok := t[key]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: project(copyItem(existing), projection)}, nil
+}
+
+// PutItem implements the DynamoDB PutItem API
+func (c *Client) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := parseRequest(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w, err := c.preparePut(params.TableName, params.Item, r)
+	if err != nil {
+		return nil, err
+	}
+	w.apply()
+	return &dynamodb.PutItemOutput{Attributes: returnValues(params.ReturnValues, w)}, nil
+}
+
+// UpdateItem implements the DynamoDB UpdateItem API
+func (c *Client) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := parseRequest(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w, err := c.prepareUpdate(params.TableName, params.Key, params.UpdateExpression, r)
+	if err != nil {
+		return nil, err
+	}
+	w.apply()
+	return &dynamodb.UpdateItemOutput{Attributes: returnValues(params.ReturnValues, w)}, nil
+}
+
+// DeleteItem implements the DynamoDB DeleteItem API
+func (c *Client) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := parseRequest(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w, err := c.prepareDelete(params.TableName, params.Key, r)
+	if err != nil {
+		return nil, err
+	}
+	w.apply()
+	return &dynamodb.DeleteItemOutput{Attributes: returnValues(params.ReturnValues, w)}, nil
+}
+
+// TransactWriteItems implements the DynamoDB TransactWriteItems API.
+// Either all writes are applied, or none of them is.
+//
+//gocyclo:ignore
+func (c *Client) TransactWriteItems(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > MaxTransactItems {
+		return nil, validationError("1 validation error detected: value at 'transactItems' failed to satisfy constraint: member must have length less than or equal to %d and greater than or equal to 1", MaxTransactItems)
+	}
+
+	writes := make([]write, len(params.TransactItems))
+	reasons := make([]dynamodbTypes.CancellationReason, len(params.TransactItems))
+	canceled := false
+	seen := map[string]bool{}
+	for i, transactItem := range params.TransactItems {
+		var w write
+		var r *request
+		var err error
+		var tableName *string
+		switch {
+		case transactItem.Put != nil:
+			op := transactItem.Put
+			tableName = op.TableName
+			if r, err = parseRequest(op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues); err == nil {
+				w, err = c.preparePut(op.TableName, op.Item, r)
+			}
+		case transactItem.Update != nil:
+			op := transactItem.Update
+			tableName = op.TableName
+			if r, err = parseRequest(op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues); err == nil {
+				w, err = c.prepareUpdate(op.TableName, op.Key, op.UpdateExpression, r)
+			}
+		case transactItem.Delete != nil:
+			op := transactItem.Delete
+			tableName = op.TableName
+			if r, err = parseRequest(op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues); err == nil {
+				w, err = c.prepareDelete(op.TableName, op.Key, r)
+			}
+		case transactItem.ConditionCheck != nil:
+			op := transactItem.ConditionCheck
+			tableName = op.TableName
+			if op.ConditionExpression == nil {
+				return nil, validationError("ConditionExpression is required for ConditionCheck")
+			}
+			if r, err = parseRequest(op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues); err == nil {
+				w, err = c.prepareConditionCheck(op.TableName, op.Key, r)
+			}
+		default:
+			return nil, validationError("TransactItems can only contain one of ConditionCheck, Put, Update or Delete")
+		}
+
+		if err != nil {
+			var condFailed *dynamodbTypes.ConditionalCheckFailedException
+			if !errors.As(err, &condFailed) {
+				return nil, err
+			}
+			canceled = true
+			reasons[i] = dynamodbTypes.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: condFailed.Message,
+			}
+			continue
+		}
+		reasons[i] = dynamodbTypes.CancellationReason{Code: aws.String("None")}
+
+		id := aws.ToString(tableName) + "/" + w.key
+		if seen[id] {
+			return nil, validationError("transaction request cannot include multiple operations on one item")
+		}
+		seen[id] = true
+		writes[i] = w
+	}
+
+	if canceled {
+		codes := make([]string, len(reasons))
+		for i, reason := range reasons {
+			codes[i] = aws.ToString(reason.Code)
+		}
+		return nil, &dynamodbTypes.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]"),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, w := range writes {
+		w.apply()
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// BatchGetItem implements the DynamoDB BatchGetItem API
+func (c *Client) BatchGetItem(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for _, keysAndAttributes := range params.RequestItems {
+		total += len(keysAndAttributes.Keys)
+	}
+	if total == 0 || total > MaxBatchGetKeys {
+		return nil, validationError("too many items requested for the BatchGetItem call")
+	}
+
+	responses := make(map[string][]map[string]dynamodbTypes.AttributeValue)
+	for tableName, keysAndAttributes := range params.RequestItems {
+		t, err := c.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+		r, err := parseRequest(nil, keysAndAttributes.ExpressionAttributeNames, nil)
+		if err != nil {
+			return nil, err
+		}
+		projection, err := r.parseProjection(keysAndAttributes.ProjectionExpression)
+		if err != nil {
+			return nil, err
+		}
+		if err = r.done(); err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		items := []map[string]dynamodbTypes.AttributeValue{}
+		for _, keyItem := range keysAndAttributes.Keys {
+			key, err := keyOf(keyItem)
+			if err != nil {
+				return nil, err
+			}
+			if seen[key] {
+				return nil, validationError("provided list of item keys contains duplicates")
+			}
+			seen[key] = true
+			if existing, ok := t[key]; ok {
+				items = append(items, project(copyItem(existing), projection))
+			}
+		}
+		responses[tableName] = items
+	}
+
+	return &dynamodb.BatchGetItemOutput{Responses: responses}, nil
+}
+
+// Query implements the DynamoDB Query API.
+// The key condition is evaluated like a filter against every item in the table or index,
+// and the results are sorted by the sort key of the index.
+//
+//gocyclo:ignore
+func (c *Client) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	index := Index{PartitionKey: KeyName}
+	if params.IndexName != nil {
+		var ok bool
+		index, ok = c.indexes[*params.IndexName]
+		if !ok {
+			return nil, validationError("the table does not have the specified index: %s", *params.IndexName)
+		}
+	}
+
+	if params.KeyConditionExpression == nil {
+		return nil, validationError("either the KeyConditions or KeyConditionExpression parameter must be specified in the request")
+	}
+	r, err := parseRequest(params.KeyConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	var filter condition
+	if params.FilterExpression != nil {
+		filter, err = r.parseCondition(*params.FilterExpression)
+		if err != nil {
+			return nil, err
+		}
+	}
+	projection, err := r.parseProjection(params.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.done(); err != nil {
+		return nil, err
+	}
+
+	// items without the index keys are not part of the index
+	var candidates []item
+	for _, it := range t {
+		if _, ok := it[index.PartitionKey]; !ok {
+			continue
+		}
+		if _, ok := it[index.SortKey]; index.SortKey != "" && !ok {
+			continue
+		}
+		ok, err := r.condition(it)
+		if err != nil {
+			return nil, validationError("%v", err)
+		}
+		if ok {
+			candidates = append(candidates, it)
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b item) int {
+		if index.SortKey != "" {
+			if cmp, _ := compareValues(a[index.SortKey], b[index.SortKey]); cmp != 0 {
+				return cmp
+			}
+		}
+		ka, _ := keyOf(a)
+		kb, _ := keyOf(b)
+		return strings.Compare(ka, kb)
+	})
+	if params.ScanIndexForward != nil && !*params.ScanIndexForward {
+		slices.Reverse(candidates)
+	}
+
+	if len(params.ExclusiveStartKey) > 0 {
+		startKey, err := keyOf(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+		position := slices.IndexFunc(candidates, func(it item) bool {
+			key, _ := keyOf(it)
+			return key == startKey
+		})
+		candidates = candidates[position+1:]
+	}
+
+	evaluated := candidates
+	if params.Limit != nil && int(*params.Limit) < len(candidates) {
+		evaluated = candidates[:*params.Limit]
+	}
+
+	items := []map[string]dynamodbTypes.AttributeValue{}
+	for _, it := range evaluated {
+		if filter != nil {
+			ok, err := filter(it)
+			if err != nil {
+				return nil, validationError("%v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		items = append(items, project(copyItem(it), projection))
+	}
+
+	output := &dynamodb.QueryOutput{
+		Items:        items,
+		Count:        int32(len(items)),     // nolint:gosec
+		ScannedCount: int32(len(evaluated)), // nolint:gosec
+	}
+	if len(evaluated) < len(candidates) {
+		last := evaluated[len(evaluated)-1]
+		output.LastEvaluatedKey = map[string]dynamodbTypes.AttributeValue{
+			KeyName: copyValue(last[KeyName]),
+		}
+		for _, attribute := range []string{index.PartitionKey, index.SortKey} {
+			if attribute != "" {
+				output.LastEvaluatedKey[attribute] = copyValue(last[attribute])
+			}
+		}
+	}
+	return output, nil
+}
+
+// Scan implements the DynamoDB Scan API on the table, in the order of the partition key.
+// Secondary indexes and parallel scans are not supported.
+func (c *Client) Scan(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if params.IndexName != nil || params.TotalSegments != nil {
+		return nil, validationError("scanning indexes or segments is not supported")
+	}
+
+	r, err := parseRequest(params.FilterExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	projection, err := r.parseProjection(params.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.done(); err != nil {
+		return nil, err
+	}
+
+	keys := slices.Sorted(maps.Keys(t))
+	if len(params.ExclusiveStartKey) > 0 {
+		startKey, err := keyOf(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+		position, _ := slices.BinarySearch(keys, startKey)
+		if position < len(keys) && keys[position] == startKey {
+			position++
+		}
+		keys = keys[position:]
+	}
+
+	evaluated := keys
+	if params.Limit != nil && int(*params.Limit) < len(keys) {
+		evaluated = keys[:*params.Limit]
+	}
+
+	items := []map[string]dynamodbTypes.AttributeValue{}
+	for _, key := range evaluated {
+		it := t[key]
+		if r.condition != nil {
+			ok, err := r.condition(it)
+			if err != nil {
+				return nil, validationError("%v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		items = append(items, project(copyItem(it), projection))
+	}
+
+	output := &dynamodb.ScanOutput{
+		Items:        items,
+		Count:        int32(len(items)),     // nolint:gosec
+		ScannedCount: int32(len(evaluated)), // nolint:gosec
+	}
+	if len(evaluated) < len(keys) {
+		output.LastEvaluatedKey = map[string]dynamodbTypes.AttributeValue{
+			KeyName: &dynamodbTypes.AttributeValueMemberS{Value: evaluated[len(evaluated)-1]},
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,1038 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"unicode"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// item is a DynamoDB item
+type item = map[string]dynamodbTypes.AttributeValue
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenIdent            // attribute name, keyword or function name
+	tokenName             // #name placeholder
+	tokenValue            // :value placeholder
+	tokenSymbol           // ( ) [ ] , . = <> < <= > >= + -
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize splits an expression into tokens
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':' || isIdentRune(r):
+			start := i
+			i++
+			for i < len(runes) && isIdentRune(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			kind := tokenIdent
+			switch r {
+			case '#':
+				kind = tokenName
+			case ':':
+				kind = tokenValue
+			}
+			if kind != tokenIdent && len(text) == 1 {
+				return nil, fmt.Errorf("invalid placeholder at position %d", start)
+			}
+			tokens = append(tokens, token{kind: kind, text: text})
+		case r == '<' || r == '>':
+			text := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				text += string(runes[i+1])
+			}
+			i += len(text)
+			tokens = append(tokens, token{kind: tokenSymbol, text: text})
+		case strings.ContainsRune("()[],.=+-", r):
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("invalid character %q at position %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+// expressionContext holds the placeholders of a request,
+// and records which of them are used by the expressions
+type expressionContext struct {
+	names      map[string]string
+	values     map[string]dynamodbTypes.AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newExpressionContext(names map[string]string, values map[string]dynamodbTypes.AttributeValue) *expressionContext {
+	return &expressionContext{
+		names:      names,
+		values:     values,
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}
+}
+
+// checkUnused returns an error if any placeholder is not referenced by the expressions,
+// which DynamoDB rejects as well
+func (e *expressionContext) checkUnused() error {
+	for name := range e.names {
+		if !e.usedNames[name] {
+			return fmt.Errorf("value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", name)
+		}
+	}
+	for value := range e.values {
+		if !e.usedValues[value] {
+			return fmt.Errorf("value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", value)
+		}
+	}
+	return nil
+}
+
+type parser struct {
+	*expressionContext
+	tokens []token
+	pos    int
+}
+
+func newParser(ctx *expressionContext, expr string) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{expressionContext: ctx, tokens: tokens}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) peekSymbol(symbol string) bool {
+	t := p.peek()
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if t := p.next(); t.kind != tokenSymbol || t.text != symbol {
+		return fmt.Errorf("syntax error: expected %q, got %q", symbol, t.text)
+	}
+	return nil
+}
+
+func (p *parser) expectEOF() error {
+	if t := p.peek(); t.kind != tokenEOF {
+		return fmt.Errorf("syntax error: unexpected token %q", t.text)
+	}
+	return nil
+}
+
+// path is a document path, with each element being a map key
+type path []string
+
+func (p path) String() string {
+	return strings.Join(p, ".")
+}
+
+func (p path) get(it item) (dynamodbTypes.AttributeValue, bool) {
+	var current dynamodbTypes.AttributeValue = &dynamodbTypes.AttributeValueMemberM{Value: it}
+	for _, key := range p {
+		m, ok := current.(*dynamodbTypes.AttributeValueMemberM)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m.Value[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func (p path) set(it item, value dynamodbTypes.AttributeValue) error {
+	m := it
+	for _, key := range p[:len(p)-1] {
+		child, ok := m[key].(*dynamodbTypes.AttributeValueMemberM)
+		if !ok {
+			return fmt.Errorf("the document path provided in the update expression is invalid for update: %s", p)
+		}
+		m = child.Value
+	}
+	m[p[len(p)-1]] = value
+	return nil
+}
+
+func (p path) remove(it item) {
+	m := it
+	for _, key := range p[:len(p)-1] {
+		child, ok := m[key].(*dynamodbTypes.AttributeValueMemberM)
+		if !ok {
+			return
+		}
+		m = child.Value
+	}
+	delete(m, p[len(p)-1])
+}
+
+func (p *parser) parsePathElement() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenIdent:
+		return t.text, nil
+	case tokenName:
+		name, ok := p.names[t.text]
+		if !ok {
+			return "", fmt.Errorf("an expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+		}
+		p.usedNames[t.text] = true
+		return name, nil
+	}
+	return "", fmt.Errorf("syntax error: expected attribute name, got %q", t.text)
+}
+
+func (p *parser) parsePath() (path, error) {
+	element, err := p.parsePathElement()
+	if err != nil {
+		return nil, err
+	}
+	result := path{element}
+	for p.peekSymbol(".") {
+		p.next()
+		element, err = p.parsePathElement()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, element)
+	}
+	return result, nil
+}
+
+// operand evaluates to an attribute value, or false if it does not exist in the item
+type operand func(it item) (dynamodbTypes.AttributeValue, bool, error)
+
+// condition evaluates a condition against an item
+type condition func(it item) (bool, error)
+
+func (p *parser) parseValue() (operand, error) {
+	t := p.next()
+	value, ok := p.values[t.text]
+	if !ok {
+		return nil, fmt.Errorf("an expression attribute value used in expression is not defined; attribute value: %s", t.text)
+	}
+	p.usedValues[t.text] = true
+	return func(item) (dynamodbTypes.AttributeValue, bool, error) {
+		return value, true, nil
+	}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	if t.kind == tokenValue {
+		return p.parseValue()
+	}
+	if t.kind == tokenIdent && strings.EqualFold(t.text, "size") && p.tokens[p.pos+1].text == "(" {
+		p.next()
+		p.next()
+		target, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (dynamodbTypes.AttributeValue, bool, error) {
+			value, ok := target.get(it)
+			if !ok {
+				return nil, false, nil
+			}
+			size, err := sizeOf(value)
+			if err != nil {
+				return nil, false, err
+			}
+			return &dynamodbTypes.AttributeValueMemberN{Value: fmt.Sprint(size)}, true, nil
+		}, nil
+	}
+
+	target, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return func(it item) (dynamodbTypes.AttributeValue, bool, error) {
+		value, ok := target.get(it)
+		return value, ok, nil
+	}, nil
+}
+
+// parseCondition parses a condition expression, which is also used for key conditions and filters
+func (p *parser) parseCondition() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) (bool, error) {
+			ok, err := l(it)
+			if err != nil || ok {
+				return ok, err
+			}
+			return right(it)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) (bool, error) {
+			ok, err := l(it)
+			if err != nil || !ok {
+				return ok, err
+			}
+			return right(it)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if !p.peekKeyword("NOT") {
+		return p.parsePrimary()
+	}
+	p.next()
+	c, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return func(it item) (bool, error) {
+		ok, err := c(it)
+		return !ok, err
+	}, nil
+}
+
+//gocyclo:ignore
+func (p *parser) parsePrimary() (condition, error) {
+	if p.peekSymbol("(") {
+		p.next()
+		c, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	if t := p.peek(); t.kind == tokenIdent && p.tokens[p.pos+1].text == "(" {
+		switch strings.ToLower(t.text) {
+		case "attribute_exists", "attribute_not_exists":
+			p.next()
+			p.next()
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			exists := strings.EqualFold(t.text, "attribute_exists")
+			return func(it item) (bool, error) {
+				_, ok := target.get(it)
+				return ok == exists, nil
+			}, nil
+		case "begins_with", "contains":
+			p.next()
+			p.next()
+			target, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+			operand, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(t.text, "begins_with") {
+				return func(it item) (bool, error) {
+					return evaluateBeginsWith(it, target, operand)
+				}, nil
+			}
+			return func(it item) (bool, error) {
+				return evaluateContains(it, target, operand)
+			}, nil
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekKeyword("BETWEEN") {
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekKeyword("AND") {
+			return nil, fmt.Errorf("syntax error: expected AND in BETWEEN, got %q", p.peek().text)
+		}
+		p.next()
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			ok, err := evaluateComparison(it, left, ">=", low)
+			if err != nil || !ok {
+				return ok, err
+			}
+			return evaluateComparison(it, left, "<=", high)
+		}, nil
+	}
+
+	if p.peekKeyword("IN") {
+		p.next()
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var candidates []operand
+		for {
+			candidate, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, candidate)
+			if !p.peekSymbol(",") {
+				break
+			}
+			p.next()
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			for _, candidate := range candidates {
+				ok, err := evaluateComparison(it, left, "=", candidate)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}, nil
+	}
+
+	comparator := p.next()
+	if comparator.kind != tokenSymbol || !slices.Contains([]string{"=", "<>", "<", "<=", ">", ">="}, comparator.text) {
+		return nil, fmt.Errorf("syntax error: expected comparator, got %q", comparator.text)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(it item) (bool, error) {
+		return evaluateComparison(it, left, comparator.text, right)
+	}, nil
+}
+
+func evaluateComparison(it item, left operand, comparator string, right operand) (bool, error) {
+	l, lok, err := left(it)
+	if err != nil {
+		return false, err
+	}
+	r, rok, err := right(it)
+	if err != nil {
+		return false, err
+	}
+	if !lok || !rok {
+		return comparator == "<>" && lok != rok, nil
+	}
+
+	switch comparator {
+	case "=":
+		return equalValues(l, r), nil
+	case "<>":
+		return !equalValues(l, r), nil
+	}
+
+	cmp, ok := compareValues(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch comparator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func evaluateBeginsWith(it item, target, prefix operand) (bool, error) {
+	t, tok, err := target(it)
+	if err != nil || !tok {
+		return false, err
+	}
+	v, vok, err := prefix(it)
+	if err != nil || !vok {
+		return false, err
+	}
+	switch t := t.(type) {
+	case *dynamodbTypes.AttributeValueMemberS:
+		if v, ok := v.(*dynamodbTypes.AttributeValueMemberS); ok {
+			return strings.HasPrefix(t.Value, v.Value), nil
+		}
+	case *dynamodbTypes.AttributeValueMemberB:
+		if v, ok := v.(*dynamodbTypes.AttributeValueMemberB); ok {
+			return bytes.HasPrefix(t.Value, v.Value), nil
+		}
+	}
+	return false, nil
+}
+
+func evaluateContains(it item, target, operand operand) (bool, error) {
+	t, tok, err := target(it)
+	if err != nil || !tok {
+		return false, err
+	}
+	v, vok, err := operand(it)
+	if err != nil || !vok {
+		return false, err
+	}
+	switch t := t.(type) {
+	case *dynamodbTypes.AttributeValueMemberS:
+		if v, ok := v.(*dynamodbTypes.AttributeValueMemberS); ok {
+			return strings.Contains(t.Value, v.Value), nil
+		}
+	case *dynamodbTypes.AttributeValueMemberSS:
+		if v, ok := v.(*dynamodbTypes.AttributeValueMemberS); ok {
+			return slices.Contains(t.Value, v.Value), nil
+		}
+	case *dynamodbTypes.AttributeValueMemberNS:
+		if v, ok := v.(*dynamodbTypes.AttributeValueMemberN); ok {
+			return slices.ContainsFunc(t.Value, func(n string) bool {
+				return compareNumbers(n, v.Value) == 0
+			}), nil
+		}
+	case *dynamodbTypes.AttributeValueMemberL:
+		return slices.ContainsFunc(t.Value, func(element dynamodbTypes.AttributeValue) bool {
+			return equalValues(element, v)
+		}), nil
+	}
+	return false, nil
+}
+
+// updateAction is a single action of an update expression
+type updateAction struct {
+	clause string // SET, REMOVE, ADD or DELETE
+	target path
+	value  operand
+}
+
+// parseUpdate parses an update expression
+//
+//gocyclo:ignore
+func (p *parser) parseUpdate() ([]updateAction, error) {
+	var actions []updateAction
+	seen := map[string]bool{}
+	for p.peek().kind != tokenEOF {
+		t := p.next()
+		clause := strings.ToUpper(t.text)
+		if t.kind != tokenIdent || !slices.Contains([]string{"SET", "REMOVE", "ADD", "DELETE"}, clause) {
+			return nil, fmt.Errorf("syntax error: unexpected token %q", t.text)
+		}
+		if seen[clause] {
+			return nil, fmt.Errorf("the %s section can only be used once in an update expression", clause)
+		}
+		seen[clause] = true
+
+		for {
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			action := updateAction{clause: clause, target: target}
+			switch clause {
+			case "SET":
+				if err = p.expectSymbol("="); err != nil {
+					return nil, err
+				}
+				action.value, err = p.parseSetValue()
+			case "ADD", "DELETE":
+				if p.peek().kind != tokenValue {
+					return nil, fmt.Errorf("syntax error: expected value for %s, got %q", clause, p.peek().text)
+				}
+				action.value, err = p.parseValue()
+			}
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, action)
+
+			if !p.peekSymbol(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("invalid UpdateExpression: the expression can not be empty")
+	}
+	return actions, nil
+}
+
+func (p *parser) parseSetValue() (operand, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekSymbol("+") && !p.peekSymbol("-") {
+		return left, nil
+	}
+	sign := p.next().text
+	right, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(it item) (dynamodbTypes.AttributeValue, bool, error) {
+		l, lok, err := left(it)
+		if err != nil {
+			return nil, false, err
+		}
+		r, rok, err := right(it)
+		if err != nil {
+			return nil, false, err
+		}
+		if !lok || !rok {
+			return nil, false, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+		}
+		ln, lok := l.(*dynamodbTypes.AttributeValueMemberN)
+		rn, rok := r.(*dynamodbTypes.AttributeValueMemberN)
+		if !lok || !rok {
+			return nil, false, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		if sign == "-" {
+			return &dynamodbTypes.AttributeValueMemberN{Value: subtractNumbers(ln.Value, rn.Value)}, true, nil
+		}
+		return &dynamodbTypes.AttributeValueMemberN{Value: addNumbers(ln.Value, rn.Value)}, true, nil
+	}, nil
+}
+
+func (p *parser) parseSetOperand() (operand, error) {
+	t := p.peek()
+	if t.kind == tokenIdent && p.tokens[p.pos+1].text == "(" {
+		switch strings.ToLower(t.text) {
+		case "list_append":
+			p.next()
+			p.next()
+			first, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+			second, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return func(it item) (dynamodbTypes.AttributeValue, bool, error) {
+				f, fok, err := first(it)
+				if err != nil {
+					return nil, false, err
+				}
+				s, sok, err := second(it)
+				if err != nil {
+					return nil, false, err
+				}
+				fl, flok := f.(*dynamodbTypes.AttributeValueMemberL)
+				sl, slok := s.(*dynamodbTypes.AttributeValueMemberL)
+				if !fok || !sok || !flok || !slok {
+					return nil, false, fmt.Errorf("an operand in the update expression has an incorrect data type")
+				}
+				return &dynamodbTypes.AttributeValueMemberL{Value: append(slices.Clone(fl.Value), sl.Value...)}, true, nil
+			}, nil
+		case "if_not_exists":
+			p.next()
+			p.next()
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+			fallback, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return func(it item) (dynamodbTypes.AttributeValue, bool, error) {
+				if value, ok := target.get(it); ok {
+					return value, true, nil
+				}
+				return fallback(it)
+			}, nil
+		}
+	}
+	return p.parseOperand()
+}
+
+// applyUpdate returns a copy of the item with the update actions applied.
+// All operands are evaluated against the original item, as DynamoDB does.
+func applyUpdate(original item, actions []updateAction) (item, error) {
+	updated := copyItem(original)
+	for _, action := range actions {
+		var value dynamodbTypes.AttributeValue
+		var ok bool
+		var err error
+		if action.value != nil {
+			value, ok, err = action.value(original)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+			}
+		}
+
+		switch action.clause {
+		case "SET":
+			err = action.target.set(updated, copyValue(value))
+		case "REMOVE":
+			action.target.remove(updated)
+		case "ADD":
+			existing, _ := action.target.get(updated)
+			value, err = addValues(existing, value)
+			if err == nil {
+				err = action.target.set(updated, value)
+			}
+		case "DELETE":
+			existing, exists := action.target.get(updated)
+			if !exists {
+				continue
+			}
+			value, err = deleteValues(existing, value)
+			if err == nil && value == nil {
+				action.target.remove(updated)
+			} else if err == nil {
+				err = action.target.set(updated, value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return updated, nil
+}
+
+// parseProjection parses a projection expression into paths
+func (p *parser) parseProjection() ([]path, error) {
+	var paths []path
+	for {
+		target, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, target)
+		if !p.peekSymbol(",") {
+			break
+		}
+		p.next()
+	}
+	return paths, p.expectEOF()
+}
+
+func project(it item, paths []path) item {
+	if paths == nil {
+		return it
+	}
+	result := item{}
+	for _, target := range paths {
+		// only top level attributes are projected
+		if value, ok := it[target[0]]; ok {
+			result[target[0]] = value
+		}
+	}
+	return result
+}
+
+func sizeOf(value dynamodbTypes.AttributeValue) (int, error) {
+	switch v := value.(type) {
+	case *dynamodbTypes.AttributeValueMemberS:
+		return len(v.Value), nil
+	case *dynamodbTypes.AttributeValueMemberB:
+		return len(v.Value), nil
+	case *dynamodbTypes.AttributeValueMemberSS:
+		return len(v.Value), nil
+	case *dynamodbTypes.AttributeValueMemberNS:
+		return len(v.Value), nil
+	case *dynamodbTypes.AttributeValueMemberBS:
+		return len(v.Value), nil
+	case *dynamodbTypes.AttributeValueMemberL:
+		return len(v.Value), nil
+	case *dynamodbTypes.AttributeValueMemberM:
+		return len(v.Value), nil
+	}
+	return 0, fmt.Errorf("incorrect operand type for operator or function; operator or function: size")
+}
+
+func addValues(existing, value dynamodbTypes.AttributeValue) (dynamodbTypes.AttributeValue, error) {
+	switch v := value.(type) {
+	case *dynamodbTypes.AttributeValueMemberN:
+		if existing == nil {
+			return &dynamodbTypes.AttributeValueMemberN{Value: v.Value}, nil
+		}
+		if e, ok := existing.(*dynamodbTypes.AttributeValueMemberN); ok {
+			return &dynamodbTypes.AttributeValueMemberN{Value: addNumbers(e.Value, v.Value)}, nil
+		}
+	case *dynamodbTypes.AttributeValueMemberSS:
+		if existing == nil {
+			return &dynamodbTypes.AttributeValueMemberSS{Value: slices.Clone(v.Value)}, nil
+		}
+		if e, ok := existing.(*dynamodbTypes.AttributeValueMemberSS); ok {
+			result := slices.Clone(e.Value)
+			for _, s := range v.Value {
+				if !slices.Contains(result, s) {
+					result = append(result, s)
+				}
+			}
+			return &dynamodbTypes.AttributeValueMemberSS{Value: result}, nil
+		}
+	}
+	return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+}
+
+func deleteValues(existing, value dynamodbTypes.AttributeValue) (dynamodbTypes.AttributeValue, error) {
+	e, eok := existing.(*dynamodbTypes.AttributeValueMemberSS)
+	v, vok := value.(*dynamodbTypes.AttributeValueMemberSS)
+	if !eok || !vok {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+	result := slices.DeleteFunc(slices.Clone(e.Value), func(s string) bool {
+		return slices.Contains(v.Value, s)
+	})
+	if len(result) == 0 {
+		// empty sets are not allowed, so the attribute is removed
+		return nil, nil
+	}
+	return &dynamodbTypes.AttributeValueMemberSS{Value: result}, nil
+}
+
+func parseNumber(n string) *big.Float {
+	f, _, err := big.ParseFloat(n, 10, 128, big.ToNearestEven)
+	if err != nil {
+		return new(big.Float)
+	}
+	return f
+}
+
+func formatNumber(f *big.Float) string {
+	if f.IsInt() {
+		i, _ := f.Int(nil)
+		return i.String()
+	}
+	return f.Text('g', 38)
+}
+
+func addNumbers(a, b string) string {
+	return formatNumber(new(big.Float).SetPrec(128).Add(parseNumber(a), parseNumber(b)))
+}
+
+func subtractNumbers(a, b string) string {
+	return formatNumber(new(big.Float).SetPrec(128).Sub(parseNumber(a), parseNumber(b)))
+}
+
+func compareNumbers(a, b string) int {
+	return parseNumber(a).Cmp(parseNumber(b))
+}
+
+// compareValues compares two scalar values of the same type
+func compareValues(a, b dynamodbTypes.AttributeValue) (int, bool) {
+	switch a := a.(type) {
+	case *dynamodbTypes.AttributeValueMemberS:
+		if b, ok := b.(*dynamodbTypes.AttributeValueMemberS); ok {
+			return strings.Compare(a.Value, b.Value), true
+		}
+	case *dynamodbTypes.AttributeValueMemberN:
+		if b, ok := b.(*dynamodbTypes.AttributeValueMemberN); ok {
+			return compareNumbers(a.Value, b.Value), true
+		}
+	case *dynamodbTypes.AttributeValueMemberB:
+		if b, ok := b.(*dynamodbTypes.AttributeValueMemberB); ok {
+			return bytes.Compare(a.Value, b.Value), true
+		}
+	}
+	return 0, false
+}
+
+func equalSets[T any](a, b []T, equal func(x, y T) bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		if !slices.ContainsFunc(b, func(y T) bool { return equal(x, y) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalValues reports whether two attribute values are equal.
+// Sets are compared regardless of their order.
+//
+//gocyclo:ignore
+func equalValues(a, b dynamodbTypes.AttributeValue) bool {
+	switch a := a.(type) {
+	case *dynamodbTypes.AttributeValueMemberS:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberS)
+		return ok && a.Value == b.Value
+	case *dynamodbTypes.AttributeValueMemberN:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberN)
+		return ok && compareNumbers(a.Value, b.Value) == 0
+	case *dynamodbTypes.AttributeValueMemberB:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberB)
+		return ok && bytes.Equal(a.Value, b.Value)
+	case *dynamodbTypes.AttributeValueMemberBOOL:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberBOOL)
+		return ok && a.Value == b.Value
+	case *dynamodbTypes.AttributeValueMemberNULL:
+		_, ok := b.(*dynamodbTypes.AttributeValueMemberNULL)
+		return ok
+	case *dynamodbTypes.AttributeValueMemberSS:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberSS)
+		return ok && equalSets(a.Value, b.Value, func(x, y string) bool { return x == y })
+	case *dynamodbTypes.AttributeValueMemberNS:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberNS)
+		return ok && equalSets(a.Value, b.Value, func(x, y string) bool { return compareNumbers(x, y) == 0 })
+	case *dynamodbTypes.AttributeValueMemberBS:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberBS)
+		return ok && equalSets(a.Value, b.Value, bytes.Equal)
+	case *dynamodbTypes.AttributeValueMemberL:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberL)
+		return ok && slices.EqualFunc(a.Value, b.Value, equalValues)
+	case *dynamodbTypes.AttributeValueMemberM:
+		b, ok := b.(*dynamodbTypes.AttributeValueMemberM)
+		if !ok || len(a.Value) != len(b.Value) {
+			return false
+		}
+		for key, value := range a.Value {
+			other, ok := b.Value[key]
+			if !ok || !equalValues(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// copyValue returns a deep copy of an attribute value,
+// so that stored items are never shared with callers
+func copyValue(value dynamodbTypes.AttributeValue) dynamodbTypes.AttributeValue {
+	switch v := value.(type) {
+	case *dynamodbTypes.AttributeValueMemberS:
+		return &dynamodbTypes.AttributeValueMemberS{Value: v.Value}
+	case *dynamodbTypes.AttributeValueMemberN:
+		return &dynamodbTypes.AttributeValueMemberN{Value: v.Value}
+	case *dynamodbTypes.AttributeValueMemberB:
+		return &dynamodbTypes.AttributeValueMemberB{Value: bytes.Clone(v.Value)}
+	case *dynamodbTypes.AttributeValueMemberBOOL:
+		return &dynamodbTypes.AttributeValueMemberBOOL{Value: v.Value}
+	case *dynamodbTypes.AttributeValueMemberNULL:
+		return &dynamodbTypes.AttributeValueMemberNULL{Value: v.Value}
+	case *dynamodbTypes.AttributeValueMemberSS:
+		return &dynamodbTypes.AttributeValueMemberSS{Value: slices.Clone(v.Value)}
+	case *dynamodbTypes.AttributeValueMemberNS:
+		return &dynamodbTypes.AttributeValueMemberNS{Value: slices.Clone(v.Value)}
+	case *dynamodbTypes.AttributeValueMemberBS:
+		values := make([][]byte, len(v.Value))
+		for i, b := range v.Value {
+			values[i] = bytes.Clone(b)
+		}
+		return &dynamodbTypes.AttributeValueMemberBS{Value: values}
+	case *dynamodbTypes.AttributeValueMemberL:
+		values := make([]dynamodbTypes.AttributeValue, len(v.Value))
+		for i, element := range v.Value {
+			values[i] = copyValue(element)
+		}
+		return &dynamodbTypes.AttributeValueMemberL{Value: values}
+	case *dynamodbTypes.AttributeValueMemberM:
+		return &dynamodbTypes.AttributeValueMemberM{Value: copyItem(v.Value)}
+	}
+	return value
+}
+
+func copyItem(it item) item {
+	if it == nil {
+		return nil
+	}
+	result := make(item, len(it))
+	for key, value := range it {
+		result[key] = copyValue(value)
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"strconv"
+	"testing"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := tokenize("SET #a = list_append(#a, :v), B <= :w")
+	assert.Nil(t, err)
+	texts := []string{}
+	for _, token := range tokens {
+		texts = append(texts, token.text)
+	}
+	assert.Equal(t, []string{"SET", "#a", "=", "list_append", "(", "#a", ",", ":v", ")", ",", "B", "<=", ":w", ""}, texts)
+
+	_, err = tokenize("a ! b")
+	assert.NotNil(t, err)
+	_, err = tokenize("a = :")
+	assert.NotNil(t, err)
+}
+
+func TestCondition(t *testing.T) {
+	it := item{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "id"},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2023-01"},
+		"Count":         &dynamodbTypes.AttributeValueMemberN{Value: "10"},
+		"To":            &dynamodbTypes.AttributeValueMemberSS{Value: []string{"a@example.com", "b@example.com"}},
+		"Verdict": &dynamodbTypes.AttributeValueMemberM{Value: map[string]dynamodbTypes.AttributeValue{
+			"Spam": &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+		}},
+	}
+	values := map[string]dynamodbTypes.AttributeValue{
+		":inbox": &dynamodbTypes.AttributeValueMemberS{Value: "inbox"},
+		":draft": &dynamodbTypes.AttributeValueMemberS{Value: "draft"},
+		":id":    &dynamodbTypes.AttributeValueMemberS{Value: "id"},
+		":five":  &dynamodbTypes.AttributeValueMemberN{Value: "5"},
+		":ten":   &dynamodbTypes.AttributeValueMemberN{Value: "10.0"},
+		":to":    &dynamodbTypes.AttributeValueMemberS{Value: "b@example.com"},
+		":true":  &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+	}
+	tests := []struct {
+		expr     string
+		expected bool
+		err      bool
+	}{
+		{expr: "attribute_exists(TypeYearMonth)", expected: true},
+		{expr: "attribute_not_exists(TrashedTime)", expected: true},
+		{expr: "attribute_exists(#tym) AND begins_with(#tym, :inbox)", expected: true},
+		{expr: "(attribute_exists(TrashedTime) OR begins_with(TypeYearMonth, :draft)) AND attribute_not_exists(ThreadID)", expected: false},
+		{expr: "attribute_not_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :draft)", expected: true},
+		{expr: "NOT NOT attribute_exists(MessageID)", expected: true},
+		{expr: "MessageID = :id", expected: true},
+		{expr: "MessageID <> :id", expected: false},
+		{expr: "Missing <> :id", expected: true},
+		{expr: "#count > :five AND #count = :ten", expected: true},
+		{expr: "#count BETWEEN :five AND :ten", expected: true},
+		{expr: "MessageID IN (:inbox, :id)", expected: true},
+		{expr: "contains(#to, :to)", expected: true},
+		{expr: "size(#to) < :five", expected: true},
+		{expr: "Verdict.Spam = :true", expected: true},
+		{expr: "(attribute_exists(TrashedTime)", err: true},
+		{expr: "attribute_exists(TrashedTime))", err: true},
+		{expr: "MessageID = :undefined", err: true},
+		{expr: "#undefined = :id", err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := newExpressionContext(map[string]string{
+				"#tym":   "TypeYearMonth",
+				"#count": "Count",
+				"#to":    "To",
+			}, values)
+			p, err := newParser(ctx, test.expr)
+			assert.Nil(t, err)
+			c, err := p.parseCondition()
+			if err == nil {
+				err = p.expectEOF()
+			}
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			ok, err := c(it)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, ok)
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	original := item{
+		"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "thread"},
+		"EmailIDs": &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{
+			&dynamodbTypes.AttributeValueMemberS{Value: "1"},
+		}},
+		"DraftID": &dynamodbTypes.AttributeValueMemberS{Value: "draft"},
+		"Count":   &dynamodbTypes.AttributeValueMemberN{Value: "1"},
+		"Labels":  &dynamodbTypes.AttributeValueMemberSS{Value: []string{"a", "b"}},
+	}
+	ctx := newExpressionContext(map[string]string{"#emails": "EmailIDs"}, map[string]dynamodbTypes.AttributeValue{
+		":emails": &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{
+			&dynamodbTypes.AttributeValueMemberS{Value: "2"},
+		}},
+		":one":    &dynamodbTypes.AttributeValueMemberN{Value: "1"},
+		":zero":   &dynamodbTypes.AttributeValueMemberN{Value: "0"},
+		":labels": &dynamodbTypes.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		":new":    &dynamodbTypes.AttributeValueMemberSS{Value: []string{"c"}},
+	})
+	p, err := newParser(ctx, "REMOVE DraftID SET #emails = list_append(#emails, :emails), #c = Count + :one, Unread = if_not_exists(Unread, :zero) ADD Tags :new DELETE Labels :labels")
+	assert.Nil(t, err)
+	_, err = p.parseUpdate()
+	assert.NotNil(t, err, "#c is not defined")
+
+	ctx.names["#c"] = "Count"
+	p, err = newParser(ctx, "REMOVE DraftID SET #emails = list_append(#emails, :emails), #c = #c + :one, Unread = if_not_exists(Unread, :zero) ADD Tags :new DELETE Labels :labels")
+	assert.Nil(t, err)
+	actions, err := p.parseUpdate()
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.checkUnused())
+
+	updated, err := applyUpdate(original, actions)
+	assert.Nil(t, err)
+	assert.Equal(t, item{
+		"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "thread"},
+		"EmailIDs": &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{
+			&dynamodbTypes.AttributeValueMemberS{Value: "1"},
+			&dynamodbTypes.AttributeValueMemberS{Value: "2"},
+		}},
+		"Count":  &dynamodbTypes.AttributeValueMemberN{Value: "2"},
+		"Unread": &dynamodbTypes.AttributeValueMemberN{Value: "0"},
+		"Tags":   &dynamodbTypes.AttributeValueMemberSS{Value: []string{"c"}},
+	}, updated)
+
+	// the original item is not modified
+	assert.Len(t, original["EmailIDs"].(*dynamodbTypes.AttributeValueMemberL).Value, 1)
+	assert.Contains(t, original, "DraftID")
+}
+
+func TestCheckUnused(t *testing.T) {
+	ctx := newExpressionContext(map[string]string{"#a": "A"}, map[string]dynamodbTypes.AttributeValue{
+		":v": &dynamodbTypes.AttributeValueMemberS{Value: "v"},
+	})
+	p, err := newParser(ctx, "#a = :v")
+	assert.Nil(t, err)
+	_, err = p.parseCondition()
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.checkUnused())
+
+	ctx = newExpressionContext(nil, map[string]dynamodbTypes.AttributeValue{
+		":v": &dynamodbTypes.AttributeValueMemberS{Value: "v"},
+	})
+	p, err = newParser(ctx, "attribute_exists(A)")
+	assert.Nil(t, err)
+	_, err = p.parseCondition()
+	assert.Nil(t, err)
+	assert.NotNil(t, ctx.checkUnused())
+}
+
+func TestEqualValues(t *testing.T) {
+	assert.True(t, equalValues(
+		&dynamodbTypes.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		&dynamodbTypes.AttributeValueMemberSS{Value: []string{"b", "a"}},
+	))
+	assert.False(t, equalValues(
+		&dynamodbTypes.AttributeValueMemberS{Value: "1"},
+		&dynamodbTypes.AttributeValueMemberN{Value: "1"},
+	))
+	assert.True(t, equalValues(
+		&dynamodbTypes.AttributeValueMemberN{Value: "1"},
+		&dynamodbTypes.AttributeValueMemberN{Value: "1.00"},
+	))
+}
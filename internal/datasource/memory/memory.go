@@ -0,0 +1,130 @@
+// Package memory provides an in-memory implementation of the AWS APIs used by mailbox
+// (DynamoDB, S3, SES and SQS), so that the whole mailbox can run without AWS,
+// e.g. in tests or during local development.
+//
+// Only the subset of behaviors relied on by mailbox is implemented.
+// In particular, reserved words are not checked and secondary indexes project all attributes.
+package memory
+
+import (
+	"sync"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Client implements every API required by mailbox
+var (
+	_ platform.GetEmailAPI            = (*Client)(nil)
+	_ platform.GetItemContentAPI      = (*Client)(nil)
+	_ platform.DeleteEmailAPI         = (*Client)(nil)
+	_ platform.DeleteThreadAPI        = (*Client)(nil)
+	_ platform.CreateAndSendEmailAPI  = (*Client)(nil)
+	_ platform.SaveAndSendEmailAPI    = (*Client)(nil)
+	_ platform.GetThreadWithEmailsAPI = (*Client)(nil)
+	_ platform.StoreEmailAPI          = (*Client)(nil)
+	_ platform.ReparseEmailAPI        = (*Client)(nil)
+	_ platform.SQSSendMessageAPI      = (*Client)(nil)
+	_ platform.ReceiveEmailAPI        = (*Client)(nil)
+	_ platform.QueryAndGetItemAPI     = (*Client)(nil)
+	_ platform.RunExportAPI           = (*Client)(nil)
+	_ platform.RestoreEmailAPI        = (*Client)(nil)
+	_ platform.WebhookAPI             = (*Client)(nil)
+	_ platform.ReplayWebhookAPI       = (*Client)(nil)
+	_ platform.CheckThreadsAPI        = (*Client)(nil)
+)
+
+// KeyName is the partition key of every table
+const KeyName = "MessageID"
+
+// Index describes a global secondary index
+type Index struct {
+	Name         string
+	PartitionKey string
+	SortKey      string // optional
+}
+
+// DefaultIndexes returns the secondary indexes of the mailbox table, named according to env
+func DefaultIndexes() []Index {
+	indexes := []Index{
+		{Name: env.GsiIndexName, PartitionKey: "TypeYearMonth", SortKey: "DateTime"},
+		{Name: env.GsiOriginalIndexName, PartitionKey: "OriginalMessageID"},
+	}
+	if env.GsiStarredIndexName != "" {
+		indexes = append(indexes, Index{Name: env.GsiStarredIndexName, PartitionKey: "StarredKey", SortKey: "StarredTime"})
+	}
+	if env.GsiSnoozeIndexName != "" {
+		indexes = append(indexes, Index{Name: env.GsiSnoozeIndexName, PartitionKey: "SnoozeKey", SortKey: "SnoozedUntil"})
+	}
+	return indexes
+}
+
+// Client is an in-memory backend that is safe for concurrent use
+type Client struct {
+	mu sync.Mutex
+
+	indexes map[string]Index
+	tables  map[string]map[string]item // table name -> partition key -> item
+	buckets map[string]map[string]*object
+	queues  map[string][]sqsTypes.Message
+	sent    []SentEmail
+}
+
+// NewClient returns an empty Client with the given indexes.
+// If no index is given, DefaultIndexes is used.
+func NewClient(indexes ...Index) *Client {
+	if len(indexes) == 0 {
+		indexes = DefaultIndexes()
+	}
+	c := &Client{
+		indexes: make(map[string]Index),
+		tables:  make(map[string]map[string]item),
+		buckets: make(map[string]map[string]*object),
+		queues:  make(map[string][]sqsTypes.Message),
+	}
+	for _, index := range indexes {
+		c.indexes[index.Name] = index
+	}
+	return c
+}
+
+// SentEmail is an email sent through SendEmail
+type SentEmail struct {
+	MessageID string
+	Input     *sesv2.SendEmailInput
+}
+
+// Item returns a copy of the stored item, or nil if it doesn't exist
+func (c *Client) Item(tableName, messageID string) map[string]dynamodbTypes.AttributeValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return copyItem(c.tables[tableName][messageID])
+}
+
+// ItemCount returns the number of items in a table
+func (c *Client) ItemCount(tableName string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.tables[tableName])
+}
+
+// SentEmails returns the emails sent through SendEmail, in order
+func (c *Client) SentEmails() []SentEmail {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]SentEmail(nil), c.sent...)
+}
+
+// Messages returns the messages sent to a queue, in order
+func (c *Client) Messages(queueName string) []sqsTypes.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]sqsTypes.Message(nil), c.queues[queueName]...)
+}
@@ -0,0 +1,428 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "table-for-memory"
+
+func putEmail(t *testing.T, client *Client, messageID, typeYearMonth, dateTime string) {
+	t.Helper()
+	_, err := client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item: map[string]dynamodbTypes.AttributeValue{
+			"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+			"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+			"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: dateTime},
+		},
+	})
+	assert.Nil(t, err)
+}
+
+func isValidationError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationException"
+}
+
+func TestClient_PutGetDelete(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient()
+	putEmail(t, client, "1", "inbox#2023-01", "01-00:00:00")
+
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"},
+		},
+		ProjectionExpression:     aws.String("#tym"),
+		ExpressionAttributeNames: map[string]string{"#tym": "TypeYearMonth"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]dynamodbTypes.AttributeValue{
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2023-01"},
+	}, resp.Item)
+
+	// condition fails on existing item
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                client.Item(tableName, "1"),
+		ConditionExpression: aws.String("attribute_not_exists(MessageID)"),
+	})
+	assert.IsType(t, &dynamodbTypes.ConditionalCheckFailedException{}, err)
+
+	_, err = client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"},
+		},
+		ConditionExpression: aws.String("attribute_exists(TrashedTime)"),
+	})
+	assert.IsType(t, &dynamodbTypes.ConditionalCheckFailedException{}, err)
+	assert.Equal(t, 1, client.ItemCount(tableName))
+
+	_, err = client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, client.Item(tableName, "1"))
+}
+
+func TestClient_UpdateItem(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient()
+
+	// UpdateItem creates the item if it doesn't exist
+	resp, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"},
+		},
+		UpdateExpression: aws.String("SET Unread = :val1"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":val1": &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+		},
+		ReturnValues: dynamodbTypes.ReturnValueAllNew,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]dynamodbTypes.AttributeValue{
+		"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"},
+		"Unread":    &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+	}, resp.Attributes)
+
+	tests := []struct {
+		input    *dynamodb.UpdateItemInput
+		validate func(t *testing.T, err error)
+	}{
+		{
+			input: &dynamodb.UpdateItemInput{
+				UpdateExpression: aws.String("REMOVE Unread"),
+				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+					":unused": &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+				},
+			},
+			validate: func(t *testing.T, err error) {
+				assert.True(t, isValidationError(err))
+			},
+		},
+		{
+			input: &dynamodb.UpdateItemInput{
+				UpdateExpression: aws.String("SET MessageID = :id"),
+				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+					":id": &dynamodbTypes.AttributeValueMemberS{Value: "2"},
+				},
+			},
+			validate: func(t *testing.T, err error) {
+				assert.True(t, isValidationError(err))
+			},
+		},
+		{
+			input: &dynamodb.UpdateItemInput{
+				UpdateExpression:    aws.String("REMOVE Unread"),
+				ConditionExpression: aws.String("attribute_not_exists(Unread)"),
+			},
+			validate: func(t *testing.T, err error) {
+				assert.IsType(t, &dynamodbTypes.ConditionalCheckFailedException{}, err)
+			},
+		},
+		{
+			input: &dynamodb.UpdateItemInput{
+				UpdateExpression:    aws.String("REMOVE Unread"),
+				ConditionExpression: aws.String("attribute_exists(Unread)"),
+			},
+			validate: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+				assert.NotContains(t, client.Item(tableName, "1"), "Unread")
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			test.input.TableName = aws.String(tableName)
+			test.input.Key = map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"},
+			}
+			_, err := client.UpdateItem(ctx, test.input)
+			test.validate(t, err)
+		})
+	}
+}
+
+func TestClient_TransactWriteItems(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient()
+	putEmail(t, client, "1", "inbox#2023-01", "01-00:00:00")
+
+	transactItems := []dynamodbTypes.TransactWriteItem{
+		{
+			Put: &dynamodbTypes.Put{
+				TableName: aws.String(tableName),
+				Item: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "2"},
+				},
+			},
+		},
+		{
+			Delete: &dynamodbTypes.Delete{
+				TableName: aws.String(tableName),
+				Key: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"},
+				},
+				ConditionExpression: aws.String("attribute_exists(TrashedTime)"),
+			},
+		},
+	}
+
+	// the condition fails, so nothing is written
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+	canceled := new(dynamodbTypes.TransactionCanceledException)
+	assert.True(t, errors.As(err, &canceled))
+	assert.Equal(t, "None", *canceled.CancellationReasons[0].Code)
+	assert.Equal(t, "ConditionalCheckFailed", *canceled.CancellationReasons[1].Code)
+	assert.Nil(t, client.Item(tableName, "2"))
+	assert.NotNil(t, client.Item(tableName, "1"))
+
+	transactItems[1].Delete.ConditionExpression = nil
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+	assert.Nil(t, err)
+	assert.NotNil(t, client.Item(tableName, "2"))
+	assert.Nil(t, client.Item(tableName, "1"))
+
+	// multiple operations on one item
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []dynamodbTypes.TransactWriteItem{transactItems[0], transactItems[0]},
+	})
+	assert.True(t, isValidationError(err))
+
+	// too many items
+	tooMany := make([]dynamodbTypes.TransactWriteItem, MaxTransactItems+1)
+	for i := range tooMany {
+		tooMany[i] = dynamodbTypes.TransactWriteItem{
+			Put: &dynamodbTypes.Put{
+				TableName: aws.String(tableName),
+				Item: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "many-" + strconv.Itoa(i)},
+				},
+			},
+		}
+	}
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: tooMany})
+	assert.True(t, isValidationError(err))
+	assert.Equal(t, 1, client.ItemCount(tableName))
+}
+
+func TestClient_Query(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient(Index{Name: "TimeIndex", PartitionKey: "TypeYearMonth", SortKey: "DateTime"})
+	putEmail(t, client, "1", "inbox#2023-01", "01-00:00:00")
+	putEmail(t, client, "2", "inbox#2023-01", "03-00:00:00")
+	putEmail(t, client, "3", "inbox#2023-01", "02-00:00:00")
+	putEmail(t, client, "4", "inbox#2023-02", "01-00:00:00")
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "3"},
+		},
+		UpdateExpression: aws.String("SET TrashedTime = :val1"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":val1": &dynamodbTypes.AttributeValueMemberS{Value: "2023-01-05T00:00:00Z"},
+		},
+	})
+	assert.Nil(t, err)
+
+	query := func(limit *int32, startKey map[string]dynamodbTypes.AttributeValue, filter *string) *dynamodb.QueryOutput {
+		t.Helper()
+		resp, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(tableName),
+			IndexName:              aws.String("TimeIndex"),
+			KeyConditionExpression: aws.String("#tym = :val"),
+			ExpressionAttributeNames: map[string]string{
+				"#tym": "TypeYearMonth",
+			},
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":val": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2023-01"},
+			},
+			ExclusiveStartKey: startKey,
+			FilterExpression:  filter,
+			Limit:             limit,
+			ScanIndexForward:  aws.Bool(false),
+		})
+		assert.Nil(t, err)
+		return resp
+	}
+	ids := func(resp *dynamodb.QueryOutput) []string {
+		result := []string{}
+		for _, it := range resp.Items {
+			result = append(result, it["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+		}
+		return result
+	}
+
+	resp := query(nil, nil, nil)
+	assert.Equal(t, []string{"2", "3", "1"}, ids(resp))
+	assert.Empty(t, resp.LastEvaluatedKey)
+
+	resp = query(aws.Int32(2), nil, aws.String("attribute_not_exists(TrashedTime)"))
+	assert.Equal(t, []string{"2"}, ids(resp))
+	assert.Equal(t, "3", resp.LastEvaluatedKey["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	assert.Contains(t, resp.LastEvaluatedKey, "DateTime")
+
+	resp = query(aws.Int32(2), resp.LastEvaluatedKey, aws.String("attribute_not_exists(TrashedTime)"))
+	assert.Equal(t, []string{"1"}, ids(resp))
+	assert.Empty(t, resp.LastEvaluatedKey)
+
+	_, err = client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String("UnknownIndex"),
+		KeyConditionExpression: aws.String("A = :a"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":a": &dynamodbTypes.AttributeValueMemberS{Value: "a"},
+		},
+	})
+	assert.True(t, isValidationError(err))
+}
+
+func TestClient_BatchGetItem(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient()
+	putEmail(t, client, "1", "inbox#2023-01", "01-00:00:00")
+	putEmail(t, client, "2", "inbox#2023-01", "02-00:00:00")
+
+	resp, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]dynamodbTypes.KeysAndAttributes{
+			tableName: {
+				Keys: []map[string]dynamodbTypes.AttributeValue{
+					{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "1"}},
+					{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "missing"}},
+					{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "2"}},
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Responses[tableName], 2)
+}
+
+func TestClient_Scan(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient()
+	putEmail(t, client, "1", "inbox#2023-01", "01-00:00:00")
+	putEmail(t, client, "2", "sent#2023-01", "02-00:00:00")
+	putEmail(t, client, "3", "inbox#2023-02", "03-00:00:00")
+
+	// paginated, in key order
+	var ids []string
+	var startKey map[string]dynamodbTypes.AttributeValue
+	for {
+		resp, err := client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:            aws.String(tableName),
+			Limit:                aws.Int32(2),
+			ExclusiveStartKey:    startKey,
+			ProjectionExpression: aws.String("MessageID"),
+		})
+		assert.Nil(t, err)
+		for _, item := range resp.Items {
+			assert.Len(t, item, 1)
+			ids = append(ids, item["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+		}
+		startKey = resp.LastEvaluatedKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+
+	resp, err := client.Scan(ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(tableName),
+		FilterExpression: aws.String("begins_with(TypeYearMonth, :type)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":type": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#"},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Items, 2)
+	assert.Equal(t, int32(3), resp.ScannedCount)
+
+	_, err = client.Scan(ctx, &dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+		IndexName: aws.String("TimeIndex"),
+	})
+	assert.True(t, isValidationError(err))
+}
+
+func TestClient_S3(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient()
+
+	_, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	assert.IsType(t, &s3Types.NoSuchKey{}, err)
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("key"),
+		Body:   strings.NewReader("content"),
+	})
+	assert.Nil(t, err)
+
+	resp, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	assert.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "content", string(body))
+
+	for _, key := range []string{"a", "b/c"} {
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String(key)})
+		assert.Nil(t, err)
+	}
+	list, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String("bucket"), MaxKeys: aws.Int32(2)})
+	assert.Nil(t, err)
+	assert.Len(t, list.Contents, 2)
+	assert.Equal(t, "a", *list.Contents[0].Key)
+	assert.True(t, *list.IsTruncated)
+	list, err = client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String("bucket"), ContinuationToken: list.NextContinuationToken})
+	assert.Nil(t, err)
+	assert.Len(t, list.Contents, 1)
+	assert.Equal(t, "key", *list.Contents[0].Key)
+	list, err = client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String("bucket"), Prefix: aws.String("b/")})
+	assert.Nil(t, err)
+	assert.Len(t, list.Contents, 1)
+
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	assert.Nil(t, err)
+	_, ok := client.Object("bucket", "key")
+	assert.False(t, ok)
+}
+
+func TestClient_SQS(t *testing.T) {
+	ctx := context.TODO()
+	client := NewClient()
+
+	urlResp, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String("queue")})
+	assert.Nil(t, err)
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    urlResp.QueueUrl,
+		MessageBody: aws.String("body"),
+	})
+	assert.Nil(t, err)
+
+	messages := client.Messages("queue")
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "body", *messages[0].Body)
+}
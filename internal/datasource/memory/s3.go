@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type object struct {
+	body         []byte
+	contentType  *string
+	lastModified time.Time
+}
+
+// now will be replaced during testing
+var now = time.Now
+
+func (c *Client) bucket(name string) map[string]*object {
+	b, ok := c.buckets[name]
+	if !ok {
+		b = make(map[string]*object)
+		c.buckets[name] = b
+	}
+	return b
+}
+
+// GetObject implements the S3 GetObject API
+func (c *Client) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.bucket(aws.ToString(params.Bucket))[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3Types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(obj.body)),
+		ContentLength: aws.Int64(int64(len(obj.body))),
+		ContentType:   obj.contentType,
+		LastModified:  aws.Time(obj.lastModified),
+	}, nil
+}
+
+// PutObject implements the S3 PutObject API
+func (c *Client) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	var body []byte
+	if params.Body != nil {
+		var err error
+		body, err = io.ReadAll(params.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bucket(aws.ToString(params.Bucket))[aws.ToString(params.Key)] = &object{
+		body:         body,
+		contentType:  params.ContentType,
+		lastModified: now().UTC(),
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// DeleteObject implements the S3 DeleteObject API.
+// Deleting an object that doesn't exist is not an error.
+func (c *Client) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.bucket(aws.ToString(params.Bucket)), aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// ListObjectsV2 implements the S3 ListObjectsV2 API, listing keys in lexicographical order.
+// The continuation token is the last key of the previous page.
+func (c *Client) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := aws.ToString(params.Prefix)
+	after := aws.ToString(params.StartAfter)
+	if params.ContinuationToken != nil {
+		after = *params.ContinuationToken
+	}
+	maxKeys := int(aws.ToInt32(params.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	keys := make([]string, 0)
+	for key := range c.bucket(aws.ToString(params.Bucket)) {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String(keys[len(keys)-1])
+	}
+	bucket := c.buckets[aws.ToString(params.Bucket)]
+	for _, key := range keys {
+		output.Contents = append(output.Contents, s3Types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(bucket[key].body))),
+			LastModified: aws.Time(bucket[key].lastModified),
+		})
+	}
+	output.KeyCount = aws.Int32(int32(len(output.Contents)))
+	return output, nil
+}
+
+// Object returns the content of an object, or false if it doesn't exist
+func (c *Client) Object(bucket, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(obj.body), true
+}
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/google/uuid"
+)
+
+// SendEmail implements the SES v2 SendEmail API. The email is recorded instead of being delivered.
+func (c *Client) SendEmail(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	if params.Content == nil || (params.Content.Simple == nil && params.Content.Raw == nil && params.Content.Template == nil) {
+		return nil, validationError("content is required")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messageID := uuid.NewString()
+	c.sent = append(c.sent, SentEmail{
+		MessageID: messageID,
+		Input:     params,
+	})
+	return &sesv2.SendEmailOutput{MessageId: aws.String(messageID)}, nil
+}
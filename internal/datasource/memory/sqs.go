@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+)
+
+// queueURLPrefix is the prefix of queue URLs, followed by the queue name
+const queueURLPrefix = "https://sqs.memory.local/"
+
+//revive:disable:var-naming
+
+// GetQueueUrl implements the SQS GetQueueUrl API. Every queue name is considered to exist.
+func (c *Client) GetQueueUrl(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	if aws.ToString(params.QueueName) == "" {
+		return nil, validationError("QueueName is required")
+	}
+	return &sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String(queueURLPrefix + *params.QueueName),
+	}, nil
+}
+
+//revive:enable:var-naming
+
+// SendMessage implements the SQS SendMessage API
+func (c *Client) SendMessage(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	queueName, err := parseQueueURL(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messageID := c.enqueue(queueName, sqsTypes.SendMessageBatchRequestEntry{
+		MessageBody:            params.MessageBody,
+		MessageAttributes:      params.MessageAttributes,
+		MessageGroupId:         params.MessageGroupId,
+		MessageDeduplicationId: params.MessageDeduplicationId,
+	})
+	return &sqs.SendMessageOutput{MessageId: aws.String(messageID)}, nil
+}
+
+// SendMessageBatch implements the SQS SendMessageBatch API
+func (c *Client) SendMessageBatch(_ context.Context, params *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	queueName, err := parseQueueURL(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Entries) == 0 || len(params.Entries) > 10 {
+		return nil, validationError("a batch must contain 1 to 10 entries")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	output := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		messageID := c.enqueue(queueName, entry)
+		output.Successful = append(output.Successful, sqsTypes.SendMessageBatchResultEntry{
+			Id:        entry.Id,
+			MessageId: aws.String(messageID),
+		})
+	}
+	return output, nil
+}
+
+// enqueue appends a message to the queue and returns its ID.
+// FIFO queues skip messages whose deduplication ID is already sent, and the message ID of the original is returned.
+// c.mu must be held.
+func (c *Client) enqueue(queueName string, entry sqsTypes.SendMessageBatchRequestEntry) string {
+	attributes := map[string]string{}
+	if strings.HasSuffix(queueName, ".fifo") {
+		attributes[string(sqsTypes.MessageSystemAttributeNameMessageGroupId)] = aws.ToString(entry.MessageGroupId)
+		attributes[string(sqsTypes.MessageSystemAttributeNameMessageDeduplicationId)] = aws.ToString(entry.MessageDeduplicationId)
+		for _, message := range c.queues[queueName] {
+			if message.Attributes[string(sqsTypes.MessageSystemAttributeNameMessageDeduplicationId)] == aws.ToString(entry.MessageDeduplicationId) {
+				return aws.ToString(message.MessageId)
+			}
+		}
+	}
+
+	messageID := uuid.NewString()
+	c.queues[queueName] = append(c.queues[queueName], sqsTypes.Message{
+		MessageId:         aws.String(messageID),
+		Body:              entry.MessageBody,
+		MessageAttributes: entry.MessageAttributes,
+		Attributes:        attributes,
+	})
+	return messageID
+}
+
+// parseQueueURL returns the queue name of a URL returned by GetQueueUrl
+func parseQueueURL(queueURL *string) (string, error) {
+	queueName, ok := strings.CutPrefix(aws.ToString(queueURL), queueURLPrefix)
+	if !ok || queueName == "" {
+		return "", &sqsTypes.QueueDoesNotExist{Message: aws.String("The specified queue does not exist.")}
+	}
+	return queueName, nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// ErrInvalidMessageID is returned when a messageID can't be used as a file name
+var ErrInvalidMessageID = errors.New("invalid messageID")
+
+// fsStorage stores raw emails in a Maildir-style directory:
+// emails are written to tmp/ and then atomically renamed into cur/,
+// so a partially written email is never visible to readers.
+type fsStorage struct {
+	dir string
+}
+
+// NewFilesystem returns a storage that keeps raw emails under dir.
+// If dir is empty, env.StorageDir at the time of each call is used.
+func NewFilesystem(dir string) S3Storage {
+	return fsStorage{dir: dir}
+}
+
+func (s fsStorage) root() string {
+	if s.dir != "" {
+		return s.dir
+	}
+	return env.StorageDir
+}
+
+// path returns the file path of an email, rejecting messageIDs that would escape the directory
+func (s fsStorage) path(messageID string) (string, error) {
+	if messageID == "" || messageID == "." || messageID == ".." || strings.ContainsAny(messageID, `/\`+"\x00") {
+		return "", ErrInvalidMessageID
+	}
+	return filepath.Join(s.root(), "cur", messageID), nil
+}
+
+// read returns the raw email, or s3Types.NoSuchKey if it doesn't exist, same as S3
+func (s fsStorage) read(messageID string) ([]byte, error) {
+	path, err := s.path(messageID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &s3Types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return raw, err
+}
+
+// GetEmail retrieves an email from the directory
+func (s fsStorage) GetEmail(_ context.Context, _ S3GetObjectAPI, messageID string) (*GetEmailResult, error) {
+	raw, err := s.read(messageID)
+	if err != nil {
+		return nil, err
+	}
+	return parseEmail(bytes.NewReader(raw))
+}
+
+// GetEmailRaw retrieves raw MIME email from the directory
+func (s fsStorage) GetEmailRaw(_ context.Context, _ S3GetObjectAPI, messageID string) ([]byte, error) {
+	return s.read(messageID)
+}
+
+// GetEmailContent retrieved the attachment of inline of an email from the directory
+func (s fsStorage) GetEmailContent(_ context.Context, _ S3GetObjectAPI, messageID, disposition, contentID string) (*GetEmailContentResult, error) {
+	raw, err := s.read(messageID)
+	if err != nil {
+		return nil, err
+	}
+	return parseEmailContent(bytes.NewReader(raw), disposition, contentID)
+}
+
+// DeleteEmail deletes an email from the directory, deleting a non-existent email is not an error
+func (s fsStorage) DeleteEmail(_ context.Context, _ S3DeleteObjectAPI, messageID string) error {
+	path, err := s.path(messageID)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PutEmail stores a raw MIME email in the directory, replacing any existing one
+func (s fsStorage) PutEmail(_ context.Context, _ S3PutObjectAPI, messageID string, raw []byte) error {
+	path, err := s.path(messageID)
+	if err != nil {
+		return err
+	}
+	tmpDir := filepath.Join(s.root(), "tmp")
+	for _, dir := range []string{tmpDir, filepath.Dir(path)} {
+		if err = os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, messageID+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name()) // no-op after a successful rename
+	}()
+
+	if _, err = tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ListEmails calls fn with the messageID of every email in the directory
+func (s fsStorage) ListEmails(_ context.Context, _ S3ListObjectsAPI, fn func(messageID string) error) error {
+	entries, err := os.ReadDir(filepath.Join(s.root(), "cur"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err = fn(entry.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
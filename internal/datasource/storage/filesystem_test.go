@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/jhillyerd/enmime/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const rawEmailWithAttachment = "From: sender@example.com\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"boundary\"\r\n" +
+	"\r\n" +
+	"--boundary\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"example-text\r\n" +
+	"--boundary\r\n" +
+	"Content-Type: text/plain; name=\"a.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"a.txt\"\r\n" +
+	"Content-ID: <attachment-id>\r\n" +
+	"\r\n" +
+	"attachment-content\r\n" +
+	"--boundary--\r\n"
+
+func TestFilesystem(t *testing.T) {
+	readEmailEnvelope = enmime.ReadEnvelope
+	ctx := context.TODO()
+	dir := t.TempDir()
+	fs := NewFilesystem(dir)
+
+	_, err := fs.GetEmailRaw(ctx, nil, "id")
+	var noSuchKey *s3Types.NoSuchKey
+	assert.ErrorAs(t, err, &noSuchKey)
+
+	err = fs.PutEmail(ctx, nil, "id", []byte(rawEmailWithAttachment))
+	assert.Nil(t, err)
+	entries, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	raw, err := fs.GetEmailRaw(ctx, nil, "id")
+	assert.Nil(t, err)
+	assert.Equal(t, rawEmailWithAttachment, string(raw))
+
+	var ids []string
+	err = fs.ListEmails(ctx, nil, func(messageID string) error {
+		ids = append(ids, messageID)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id"}, ids)
+
+	result, err := fs.GetEmail(ctx, nil, "id")
+	assert.Nil(t, err)
+	assert.Equal(t, "example-text", result.Text)
+	assert.Len(t, result.Attachments, 1)
+	assert.Equal(t, "a.txt", result.Attachments[0].Filename)
+
+	content, err := fs.GetEmailContent(ctx, nil, "id", DispositionAttachments, "attachment-id")
+	assert.Nil(t, err)
+	assert.Equal(t, "attachment-content", string(content.Content))
+	content, err = fs.GetEmailContent(ctx, nil, "id", DispositionInlines, "attachment-id")
+	assert.Nil(t, err)
+	assert.Nil(t, content)
+	_, err = fs.GetEmailContent(ctx, nil, "id", "invalid", "attachment-id")
+	assert.Equal(t, ErrorInvalidDisposition, err)
+
+	err = fs.DeleteEmail(ctx, nil, "id")
+	assert.Nil(t, err)
+	_, err = fs.GetEmail(ctx, nil, "id")
+	assert.ErrorAs(t, err, &noSuchKey)
+	err = fs.DeleteEmail(ctx, nil, "id")
+	assert.Nil(t, err, "deleting twice is not an error, same as S3")
+}
+
+func TestFilesystem_InvalidMessageID(t *testing.T) {
+	ctx := context.TODO()
+	fs := NewFilesystem(t.TempDir())
+
+	for _, messageID := range []string{"", ".", "..", "../id", `a\b`} {
+		err := fs.PutEmail(ctx, nil, messageID, []byte("raw"))
+		assert.Equal(t, ErrInvalidMessageID, err, messageID)
+		_, err = fs.GetEmailRaw(ctx, nil, messageID)
+		assert.Equal(t, ErrInvalidMessageID, err, messageID)
+		err = fs.DeleteEmail(ctx, nil, messageID)
+		assert.Equal(t, ErrInvalidMessageID, err, messageID)
+	}
+}
+
+func TestNew(t *testing.T) {
+	assert.IsType(t, s3Storage{}, New("", ""))
+	assert.IsType(t, s3Storage{}, New(BackendS3, ""))
+	assert.Equal(t, fsStorage{dir: "dir"}, New(BackendFilesystem, "dir"))
+
+	// the directory falls back to env
+	env.StorageDir = t.TempDir()
+	defer func() { env.StorageDir = "" }()
+	err := New(BackendFilesystem, "").PutEmail(context.TODO(), nil, "id", []byte("raw"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(env.StorageDir, "cur", "id"))
+	assert.Nil(t, err)
+}
@@ -1,17 +1,26 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/jhillyerd/enmime/v2"
 )
 
+// Supported storage backends
+const (
+	BackendS3         = "s3"
+	BackendFilesystem = "filesystem"
+)
+
 var (
 	ErrorInvalidDisposition = errors.New("invalid disposition")
 
@@ -28,18 +37,30 @@ type GetEmailResult struct {
 	OtherParts  model.Files
 }
 
-// S3Storage is an interface that defines required S3 functions
+// S3Storage is an interface that defines required storage functions.
+// Implementations other than S3 may ignore the api argument.
 type S3Storage interface {
 	GetEmail(ctx context.Context, api S3GetObjectAPI, messageID string) (*GetEmailResult, error)
 	DeleteEmail(ctx context.Context, api S3DeleteObjectAPI, messageID string) error
 	GetEmailRaw(ctx context.Context, api S3GetObjectAPI, messageID string) ([]byte, error)
 	GetEmailContent(ctx context.Context, api S3GetObjectAPI, messageID, disposition, contentID string) (*GetEmailContentResult, error)
+	PutEmail(ctx context.Context, api S3PutObjectAPI, messageID string, raw []byte) error
+	ListEmails(ctx context.Context, api S3ListObjectsAPI, fn func(messageID string) error) error
 }
 
 type s3Storage struct{}
 
-// S3 holds functions that handles S3 related operations
-var S3 S3Storage = s3Storage{}
+// S3 holds functions that handles storage related operations.
+// It's backed by S3 unless env.StorageBackend is set to BackendFilesystem.
+var S3 = New(env.StorageBackend, env.StorageDir)
+
+// New returns the storage for the given backend, defaulting to S3
+func New(backend, dir string) S3Storage {
+	if backend == BackendFilesystem {
+		return NewFilesystem(dir)
+	}
+	return s3Storage{}
+}
 
 // readEmailEnvelope is used in GetEmail will be mocked in unit testing
 var readEmailEnvelope = enmime.ReadEnvelope
@@ -63,17 +84,7 @@ func (s s3Storage) GetEmail(ctx context.Context, api S3GetObjectAPI, messageID s
 		fmt.Println("error closing object body", err)
 	}()
 
-	env, err := readEmailEnvelope(object.Body)
-	if err != nil {
-		return nil, err
-	}
-	return &GetEmailResult{
-		Text:        env.Text,
-		HTML:        env.HTML,
-		Attachments: ParseFiles(env.Attachments),
-		Inlines:     ParseFiles(env.Inlines),
-		OtherParts:  ParseFiles(env.OtherParts),
-	}, nil
+	return parseEmail(object.Body)
 }
 
 // GetEmailRaw retrieves raw MIME email from s3 bucket
@@ -113,7 +124,13 @@ func (s s3Storage) GetEmailContent(ctx context.Context, api S3GetObjectAPI, mess
 		fmt.Println("error closing object body", err)
 	}()
 
-	env, err := readEmailEnvelope(object.Body)
+	return parseEmailContent(object.Body, disposition, contentID)
+}
+
+// parseEmailContent finds the part of a raw MIME email with the disposition and contentID,
+// it returns nil if no part is found
+func parseEmailContent(r io.Reader, disposition, contentID string) (*GetEmailContentResult, error) {
+	env, err := readEmailEnvelope(r)
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +183,65 @@ func (s s3Storage) DeleteEmail(ctx context.Context, api S3DeleteObjectAPI, messa
 	return nil
 }
 
+// S3PutObjectAPI defines set of API required by PutEmail functions
+type S3PutObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// PutEmail stores a raw MIME email in S3 bucket
+func (s s3Storage) PutEmail(ctx context.Context, api S3PutObjectAPI, messageID string, raw []byte) error {
+	_, err := api.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &env.S3Bucket,
+		Key:    &messageID,
+		Body:   bytes.NewReader(raw),
+	})
+	return err
+}
+
+// S3ListObjectsAPI defines set of API required by ListEmails functions
+type S3ListObjectsAPI interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// ListEmails calls fn with the messageID of every email in S3 bucket.
+// Keys with a "/", such as the ones under exports/, are not emails and are skipped.
+func (s s3Storage) ListEmails(ctx context.Context, api S3ListObjectsAPI, fn func(messageID string) error) error {
+	paginator := s3.NewListObjectsV2Paginator(api, &s3.ListObjectsV2Input{
+		Bucket: &env.S3Bucket,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if strings.Contains(key, "/") {
+				continue
+			}
+			if err = fn(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseEmail parses a raw MIME email into GetEmailResult
+func parseEmail(r io.Reader) (*GetEmailResult, error) {
+	env, err := readEmailEnvelope(r)
+	if err != nil {
+		return nil, err
+	}
+	return &GetEmailResult{
+		Text:        env.Text,
+		HTML:        env.HTML,
+		Attachments: ParseFiles(env.Attachments),
+		Inlines:     ParseFiles(env.Inlines),
+		OtherParts:  ParseFiles(env.OtherParts),
+	}, nil
+}
+
 // ParseFiles parses enmime parts into File slice
 func ParseFiles(parts []*enmime.Part) model.Files {
 	files := make([]model.File, len(parts))
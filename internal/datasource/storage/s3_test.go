@@ -8,7 +8,9 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/jhillyerd/enmime/v2"
 	"github.com/stretchr/testify/assert"
@@ -191,3 +193,55 @@ func TestS3_DeleteEmail(t *testing.T) {
 		})
 	}
 }
+
+type mockPutObjectAPI func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+
+func (m mockPutObjectAPI) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestS3_PutEmail(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+
+	client := mockPutObjectAPI(func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		assert.Equal(t, env.S3Bucket, *params.Bucket)
+		assert.Equal(t, "exampleMessageID", *params.Key)
+		body, err := io.ReadAll(params.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "raw", string(body))
+		return &s3.PutObjectOutput{}, nil
+	})
+	err := S3.PutEmail(context.TODO(), client, "exampleMessageID", []byte("raw"))
+	assert.Nil(t, err)
+}
+
+type mockListObjectsAPI func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+
+func (m mockListObjectsAPI) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestS3_ListEmails(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+
+	client := mockListObjectsAPI(func(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+		assert.Equal(t, env.S3Bucket, *params.Bucket)
+		if params.ContinuationToken == nil {
+			return &s3.ListObjectsV2Output{
+				Contents:              []s3Types.Object{{Key: aws.String("a")}, {Key: aws.String("exports/export-1/inbox/2023-01.mbox")}},
+				IsTruncated:           aws.Bool(true),
+				NextContinuationToken: aws.String("token"),
+			}, nil
+		}
+		assert.Equal(t, "token", *params.ContinuationToken)
+		return &s3.ListObjectsV2Output{Contents: []s3Types.Object{{Key: aws.String("b")}}}, nil
+	})
+
+	var ids []string
+	err := S3.ListEmails(context.TODO(), client, func(messageID string) error {
+		ids = append(ids, messageID)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+}
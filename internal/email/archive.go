@@ -0,0 +1,100 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Archive marks a received email as archived.
+// Unlike Trash, archived emails are kept, and they are hidden from the inbox by ListInput.ShowArchived.
+// It returns ErrInvalidInput if the email isn't received.
+func Archive(ctx context.Context, client platform.GetEmailAPI, messageID string) error {
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("SET ArchivedTime = :archivedTime"),
+		ConditionExpression: aws.String("attribute_not_exists(ArchivedTime) AND begins_with(TypeYearMonth, :v_type)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":archivedTime": &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":v_type":       &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeInbox + "#"},
+		},
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return archiveError(ctx, client, messageID)
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionArchived, Email: hook.Email{ID: messageID}})
+
+	fmt.Println("archive method finished successfully")
+	return nil
+}
+
+// archiveError returns the error of an archive failing its condition,
+// which is ErrNotFound or ErrInvalidInput unless the email is already archived
+func archiveError(ctx context.Context, client platform.GetItemAPI, messageID string) error {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("TypeYearMonth"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Item) == 0 {
+		return platform.ErrNotFound
+	}
+	var typeYearMonth string
+	_ = attributevalue.Unmarshal(resp.Item["TypeYearMonth"], &typeYearMonth)
+	if !strings.HasPrefix(typeYearMonth, model.EmailTypeInbox+"#") {
+		return platform.ErrInvalidInput
+	}
+	return &platform.AlreadyArchivedError{Type: "email"}
+}
+
+// Unarchive marks an archived email as not archived
+func Unarchive(ctx context.Context, client platform.UpdateEmailAPI, messageID string) error {
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("REMOVE ArchivedTime, ArchivedByThread"),
+		ConditionExpression: aws.String("attribute_exists(ArchivedTime)"),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return &platform.NotArchivedError{Type: "email"}
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionUnarchived, Email: hook.Email{ID: messageID}})
+
+	fmt.Println("unarchive method finished successfully")
+	return nil
+}
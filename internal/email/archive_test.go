@@ -0,0 +1,64 @@
+package email
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchive(t *testing.T) {
+	env.TableName = "table-for-archive"
+	env.GsiIndexName = "TimeIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	for _, e := range [][2]string{{"inbox-1", "inbox"}, {"inbox-2", "inbox"}, {"sent-1", "sent"}} {
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(env.TableName),
+			Item: map[string]dynamodbTypes.AttributeValue{
+				"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: e[0]},
+				"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: e[1] + "#2023-02"},
+				"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "01-00:00:00"},
+			},
+		})
+		assert.Nil(t, err)
+	}
+	list := func(showArchived string) []string {
+		t.Helper()
+		result, err := List(ctx, client, ListInput{Type: "inbox", Year: "2023", Month: "2", ShowArchived: showArchived})
+		assert.Nil(t, err)
+		var ids []string
+		for _, item := range result.Items {
+			ids = append(ids, item.MessageID)
+		}
+		return ids
+	}
+
+	assert.Nil(t, Archive(ctx, client, "inbox-1"))
+	result, err := Get(ctx, client, "inbox-1")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, result.ArchivedTime)
+	assert.Equal(t, &platform.AlreadyArchivedError{Type: "email"}, Archive(ctx, client, "inbox-1"))
+	assert.Equal(t, platform.ErrInvalidInput, Archive(ctx, client, "sent-1"), "only received emails are archived")
+	assert.Equal(t, platform.ErrNotFound, Archive(ctx, client, "missing"))
+
+	assert.Equal(t, []string{"inbox-2"}, list(""))
+	assert.Equal(t, []string{"inbox-2", "inbox-1"}, list(ShowArchivedInclude))
+	assert.Equal(t, []string{"inbox-1"}, list("ONLY"))
+	_, err = List(ctx, client, ListInput{Type: "inbox", Year: "2023", Month: "2", ShowArchived: "all"})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+
+	// archived emails are not trashed, so they can't be deleted
+	assert.Equal(t, &platform.NotTrashedError{Type: "email"}, Delete(ctx, client, "inbox-1"))
+
+	assert.Nil(t, Unarchive(ctx, client, "inbox-1"))
+	assert.Equal(t, &platform.NotArchivedError{Type: "email"}, Unarchive(ctx, client, "inbox-1"))
+	assert.Equal(t, []string{"inbox-2", "inbox-1"}, list(ShowArchivedExclude))
+}
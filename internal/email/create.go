@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/harryzcy/mailbox/internal/util/format"
@@ -164,6 +166,7 @@ func Create(ctx context.Context, client platform.CreateAndSendEmailAPI, input Cr
 				},
 				"TimeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: format.RFC3399(t)},
 				"DraftID":     item["MessageID"],
+				"UnreadCount": &dynamodbTypes.AttributeValueMemberN{Value: strconv.Itoa(unreadCount(info.CreatingUnread))},
 			}
 			_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 				TransactItems: []dynamodbTypes.TransactWriteItem{
@@ -219,8 +222,22 @@ func Create(ctx context.Context, client platform.CreateAndSendEmailAPI, input Cr
 		}
 	}
 
+	if isThread {
+		threadAction := hook.ActionCreated
+		if isExistingThread {
+			threadAction = hook.ActionUpdated
+		}
+		hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: threadAction, Thread: hook.Thread{ID: threadID}})
+	}
+
 	emailType := model.EmailTypeDraft
-	if input.Send {
+	if !input.Send {
+		hook.Notify(ctx, client, &hook.Hook{
+			Event:  hook.EventDraft,
+			Action: hook.ActionCreated,
+			Email:  hook.Email{ID: input.MessageID, ThreadID: threadID},
+		})
+	} else {
 		email := &Input{
 			MessageID:  input.MessageID,
 			Subject:    input.Subject,
@@ -278,9 +295,21 @@ type ThreadInfo struct {
 	// used to create a new thread
 	CreatingEmailID  string
 	CreatingSubject  string
+	CreatingUnread   bool
 	ReplyToMessageID string // the original message id from the sender, rather than the one generated by SES
 }
 
+// unreadCount returns the number of unread emails
+func unreadCount(unread ...bool) int {
+	count := 0
+	for _, u := range unread {
+		if u {
+			count++
+		}
+	}
+	return count
+}
+
 func getThreadInfo(ctx context.Context, client platform.CreateAndSendEmailAPI, replyEmailID string) (*ThreadInfo, error) {
 	fmt.Println("getting email to reply to")
 	email, err := Get(ctx, client, replyEmailID)
@@ -302,6 +331,7 @@ func getThreadInfo(ctx context.Context, client platform.CreateAndSendEmailAPI, r
 		References:       email.References,
 		CreatingEmailID:  email.MessageID,
 		CreatingSubject:  email.Subject,
+		CreatingUnread:   email.Unread != nil && *email.Unread,
 		ReplyToMessageID: replyToMessageID,
 	}, nil
 }
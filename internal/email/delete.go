@@ -4,20 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
-// Delete deletes an trashed email from DynamoDB and S3.
+// Delete deletes an trashed email from DynamoDB and S3, including the raw emails of its other deliveries.
 // This action won't be successful if it's not trashed.
-func Delete(ctx context.Context, client platform.DeleteItemAPI, messageID string) error {
-	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+func Delete(ctx context.Context, client platform.DeleteEmailAPI, messageID string) error {
+	resp, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]dynamodbTypes.AttributeValue{
 			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
@@ -26,6 +28,7 @@ func Delete(ctx context.Context, client platform.DeleteItemAPI, messageID string
 		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
 			":v_type": &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeDraft},
 		},
+		ReturnValues: dynamodbTypes.ReturnValueAllOld,
 	})
 	if err != nil {
 		var condFailedErr *dynamodbTypes.ConditionalCheckFailedException
@@ -35,14 +38,27 @@ func Delete(ctx context.Context, client platform.DeleteItemAPI, messageID string
 		return err
 	}
 
-	err = storage.S3.DeleteEmail(ctx, client, messageID)
-	if err != nil {
-		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
-			return platform.ErrTooManyRequests
+	ids := []string{messageID}
+	if deliveries, ok := resp.Attributes["Deliveries"].(*dynamodbTypes.AttributeValueMemberSS); ok {
+		ids = append(ids, deliveries.Value...)
+	}
+	for _, id := range ids {
+		err = storage.S3.DeleteEmail(ctx, client, id)
+		if err != nil {
+			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return platform.ErrTooManyRequests
+			}
+			return err
 		}
-		return err
 	}
 
+	event := hook.EventEmail
+	if typeYearMonth, ok := resp.Attributes["TypeYearMonth"].(*dynamodbTypes.AttributeValueMemberS); ok &&
+		strings.HasPrefix(typeYearMonth.Value, model.EmailTypeDraft+"#") {
+		event = hook.EventDraft
+	}
+	hook.Notify(ctx, client, &hook.Hook{Event: event, Action: hook.ActionDeleted, Email: hook.Email{ID: messageID}})
+
 	fmt.Println("delete method finished successfully")
 	return nil
 }
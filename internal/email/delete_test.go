@@ -5,16 +5,20 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/mockutil"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockDeleteItemAPI struct {
+	mockutil.MockPublishAPI
 	mockDeleteItem   func(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
 	mockDeleteObject func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 }
@@ -30,12 +34,12 @@ func (m mockDeleteItemAPI) DeleteObject(ctx context.Context, params *s3.DeleteOb
 func TestDelete(t *testing.T) {
 	env.TableName = "table-for-delete"
 	tests := []struct {
-		client      func(t *testing.T) platform.DeleteItemAPI
+		client      func(t *testing.T) platform.DeleteEmailAPI
 		messageID   string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) platform.DeleteItemAPI {
+			client: func(t *testing.T) platform.DeleteEmailAPI {
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
 						t.Helper()
@@ -65,7 +69,7 @@ func TestDelete(t *testing.T) {
 			messageID: "exampleMessageID",
 		},
 		{
-			client: func(t *testing.T) platform.DeleteItemAPI {
+			client: func(t *testing.T) platform.DeleteEmailAPI {
 				t.Helper()
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
@@ -79,7 +83,7 @@ func TestDelete(t *testing.T) {
 			expectedErr: &platform.NotTrashedError{Type: "email"},
 		},
 		{
-			client: func(t *testing.T) platform.DeleteItemAPI {
+			client: func(t *testing.T) platform.DeleteEmailAPI {
 				t.Helper()
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
@@ -93,7 +97,7 @@ func TestDelete(t *testing.T) {
 			expectedErr: &platform.NotTrashedError{Type: "email"},
 		},
 		{
-			client: func(t *testing.T) platform.DeleteItemAPI {
+			client: func(t *testing.T) platform.DeleteEmailAPI {
 				t.Helper()
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
@@ -117,3 +121,32 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestDelete_Event(t *testing.T) {
+	env.TableName = "table-for-delete-event"
+	env.S3Bucket = "bucket-for-delete-event"
+	env.QueueName = "queue-for-delete-event"
+	defer func() { env.QueueName = "" }()
+	ctx := context.TODO()
+	client := memory.NewClient()
+	for id, typeYearMonth := range map[string]string{"saved": "draft#2023-02", "received": "inbox#2023-02"} {
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(env.TableName),
+			Item: map[string]dynamodbTypes.AttributeValue{
+				"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: id},
+				"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+				"TrashedTime":   &dynamodbTypes.AttributeValueMemberS{Value: "2023-02-01T00:00:00Z"},
+			},
+		})
+		assert.Nil(t, err)
+	}
+
+	// the event depends on the type of the email, not its ID
+	assert.Nil(t, Delete(ctx, client, "saved"))
+	assert.Nil(t, Delete(ctx, client, "received"))
+	messages := client.Messages(env.QueueName)
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, "draft", *messages[0].MessageAttributes["Event"].StringValue)
+		assert.Equal(t, "email", *messages[1].MessageAttributes["Event"].StringValue)
+	}
+}
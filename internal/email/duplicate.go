@@ -0,0 +1,181 @@
+package email
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// FindByOriginalMessageID returns the emails with the Message-ID header, in no particular order.
+// There can be more than one if the message is both sent and received, or imported as a different email.
+func FindByOriginalMessageID(ctx context.Context, client platform.QueryAndGetItemAPI, originalMessageID string) ([]*GetResult, error) {
+	var ids []string
+	var startKey map[string]dynamodbTypes.AttributeValue
+	for {
+		resp, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(env.TableName),
+			IndexName:              aws.String(env.GsiOriginalIndexName),
+			ExclusiveStartKey:      startKey,
+			KeyConditionExpression: aws.String("OriginalMessageID = :originalMessageID"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":originalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: originalMessageID},
+			},
+		})
+		if err != nil {
+			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, platform.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		for _, item := range resp.Items {
+			if id, ok := item["MessageID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+				ids = append(ids, id.Value)
+			}
+		}
+		startKey = resp.LastEvaluatedKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+
+	// OriginalMessageIDIndex only projects the keys
+	emails := make([]*GetResult, 0, len(ids))
+	for _, id := range ids {
+		email, err := Get(ctx, client, id)
+		if err != nil {
+			if errors.Is(err, platform.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// Time returns the time the email is received, sent, or last updated if it's a draft, in RFC3339 format
+func (e *GetResult) Time() string {
+	switch e.Type {
+	case model.EmailTypeInbox:
+		return e.TimeReceived
+	case model.EmailTypeSent:
+		return e.TimeSent
+	}
+	return e.TimeUpdated
+}
+
+// compareTime orders emails by time, then by ID, so that the order is deterministic
+func compareTime(a, b *GetResult) int {
+	return cmp.Or(cmp.Compare(a.Time(), b.Time()), cmp.Compare(a.MessageID, b.MessageID))
+}
+
+// Newest returns the newest email, or the one with the greatest ID if they have the same time
+func Newest(emails []*GetResult) *GetResult {
+	if len(emails) == 0 {
+		return nil
+	}
+	return slices.MaxFunc(emails, compareTime)
+}
+
+// Delivery is a received email, which may have been received before, e.g. when it's sent to several addresses
+type Delivery struct {
+	MessageID         string    // the ID generated by SES
+	OriginalMessageID string    // the Message-ID header
+	Destination       []string  // the addresses it's delivered to
+	From              []string  // the From header
+	Subject           string    // the Subject header
+	DateSent          string    // the Date header, formatted by format.Date
+	TimeReceived      time.Time // the time SES receives it
+}
+
+// deliveryWindow is the longest time between deliveries of the same message.
+// A message with the same Message-ID received later is stored as a new email, since the ID may be reused.
+const deliveryWindow = 24 * time.Hour
+
+// RecordDelivery records a received email as another delivery of the email with the same Message-ID, if there's one,
+// adding its ID to Deliveries and its destinations to Destination, so the message is only stored once.
+// The email must not be trashed, must have the same From, Subject and Date headers,
+// and must be received within deliveryWindow, otherwise the delivery is stored as a new email.
+// The raw emails of all deliveries are kept, and deleted with the email.
+// It returns the ID of the existing email, or an empty string if the email isn't received before and should be stored.
+func RecordDelivery(ctx context.Context, client platform.RecordDeliveryAPI, delivery Delivery) (string, error) {
+	if delivery.OriginalMessageID == "" {
+		return "", nil
+	}
+	candidates, err := FindByOriginalMessageID(ctx, client, delivery.OriginalMessageID)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range candidates {
+		if e.MessageID == delivery.MessageID || slices.Contains(e.Deliveries, delivery.MessageID) {
+			// the same delivery is processed again, e.g. when the invocation is retried
+			return e.MessageID, nil
+		}
+	}
+	candidates = slices.DeleteFunc(candidates, func(e *GetResult) bool {
+		return !delivery.sameMessage(e)
+	})
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	// the first delivery is the logical message
+	original := slices.MinFunc(candidates, compareTime)
+	expression := "ADD Deliveries :deliveries"
+	values := map[string]dynamodbTypes.AttributeValue{
+		":deliveries": &dynamodbTypes.AttributeValueMemberSS{Value: []string{delivery.MessageID}},
+	}
+	if len(delivery.Destination) > 0 {
+		expression += ", Destination :destination"
+		values[":destination"] = &dynamodbTypes.AttributeValueMemberSS{Value: delivery.Destination}
+	}
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: original.MessageID},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("attribute_exists(MessageID)"),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			// the email is deleted meanwhile, so the delivery is stored as a new email
+			return "", nil
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return "", platform.ErrTooManyRequests
+		}
+		return "", err
+	}
+
+	fmt.Printf("email %s is recorded as another delivery of %s\n", delivery.MessageID, original.MessageID)
+	return original.MessageID, nil
+}
+
+// sameMessage returns whether an email is the message of the delivery received before
+func (d Delivery) sameMessage(e *GetResult) bool {
+	if e.Type != model.EmailTypeInbox || e.TrashedTime != "" {
+		return false
+	}
+	if e.Subject != d.Subject || e.DateSent != d.DateSent ||
+		!slices.Equal(slices.Sorted(slices.Values(e.From)), slices.Sorted(slices.Values(d.From))) {
+		return false
+	}
+	received, err := time.Parse(time.RFC3339, e.TimeReceived)
+	if err != nil {
+		return false
+	}
+	elapsed := d.TimeReceived.Sub(received)
+	return elapsed < deliveryWindow && elapsed > -deliveryWindow
+}
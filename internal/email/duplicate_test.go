@@ -0,0 +1,98 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewest(t *testing.T) {
+	assert.Nil(t, Newest(nil))
+
+	emails := []*GetResult{
+		{MessageID: "b", Type: "inbox", TimeReceived: "2023-02-02T00:00:00Z"},
+		{MessageID: "c", Type: "sent", TimeSent: "2023-02-01T00:00:00Z"},
+		{MessageID: "a", Type: "inbox", TimeReceived: "2023-02-02T00:00:00Z"},
+	}
+	assert.Equal(t, "b", Newest(emails).MessageID, "ties are broken by ID")
+}
+
+func TestRecordDelivery(t *testing.T) {
+	env.TableName = "table-for-record-delivery"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiOriginalIndexName = "OriginalMessageIDIndex"
+	ctx := context.TODO()
+	client := memory.NewClient()
+	for _, e := range [][4]string{
+		{"sent", "sent", "02-00:00:00"},
+		{"second", "inbox", "03-00:00:00"},
+		{"first", "inbox", "03-00:00:00"},
+		{"trashed", "inbox", "02-23:00:00"},
+	} {
+		item := map[string]dynamodbTypes.AttributeValue{
+			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: e[0]},
+			"TypeYearMonth":     &dynamodbTypes.AttributeValueMemberS{Value: e[1] + "#2023-02"},
+			"DateTime":          &dynamodbTypes.AttributeValueMemberS{Value: e[2]},
+			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "<message@example.com>"},
+			"Destination":       &dynamodbTypes.AttributeValueMemberSS{Value: []string{"me@example.com"}},
+			"From":              &dynamodbTypes.AttributeValueMemberSS{Value: []string{"a@example.com", "b@example.com"}},
+			"Subject":           &dynamodbTypes.AttributeValueMemberS{Value: "subject"},
+			"DateSent":          &dynamodbTypes.AttributeValueMemberS{Value: "2023-02-02T23:00:00Z"},
+		}
+		if e[0] == "trashed" {
+			item["TrashedTime"] = &dynamodbTypes.AttributeValueMemberS{Value: "2023-02-03T00:00:00Z"}
+		}
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(env.TableName), Item: item})
+		assert.Nil(t, err)
+	}
+
+	id, err := RecordDelivery(ctx, client, Delivery{MessageID: "new", OriginalMessageID: "<other@example.com>"})
+	assert.Nil(t, err)
+	assert.Empty(t, id)
+
+	delivery := Delivery{
+		MessageID:         "third",
+		OriginalMessageID: "<message@example.com>",
+		Destination:       []string{"alias@example.com"},
+		From:              []string{"b@example.com", "a@example.com"},
+		Subject:           "subject",
+		DateSent:          "2023-02-02T23:00:00Z",
+		TimeReceived:      time.Date(2023, 2, 3, 0, 1, 0, 0, time.UTC),
+	}
+	for name, change := range map[string]func(d *Delivery){
+		"from":    func(d *Delivery) { d.From = []string{"a@example.com"} },
+		"subject": func(d *Delivery) { d.Subject = "other subject" },
+		"date":    func(d *Delivery) { d.DateSent = "2023-02-02T23:30:00Z" },
+		"time":    func(d *Delivery) { d.TimeReceived = time.Date(2023, 2, 5, 0, 0, 0, 0, time.UTC) },
+	} {
+		d := delivery
+		d.MessageID = "reused-" + name
+		change(&d)
+		id, err = RecordDelivery(ctx, client, d)
+		assert.Nil(t, err)
+		assert.Empty(t, id, "a message with a different %s is stored as a new email", name)
+	}
+
+	id, err = RecordDelivery(ctx, client, delivery)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", id, "sent and trashed emails are skipped, and the earliest delivery is chosen")
+
+	result, err := Get(ctx, client, "first")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"third"}, result.Deliveries)
+	assert.ElementsMatch(t, []string{"me@example.com", "alias@example.com"}, result.Destination)
+
+	id, err = RecordDelivery(ctx, client, delivery)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", id, "the same delivery is only recorded once")
+	result, err = Get(ctx, client, "first")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"third"}, result.Deliveries)
+}
@@ -90,6 +90,9 @@ type Item struct {
 	Unread         *bool    `json:"unread,omitempty"`
 	ThreadID       string   `json:"threadID,omitempty"`
 	IsThreadLatest bool     `json:"isThreadLatest,omitempty"`
+	ArchivedTime   string   `json:"archivedTime,omitempty"`
+	Starred        bool     `json:"starred,omitempty"`
+	SnoozedUntil   string   `json:"snoozedUntil,omitempty"`
 }
 
 type RawEmailItem struct {
@@ -100,6 +103,9 @@ type RawEmailItem struct {
 	Unread         *bool    `json:"unread,omitempty"`
 	ThreadID       string   `json:"threadID,omitempty"`
 	IsThreadLatest bool     `json:"isThreadLatest,omitempty"`
+	ArchivedTime   string   `json:"archivedTime,omitempty"`
+	Starred        bool     `json:"starred,omitempty"`
+	SnoozedUntil   string   `json:"snoozedUntil,omitempty"`
 }
 
 func (raw RawEmailItem) ToEmailItem() (*Item, error) {
@@ -115,6 +121,9 @@ func (raw RawEmailItem) ToEmailItem() (*Item, error) {
 		Unread:         raw.Unread,
 		ThreadID:       raw.ThreadID,
 		IsThreadLatest: raw.IsThreadLatest,
+		ArchivedTime:   raw.ArchivedTime,
+		Starred:        raw.Starred,
+		SnoozedUntil:   raw.SnoozedUntil,
 	}
 	if item.Unread == nil && item.Type == model.EmailTypeInbox {
 		item.Unread = new(bool)
@@ -29,6 +29,14 @@ type GetResult struct {
 	References        string   `json:"references"` // space separated string
 	ThreadID          string   `json:"threadID,omitempty"`
 	IsThreadLatest    bool     `json:"isThreadLatest,omitempty"`
+	TrashedTime       string   `json:"trashedTime,omitempty"`
+	TrashedByThread   bool     `json:"trashedByThread,omitempty"` // true if trashed together with its thread
+	MutedByThread     bool     `json:"mutedByThread,omitempty"`   // true if received in a muted thread, so stored as read without notifications
+	ArchivedTime      string   `json:"archivedTime,omitempty"`
+	ArchivedByThread  bool     `json:"archivedByThread,omitempty"` // true if archived together with its thread
+	Starred           bool     `json:"starred,omitempty"`
+	SnoozedUntil      string   `json:"snoozedUntil,omitempty"`
+	SnoozedByThread   bool     `json:"snoozedByThread,omitempty"` // true if snoozed together with its thread
 
 	// Inbox email attributes
 	TimeReceived string   `json:"timeReceived,omitempty"`
@@ -38,6 +46,7 @@ type GetResult struct {
 	ReturnPath   string   `json:"returnPath,omitempty"`
 	Verdict      *Verdict `json:"verdict,omitempty"`
 	Unread       *bool    `json:"unread,omitempty"`
+	Deliveries   []string `json:"deliveries,omitempty"` // IDs of other deliveries of the same message, whose raw emails are kept
 
 	// Draft email attributes
 	TimeUpdated string   `json:"timeUpdated,omitempty"`
@@ -70,7 +79,7 @@ func GetAndRead(ctx context.Context, client platform.GetEmailAPI, messageID stri
 
 	// mark email as read
 	if result.Type == model.EmailTypeInbox && result.Unread != nil && *result.Unread {
-		err = Read(ctx, client, messageID, ActionRead)
+		err = read(ctx, client, messageID, result.ThreadID, ActionRead)
 		if err != nil {
 			return nil, err
 		}
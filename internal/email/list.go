@@ -16,13 +16,17 @@ const (
 
 // ListInput represents the input of list method
 type ListInput struct {
-	Type       string  `json:"type"`
-	Year       string  `json:"year"`
-	Month      string  `json:"month"`
-	Order      string  `json:"order"`     // asc or desc (default)
-	ShowTrash  string  `json:"showTrash"` // 'include', 'exclude' or 'only' (default is 'exclude')
-	PageSize   int32   `json:"pageSize"`  // 0 means no limit, default is 100
-	NextCursor *Cursor `json:"nextCursor"`
+	Type      string `json:"type"`
+	Year      string `json:"year"`
+	Month     string `json:"month"`
+	Order     string `json:"order"`     // asc or desc (default)
+	ShowTrash string `json:"showTrash"` // 'include', 'exclude' or 'only' (default is 'exclude')
+	// ShowArchived is 'include', 'exclude' or 'only' (default is 'exclude'), only archived inbox emails are affected
+	ShowArchived string `json:"showArchived"`
+	// ShowSnoozed is 'include', 'exclude' or 'only' (default is 'exclude'), only snoozed inbox emails are affected
+	ShowSnoozed string  `json:"showSnoozed"`
+	PageSize    int32   `json:"pageSize"` // 0 means no limit, default is 100
+	NextCursor  *Cursor `json:"nextCursor"`
 }
 
 // ListResult represents the result of list method
@@ -39,6 +43,18 @@ const (
 	ShowTrashOnly    = "only"
 )
 
+const (
+	ShowArchivedExclude = "exclude"
+	ShowArchivedInclude = "include"
+	ShowArchivedOnly    = "only"
+)
+
+const (
+	ShowSnoozedExclude = "exclude"
+	ShowSnoozedInclude = "include"
+	ShowSnoozedOnly    = "only"
+)
+
 // List lists emails in DynamoDB
 //
 // TODO: refactor this function
@@ -73,13 +89,33 @@ func List(ctx context.Context, client platform.QueryAPI, input ListInput) (*List
 		}
 	}
 
+	if input.ShowArchived == "" {
+		input.ShowArchived = ShowArchivedExclude
+	} else {
+		input.ShowArchived = strings.ToLower(input.ShowArchived)
+		if input.ShowArchived != ShowArchivedOnly && input.ShowArchived != ShowArchivedInclude && input.ShowArchived != ShowArchivedExclude {
+			return nil, platform.ErrInvalidInput
+		}
+	}
+
+	if input.ShowSnoozed == "" {
+		input.ShowSnoozed = ShowSnoozedExclude
+	} else {
+		input.ShowSnoozed = strings.ToLower(input.ShowSnoozed)
+		if input.ShowSnoozed != ShowSnoozedOnly && input.ShowSnoozed != ShowSnoozedInclude && input.ShowSnoozed != ShowSnoozedExclude {
+			return nil, platform.ErrInvalidInput
+		}
+	}
+
 	inputs := listQueryInput{
-		emailType: input.Type,
-		year:      input.Year,
-		month:     input.Month,
-		order:     input.Order,
-		showTrash: input.ShowTrash,
-		pageSize:  input.PageSize,
+		emailType:    input.Type,
+		year:         input.Year,
+		month:        input.Month,
+		order:        input.Order,
+		showTrash:    input.ShowTrash,
+		showArchived: input.ShowArchived,
+		showSnoozed:  input.ShowSnoozed,
+		pageSize:     input.PageSize,
 	}
 
 	if input.NextCursor != nil && len(input.NextCursor.LastEvaluatedKey) > 0 {
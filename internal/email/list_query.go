@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -20,6 +21,8 @@ type listQueryInput struct {
 	month            string
 	order            string
 	showTrash        string
+	showArchived     string
+	showSnoozed      string
 	pageSize         int32
 	lastEvaluatedKey map[string]dynamodbTypes.AttributeValue
 }
@@ -60,11 +63,27 @@ func listByYearMonth(ctx context.Context, client platform.QueryAPI, input listQu
 		Limit:            limit,
 		ScanIndexForward: aws.Bool(false), // reverse order
 	}
+	var filters []string
 	switch input.showTrash {
 	case ShowTrashExclude:
-		queryInput.FilterExpression = aws.String("attribute_not_exists(TrashedTime)")
+		filters = append(filters, "attribute_not_exists(TrashedTime)")
 	case ShowTrashOnly:
-		queryInput.FilterExpression = aws.String("attribute_exists(TrashedTime)")
+		filters = append(filters, "attribute_exists(TrashedTime)")
+	}
+	switch input.showArchived {
+	case ShowArchivedExclude:
+		filters = append(filters, "attribute_not_exists(ArchivedTime)")
+	case ShowArchivedOnly:
+		filters = append(filters, "attribute_exists(ArchivedTime)")
+	}
+	switch input.showSnoozed {
+	case ShowSnoozedExclude:
+		filters = append(filters, "attribute_not_exists(SnoozedUntil)")
+	case ShowSnoozedOnly:
+		filters = append(filters, "attribute_exists(SnoozedUntil)")
+	}
+	if len(filters) > 0 {
+		queryInput.FilterExpression = aws.String(strings.Join(filters, " AND "))
 	}
 
 	resp, err := client.Query(ctx, queryInput)
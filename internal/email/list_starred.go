@@ -0,0 +1,114 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// ListStarredInput represents the input of ListStarred method
+type ListStarredInput struct {
+	Order      string  `json:"order"`    // asc or desc (default), by the time items are starred
+	PageSize   int32   `json:"pageSize"` // 0 means no limit, default is 100
+	NextCursor *Cursor `json:"nextCursor"`
+}
+
+// ListStarredResult represents the result of ListStarred method
+type ListStarredResult struct {
+	Count      int           `json:"count"`
+	Items      []StarredItem `json:"items"`
+	NextCursor *Cursor       `json:"nextCursor"`
+	HasMore    bool          `json:"hasMore"`
+}
+
+// StarredItem is a starred email or thread
+type StarredItem struct {
+	MessageID   string   `json:"messageID"`
+	Type        string   `json:"type"` // inbox, draft, sent or thread
+	Subject     string   `json:"subject"`
+	From        []string `json:"from,omitempty"`
+	To          []string `json:"to,omitempty"`
+	Unread      *bool    `json:"unread,omitempty"`
+	ThreadID    string   `json:"threadID,omitempty"`
+	StarredTime string   `json:"starredTime"`
+}
+
+// starredQueryType is the type of cursors returned by ListStarred
+const starredQueryType = "starred"
+
+// ListStarred lists starred emails and threads across all months, using the starred index.
+// Trashed items are not listed.
+func ListStarred(ctx context.Context, client platform.QueryAPI, input ListStarredInput) (*ListStarredResult, error) {
+	if input.Order == "" {
+		input.Order = "desc"
+	}
+	if input.Order != "asc" && input.Order != "desc" {
+		return nil, platform.ErrInvalidInput
+	}
+
+	var lastEvaluatedKey map[string]dynamodbTypes.AttributeValue
+	if input.NextCursor != nil && len(input.NextCursor.LastEvaluatedKey) > 0 {
+		if input.NextCursor.QueryInfo.Type != starredQueryType || input.NextCursor.QueryInfo.Order != input.Order {
+			return nil, platform.ErrQueryNotMatch
+		}
+		lastEvaluatedKey = input.NextCursor.LastEvaluatedKey
+	}
+
+	var limit *int32
+	if input.PageSize > 0 {
+		limit = aws.Int32(input.PageSize)
+	}
+	resp, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              &env.TableName,
+		IndexName:              &env.GsiStarredIndexName,
+		ExclusiveStartKey:      lastEvaluatedKey,
+		KeyConditionExpression: aws.String("StarredKey = :key"),
+		FilterExpression:       aws.String("attribute_not_exists(TrashedTime)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":key": &dynamodbTypes.AttributeValueMemberS{Value: StarredKey},
+		},
+		Limit:            limit,
+		ScanIndexForward: aws.Bool(input.Order == "asc"),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, platform.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	var rawItems []struct {
+		StarredItem
+		TypeYearMonth string
+	}
+	err = unmarshalListOfMaps(resp.Items, &rawItems)
+	if err != nil {
+		fmt.Printf("unmarshal failed: %v\n", err)
+		return nil, err
+	}
+	items := make([]StarredItem, len(rawItems))
+	for i, raw := range rawItems {
+		items[i] = raw.StarredItem
+		items[i].Type, _, _ = strings.Cut(raw.TypeYearMonth, "#")
+	}
+
+	result := &ListStarredResult{
+		Count:   len(items),
+		Items:   items,
+		HasMore: len(resp.LastEvaluatedKey) > 0,
+	}
+	if result.HasMore {
+		result.NextCursor = &Cursor{
+			QueryInfo:        QueryInfo{Type: starredQueryType, Order: input.Order},
+			LastEvaluatedKey: resp.LastEvaluatedKey,
+		}
+	}
+	return result, nil
+}
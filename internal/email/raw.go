@@ -0,0 +1,102 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/jhillyerd/enmime/v2"
+)
+
+// GetRaw returns the raw MIME of an email.
+// Only received emails are stored as raw MIME, so for draft and sent emails, it's built from the stored attributes.
+func GetRaw(ctx context.Context, api platform.GetItemContentAPI, result *GetResult) ([]byte, error) {
+	raw, err := storage.S3.GetEmailRaw(ctx, api, result.MessageID)
+	if err == nil {
+		return raw, nil
+	}
+	if apiErr := new(s3Types.NoSuchKey); !errors.As(err, &apiErr) || result.Type == model.EmailTypeInbox {
+		return nil, err
+	}
+	return BuildMIME(result)
+}
+
+// BuildMIME builds the MIME message of an email from its attributes
+func BuildMIME(result *GetResult) ([]byte, error) {
+	var errs []error
+	builder := enmime.Builder().Subject(result.Subject)
+
+	if len(result.From) == 0 {
+		errs = append(errs, platform.ErrInvalidInput)
+	} else if from, err := mail.ParseAddress(result.From[0]); err == nil {
+		builder = builder.From(from.Name, from.Address)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse from address: %v", err))
+	}
+
+	if to, err := convertToMailAddresses(result.To); err == nil {
+		builder = builder.ToAddrs(to)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse to address: %v", err))
+	}
+	if cc, err := convertToMailAddresses(result.Cc); err == nil {
+		builder = builder.CCAddrs(cc)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse cc address: %v", err))
+	}
+	if bcc, err := convertToMailAddresses(result.Bcc); err == nil {
+		builder = builder.BCCAddrs(bcc)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse bcc address: %v", err))
+	}
+	if replyTo, err := convertToMailAddresses(result.ReplyTo); err == nil {
+		builder = builder.ReplyToAddrs(replyTo)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse reply-to address: %v", err))
+	}
+
+	// the time of the email is either received, sent, or last updated time depending on its type
+	for _, t := range []string{result.TimeReceived, result.TimeSent, result.TimeUpdated} {
+		if date, err := time.Parse(time.RFC3339, t); err == nil {
+			builder = builder.Date(date)
+			break
+		}
+	}
+	if result.OriginalMessageID != "" {
+		builder = builder.Header("Message-ID", result.OriginalMessageID)
+	}
+	if result.InReplyTo != "" {
+		builder = builder.Header("In-Reply-To", result.InReplyTo)
+	}
+	if result.References != "" {
+		builder = builder.Header("References", result.References)
+	}
+	if result.Text != "" || result.HTML == "" {
+		builder = builder.Text([]byte(result.Text))
+	}
+	if result.HTML != "" {
+		builder = builder.HTML([]byte(result.HTML))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	part, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	writer := bytes.NewBuffer(nil)
+	err = part.Encode(writer)
+	if err != nil {
+		return nil, err
+	}
+	return writer.Bytes(), nil
+}
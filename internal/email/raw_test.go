@@ -0,0 +1,68 @@
+package email
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockGetObjectAPI func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+
+func (m mockGetObjectAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestGetRaw(t *testing.T) {
+	notFound := mockGetObjectAPI(func(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		return nil, &s3Types.NoSuchKey{}
+	})
+
+	raw, err := GetRaw(context.TODO(), notFound, &GetResult{
+		MessageID: "sent-id",
+		Type:      model.EmailTypeSent,
+		Subject:   "subject",
+		From:      []string{"Sender <sender@example.com>"},
+		To:        []string{"me@example.com"},
+		TimeSent:  "2023-01-01T10:00:00Z",
+		Text:      "text",
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, string(raw), "Subject: subject")
+	assert.Contains(t, string(raw), "Date: Sun, 01 Jan 2023 10:00:00 +0000")
+
+	_, err = GetRaw(context.TODO(), notFound, &GetResult{MessageID: "inbox-id", Type: model.EmailTypeInbox})
+	assert.IsType(t, &s3Types.NoSuchKey{}, err, "inbox emails must have raw MIME")
+}
+
+func TestBuildMIME(t *testing.T) {
+	raw, err := BuildMIME(&GetResult{
+		OriginalMessageID: "<id@example.com>",
+		Subject:           "subject",
+		From:              []string{"sender@example.com"},
+		To:                []string{"to@example.com"},
+		Cc:                []string{"cc@example.com"},
+		ReplyTo:           []string{"reply@example.com"},
+		InReplyTo:         "<parent@example.com>",
+		References:        "<parent@example.com>",
+		TimeUpdated:       "2023-01-01T10:00:00Z",
+		HTML:              "<p>html</p>",
+	})
+	assert.Nil(t, err)
+	for _, header := range []string{
+		"Message-Id: <id@example.com>", "Cc: <cc@example.com>", "Reply-To: <reply@example.com>",
+		"In-Reply-To: <parent@example.com>", "References: <parent@example.com>", "Content-Type: text/html",
+	} {
+		assert.True(t, strings.Contains(string(raw), header), header)
+	}
+
+	_, err = BuildMIME(&GetResult{To: []string{"to@example.com"}})
+	assert.ErrorIs(t, err, platform.ErrInvalidInput)
+	_, err = BuildMIME(&GetResult{From: []string{"sender@example.com"}, To: []string{"invalid"}})
+	assert.NotNil(t, err)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
@@ -18,9 +20,32 @@ const (
 	ActionUnread = "unread"
 )
 
-// Read marks an email as read or unread
-func Read(ctx context.Context, client platform.UpdateItemAPI, messageID, action string) error {
-	input := &dynamodb.UpdateItemInput{
+// Read marks an email as read or unread.
+// If the email is in a thread, UnreadCount of the thread is updated in the same transaction.
+func Read(ctx context.Context, client platform.ReadEmailAPI, messageID, action string) error {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("ThreadID"),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	var threadID string
+	if id, ok := resp.Item["ThreadID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+		threadID = id.Value
+	}
+	return read(ctx, client, messageID, threadID, action)
+}
+
+// read marks an email in the thread, or not in any thread if threadID is empty, as read or unread
+func read(ctx context.Context, client platform.ReadEmailAPI, messageID, threadID, action string) error {
+	update := &dynamodbTypes.Update{
 		TableName: aws.String(env.TableName),
 		Key: map[string]dynamodbTypes.AttributeValue{
 			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
@@ -29,18 +54,41 @@ func Read(ctx context.Context, client platform.UpdateItemAPI, messageID, action
 			":v_type": &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeInbox},
 		},
 	}
+	delta := -1
 	if action == ActionRead {
-		input.UpdateExpression = aws.String("REMOVE Unread")
-		input.ConditionExpression = aws.String("attribute_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
+		update.UpdateExpression = aws.String("REMOVE Unread")
+		update.ConditionExpression = aws.String("attribute_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
+	} else {
+		delta = 1
+		update.UpdateExpression = aws.String("SET Unread = :val1")
+		update.ConditionExpression = aws.String("attribute_not_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
+		update.ExpressionAttributeValues[":val1"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+	}
+	// the email must not be moved to another thread meanwhile
+	if threadID == "" {
+		update.ConditionExpression = aws.String(*update.ConditionExpression + " AND attribute_not_exists(ThreadID)")
 	} else {
-		input.UpdateExpression = aws.String("SET Unread = :val1")
-		input.ConditionExpression = aws.String("attribute_not_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
-		input.ExpressionAttributeValues[":val1"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		update.ConditionExpression = aws.String(*update.ConditionExpression + " AND ThreadID = :threadID")
+		update.ExpressionAttributeValues[":threadID"] = &dynamodbTypes.AttributeValueMemberS{Value: threadID}
 	}
 
-	_, err := client.UpdateItem(ctx, input)
+	items := []dynamodbTypes.TransactWriteItem{{Update: update}}
+	if threadID != "" {
+		items = append(items, dynamodbTypes.TransactWriteItem{Update: unreadCountUpdate(threadID, delta)})
+	}
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if apiErr := new(dynamodbTypes.TransactionCanceledException); errors.As(err, &apiErr) && len(items) == 2 &&
+		len(apiErr.CancellationReasons) == 2 && aws.ToString(apiErr.CancellationReasons[0].Code) == "None" {
+		// UnreadCount of the thread fails its condition, which is fixed by the next thread read or unread
+		fmt.Printf("unread count of thread %s is not updated\n", threadID)
+		_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items[:1],
+		})
+	}
 	if err != nil {
-		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+		if apiErr := new(dynamodbTypes.TransactionCanceledException); errors.As(err, &apiErr) {
 			return platform.ErrReadActionFailed
 		}
 		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
@@ -50,6 +98,33 @@ func Read(ctx context.Context, client platform.UpdateItemAPI, messageID, action
 		return err
 	}
 
+	hookAction := hook.ActionRead
+	if action != ActionRead {
+		hookAction = hook.ActionUnread
+	}
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hookAction, Email: hook.Email{ID: messageID}})
+
 	fmt.Println("read method finished successfully")
 	return nil
 }
+
+// unreadCountUpdate returns the update to add delta to UnreadCount of a thread, which never goes below zero.
+// Threads created before UnreadCount was introduced fail its condition, so they are not updated.
+func unreadCountUpdate(threadID string, delta int) *dynamodbTypes.Update {
+	update := &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+		UpdateExpression:    aws.String("ADD UnreadCount :delta"),
+		ConditionExpression: aws.String("attribute_exists(UnreadCount)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":delta": &dynamodbTypes.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+		},
+	}
+	if delta < 0 {
+		update.ConditionExpression = aws.String("UnreadCount >= :min")
+		update.ExpressionAttributeValues[":min"] = &dynamodbTypes.AttributeValueMemberN{Value: strconv.Itoa(-delta)}
+	}
+	return update
+}
@@ -3,95 +3,129 @@ package email
 import (
 	"context"
 	"strconv"
-	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/mockutil"
 	"github.com/stretchr/testify/assert"
 )
 
+type mockReadEmailAPI struct {
+	mockutil.MockPublishAPI
+	mockGetItem            mockGetItemAPI
+	mockTransactWriteItems mockutil.MockTransactWriteItemAPI
+}
+
+func (m mockReadEmailAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return m.mockGetItem(ctx, params, optFns...)
+}
+
+func (m mockReadEmailAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return m.mockTransactWriteItems(ctx, params, optFns...)
+}
+
 func TestRead(t *testing.T) {
+	getItem := func(threadID string) mockGetItemAPI {
+		return func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			assert.Equal(t, "exampleMessageID", params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+			item := map[string]dynamodbTypes.AttributeValue{}
+			if threadID != "" {
+				item["ThreadID"] = &dynamodbTypes.AttributeValueMemberS{Value: threadID}
+			}
+			return &dynamodb.GetItemOutput{Item: item}, nil
+		}
+	}
 	tests := []struct {
-		client      func(t *testing.T) platform.UpdateItemAPI
+		client      func(t *testing.T) platform.ReadEmailAPI
 		messageID   string
 		action      string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					assert.Len(t, params.Key, 1)
-					assert.IsType(t, params.Key["MessageID"], &dynamodbTypes.AttributeValueMemberS{})
-					assert.Equal(t,
-						params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value,
-						"exampleMessageID",
-					)
-
-					assert.Equal(t, "REMOVE Unread", strings.TrimSpace(*params.UpdateExpression))
-					assert.Equal(t, "attribute_exists(Unread) AND begins_with(TypeYearMonth, :v_type)",
-						*params.ConditionExpression)
-
-					return &dynamodb.UpdateItemOutput{}, nil
-				})
+			client: func(t *testing.T) platform.ReadEmailAPI {
+				return mockReadEmailAPI{
+					mockGetItem: getItem(""),
+					mockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+						t.Helper()
+						assert.Len(t, params.TransactItems, 1)
+						update := params.TransactItems[0].Update
+						assert.Equal(t, "exampleMessageID", update.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+						assert.Equal(t, "REMOVE Unread", *update.UpdateExpression)
+						assert.Equal(t, "attribute_exists(Unread) AND begins_with(TypeYearMonth, :v_type) AND attribute_not_exists(ThreadID)",
+							*update.ConditionExpression)
+						return &dynamodb.TransactWriteItemsOutput{}, nil
+					},
+				}
 			},
 			messageID: "exampleMessageID",
 			action:    ActionRead,
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					assert.Len(t, params.Key, 1)
-					assert.IsType(t, params.Key["MessageID"], &dynamodbTypes.AttributeValueMemberS{})
-					assert.Equal(t,
-						params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value,
-						"exampleMessageID",
-					)
-
-					assert.Contains(t, *params.UpdateExpression, "=")
-					updateExpressionParts := strings.Split(*params.UpdateExpression, "=")
-					assert.Equal(t, "SET Unread", strings.TrimSpace(updateExpressionParts[0]))
-					assert.Contains(t, params.ExpressionAttributeValues, strings.TrimSpace(updateExpressionParts[1]))
+			client: func(t *testing.T) platform.ReadEmailAPI {
+				return mockReadEmailAPI{
+					mockGetItem: getItem("exampleThreadID"),
+					mockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+						t.Helper()
+						assert.Len(t, params.TransactItems, 2)
+						update := params.TransactItems[0].Update
+						assert.Equal(t, "SET Unread = :val1", *update.UpdateExpression)
+						assert.Equal(t, "attribute_not_exists(Unread) AND begins_with(TypeYearMonth, :v_type) AND ThreadID = :threadID",
+							*update.ConditionExpression)
 
-					assert.Equal(t, "attribute_not_exists(Unread) AND begins_with(TypeYearMonth, :v_type)",
-						*params.ConditionExpression)
-
-					return &dynamodb.UpdateItemOutput{}, nil
-				})
+						update = params.TransactItems[1].Update
+						assert.Equal(t, "exampleThreadID", update.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+						assert.Equal(t, "ADD UnreadCount :delta", *update.UpdateExpression)
+						assert.Equal(t, "1", update.ExpressionAttributeValues[":delta"].(*dynamodbTypes.AttributeValueMemberN).Value)
+						return &dynamodb.TransactWriteItemsOutput{}, nil
+					},
+				}
 			},
 			messageID: "exampleMessageID",
 			action:    ActionUnread,
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					return &dynamodb.UpdateItemOutput{}, &dynamodbTypes.ConditionalCheckFailedException{}
-				})
+			client: func(t *testing.T) platform.ReadEmailAPI {
+				return mockReadEmailAPI{
+					mockGetItem: getItem(""),
+					mockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+						t.Helper()
+						return nil, &dynamodbTypes.TransactionCanceledException{
+							CancellationReasons: []dynamodbTypes.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}},
+						}
+					},
+				}
 			},
-			messageID:   "",
+			messageID:   "exampleMessageID",
 			expectedErr: platform.ErrReadActionFailed,
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					return &dynamodb.UpdateItemOutput{}, platform.ErrNotFound
-				})
+			client: func(t *testing.T) platform.ReadEmailAPI {
+				return mockReadEmailAPI{
+					mockGetItem: getItem(""),
+					mockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+						t.Helper()
+						return nil, platform.ErrNotFound
+					},
+				}
 			},
-			messageID:   "",
+			messageID:   "exampleMessageID",
 			expectedErr: platform.ErrNotFound,
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					return &dynamodb.UpdateItemOutput{}, &dynamodbTypes.ProvisionedThroughputExceededException{}
-				})
+			client: func(t *testing.T) platform.ReadEmailAPI {
+				return mockReadEmailAPI{
+					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						t.Helper()
+						return nil, &dynamodbTypes.ProvisionedThroughputExceededException{}
+					},
+				}
 			},
+			messageID:   "exampleMessageID",
 			expectedErr: platform.ErrTooManyRequests,
 		},
 	}
@@ -104,3 +138,45 @@ func TestRead(t *testing.T) {
 		})
 	}
 }
+
+func TestRead_Thread(t *testing.T) {
+	env.TableName = "table-for-read-thread-email"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	put := func(item map[string]dynamodbTypes.AttributeValue) {
+		t.Helper()
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(env.TableName), Item: item})
+		assert.Nil(t, err)
+	}
+	unreadCount := func(threadID string) dynamodbTypes.AttributeValue {
+		return client.Item(env.TableName, threadID)["UnreadCount"]
+	}
+	for _, id := range []string{"inbox-1", "inbox-2"} {
+		put(map[string]dynamodbTypes.AttributeValue{
+			"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: id},
+			"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2023-02"},
+			"ThreadID":      &dynamodbTypes.AttributeValueMemberS{Value: "thread-" + id},
+			"Unread":        &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+		})
+	}
+	put(map[string]dynamodbTypes.AttributeValue{
+		"MessageID":   &dynamodbTypes.AttributeValueMemberS{Value: "thread-inbox-1"},
+		"UnreadCount": &dynamodbTypes.AttributeValueMemberN{Value: "1"},
+	})
+	// created before UnreadCount is introduced
+	put(map[string]dynamodbTypes.AttributeValue{
+		"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "thread-inbox-2"},
+	})
+
+	assert.Nil(t, Read(ctx, client, "inbox-1", ActionRead))
+	assert.Equal(t, &dynamodbTypes.AttributeValueMemberN{Value: "0"}, unreadCount("thread-inbox-1"))
+	assert.Equal(t, platform.ErrReadActionFailed, Read(ctx, client, "inbox-1", ActionRead), "the count isn't changed twice")
+	assert.Equal(t, &dynamodbTypes.AttributeValueMemberN{Value: "0"}, unreadCount("thread-inbox-1"))
+	assert.Nil(t, Read(ctx, client, "inbox-1", ActionUnread))
+	assert.Equal(t, &dynamodbTypes.AttributeValueMemberN{Value: "1"}, unreadCount("thread-inbox-1"))
+
+	assert.Nil(t, Read(ctx, client, "inbox-2", ActionRead), "the email is read without the count")
+	assert.Nil(t, unreadCount("thread-inbox-2"))
+	assert.NotContains(t, client.Item(env.TableName, "inbox-2"), "Unread")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
@@ -52,6 +53,8 @@ func Reparse(ctx context.Context, client platform.ReparseEmailAPI, messageID str
 		return err
 	}
 
-	fmt.Println("read method finished successfully")
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionReparsed, Email: hook.Email{ID: messageID}})
+
+	fmt.Println("reparse method finished successfully")
 	return nil
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/harryzcy/mailbox/internal/util/format"
@@ -114,7 +115,13 @@ func Save(ctx context.Context, client platform.SaveAndSendEmailAPI, input SaveIn
 
 	emailType := model.EmailTypeDraft
 	messageID := input.MessageID
-	if input.Send {
+	if !input.Send {
+		hook.Notify(ctx, client, &hook.Hook{
+			Event:  hook.EventDraft,
+			Action: hook.ActionSaved,
+			Email:  hook.Email{ID: messageID, ThreadID: extraFields["ThreadID"]},
+		})
+	} else {
 		email := &Input{
 			MessageID:  messageID,
 			Subject:    input.Subject,
@@ -25,6 +25,7 @@ var (
 )
 
 type mockSaveEmailAPI struct {
+	mockutil.MockPublishAPI
 	mockGetItem           mockGetItemAPI
 	mockPutItem           func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
 	mockTransactWriteItem mockutil.MockTransactWriteItemAPI
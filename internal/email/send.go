@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	sesTypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/harryzcy/mailbox/internal/util/format"
@@ -196,6 +197,15 @@ func markEmailAsSent(ctx context.Context, client platform.SendEmailAPI, oldMessa
 		}
 		return err
 	}
+	hook.Notify(ctx, client, &hook.Hook{
+		Event:  hook.EventEmail,
+		Action: hook.ActionSent,
+		Email:  hook.Email{ID: email.MessageID, ThreadID: email.ThreadID},
+	})
+	if email.InReplyTo != "" {
+		hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUpdated, Thread: hook.Thread{ID: email.ThreadID}})
+	}
+
 	fmt.Println("email marked as sent successfully")
 	return nil
 }
@@ -17,6 +17,7 @@ import (
 )
 
 type mockSendEmailAPI struct {
+	mockutil.MockPublishAPI
 	mockGetItem           mockGetItemAPI
 	mockTransactWriteItem mockutil.MockTransactWriteItemAPI
 	mockSendEmail         func(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
@@ -0,0 +1,101 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// SnoozeKey is the partition key of every snoozed email and thread in the snooze index, sorted by SnoozedUntil.
+// Emails snoozed together with their thread don't have SnoozeKey, since they're woken with the thread.
+const SnoozeKey = "snoozed"
+
+// Snooze hides a received email from List until the time, when it's woken by thread.Wake.
+// Snoozing a snoozed email changes the time.
+// It returns ErrInvalidInput if the time isn't in the future, or the email is trashed or isn't received.
+func Snooze(ctx context.Context, client platform.GetEmailAPI, messageID string, until time.Time) error {
+	if !until.After(now()) {
+		return platform.ErrInvalidInput
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("SET SnoozedUntil = :snoozedUntil, SnoozeKey = :snoozeKey REMOVE SnoozedByThread"),
+		ConditionExpression: aws.String("attribute_not_exists(TrashedTime) AND begins_with(TypeYearMonth, :v_type)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":snoozedUntil": &dynamodbTypes.AttributeValueMemberS{Value: until.UTC().Format(time.RFC3339)},
+			":snoozeKey":    &dynamodbTypes.AttributeValueMemberS{Value: SnoozeKey},
+			":v_type":       &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeInbox + "#"},
+		},
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return snoozeError(ctx, client, messageID)
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionSnoozed, Email: hook.Email{ID: messageID}})
+
+	fmt.Println("snooze method finished successfully")
+	return nil
+}
+
+// snoozeError returns the error of a snooze failing its condition,
+// which is ErrNotFound if the email doesn't exist, or ErrInvalidInput since it's trashed or isn't received
+func snoozeError(ctx context.Context, client platform.GetItemAPI, messageID string) error {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("MessageID"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Item) == 0 {
+		return platform.ErrNotFound
+	}
+	return platform.ErrInvalidInput
+}
+
+// Unsnooze shows a snoozed email again without waking it, so it's neither marked unread nor moved
+func Unsnooze(ctx context.Context, client platform.UpdateEmailAPI, messageID string) error {
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("REMOVE SnoozedUntil, SnoozeKey, SnoozedByThread"),
+		ConditionExpression: aws.String("attribute_exists(SnoozedUntil)"),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return &platform.NotSnoozedError{Type: "email"}
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionUnsnoozed, Email: hook.Email{ID: messageID}})
+
+	fmt.Println("unsnooze method finished successfully")
+	return nil
+}
@@ -0,0 +1,69 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnooze(t *testing.T) {
+	env.TableName = "table-for-snooze"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiSnoozeIndexName = "SnoozeIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	for _, e := range [][2]string{{"inbox-1", "inbox"}, {"inbox-2", "inbox"}, {"sent-1", "sent"}} {
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(env.TableName),
+			Item: map[string]dynamodbTypes.AttributeValue{
+				"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: e[0]},
+				"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: e[1] + "#2023-02"},
+				"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "01-00:00:00"},
+			},
+		})
+		assert.Nil(t, err)
+	}
+	list := func(showSnoozed string) []string {
+		t.Helper()
+		result, err := List(ctx, client, ListInput{Type: "inbox", Year: "2023", Month: "2", ShowSnoozed: showSnoozed})
+		assert.Nil(t, err)
+		var ids []string
+		for _, item := range result.Items {
+			ids = append(ids, item.MessageID)
+		}
+		return ids
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	assert.Nil(t, Snooze(ctx, client, "inbox-1", until))
+	result, err := Get(ctx, client, "inbox-1")
+	assert.Nil(t, err)
+	assert.Equal(t, until.Format(time.RFC3339), result.SnoozedUntil)
+	assert.False(t, result.SnoozedByThread)
+
+	assert.Equal(t, []string{"inbox-2"}, list(""))
+	assert.Equal(t, []string{"inbox-2", "inbox-1"}, list(ShowSnoozedInclude))
+	assert.Equal(t, []string{"inbox-1"}, list("ONLY"))
+	_, err = List(ctx, client, ListInput{Type: "inbox", Year: "2023", Month: "2", ShowSnoozed: "all"})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+
+	assert.Equal(t, platform.ErrInvalidInput, Snooze(ctx, client, "inbox-2", time.Now().Add(-time.Minute)))
+	assert.Equal(t, platform.ErrInvalidInput, Snooze(ctx, client, "sent-1", until), "only received emails are snoozed")
+	assert.Equal(t, platform.ErrNotFound, Snooze(ctx, client, "missing", until))
+
+	assert.Nil(t, Unsnooze(ctx, client, "inbox-1"))
+	assert.Equal(t, &platform.NotSnoozedError{Type: "email"}, Unsnooze(ctx, client, "inbox-1"))
+	assert.Equal(t, []string{"inbox-2", "inbox-1"}, list(ShowSnoozedExclude))
+
+	assert.Nil(t, Trash(ctx, client, "inbox-2"))
+	assert.Equal(t, platform.ErrInvalidInput, Snooze(ctx, client, "inbox-2", until), "trashed emails aren't snoozed")
+}
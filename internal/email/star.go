@@ -0,0 +1,81 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// StarredKey is the partition key of every starred email and thread in the starred index.
+// The index is sparse, since StarredKey is only set on starred items.
+const StarredKey = "starred"
+
+// Star marks an email as starred. Starring a starred email keeps its StarredTime.
+func Star(ctx context.Context, client platform.UpdateEmailAPI, messageID string) error {
+	err := UpdateStarred(ctx, client, messageID, true, "NOT begins_with(TypeYearMonth, :v_type)")
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionStarred, Email: hook.Email{ID: messageID}})
+
+	fmt.Println("star method finished successfully")
+	return nil
+}
+
+// Unstar marks an email as not starred
+func Unstar(ctx context.Context, client platform.UpdateEmailAPI, messageID string) error {
+	err := UpdateStarred(ctx, client, messageID, false, "NOT begins_with(TypeYearMonth, :v_type)")
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionUnstarred, Email: hook.Email{ID: messageID}})
+
+	fmt.Println("unstar method finished successfully")
+	return nil
+}
+
+// UpdateStarred stars or unstars an email or a thread, which must satisfy condition.
+// The condition may use :v_type, the prefix of TypeYearMonth of threads.
+// Starred items are in the starred index by StarredKey and StarredTime.
+func UpdateStarred(ctx context.Context, client platform.UpdateItemAPI, messageID string, starred bool, condition string) error {
+	values := map[string]dynamodbTypes.AttributeValue{
+		":v_type": &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeThread + "#"},
+	}
+	expression := "REMOVE Starred, StarredKey, StarredTime"
+	if starred {
+		expression = "SET Starred = :true, StarredKey = :starredKey, StarredTime = if_not_exists(StarredTime, :starredTime)"
+		values[":true"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		values[":starredKey"] = &dynamodbTypes.AttributeValueMemberS{Value: StarredKey}
+		values[":starredTime"] = &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("attribute_exists(TypeYearMonth) AND " + condition),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return platform.ErrNotFound
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package email
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStar(t *testing.T) {
+	env.TableName = "table-for-star"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiStarredIndexName = "StarredIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	for _, e := range [][2]string{{"inbox-1", "inbox"}, {"thread-1", "thread"}} {
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(env.TableName),
+			Item: map[string]dynamodbTypes.AttributeValue{
+				"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: e[0]},
+				"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: e[1] + "#2023-02"},
+				"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "01-00:00:00"},
+			},
+		})
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, Star(ctx, client, "inbox-1"))
+	result, err := Get(ctx, client, "inbox-1")
+	assert.Nil(t, err)
+	assert.True(t, result.Starred)
+	starred, err := ListStarred(ctx, client, ListStarredInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, starred.Count)
+	starredTime := starred.Items[0].StarredTime
+	assert.NotEmpty(t, starredTime)
+
+	// starring again keeps the time it's first starred
+	assert.Nil(t, Star(ctx, client, "inbox-1"))
+	starred, err = ListStarred(ctx, client, ListStarredInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, starredTime, starred.Items[0].StarredTime)
+
+	assert.Equal(t, platform.ErrNotFound, Star(ctx, client, "missing"))
+	assert.Equal(t, platform.ErrNotFound, Star(ctx, client, "thread-1"), "threads are starred by thread.Star")
+
+	assert.Nil(t, Unstar(ctx, client, "inbox-1"))
+	result, err = Get(ctx, client, "inbox-1")
+	assert.Nil(t, err)
+	assert.False(t, result.Starred)
+	starred, err = ListStarred(ctx, client, ListStarredInput{})
+	assert.Nil(t, err)
+	assert.Empty(t, starred.Items)
+	assert.Equal(t, platform.ErrNotFound, Unstar(ctx, client, "missing"))
+}
+
+func TestListStarred(t *testing.T) {
+	env.TableName = "table-for-list-starred"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiStarredIndexName = "StarredIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	for _, e := range [][3]string{
+		{"inbox-1", "inbox#2023-01", "2023-03-02T00:00:00Z"},
+		{"thread-1", "thread#2022-12", "2023-03-01T00:00:00Z"},
+		{"sent-1", "sent#2023-02", "2023-03-03T00:00:00Z"},
+		{"inbox-2", "inbox#2023-02", ""},
+		{"inbox-3", "inbox#2023-02", "2023-03-04T00:00:00Z"},
+	} {
+		item := map[string]dynamodbTypes.AttributeValue{
+			"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: e[0]},
+			"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: e[1]},
+			"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "01-00:00:00"},
+			"Subject":       &dynamodbTypes.AttributeValueMemberS{Value: "subject " + e[0]},
+		}
+		if e[2] != "" {
+			item["Starred"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+			item["StarredKey"] = &dynamodbTypes.AttributeValueMemberS{Value: StarredKey}
+			item["StarredTime"] = &dynamodbTypes.AttributeValueMemberS{Value: e[2]}
+		}
+		if e[0] == "inbox-3" {
+			item["TrashedTime"] = &dynamodbTypes.AttributeValueMemberS{Value: "2023-03-05T00:00:00Z"}
+		}
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(env.TableName), Item: item})
+		assert.Nil(t, err)
+	}
+	list := func(input ListStarredInput) ([]string, *ListStarredResult) {
+		t.Helper()
+		result, err := ListStarred(ctx, client, input)
+		assert.Nil(t, err)
+		var ids []string
+		for _, item := range result.Items {
+			ids = append(ids, item.Type+" "+item.MessageID)
+		}
+		return ids, result
+	}
+
+	ids, _ := list(ListStarredInput{})
+	assert.Equal(t, []string{"sent sent-1", "inbox inbox-1", "thread thread-1"}, ids)
+
+	ids, result := list(ListStarredInput{Order: "asc", PageSize: 2})
+	assert.Equal(t, []string{"thread thread-1", "inbox inbox-1"}, ids)
+	assert.True(t, result.HasMore)
+	ids, result = list(ListStarredInput{Order: "asc", PageSize: 2, NextCursor: result.NextCursor})
+	assert.Equal(t, []string{"sent sent-1"}, ids)
+	assert.Equal(t, "subject sent-1", result.Items[0].Subject)
+
+	_, err := ListStarred(ctx, client, ListStarredInput{Order: "desc", NextCursor: &Cursor{
+		QueryInfo:        QueryInfo{Type: "starred", Order: "asc"},
+		LastEvaluatedKey: map[string]dynamodbTypes.AttributeValue{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "inbox-1"}},
+	}})
+	assert.Equal(t, platform.ErrQueryNotMatch, err)
+	_, err = ListStarred(ctx, client, ListStarredInput{Order: "random"})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+}
@@ -10,12 +10,13 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
 // Trash marks an email as trashed
-func Trash(ctx context.Context, client platform.UpdateItemAPI, messageID string) error {
+func Trash(ctx context.Context, client platform.UpdateEmailAPI, messageID string) error {
 	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]dynamodbTypes.AttributeValue{
@@ -39,6 +40,8 @@ func Trash(ctx context.Context, client platform.UpdateItemAPI, messageID string)
 		return err
 	}
 
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionTrashed, Email: hook.Email{ID: messageID}})
+
 	fmt.Println("trash method finished successfully")
 	return nil
 }
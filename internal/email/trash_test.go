@@ -8,7 +8,9 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/mockutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,14 +20,31 @@ func (m mockUpdateItemAPI) UpdateItem(ctx context.Context, params *dynamodb.Upda
 	return m(ctx, params, optFns...)
 }
 
+func (m mockUpdateItemAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return mockutil.MockPublishAPI{}.GetItem(ctx, params, optFns...)
+}
+
+func (m mockUpdateItemAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return mockutil.MockPublishAPI{}.PutItem(ctx, params, optFns...)
+}
+
+//revive:disable:var-naming
+func (m mockUpdateItemAPI) GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return mockutil.MockPublishAPI{}.GetQueueUrl(ctx, params, optFns...)
+}
+
+func (m mockUpdateItemAPI) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	return mockutil.MockPublishAPI{}.SendMessage(ctx, params, optFns...)
+}
+
 func TestTrash(t *testing.T) {
 	tests := []struct {
-		client      func(t *testing.T) platform.UpdateItemAPI
+		client      func(t *testing.T) platform.UpdateEmailAPI
 		messageID   string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
+			client: func(t *testing.T) platform.UpdateEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					assert.Len(t, params.Key, 1)
@@ -49,7 +68,7 @@ func TestTrash(t *testing.T) {
 			messageID: "exampleMessageID",
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
+			client: func(t *testing.T) platform.UpdateEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, &types.ConditionalCheckFailedException{}
@@ -59,7 +78,7 @@ func TestTrash(t *testing.T) {
 			expectedErr: &platform.NotTrashedError{Type: "email"},
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
+			client: func(t *testing.T) platform.UpdateEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, platform.ErrNotFound
@@ -9,18 +9,19 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
 // Untrash marks an trashed email as not trashed
-func Untrash(ctx context.Context, client platform.UpdateItemAPI, messageID string) error {
+func Untrash(ctx context.Context, client platform.UpdateEmailAPI, messageID string) error {
 	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]dynamodbTypes.AttributeValue{
 			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
 		},
-		UpdateExpression:    aws.String("REMOVE TrashedTime"),
+		UpdateExpression:    aws.String("REMOVE TrashedTime, TrashedByThread"),
 		ConditionExpression: aws.String("attribute_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :v_type)"),
 		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
 			":v_type": &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeDraft},
@@ -38,6 +39,8 @@ func Untrash(ctx context.Context, client platform.UpdateItemAPI, messageID strin
 		return err
 	}
 
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionUntrashed, Email: hook.Email{ID: messageID}})
+
 	fmt.Println("untrash method finished successfully")
 	return nil
 }
@@ -13,12 +13,12 @@ import (
 
 func TestUntrash(t *testing.T) {
 	tests := []struct {
-		client      func(t *testing.T) platform.UpdateItemAPI
+		client      func(t *testing.T) platform.UpdateEmailAPI
 		messageID   string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
+			client: func(t *testing.T) platform.UpdateEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					assert.Len(t, params.Key, 1)
@@ -27,7 +27,7 @@ func TestUntrash(t *testing.T) {
 						params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value,
 						"exampleMessageID",
 					)
-					assert.Equal(t, "REMOVE TrashedTime", *params.UpdateExpression)
+					assert.Equal(t, "REMOVE TrashedTime, TrashedByThread", *params.UpdateExpression)
 					assert.Equal(t, "attribute_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :v_type)",
 						*params.ConditionExpression)
 
@@ -37,7 +37,7 @@ func TestUntrash(t *testing.T) {
 			messageID: "exampleMessageID",
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
+			client: func(t *testing.T) platform.UpdateEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, &dynamodbTypes.ConditionalCheckFailedException{}
@@ -47,7 +47,7 @@ func TestUntrash(t *testing.T) {
 			expectedErr: &platform.NotTrashedError{Type: "email"},
 		},
 		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
+			client: func(t *testing.T) platform.UpdateEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, platform.ErrNotFound
@@ -9,8 +9,46 @@ var (
 	TableName            = os.Getenv("DYNAMODB_TABLE")
 	GsiOriginalIndexName = os.Getenv("DYNAMODB_ORIGINAL_INDEX")
 	GsiIndexName         = os.Getenv("DYNAMODB_TIME_INDEX")
+	GsiStarredIndexName  = os.Getenv("DYNAMODB_STARRED_INDEX")
+	GsiSnoozeIndexName   = os.Getenv("DYNAMODB_SNOOZE_INDEX")
 	S3Bucket             = os.Getenv("S3_BUCKET")
 	QueueName            = os.Getenv("SQS_QUEUE")
 
+	// EventPayload is the level of details in event payloads, either "id" (default), "summary" or "full"
+	EventPayload = os.Getenv("EVENT_PAYLOAD")
+	// EventSource is the source of CloudEvents, "/mailbox" by default
+	EventSource = os.Getenv("EVENT_SOURCE")
+	// QueueFormat is the format of events sent to QueueName, either "hook" (default), "cloudevents" or "cloudevents-binary"
+	QueueFormat = os.Getenv("SQS_FORMAT")
+
+	// Threading is a comma separated list of the stages matching incoming emails to threads,
+	// from "in-reply-to", "references" and "subject", and "in-reply-to,references" by default
+	Threading = os.Getenv("THREADING")
+	// ThreadingWindow is how far back the subject stage looks for emails, as a Go duration, "336h" by default
+	ThreadingWindow = os.Getenv("THREADING_WINDOW")
+
+	// Retention is a JSON object of the days to keep trashed, junk and received emails before they're deleted,
+	// e.g. {"trash": 30, "junk": 14}, where a missing or zero value keeps them forever
+	Retention = os.Getenv("RETENTION")
+
+	// ExportQueueName is the SQS queue processing export jobs
+	ExportQueueName = os.Getenv("EXPORT_QUEUE")
+
+	// StorageBackend selects where raw emails are stored, either "s3" (default) or "filesystem"
+	StorageBackend = os.Getenv("STORAGE_BACKEND")
+	// StorageDir is the root directory of the filesystem storage backend
+	StorageDir = os.Getenv("STORAGE_DIR")
+
 	WebhookURL = os.Getenv("WEBHOOK_URL")
+	// Webhooks is a JSON array of webhook endpoints, each with its own secret and events
+	Webhooks = os.Getenv("WEBHOOKS")
+	// WebhookQueueName is the SQS queue delivering and retrying webhooks (optional)
+	WebhookQueueName = os.Getenv("WEBHOOK_QUEUE")
+	// Notifiers is a JSON array of Slack, Discord and Matrix notifiers of received emails
+	Notifiers = os.Getenv("NOTIFIERS")
+
+	// VAPIDPrivateKey is the base64url encoded private key of Web Push, which is disabled if it's empty
+	VAPIDPrivateKey = os.Getenv("VAPID_PRIVATE_KEY")
+	// VAPIDSubject is the contact of the application server sent to push services, e.g. mailto:admin@example.com
+	VAPIDSubject = os.Getenv("VAPID_SUBJECT")
 )
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+)
+
+// Destination is where exported files are written to
+type Destination interface {
+	// Put writes a file, replacing the existing one
+	Put(ctx context.Context, key string, data []byte) error
+	// Mkdir creates a directory, it's a no-op if directories are not supported
+	Mkdir(ctx context.Context, key string) error
+}
+
+// ParseDestination returns the destination of a location,
+// which is either s3://bucket/prefix or a local directory
+func ParseDestination(location string, api storage.S3PutObjectAPI) Destination {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		return &S3Destination{API: api, Bucket: bucket, Prefix: prefix}
+	}
+	return Dir(location)
+}
+
+// Dir is a local directory
+type Dir string
+
+// Put writes a file atomically, by writing to a temporary file first
+func (d Dir) Put(_ context.Context, key string, data []byte) error {
+	name := filepath.Join(string(d), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name()) // no-op after a successful rename
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Mkdir creates a directory and its parents
+func (d Dir) Mkdir(_ context.Context, key string) error {
+	return os.MkdirAll(filepath.Join(string(d), filepath.FromSlash(key)), 0o700)
+}
+
+// S3Destination is a prefix in a S3 bucket
+type S3Destination struct {
+	API    storage.S3PutObjectAPI
+	Bucket string
+	Prefix string
+}
+
+// Put writes an object
+func (d *S3Destination) Put(ctx context.Context, key string, data []byte) error {
+	key = path.Join(d.Prefix, key)
+	_, err := d.API.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &d.Bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// Mkdir is a no-op, since S3 doesn't have directories
+func (d *S3Destination) Mkdir(_ context.Context, _ string) error {
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package export exports emails in bulk, as mbox files or a Maildir tree.
+//
+// An export is split into units of one email type and one month.
+// Each unit is written independently, so an interrupted export can be resumed from its Progress.
+package export
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Supported export formats
+const (
+	FormatMbox    = "mbox"
+	FormatMaildir = "maildir"
+)
+
+const yearMonthLayout = "2006-01"
+
+// Input represents what to export
+type Input struct {
+	Types        []string `json:"types"`        // inbox, sent or draft (default is inbox and sent)
+	Start        string   `json:"start"`        // first month to export, in YYYY-MM
+	End          string   `json:"end"`          // last month to export, in YYYY-MM (default is current month)
+	Format       string   `json:"format"`       // mbox (default) or maildir
+	IncludeTrash bool     `json:"includeTrash"` // whether trashed emails are exported
+}
+
+// Progress represents how much of an export is done
+type Progress struct {
+	Completed int      `json:"completed"`        // number of completed units
+	Total     int      `json:"total"`            // number of units
+	Exported  int      `json:"exported"`         // number of exported emails
+	Failed    []string `json:"failed,omitempty"` // IDs of emails that can't be exported
+	Done      bool     `json:"done"`
+}
+
+// unit is an email type and a month, which is exported at once
+type unit struct {
+	emailType string
+	yearMonth time.Time
+}
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// Validate checks the input and fills in the default values
+func (input *Input) Validate() error {
+	if len(input.Types) == 0 {
+		input.Types = []string{model.EmailTypeInbox, model.EmailTypeSent}
+	}
+	for _, t := range input.Types {
+		if t != model.EmailTypeInbox && t != model.EmailTypeSent && t != model.EmailTypeDraft {
+			return platform.ErrInvalidInput
+		}
+	}
+
+	if input.Format == "" {
+		input.Format = FormatMbox
+	}
+	input.Format = strings.ToLower(input.Format)
+	if input.Format != FormatMbox && input.Format != FormatMaildir {
+		return platform.ErrInvalidInput
+	}
+
+	if input.End == "" {
+		input.End = now().UTC().Format(yearMonthLayout)
+	}
+	start, err := time.Parse(yearMonthLayout, input.Start)
+	if err != nil {
+		return platform.ErrInvalidInput
+	}
+	end, err := time.Parse(yearMonthLayout, input.End)
+	if err != nil || end.Before(start) {
+		return platform.ErrInvalidInput
+	}
+	return nil
+}
+
+// units returns the units of a validated input, in the order they are exported
+func (input Input) units() []unit {
+	start, _ := time.Parse(yearMonthLayout, input.Start)
+	end, _ := time.Parse(yearMonthLayout, input.End)
+
+	var units []unit
+	for _, t := range input.Types {
+		for month := start; !month.After(end); month = month.AddDate(0, 1, 0) {
+			units = append(units, unit{emailType: t, yearMonth: month})
+		}
+	}
+	return units
+}
+
+// Run exports the emails selected by input to dest, starting after the units completed in progress.
+// checkpoint is called after each unit, so that progress can be persisted.
+// If ctx is done before the export completes, ctx.Err() is returned and the export can be resumed with the same progress.
+func Run(ctx context.Context, client platform.ExportEmailAPI, dest Destination, input Input, progress *Progress, checkpoint func(*Progress) error) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	units := input.units()
+	progress.Total = len(units)
+	for progress.Completed < len(units) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		u := units[progress.Completed]
+		exported, failed, err := exportUnit(ctx, client, dest, input, u)
+		if err != nil {
+			return err
+		}
+
+		progress.Completed++
+		progress.Exported += exported
+		progress.Failed = append(progress.Failed, failed...)
+		if err = checkpoint(progress); err != nil {
+			return err
+		}
+	}
+
+	progress.Done = true
+	return checkpoint(progress)
+}
+
+// exportUnit exports all emails of a unit, and returns the number of exported emails and the IDs of failed emails
+func exportUnit(ctx context.Context, client platform.ExportEmailAPI, dest Destination, input Input, u unit) (int, []string, error) {
+	fmt.Printf("exporting %s emails of %s\n", u.emailType, u.yearMonth.Format(yearMonthLayout))
+
+	showTrash := email.ShowTrashExclude
+	if input.IncludeTrash {
+		showTrash = email.ShowTrashInclude
+	}
+
+	var ids []string
+	cursor := &email.Cursor{}
+	for {
+		result, err := email.List(ctx, client, email.ListInput{
+			Type:      u.emailType,
+			Year:      u.yearMonth.Format("2006"),
+			Month:     u.yearMonth.Format("01"),
+			ShowTrash: showTrash,
+			// archived and snoozed emails are exported like the others
+			ShowArchived: email.ShowArchivedInclude,
+			ShowSnoozed:  email.ShowSnoozedInclude,
+			PageSize:     email.DefaultPageSize,
+			NextCursor:   cursor,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, item := range result.Items {
+			ids = append(ids, item.MessageID)
+		}
+		if !result.HasMore {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	// emails are listed from the latest, and exported from the earliest
+	slices.Reverse(ids)
+
+	w := newWriter(input.Format, dest, u)
+	exported := 0
+	var failed []string
+	for _, id := range ids {
+		msg, err := getMessage(ctx, client, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, nil, ctx.Err()
+			}
+			fmt.Printf("failed to get email %s: %v\n", id, err)
+			failed = append(failed, id)
+			continue
+		}
+		if err = w.write(ctx, msg); err != nil {
+			return 0, nil, err
+		}
+		exported++
+	}
+
+	if err := w.close(ctx); err != nil {
+		return 0, nil, err
+	}
+	return exported, failed, nil
+}
+
+// getMessage gets an email and its raw MIME
+func getMessage(ctx context.Context, client platform.ExportEmailAPI, messageID string) (*message, error) {
+	result, err := email.Get(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := email.GetRaw(ctx, client, result)
+	if err != nil {
+		return nil, err
+	}
+
+	var t time.Time
+	for _, value := range []string{result.TimeReceived, result.TimeSent, result.TimeUpdated} {
+		if t, err = time.Parse(time.RFC3339, value); err == nil {
+			break
+		}
+	}
+
+	return &message{
+		id:        result.MessageID,
+		emailType: result.Type,
+		raw:       raw,
+		time:      t,
+		unread:    result.Unread != nil && *result.Unread,
+		trashed:   result.TrashedTime != "",
+	}, nil
+}
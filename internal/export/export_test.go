@@ -0,0 +1,226 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEnv() {
+	env.TableName = "table-for-export"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiOriginalIndexName = "OriginalMessageIDIndex"
+	env.S3Bucket = "bucket-for-export"
+	env.ExportQueueName = "queue-for-export"
+	now = func() time.Time { return time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC) }
+}
+
+func putEmail(t *testing.T, client *memory.Client, messageID, typeYearMonth, dateTime string, attributes map[string]dynamodbTypes.AttributeValue, raw string) {
+	t.Helper()
+	item := map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+		"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: dateTime},
+		"Subject":       &dynamodbTypes.AttributeValueMemberS{Value: "Subject of " + messageID},
+		"From":          &dynamodbTypes.AttributeValueMemberSS{Value: []string{"sender@example.com"}},
+		"To":            &dynamodbTypes.AttributeValueMemberSS{Value: []string{"me@example.com"}},
+		"Text":          &dynamodbTypes.AttributeValueMemberS{Value: "Body of " + messageID},
+	}
+	for k, v := range attributes {
+		item[k] = v
+	}
+	_, err := client.PutItem(context.TODO(), &dynamodb.PutItemInput{TableName: &env.TableName, Item: item})
+	assert.Nil(t, err)
+
+	if raw != "" {
+		_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket: &env.S3Bucket,
+			Key:    &messageID,
+			Body:   strings.NewReader(raw),
+		})
+		assert.Nil(t, err)
+	}
+}
+
+func setupMailbox(t *testing.T) *memory.Client {
+	client := memory.NewClient()
+	putEmail(t, client, "inbox-1", "inbox#2023-01", "01-10:00:00", map[string]dynamodbTypes.AttributeValue{
+		"Unread": &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+	}, "From: sender@example.com\r\nSubject: one\r\n\r\nFrom here on\r\n>From quoted\r\n")
+	putEmail(t, client, "inbox-2", "inbox#2023-01", "02-10:00:00", map[string]dynamodbTypes.AttributeValue{
+		"Unread":      &dynamodbTypes.AttributeValueMemberBOOL{Value: false},
+		"TrashedTime": &dynamodbTypes.AttributeValueMemberS{Value: "2023-01-03T00:00:00Z"},
+	}, "From: sender@example.com\r\nSubject: two\r\n\r\nbody\r\n")
+	putEmail(t, client, "inbox-3", "inbox#2023-03", "01-10:00:00", nil, "") // raw email is missing
+	putEmail(t, client, "sent-1", "sent#2023-02", "01-10:00:00", map[string]dynamodbTypes.AttributeValue{
+		"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "<sent-1@example.com>"},
+	}, "")
+	return client
+}
+
+func TestInput_Validate(t *testing.T) {
+	setupEnv()
+
+	input := Input{Start: "2023-01"}
+	assert.Nil(t, input.Validate())
+	assert.Equal(t, Input{Types: []string{"inbox", "sent"}, Start: "2023-01", End: "2023-03", Format: FormatMbox}, input)
+	assert.Len(t, input.units(), 6)
+
+	for _, input := range []Input{
+		{},
+		{Start: "2023-1"},
+		{Start: "2023-02", End: "2023-01"},
+		{Start: "2023-01", Types: []string{"thread"}},
+		{Start: "2023-01", Format: "pst"},
+	} {
+		assert.Equal(t, platform.ErrInvalidInput, input.Validate())
+	}
+}
+
+func TestRun_Mbox(t *testing.T) {
+	setupEnv()
+	client := setupMailbox(t)
+	dir := t.TempDir()
+
+	progress := &Progress{}
+	checkpoints := 0
+	err := Run(context.TODO(), client, Dir(dir), Input{Start: "2023-01", IncludeTrash: true}, progress, func(*Progress) error {
+		checkpoints++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &Progress{Completed: 6, Total: 6, Exported: 3, Failed: []string{"inbox-3"}, Done: true}, progress)
+	assert.Equal(t, 7, checkpoints)
+
+	data, err := os.ReadFile(filepath.Join(dir, "inbox", "2023-01.mbox"))
+	assert.Nil(t, err)
+	mbox := string(data)
+	assert.Equal(t, 2, strings.Count(mbox, "From MAILER-DAEMON "))
+	assert.True(t, strings.HasPrefix(mbox, "From MAILER-DAEMON Sun Jan  1 10:00:00 2023\nStatus: O\n"), mbox)
+	assert.Contains(t, mbox, "\n>From here on\n>>From quoted\n\n")
+	assert.Contains(t, mbox, "Status: RO\nX-Status: D\nFrom: sender@example.com\nSubject: two\n")
+	assert.NotContains(t, mbox, "\r")
+
+	data, err = os.ReadFile(filepath.Join(dir, "sent", "2023-02.mbox"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "Message-Id: <sent-1@example.com>")
+	assert.Contains(t, string(data), "Body of sent-1")
+
+	_, err = os.Stat(filepath.Join(dir, "sent", "2023-01.mbox"))
+	assert.True(t, os.IsNotExist(err), "empty months are not written")
+}
+
+func TestRun_Maildir(t *testing.T) {
+	setupEnv()
+	client := setupMailbox(t)
+	dir := t.TempDir()
+
+	progress := &Progress{}
+	err := Run(context.TODO(), client, Dir(dir), Input{Start: "2023-01", End: "2023-02", Format: FormatMaildir}, progress, func(*Progress) error {
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, progress.Exported, "trashed email is excluded")
+
+	for _, folder := range []string{"", ".Sent"} {
+		for _, sub := range []string{"cur", "new", "tmp"} {
+			info, err := os.Stat(filepath.Join(dir, folder, sub))
+			assert.Nil(t, err)
+			assert.True(t, info.IsDir())
+		}
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "cur", "1672567200.inbox-1.mailbox:2,"))
+	assert.Nil(t, err)
+	assert.Equal(t, "From: sender@example.com\r\nSubject: one\r\n\r\nFrom here on\r\n>From quoted\r\n", string(raw))
+	_, err = os.Stat(filepath.Join(dir, ".Sent", "cur", "1675245600.sent-1.mailbox:2,S"))
+	assert.Nil(t, err)
+}
+
+func TestRun_Resume(t *testing.T) {
+	setupEnv()
+	client := setupMailbox(t)
+	dir := t.TempDir()
+	input := Input{Start: "2023-01", End: "2023-02", Types: []string{"inbox"}, IncludeTrash: true}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	progress := &Progress{}
+	err := Run(ctx, client, Dir(dir), input, progress, func(*Progress) error {
+		cancel() // interrupted after the first month
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, &Progress{Completed: 1, Total: 2, Exported: 2}, progress)
+
+	err = Run(context.TODO(), client, Dir(dir), input, progress, func(*Progress) error { return nil })
+	assert.Nil(t, err)
+	assert.Equal(t, &Progress{Completed: 2, Total: 2, Exported: 2, Done: true}, progress)
+}
+
+func TestJob(t *testing.T) {
+	setupEnv()
+	client := setupMailbox(t)
+	ctx := context.TODO()
+
+	_, err := CreateJob(ctx, client, Input{})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+
+	job, err := CreateJob(ctx, client, Input{Start: "2023-01", End: "2023-02"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(job.ID, JobIDPrefix))
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, "s3://bucket-for-export/exports/"+job.ID, job.Location)
+	messages := client.Messages(env.ExportQueueName)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, job.ID, *messages[0].Body)
+
+	// paused jobs are enqueued again
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = RunJob(canceled, client, job.ID)
+	assert.Nil(t, err)
+	assert.Len(t, client.Messages(env.ExportQueueName), 2)
+	got, err := GetJob(ctx, client, job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusRunning, got.Status)
+
+	err = RunJob(ctx, client, job.ID)
+	assert.Nil(t, err)
+	got, err = GetJob(ctx, client, job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusDone, got.Status)
+	assert.Equal(t, Progress{Completed: 4, Total: 4, Exported: 2, Done: true}, got.Progress)
+	assert.Equal(t, job.Input, got.Input)
+
+	_, ok := client.Object(env.S3Bucket, "exports/"+job.ID+"/inbox/2023-01.mbox")
+	assert.True(t, ok)
+	_, ok = client.Object(env.S3Bucket, "exports/"+job.ID+"/sent/2023-02.mbox")
+	assert.True(t, ok)
+
+	_, err = GetJob(ctx, client, "inbox-1")
+	assert.Equal(t, ErrJobNotFound, err)
+	_, err = GetJob(ctx, client, JobIDPrefix+"unknown")
+	assert.Equal(t, ErrJobNotFound, err)
+}
+
+func TestParseDestination(t *testing.T) {
+	client := memory.NewClient()
+	assert.Equal(t, Dir("./mail"), ParseDestination("./mail", client))
+	assert.Equal(t, &S3Destination{API: client, Bucket: "bucket", Prefix: "a/b"}, ParseDestination("s3://bucket/a/b", client))
+
+	dest := ParseDestination("s3://bucket/prefix", client)
+	assert.Nil(t, dest.Put(context.TODO(), "inbox/2023-01.mbox", []byte("mbox")))
+	data, ok := client.Object("bucket", "prefix/inbox/2023-01.mbox")
+	assert.True(t, ok)
+	assert.Equal(t, "mbox", string(data))
+}
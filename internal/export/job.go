@@ -0,0 +1,186 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Status of an export job
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+const (
+	// JobIDPrefix is the prefix of export job IDs, which are stored alongside emails
+	JobIDPrefix = "export-"
+	// KeyPrefix is the prefix of S3 keys written by export jobs
+	KeyPrefix = "exports/"
+)
+
+// ErrJobNotFound is returned when the export job doesn't exist
+var ErrJobNotFound = errors.New("export job not found")
+
+// Job is an asynchronous export, run by functions/emailExport
+type Job struct {
+	ID          string   `json:"id" dynamodbav:"MessageID"`
+	Input       Input    `json:"input"`
+	Status      string   `json:"status"`
+	Progress    Progress `json:"progress"`
+	Location    string   `json:"location"` // s3://bucket/prefix where exported files are written
+	Error       string   `json:"error,omitempty" dynamodbav:",omitempty"`
+	TimeCreated string   `json:"timeCreated"`
+	TimeUpdated string   `json:"timeUpdated"`
+}
+
+// CreateJob creates an export job and enqueues it
+func CreateJob(ctx context.Context, client platform.CreateExportAPI, input Input) (*Job, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	id := JobIDPrefix + strings.ReplaceAll(uuid.NewString(), "-", "")
+	t := now().UTC().Format(time.RFC3339)
+	job := &Job{
+		ID:          id,
+		Input:       input,
+		Status:      StatusPending,
+		Location:    "s3://" + env.S3Bucket + "/" + KeyPrefix + id,
+		TimeCreated: t,
+		TimeUpdated: t,
+	}
+	if err := saveJob(ctx, client, job, "attribute_not_exists(MessageID)"); err != nil {
+		return nil, err
+	}
+	if err := enqueueJob(ctx, client, id); err != nil {
+		return nil, err
+	}
+
+	fmt.Println("export job created:", id)
+	return job, nil
+}
+
+// GetJob returns an export job
+func GetJob(ctx context.Context, client platform.GetItemAPI, id string) (*Job, error) {
+	if !strings.HasPrefix(id, JobIDPrefix) {
+		return nil, ErrJobNotFound
+	}
+
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, platform.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	job := new(Job)
+	if err = attributevalue.UnmarshalMap(resp.Item, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RunJob runs an export job until it's done or ctx is done.
+// In the latter case, the progress is saved and the job is enqueued again to be continued.
+func RunJob(ctx context.Context, client platform.RunExportAPI, id string) error {
+	job, err := GetJob(ctx, client, id)
+	if err != nil {
+		return err
+	}
+	if job.Status == StatusDone || job.Status == StatusFailed {
+		fmt.Printf("export job %s is already %s\n", id, job.Status)
+		return nil
+	}
+
+	// saving progress must succeed even when ctx is done
+	saveCtx := context.WithoutCancel(ctx)
+	job.Status = StatusRunning
+	if err = saveJob(saveCtx, client, job, ""); err != nil {
+		return err
+	}
+
+	dest := &S3Destination{API: client, Bucket: env.S3Bucket, Prefix: KeyPrefix + id}
+	err = Run(ctx, client, dest, job.Input, &job.Progress, func(*Progress) error {
+		return saveJob(saveCtx, client, job, "")
+	})
+	switch {
+	case err == nil:
+		job.Status = StatusDone
+		fmt.Printf("export job %s done, %d emails exported\n", id, job.Progress.Exported)
+		return saveJob(saveCtx, client, job, "")
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		fmt.Printf("export job %s paused at %d/%d\n", id, job.Progress.Completed, job.Progress.Total)
+		return enqueueJob(saveCtx, client, id)
+	case errors.Is(err, platform.ErrInvalidInput):
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		return saveJob(saveCtx, client, job, "")
+	default:
+		// the job is retried from its progress
+		return err
+	}
+}
+
+func saveJob(ctx context.Context, client platform.PutItemAPI, job *Job, condition string) error {
+	job.TimeUpdated = now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item:      item,
+	}
+	if condition != "" {
+		input.ConditionExpression = aws.String(condition)
+	}
+	_, err = client.PutItem(ctx, input)
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// enqueueJob sends the job ID to the export queue
+func enqueueJob(ctx context.Context, client platform.SQSSendMessageAPI, id string) error {
+	result, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: &env.ExportQueueName,
+	})
+	if err != nil {
+		fmt.Println("Failed to get queue url")
+		return err
+	}
+
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		MessageBody: aws.String(id),
+		QueueUrl:    result.QueueUrl,
+	})
+	return err
+}
@@ -0,0 +1,132 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/model"
+)
+
+// message is an email to be exported
+type message struct {
+	id        string
+	emailType string
+	raw       []byte
+	time      time.Time
+	unread    bool
+	trashed   bool
+}
+
+// writer writes the emails of a unit
+type writer interface {
+	write(ctx context.Context, msg *message) error
+	// close is called after all emails of the unit are written
+	close(ctx context.Context) error
+}
+
+func newWriter(format string, dest Destination, u unit) writer {
+	if format == FormatMaildir {
+		return &maildirWriter{dest: dest, folder: maildirFolder(u.emailType)}
+	}
+	return &mboxWriter{
+		dest: dest,
+		key:  path.Join(u.emailType, u.yearMonth.Format(yearMonthLayout)+".mbox"),
+	}
+}
+
+// mboxWriter writes a unit to a single mbox file, in mboxrd format.
+// Flags are stored in Status and X-Status headers, as understood by most mail clients.
+type mboxWriter struct {
+	dest Destination
+	key  string
+	buf  bytes.Buffer
+}
+
+var fromLineRegex = regexp.MustCompile(`(?m)^(>*From )`)
+
+func (w *mboxWriter) write(_ context.Context, msg *message) error {
+	w.buf.WriteString("From MAILER-DAEMON " + msg.time.UTC().Format(time.ANSIC) + "\n")
+
+	status := "O"
+	if !msg.unread {
+		status = "RO"
+	}
+	w.buf.WriteString("Status: " + status + "\n")
+	if msg.trashed {
+		w.buf.WriteString("X-Status: D\n")
+	}
+
+	body := strings.ReplaceAll(string(msg.raw), "\r\n", "\n")
+	body = fromLineRegex.ReplaceAllString(body, ">$1")
+	w.buf.WriteString(body)
+	if !strings.HasSuffix(body, "\n") {
+		w.buf.WriteByte('\n')
+	}
+	w.buf.WriteByte('\n')
+	return nil
+}
+
+func (w *mboxWriter) close(ctx context.Context) error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	return w.dest.Put(ctx, w.key, w.buf.Bytes())
+}
+
+// maildirWriter writes each email as a file in a Maildir++ folder.
+// File names only depend on the email, so a resumed export overwrites the same files.
+type maildirWriter struct {
+	dest    Destination
+	folder  string
+	created bool
+}
+
+// maildirFolder returns the Maildir++ folder of an email type, inbox emails are at the root
+func maildirFolder(emailType string) string {
+	switch emailType {
+	case model.EmailTypeSent:
+		return ".Sent"
+	case model.EmailTypeDraft:
+		return ".Drafts"
+	}
+	return ""
+}
+
+func (w *maildirWriter) write(ctx context.Context, msg *message) error {
+	if !w.created {
+		for _, dir := range []string{"cur", "new", "tmp"} {
+			if err := w.dest.Mkdir(ctx, path.Join(w.folder, dir)); err != nil {
+				return err
+			}
+		}
+		w.created = true
+	}
+
+	return w.dest.Put(ctx, path.Join(w.folder, "cur", maildirFilename(msg)), msg.raw)
+}
+
+func (w *maildirWriter) close(_ context.Context) error {
+	return nil
+}
+
+// maildirFilename returns the file name of an email, with flags in alphabetical order
+func maildirFilename(msg *message) string {
+	flags := ""
+	if msg.emailType == model.EmailTypeDraft {
+		flags += "D"
+	}
+	if !msg.unread {
+		flags += "S"
+	}
+	if msg.trashed {
+		flags += "T"
+	}
+
+	id := strings.NewReplacer("/", "_", ":", "_").Replace(msg.id)
+	return strconv.FormatInt(msg.time.Unix(), 10) + "." + id + ".mailbox:2," + flags
+}
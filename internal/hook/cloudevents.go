@@ -0,0 +1,137 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Formats of events, selectable per webhook endpoint and for SQS
+const (
+	// FormatHook sends the Hook as JSON (default)
+	FormatHook = "hook"
+	// FormatCloudEvents sends a CloudEvent in structured mode, i.e. the event with its attributes as JSON
+	FormatCloudEvents = "cloudevents"
+	// FormatCloudEventsBinary sends the Hook as JSON, with the attributes of the CloudEvent as headers or message attributes
+	FormatCloudEventsBinary = "cloudevents-binary"
+)
+
+const (
+	// CloudEventsSpecVersion is the version of the CloudEvents specification
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsContentType is the content type of CloudEvents in structured mode
+	CloudEventsContentType = "application/cloudevents+json"
+	// cloudEventsTypePrefix is prepended to "event.action" to make the type of CloudEvents
+	cloudEventsTypePrefix = "mailbox."
+	// defaultEventSource is the source of CloudEvents if env.EventSource isn't set
+	defaultEventSource = "/mailbox"
+	// cloudEventsPrefix is the prefix of CloudEvents attributes in binary mode
+	cloudEventsPrefix = "ce-"
+)
+
+// CloudEvent is an event in the CloudEvents 1.0 format, whose data is the Hook
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"` // e.g. mailbox.email.received
+	Source          string          `json:"source"`
+	ID              string          `json:"id"`
+	Time            string          `json:"time,omitempty"`
+	Subject         string          `json:"subject,omitempty"` // ID of the email or thread
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// validFormat returns true if format is a known format, or empty for the default
+func validFormat(format string) bool {
+	switch format {
+	case "", FormatHook, FormatCloudEvents, FormatCloudEventsBinary:
+		return true
+	default:
+		return false
+	}
+}
+
+// newEventID returns a unique ID of an event, shared by all its destinations
+func newEventID() string {
+	return uuid.NewString()
+}
+
+// eventSource returns the source of CloudEvents
+func eventSource() string {
+	if env.EventSource != "" {
+		return env.EventSource
+	}
+	return defaultEventSource
+}
+
+// NewCloudEvent returns the CloudEvent with the ID, whose data is the JSON encoded Hook
+func NewCloudEvent(id string, payload []byte) (*CloudEvent, error) {
+	h := new(Hook)
+	if err := json.Unmarshal(payload, h); err != nil {
+		return nil, fmt.Errorf("invalid hook payload: %w", err)
+	}
+	subject := h.Email.ID
+	if h.Event == EventThread {
+		subject = h.Thread.ID
+	}
+	return &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		Type:            cloudEventsTypePrefix + h.Name(),
+		Source:          eventSource(),
+		ID:              id,
+		Time:            h.Timestamp,
+		Subject:         subject,
+		DataContentType: "application/json",
+		Data:            payload,
+	}, nil
+}
+
+// Attributes returns the context attributes, without data, as used in binary mode with the "ce-" prefix
+func (e *CloudEvent) Attributes() map[string]string {
+	attributes := map[string]string{
+		"specversion": e.SpecVersion,
+		"type":        e.Type,
+		"source":      e.Source,
+		"id":          e.ID,
+	}
+	if e.Time != "" {
+		attributes["time"] = e.Time
+	}
+	if e.Subject != "" {
+		attributes["subject"] = e.Subject
+	}
+	return attributes
+}
+
+// encodeEvent returns the body and the content type of an event in the format,
+// and the attributes (without the "ce-" prefix) to send along with it in binary mode
+func encodeEvent(format, id string, payload []byte) ([]byte, string, map[string]string, error) {
+	if !validFormat(format) {
+		return nil, "", nil, fmt.Errorf("unknown event format %q", format)
+	}
+	if format == "" || format == FormatHook {
+		return payload, "application/json", nil, nil
+	}
+	event, err := NewCloudEvent(id, payload)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if format == FormatCloudEventsBinary {
+		return payload, event.DataContentType, event.Attributes(), nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return body, CloudEventsContentType, nil, nil
+}
+
+// setCloudEventsHeaders sets the attributes of binary mode as headers
+func setCloudEventsHeaders(header http.Header, attributes map[string]string) {
+	for name, value := range attributes {
+		header.Set(cloudEventsPrefix+name, value)
+	}
+}
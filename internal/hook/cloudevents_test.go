@@ -0,0 +1,169 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCloudEvent(t *testing.T) {
+	env.EventSource = ""
+	payload := []byte(`{"event":"thread","action":"created","timestamp":"2023-01-01T00:00:00Z","Thread":{"id":"thread-1"}}`)
+	event, err := NewCloudEvent("event-1", payload)
+	assert.Nil(t, err)
+	assert.Equal(t, &CloudEvent{
+		SpecVersion:     "1.0",
+		Type:            "mailbox.thread.created",
+		Source:          "/mailbox",
+		ID:              "event-1",
+		Time:            "2023-01-01T00:00:00Z",
+		Subject:         "thread-1",
+		DataContentType: "application/json",
+		Data:            payload,
+	}, event)
+
+	env.EventSource = "https://mail.example.com"
+	defer func() { env.EventSource = "" }()
+	event, err = NewCloudEvent("event-1", []byte(`{"event":"email","action":"read","Email":{"id":"123"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "https://mail.example.com", event.Source)
+	assert.Equal(t, "123", event.Subject)
+	assert.Equal(t, map[string]string{
+		"specversion": "1.0",
+		"type":        "mailbox.email.read",
+		"source":      "https://mail.example.com",
+		"id":          "event-1",
+		"subject":     "123",
+	}, event.Attributes())
+
+	_, err = NewCloudEvent("event-1", []byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestEncodeEvent(t *testing.T) {
+	payload := []byte(`{"event":"email","action":"received","timestamp":"2023-01-01T00:00:00Z","Email":{"id":"123"}}`)
+
+	for _, format := range []string{"", FormatHook} {
+		body, contentType, attributes, err := encodeEvent(format, "event-1", payload)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, body)
+		assert.Equal(t, "application/json", contentType)
+		assert.Nil(t, attributes)
+	}
+
+	body, contentType, attributes, err := encodeEvent(FormatCloudEvents, "event-1", payload)
+	assert.Nil(t, err)
+	assert.Equal(t, CloudEventsContentType, contentType)
+	assert.Nil(t, attributes)
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"type": "mailbox.email.received",
+		"source": "/mailbox",
+		"id": "event-1",
+		"time": "2023-01-01T00:00:00Z",
+		"subject": "123",
+		"datacontenttype": "application/json",
+		"data": {"event": "email", "action": "received", "timestamp": "2023-01-01T00:00:00Z", "Email": {"id": "123"}}
+	}`, string(body))
+
+	body, contentType, attributes, err = encodeEvent(FormatCloudEventsBinary, "event-1", payload)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, body)
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, "mailbox.email.received", attributes["type"])
+	assert.Equal(t, "event-1", attributes["id"])
+
+	_, _, _, err = encodeEvent("xml", "event-1", payload)
+	assert.Error(t, err)
+}
+
+func TestSendWebhook_CloudEvents(t *testing.T) {
+	setupWebhookEnv()
+	requests := map[string]*http.Request{}
+	bodies := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requests[req.URL.Path] = req
+		bodies[req.URL.Path] = body
+	}))
+	defer server.Close()
+	env.Webhooks = `[
+		{"id": "hook", "url": "` + server.URL + `/hook"},
+		{"id": "structured", "url": "` + server.URL + `/structured", "format": "cloudevents", "secret": "secret"},
+		{"id": "binary", "url": "` + server.URL + `/binary", "format": "cloudevents-binary"}
+	]`
+
+	h := &Hook{Event: EventEmail, Action: ActionReceived, Timestamp: "2023-01-01T00:00:00Z", Email: Email{ID: "123"}}
+	err := SendWebhook(context.Background(), memory.NewClient(), h)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, h.ID)
+
+	assert.Equal(t, "application/json", requests["/hook"].Header.Get("Content-Type"))
+	assert.Empty(t, requests["/hook"].Header.Get("ce-id"))
+
+	structured := requests["/structured"]
+	assert.Equal(t, CloudEventsContentType, structured.Header.Get("Content-Type"))
+	event := new(CloudEvent)
+	assert.Nil(t, json.Unmarshal(bodies["/structured"], event))
+	assert.Equal(t, h.ID, event.ID)
+	assert.Equal(t, "mailbox.email.received", event.Type)
+	assert.JSONEq(t, string(bodies["/hook"]), string(event.Data))
+	assert.Nil(t, VerifySignature("secret", structured.Header.Get(HeaderTimestamp),
+		structured.Header.Get(HeaderSignature), bodies["/structured"], time.Minute))
+
+	binary := requests["/binary"]
+	assert.Equal(t, "application/json", binary.Header.Get("Content-Type"))
+	assert.Equal(t, "1.0", binary.Header.Get("ce-specversion"))
+	assert.Equal(t, "mailbox.email.received", binary.Header.Get("ce-type"))
+	assert.Equal(t, "/mailbox", binary.Header.Get("ce-source"))
+	assert.Equal(t, h.ID, binary.Header.Get("ce-id"))
+	assert.Equal(t, "2023-01-01T00:00:00Z", binary.Header.Get("ce-time"))
+	assert.Equal(t, "123", binary.Header.Get("ce-subject"))
+	assert.Equal(t, bodies["/hook"], bodies["/binary"])
+}
+
+func TestPublish_CloudEventsSQS(t *testing.T) {
+	setupWebhookEnv()
+	env.QueueName = "queue-for-cloudevents"
+	defer func() {
+		env.QueueName = ""
+		env.QueueFormat = ""
+	}()
+	client := memory.NewClient()
+	ctx := context.Background()
+
+	env.QueueFormat = FormatCloudEvents
+	h := &Hook{Event: EventEmail, Action: ActionSent, Email: Email{ID: "123"}}
+	assert.Nil(t, Publish(ctx, client, h))
+	env.QueueFormat = FormatCloudEventsBinary
+	assert.Nil(t, Publish(ctx, client, &Hook{Event: EventEmail, Action: ActionSent, Email: Email{ID: "456"}}))
+
+	messages := client.Messages(env.QueueName)
+	assert.Len(t, messages, 2)
+
+	structured := messages[0]
+	assert.Equal(t, CloudEventsContentType, *structured.MessageAttributes["content-type"].StringValue)
+	assert.Equal(t, "sent", *structured.MessageAttributes["Action"].StringValue)
+	event := new(CloudEvent)
+	assert.Nil(t, json.Unmarshal([]byte(*structured.Body), event))
+	assert.Equal(t, h.ID, event.ID)
+	assert.Equal(t, "mailbox.email.sent", event.Type)
+
+	binary := messages[1]
+	assert.Equal(t, "application/json", *binary.MessageAttributes["content-type"].StringValue)
+	assert.Equal(t, "mailbox.email.sent", *binary.MessageAttributes["ce-type"].StringValue)
+	assert.Equal(t, "456", *binary.MessageAttributes["ce-subject"].StringValue)
+	assert.LessOrEqual(t, len(binary.MessageAttributes), 10, "limit of SQS")
+	assert.Contains(t, *binary.Body, `"id":"456"`)
+
+	env.QueueFormat = "xml"
+	assert.Error(t, Publish(ctx, client, &Hook{Event: EventEmail, Action: ActionSent, Email: Email{ID: "789"}}))
+}
@@ -1,8 +1,34 @@
 package hook
 
+// Events, i.e. the kinds of objects that changed
 const (
-	EventEmail     = "email"
-	ActionReceived = "received"
+	EventEmail  = "email"
+	EventDraft  = "draft"
+	EventThread = "thread"
+)
+
+// Actions, i.e. how the objects changed
+const (
+	ActionReceived   = "received"   // email
+	ActionSent       = "sent"       // email, the ID is of the sent email
+	ActionCreated    = "created"    // draft, thread
+	ActionSaved      = "saved"      // draft
+	ActionUpdated    = "updated"    // thread, when an email or a draft is added
+	ActionRead       = "read"       // email
+	ActionUnread     = "unread"     // email
+	ActionTrashed    = "trashed"    // email, thread
+	ActionUntrashed  = "untrashed"  // email, thread
+	ActionDeleted    = "deleted"    // email, draft, thread
+	ActionReparsed   = "reparsed"   // email
+	ActionArchived   = "archived"   // email, thread
+	ActionUnarchived = "unarchived" // email, thread
+	ActionStarred    = "starred"    // email, thread
+	ActionUnstarred  = "unstarred"  // email, thread
+	ActionSnoozed    = "snoozed"    // email, thread
+	ActionUnsnoozed  = "unsnoozed"  // email, thread
+	ActionWoken      = "woken"      // email, thread, when the snooze time is due
+	ActionMuted      = "muted"      // thread
+	ActionUnmuted    = "unmuted"    // thread
 )
 
 // EmailReceipt contains information needed for an email receipt
@@ -12,12 +38,55 @@ type EmailReceipt struct {
 }
 
 type Hook struct {
+	ID        string `json:"-"` // unique ID of the event, used as the ID of CloudEvents
 	Event     string `json:"event"`
 	Action    string `json:"action"`
 	Timestamp string `json:"timestamp"`
-	Email     Email
+	Email     Email  `json:"Email,omitzero"`  // for email and draft events
+	Thread    Thread `json:"Thread,omitzero"` // for thread events
+}
+
+// Name returns the name of the hook, as "event.action"
+func (h *Hook) Name() string {
+	return h.Event + "." + h.Action
 }
 
 type Email struct {
-	ID string `json:"id"` // message id
+	ID       string `json:"id"` // message id
+	ThreadID string `json:"threadID,omitempty"`
+
+	// Included when the payload level is summary or full
+	Subject     string       `json:"subject,omitempty"`
+	From        []string     `json:"from,omitempty"`
+	To          []string     `json:"to,omitempty"`
+	Snippet     string       `json:"snippet,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Verdict     *Verdict     `json:"verdict,omitempty"`
+
+	// Included when the payload level is full
+	Text string `json:"text,omitempty"`
+	HTML string `json:"html,omitempty"`
+
+	// Truncated is true if the bodies or attachments are cut to keep the payload under the size limit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Attachment is the metadata of an attachment or an inline file
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	ContentID   string `json:"contentID,omitempty"`
+}
+
+// Verdict is the result of the spam, virus and authentication checks of a received email
+type Verdict struct {
+	Spam  bool `json:"spam"`
+	DKIM  bool `json:"dkim"`
+	DMARC bool `json:"dmarc"`
+	SPF   bool `json:"spf"`
+	Virus bool `json:"virus"`
+}
+
+type Thread struct {
+	ID string `json:"id"`
 }
@@ -0,0 +1,304 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Status of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// DeliveryIDPrefix is the prefix of delivery IDs, which are stored alongside emails
+const DeliveryIDPrefix = "webhook-"
+
+// deliveryType is the type of deliveries in TimeIndex, i.e. their TypeYearMonth is webhook#YYYY-MM
+const deliveryType = "webhook"
+
+const (
+	// maxAttempts is the number of attempts before a delivery fails
+	maxAttempts = 6
+	// baseBackoff is the delay before the first retry, doubled for each following retry
+	baseBackoff = 30 * time.Second
+	// maxBackoff is the maximum delay of SQS messages
+	maxBackoff = 15 * time.Minute
+	// maxErrorLength is the maximum length of the response body recorded on failure
+	maxErrorLength = 256
+)
+
+// ErrDeliveryNotFound is returned when the webhook delivery doesn't exist
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// httpClient sends webhook requests, a non-2xx response or a timeout is retried
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Delivery is the record of a webhook sent to an endpoint
+type Delivery struct {
+	ID              string    `json:"id" dynamodbav:"MessageID"`
+	Endpoint        string    `json:"endpoint"`                                  // ID of the endpoint
+	Event           string    `json:"event"`                                     // e.g. email.received
+	EventID         string    `json:"eventID,omitempty" dynamodbav:",omitempty"` // shared by the deliveries of an event
+	Payload         string    `json:"payload,omitempty"`
+	Status          string    `json:"status"`
+	Attempts        int       `json:"attempts"`
+	StatusCode      int       `json:"statusCode,omitempty" dynamodbav:",omitempty"` // of the last attempt
+	Latency         int64     `json:"latency,omitempty" dynamodbav:",omitempty"`    // of the last attempt, in milliseconds
+	Error           string    `json:"error,omitempty" dynamodbav:",omitempty"`      // of the last attempt
+	History         []Attempt `json:"history,omitempty" dynamodbav:",omitempty"`
+	NextAttemptTime string    `json:"nextAttemptTime,omitempty" dynamodbav:",omitempty"`
+	ReplayOf        string    `json:"replayOf,omitempty" dynamodbav:",omitempty"`   // ID of the replayed delivery
+	ReplayedBy      string    `json:"replayedBy,omitempty" dynamodbav:",omitempty"` // ID of the latest replay
+	TimeCreated     string    `json:"timeCreated"`
+	TimeUpdated     string    `json:"timeUpdated"`
+
+	// for TimeIndex, to list deliveries by the time they are created
+	TypeYearMonth string `json:"-"`
+	DateTime      string `json:"-"`
+}
+
+// Attempt is an attempt of a delivery
+type Attempt struct {
+	Time       string `json:"time"`
+	StatusCode int    `json:"statusCode,omitempty" dynamodbav:",omitempty"` // 0 if there's no response
+	Latency    int64  `json:"latency"`                                      // in milliseconds
+	Error      string `json:"error,omitempty" dynamodbav:",omitempty"`
+}
+
+// newDelivery returns a new delivery of a payload to an endpoint, which is not saved yet
+func newDelivery(endpoint Endpoint, event string, payload []byte) *Delivery {
+	t := now().UTC()
+	return &Delivery{
+		ID:            DeliveryIDPrefix + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Endpoint:      endpoint.ID,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        DeliveryPending,
+		TimeCreated:   t.Format(time.RFC3339),
+		TimeUpdated:   t.Format(time.RFC3339),
+		TypeYearMonth: deliveryType + "#" + t.Format("2006-01"),
+		DateTime:      format.DateTime(t),
+	}
+}
+
+// dispatch saves a new delivery and sends it, either through the queue or immediately.
+// Without the queue, a failed attempt is recorded in the delivery and is not an error.
+func dispatch(ctx context.Context, client platform.PublishAPI, endpoint Endpoint, delivery *Delivery) error {
+	if err := saveDelivery(ctx, client, delivery); err != nil {
+		return err
+	}
+	if env.WebhookQueueName != "" {
+		return enqueueDelivery(ctx, client, delivery.ID, 0)
+	}
+	attempt(ctx, endpoint, delivery)
+	return saveDelivery(ctx, client, delivery)
+}
+
+// GetDelivery returns a webhook delivery
+func GetDelivery(ctx context.Context, client platform.GetItemAPI, id string) (*Delivery, error) {
+	if !strings.HasPrefix(id, DeliveryIDPrefix) {
+		return nil, ErrDeliveryNotFound
+	}
+
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, platform.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+
+	delivery := new(Delivery)
+	if err = attributevalue.UnmarshalMap(resp.Item, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Deliver makes an attempt of a queued delivery, and enqueues it again with exponential backoff if the attempt fails.
+// It's called by functions/webhookDeliver for every message of the webhook queue.
+func Deliver(ctx context.Context, client platform.WebhookAPI, id string) error {
+	delivery, err := GetDelivery(ctx, client, id)
+	if err != nil {
+		return err
+	}
+	if delivery.Status == DeliverySucceeded || delivery.Status == DeliveryFailed {
+		fmt.Printf("webhook delivery %s is already %s\n", id, delivery.Status)
+		return nil
+	}
+
+	endpoint, ok, err := findEndpoint(delivery.Endpoint)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		delivery.Status = DeliveryFailed
+		delivery.Error = "endpoint is not configured"
+		return saveDelivery(ctx, client, delivery)
+	}
+
+	attempt(ctx, endpoint, delivery)
+	if delivery.Status != DeliveryRetrying {
+		return saveDelivery(ctx, client, delivery)
+	}
+
+	delay := backoff(delivery.Attempts)
+	delivery.NextAttemptTime = now().UTC().Add(delay).Format(time.RFC3339)
+	if err = saveDelivery(ctx, client, delivery); err != nil {
+		return err
+	}
+	return enqueueDelivery(ctx, client, delivery.ID, delay)
+}
+
+// attempt sends the delivery to the endpoint and updates its status
+func attempt(ctx context.Context, endpoint Endpoint, delivery *Delivery) {
+	delivery.Attempts++
+	delivery.Error = ""
+	delivery.NextAttemptTime = ""
+
+	start := now()
+	statusCode, err := post(ctx, endpoint, delivery)
+	delivery.StatusCode = statusCode
+	delivery.Latency = now().Sub(start).Milliseconds()
+	record := Attempt{
+		Time:       start.UTC().Format(time.RFC3339),
+		StatusCode: statusCode,
+		Latency:    delivery.Latency,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	delivery.History = append(delivery.History, record)
+	if err == nil {
+		fmt.Printf("webhook delivery %s to %s succeeded\n", delivery.ID, endpoint.ID)
+		delivery.Status = DeliverySucceeded
+		return
+	}
+
+	fmt.Printf("webhook delivery %s to %s failed (attempt %d): %v\n", delivery.ID, endpoint.ID, delivery.Attempts, err)
+	delivery.Error = err.Error()
+	if delivery.Attempts >= maxAttempts || env.WebhookQueueName == "" {
+		delivery.Status = DeliveryFailed
+	} else {
+		delivery.Status = DeliveryRetrying
+	}
+}
+
+// post sends a signed webhook request, returning an error on a non-2xx response
+func post(ctx context.Context, endpoint Endpoint, delivery *Delivery) (int, error) {
+	eventID := delivery.EventID
+	if eventID == "" {
+		eventID = delivery.ID // recorded before events have IDs
+	}
+	body, contentType, attributes, err := encodeEvent(endpoint.Format, eventID, []byte(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+	req.Header.Set("Content-Type", contentType)
+	setCloudEventsHeaders(req.Header, attributes)
+	req.Header.Set("User-Agent", "mailbox-webhook")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if endpoint.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+		return res.StatusCode, fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(data)))
+	}
+	_, _ = io.Copy(io.Discard, res.Body) // so the connection can be reused
+	return res.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt, after the given number of attempts
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff << (attempts - 1)
+	if delay > maxBackoff || delay <= 0 {
+		return maxBackoff
+	}
+	return delay
+}
+
+func saveDelivery(ctx context.Context, client platform.PutItemAPI, delivery *Delivery) error {
+	delivery.TimeUpdated = now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(delivery)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item:      item,
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// enqueueDelivery sends the delivery ID to the webhook queue, to be delivered after delay
+func enqueueDelivery(ctx context.Context, client platform.SQSSendMessageAPI, id string, delay time.Duration) error {
+	url, err := queueURL(ctx, client, env.WebhookQueueName)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		MessageBody:  aws.String(id),
+		QueueUrl:     url,
+		DelaySeconds: int32(delay / time.Second),
+	})
+	if err != nil {
+		forgetQueueURL(env.WebhookQueueName, err)
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// defaultEndpointID is the ID of the endpoint configured by WEBHOOK_URL
+const defaultEndpointID = "default"
+
+// Endpoint is a webhook receiver, configured in env.Webhooks as a JSON array
+type Endpoint struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // used to sign the payloads, unsigned if empty
+	// Events are the events sent to the endpoint, either as "event.action" (e.g. "email.received") or "event".
+	// All events are sent if it's empty.
+	Events []string `json:"events,omitempty"`
+	// Format is the format of requests, either "hook" (default), "cloudevents" or "cloudevents-binary"
+	Format string `json:"format,omitempty"`
+}
+
+// Accepts returns true if the endpoint subscribes to the hook
+func (e Endpoint) Accepts(h *Hook) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, h.Event) || slices.Contains(e.Events, h.Name())
+}
+
+// Endpoints returns the configured webhook endpoints.
+// The endpoint of env.WebhookURL, if set, has the ID "default" and receives all events.
+func Endpoints() ([]Endpoint, error) {
+	var endpoints []Endpoint
+	if env.Webhooks != "" {
+		if err := json.Unmarshal([]byte(env.Webhooks), &endpoints); err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOKS: %w", err)
+		}
+	}
+	for _, e := range endpoints {
+		if e.ID == "" || e.URL == "" {
+			return nil, fmt.Errorf("invalid WEBHOOKS: id and url are required")
+		}
+		if !validFormat(e.Format) {
+			return nil, fmt.Errorf("invalid WEBHOOKS: unknown format %q", e.Format)
+		}
+	}
+	if env.WebhookURL != "" {
+		endpoints = append(endpoints, Endpoint{ID: defaultEndpointID, URL: env.WebhookURL})
+	}
+	return endpoints, nil
+}
+
+// findEndpoint returns the endpoint with the ID, or false if it's no longer configured
+func findEndpoint(id string) (Endpoint, bool, error) {
+	endpoints, err := Endpoints()
+	if err != nil {
+		return Endpoint{}, false, err
+	}
+	for _, e := range endpoints {
+		if e.ID == id {
+			return e, true, nil
+		}
+	}
+	return Endpoint{}, false, nil
+}
@@ -0,0 +1,226 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// maxPageSize is the maximum number of deliveries returned at once, which is limited by BatchGetItem
+const maxPageSize = 100
+
+// ListDeliveriesInput represents the input of ListDeliveries
+type ListDeliveriesInput struct {
+	Year       string  `json:"year"`
+	Month      string  `json:"month"`
+	Order      string  `json:"order"`    // asc or desc (default)
+	Status     string  `json:"status"`   // only list deliveries with the status if set
+	Endpoint   string  `json:"endpoint"` // only list deliveries to the endpoint if set
+	PageSize   int32   `json:"pageSize"` // default and maximum are 100
+	NextCursor *Cursor `json:"nextCursor"`
+}
+
+// ListDeliveriesResult represents the result of ListDeliveries
+type ListDeliveriesResult struct {
+	Count      int         `json:"count"`
+	Items      []*Delivery `json:"items"` // without payloads
+	NextCursor *Cursor     `json:"nextCursor"`
+	HasMore    bool        `json:"hasMore"`
+}
+
+// ListDeliveries lists the webhook deliveries created in a month, the current month by default
+func ListDeliveries(ctx context.Context, client platform.ListWebhookDeliveriesAPI, input ListDeliveriesInput) (*ListDeliveriesResult, error) {
+	month, err := parseYearMonth(input.Year, input.Month)
+	if err != nil {
+		return nil, err
+	}
+	input.Year, input.Month = month.Format("2006"), month.Format("01")
+	if input.Order == "" {
+		input.Order = "desc"
+	}
+	if input.Order != "asc" && input.Order != "desc" {
+		return nil, platform.ErrInvalidInput
+	}
+	if input.PageSize <= 0 || input.PageSize > maxPageSize {
+		input.PageSize = maxPageSize
+	}
+
+	query := deliveryQuery{
+		typeYearMonth: deliveryType + "#" + input.Year + "-" + input.Month,
+		ascending:     input.Order == "asc",
+	}
+	if input.NextCursor != nil && len(input.NextCursor.LastEvaluatedKey) > 0 {
+		if input.NextCursor.Year != input.Year || input.NextCursor.Month != input.Month ||
+			input.NextCursor.Order != input.Order {
+			return nil, platform.ErrQueryNotMatch
+		}
+		query.startKey = input.NextCursor.LastEvaluatedKey
+	}
+
+	// deliveries are filtered after they are read, so more queries may be needed to fill a page
+	items := []*Delivery{}
+	for len(items) < int(input.PageSize) {
+		query.limit = input.PageSize - int32(len(items)) // nolint:gosec
+		ids, err := query.next(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		deliveries, err := getDeliveries(ctx, client, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, delivery := range deliveries {
+			if (input.Status == "" || delivery.Status == input.Status) &&
+				(input.Endpoint == "" || delivery.Endpoint == input.Endpoint) {
+				delivery.Payload = ""
+				items = append(items, delivery)
+			}
+		}
+		if len(query.startKey) == 0 {
+			break
+		}
+	}
+
+	result := &ListDeliveriesResult{
+		Count:   len(items),
+		Items:   items,
+		HasMore: len(query.startKey) > 0,
+	}
+	if result.HasMore {
+		result.NextCursor = &Cursor{
+			Year:             input.Year,
+			Month:            input.Month,
+			Order:            input.Order,
+			LastEvaluatedKey: query.startKey,
+		}
+	}
+	return result, nil
+}
+
+// parseYearMonth returns the first day of a month, or of the current month if both are empty
+func parseYearMonth(year, month string) (time.Time, error) {
+	if year == "" && month == "" {
+		t := now().UTC()
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	t, err := time.Parse("2006-01", year+"-"+month)
+	if err != nil {
+		return time.Time{}, platform.ErrInvalidInput
+	}
+	return t, nil
+}
+
+// deliveryQuery queries the IDs of deliveries in a month from TimeIndex, page by page
+type deliveryQuery struct {
+	typeYearMonth string
+	from, to      string // DateTime range, both inclusive, optional
+	ascending     bool
+	limit         int32
+	startKey      map[string]dynamodbTypes.AttributeValue
+}
+
+// next returns the IDs in the next page, and updates startKey, which is empty after the last page
+func (q *deliveryQuery) next(ctx context.Context, client platform.QueryAPI) ([]string, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              &env.TableName,
+		IndexName:              &env.GsiIndexName,
+		ExclusiveStartKey:      q.startKey,
+		KeyConditionExpression: aws.String("#tym = :tym"),
+		ExpressionAttributeNames: map[string]string{
+			"#tym": "TypeYearMonth",
+		},
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":tym": &dynamodbTypes.AttributeValueMemberS{Value: q.typeYearMonth},
+		},
+		ProjectionExpression: aws.String("MessageID"),
+		ScanIndexForward:     aws.Bool(q.ascending),
+	}
+	if q.limit > 0 {
+		input.Limit = aws.Int32(q.limit)
+	}
+	if q.from != "" || q.to != "" {
+		// DateTime is dd-hh:mm:ss, so these cover the whole month
+		from, to := q.from, q.to
+		if from == "" {
+			from = "00"
+		}
+		if to == "" {
+			to = "99"
+		}
+		input.KeyConditionExpression = aws.String("#tym = :tym AND #dt BETWEEN :from AND :to")
+		input.ExpressionAttributeNames["#dt"] = "DateTime"
+		input.ExpressionAttributeValues[":from"] = &dynamodbTypes.AttributeValueMemberS{Value: from}
+		input.ExpressionAttributeValues[":to"] = &dynamodbTypes.AttributeValueMemberS{Value: to}
+	}
+
+	resp, err := client.Query(ctx, input)
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, platform.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	q.startKey = resp.LastEvaluatedKey
+
+	ids := make([]string, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		if id, ok := item["MessageID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+			ids = append(ids, id.Value)
+		}
+	}
+	return ids, nil
+}
+
+// getDeliveries returns the deliveries with the IDs, in the same order
+func getDeliveries(ctx context.Context, client platform.ListWebhookDeliveriesAPI, ids []string) ([]*Delivery, error) {
+	found := make(map[string]*Delivery, len(ids))
+	for chunk := range slices.Chunk(ids, maxPageSize) {
+		keys := make([]map[string]dynamodbTypes.AttributeValue, 0, len(chunk))
+		for _, id := range chunk {
+			keys = append(keys, map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+			})
+		}
+		requestItems := map[string]dynamodbTypes.KeysAndAttributes{
+			env.TableName: {Keys: keys},
+		}
+
+		for len(requestItems) > 0 {
+			resp, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: requestItems})
+			if err != nil {
+				if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+					return nil, platform.ErrTooManyRequests
+				}
+				return nil, err
+			}
+			for _, item := range resp.Responses[env.TableName] {
+				delivery := new(Delivery)
+				if err = attributevalue.UnmarshalMap(item, delivery); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal webhook delivery: %w", err)
+				}
+				found[delivery.ID] = delivery
+			}
+			requestItems = resp.UnprocessedKeys
+		}
+	}
+
+	deliveries := make([]*Delivery, 0, len(ids))
+	for _, id := range ids {
+		if delivery, ok := found[id]; ok {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
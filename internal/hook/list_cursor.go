@@ -0,0 +1,69 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/avutil"
+)
+
+// Cursor points to the next page of deliveries, and is encoded as "year,month,order,lastEvaluatedKey" in base64.
+// It's the same format as email cursors, without the type.
+type Cursor struct {
+	Year             string
+	Month            string
+	Order            string
+	LastEvaluatedKey map[string]dynamodbTypes.AttributeValue
+}
+
+func (c Cursor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// String returns the encoded cursor
+func (c Cursor) String() string {
+	var builder bytes.Buffer
+	builder.WriteString(c.Year)
+	builder.WriteByte(',')
+	builder.WriteString(c.Month)
+	builder.WriteByte(',')
+	builder.WriteString(c.Order)
+	builder.WriteByte(',')
+	if len(c.LastEvaluatedKey) > 0 {
+		builder.Write(avutil.EncodeAttributeValue(&dynamodbTypes.AttributeValueMemberM{Value: c.LastEvaluatedKey}))
+	}
+	return base64.URLEncoding.EncodeToString(builder.Bytes())
+}
+
+// BindString decodes an encoded cursor, an empty string is an empty cursor
+func (c *Cursor) BindString(data string) error {
+	if data == "" {
+		return nil
+	}
+	decoded, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		return platform.ErrInvalidInput
+	}
+	parts := bytes.SplitN(decoded, []byte(","), 4)
+	if len(parts) != 4 {
+		return platform.ErrInvalidInput
+	}
+	c.Year, c.Month, c.Order = string(parts[0]), string(parts[1]), string(parts[2])
+	c.LastEvaluatedKey = nil
+	if len(parts[3]) == 0 {
+		return nil
+	}
+	av, err := avutil.DecodeAttributeValue(parts[3])
+	if err != nil {
+		return platform.ErrInvalidInput
+	}
+	m, ok := av.(*dynamodbTypes.AttributeValueMemberM)
+	if !ok {
+		return platform.ErrInvalidInput
+	}
+	c.LastEvaluatedKey = m.Value
+	return nil
+}
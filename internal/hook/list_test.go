@@ -0,0 +1,78 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendAt sends a hook to the configured endpoints at the given time
+func sendAt(t *testing.T, client *memory.Client, at time.Time, id string) {
+	t.Helper()
+	now = func() time.Time { return at }
+	_ = SendWebhook(context.Background(), client, &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{ID: id}})
+}
+
+func TestListDeliveries(t *testing.T) {
+	setupWebhookEnv()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/broken" {
+			rw.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	setEndpoints(server.URL)
+
+	client := memory.NewClient()
+	for day := 1; day <= 3; day++ {
+		sendAt(t, client, time.Date(2023, 1, day, 0, 0, 0, 0, time.UTC), "jan")
+	}
+	sendAt(t, client, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), "feb")
+
+	ctx := context.Background()
+	result, err := ListDeliveries(ctx, client, ListDeliveriesInput{Year: "2023", Month: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, result.Count)
+	assert.False(t, result.HasMore)
+	assert.Equal(t, "2023-01-03T00:00:00Z", result.Items[0].TimeCreated, "newest first by default")
+	for _, delivery := range result.Items {
+		assert.Empty(t, delivery.Payload, "payloads are not listed")
+	}
+
+	// filtered and paginated
+	input := ListDeliveriesInput{Year: "2023", Month: "01", Order: "asc", Status: DeliveryFailed, PageSize: 2}
+	result, err = ListDeliveries(ctx, client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Count)
+	assert.True(t, result.HasMore)
+	for _, delivery := range result.Items {
+		assert.Equal(t, "broken", delivery.Endpoint)
+		assert.Equal(t, http.StatusBadGateway, delivery.StatusCode)
+		assert.Len(t, delivery.History, 1)
+	}
+	assert.Equal(t, "2023-01-01T00:00:00Z", result.Items[0].TimeCreated)
+
+	input.NextCursor = result.NextCursor
+	result, err = ListDeliveries(ctx, client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Count)
+	assert.Equal(t, "2023-01-03T00:00:00Z", result.Items[0].TimeCreated)
+
+	input.Order = "desc"
+	_, err = ListDeliveries(ctx, client, input)
+	assert.Equal(t, platform.ErrQueryNotMatch, err)
+
+	result, err = ListDeliveries(ctx, client, ListDeliveriesInput{Year: "2023", Month: "02", Endpoint: "ok"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Count)
+	assert.Equal(t, DeliverySucceeded, result.Items[0].Status)
+
+	_, err = ListDeliveries(ctx, client, ListDeliveriesInput{Year: "2023", Month: "13"})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+}
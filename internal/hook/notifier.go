@@ -0,0 +1,271 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Types of notifiers
+const (
+	NotifierSlack   = "slack"
+	NotifierDiscord = "discord"
+	NotifierMatrix  = "matrix"
+)
+
+// noSubject is shown for emails without a subject
+const noSubject = "(no subject)"
+
+// Notifier posts a chat message when an email is received, configured in env.Notifiers as a JSON array
+type Notifier struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // slack, discord or matrix
+	// URL is the incoming webhook URL of Slack or Discord, or the homeserver URL of Matrix
+	URL    string `json:"url"`
+	RoomID string `json:"roomID,omitempty"` // Matrix room, e.g. !abc:example.com
+	Token  string `json:"token,omitempty"`  // Matrix access token
+	// Link is the URL of an email, where "{id}" is replaced by its ID. No link is included if it's empty.
+	Link string `json:"link,omitempty"`
+
+	// Recipients and Senders limit the emails notified, to those sent to or from any of the addresses if set.
+	// An address starting with "@" matches a domain, e.g. "@example.com".
+	Recipients []string `json:"recipients,omitempty"`
+	Senders    []string `json:"senders,omitempty"`
+}
+
+// ChatMessage is the content of a chat notification
+type ChatMessage struct {
+	ID      string
+	From    string
+	To      []string
+	Subject string
+	Snippet string
+}
+
+// Notifiers returns the configured notifiers
+func Notifiers() ([]Notifier, error) {
+	if env.Notifiers == "" {
+		return nil, nil
+	}
+	var notifiers []Notifier
+	if err := json.Unmarshal([]byte(env.Notifiers), &notifiers); err != nil {
+		return nil, fmt.Errorf("invalid NOTIFIERS: %w", err)
+	}
+	for _, n := range notifiers {
+		if n.ID == "" || n.URL == "" {
+			return nil, fmt.Errorf("invalid NOTIFIERS: id and url are required")
+		}
+		switch n.Type {
+		case NotifierSlack, NotifierDiscord:
+		case NotifierMatrix:
+			if n.RoomID == "" || n.Token == "" {
+				return nil, fmt.Errorf("invalid NOTIFIERS: roomID and token are required by matrix")
+			}
+		default:
+			return nil, fmt.Errorf("invalid NOTIFIERS: unknown type %q", n.Type)
+		}
+	}
+	return notifiers, nil
+}
+
+// Accepts returns true if the email matches the filters of the notifier
+func (n Notifier) Accepts(m *ChatMessage) bool {
+	return matchAddresses(n.Recipients, m.To) && matchAddresses(n.Senders, []string{m.From})
+}
+
+// matchAddresses returns true if filters is empty, or any of the addresses matches a filter
+func matchAddresses(filters, addresses []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, address := range addresses {
+		if parsed, err := mail.ParseAddress(address); err == nil {
+			address = parsed.Address
+		}
+		address = strings.ToLower(address)
+		matched := slices.ContainsFunc(filters, func(filter string) bool {
+			filter = strings.ToLower(filter)
+			if strings.HasPrefix(filter, "@") {
+				return strings.HasSuffix(address, filter)
+			}
+			return address == filter
+		})
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sendNotifications notifies chats of received emails
+func sendNotifications(ctx context.Context, client platform.GetItemAPI, h *Hook) error {
+	if h.Event != EventEmail || h.Action != ActionReceived {
+		return nil
+	}
+	notifiers, err := Notifiers()
+	if err != nil || len(notifiers) == 0 {
+		return err
+	}
+
+	item, err := loadEmail(ctx, client, h.Email.ID)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return fmt.Errorf("email %s not found", h.Email.ID)
+	}
+	message := &ChatMessage{
+		ID:      h.Email.ID,
+		To:      item.To,
+		Subject: item.Subject,
+		Snippet: snippet(item.Text),
+	}
+	if len(item.From) > 0 {
+		message.From = item.From[0]
+	}
+	if message.Subject == "" {
+		message.Subject = noSubject
+	}
+
+	var errs []error
+	for _, notifier := range notifiers {
+		if !notifier.Accepts(message) {
+			continue
+		}
+		if err := notifier.Send(ctx, h.ID, message); err != nil {
+			errs = append(errs, fmt.Errorf("notifier %s failed: %w", notifier.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Send posts the message to the chat. The event ID makes Matrix messages idempotent.
+func (n Notifier) Send(ctx context.Context, eventID string, m *ChatMessage) error {
+	link := ""
+	if n.Link != "" {
+		link = strings.ReplaceAll(n.Link, "{id}", url.PathEscape(m.ID))
+	}
+
+	var (
+		method   = http.MethodPost
+		endpoint = n.URL
+		body     any
+	)
+	switch n.Type {
+	case NotifierSlack:
+		body = slackMessage(m, link)
+	case NotifierDiscord:
+		body = discordMessage(m, link)
+	case NotifierMatrix:
+		method = http.MethodPut
+		endpoint = strings.TrimSuffix(n.URL, "/") + "/_matrix/client/v3/rooms/" + url.PathEscape(n.RoomID) +
+			"/send/m.room.message/" + url.PathEscape(eventID)
+		body = matrixMessage(m, link)
+	default:
+		return fmt.Errorf("unknown notifier type %q", n.Type)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mailbox-webhook")
+	if n.Type == NotifierMatrix {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// slackEscape escapes the control characters of Slack mrkdwn
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackMessage returns the payload of a Slack incoming webhook
+func slackMessage(m *ChatMessage, link string) map[string]any {
+	title := "*" + slackEscape.Replace(m.Subject) + "*"
+	if link != "" {
+		title = "*<" + link + "|" + slackEscape.Replace(m.Subject) + ">*"
+	}
+	text := title + "\nFrom: " + slackEscape.Replace(m.From)
+	if m.Snippet != "" {
+		text += "\n" + slackEscape.Replace(m.Snippet)
+	}
+	return map[string]any{
+		"text": "New email from " + m.From + ": " + m.Subject, // used in notifications
+		"blocks": []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": text},
+			},
+		},
+	}
+}
+
+// discordMessage returns the payload of a Discord webhook
+func discordMessage(m *ChatMessage, link string) map[string]any {
+	embed := map[string]any{
+		"title": truncate(m.Subject, 256),
+	}
+	if m.From != "" {
+		embed["author"] = map[string]any{"name": truncate(m.From, 256)}
+	}
+	if m.Snippet != "" {
+		embed["description"] = m.Snippet
+	}
+	if link != "" {
+		embed["url"] = link
+	}
+	return map[string]any{
+		"content": "New email",
+		"embeds":  []any{embed},
+	}
+}
+
+// matrixMessage returns the content of a Matrix m.room.message event
+func matrixMessage(m *ChatMessage, link string) map[string]any {
+	plain := "New email from " + m.From + ": " + m.Subject
+	subject := "<b>" + html.EscapeString(m.Subject) + "</b>"
+	if link != "" {
+		plain += " " + link
+		subject = `<a href="` + html.EscapeString(link) + `">` + subject + "</a>"
+	}
+	formatted := subject + "<br>From: " + html.EscapeString(m.From)
+	if m.Snippet != "" {
+		plain += "\n" + m.Snippet
+		formatted += "<br>" + html.EscapeString(m.Snippet)
+	}
+	return map[string]any{
+		"msgtype":        "m.text",
+		"body":           plain,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	}
+}
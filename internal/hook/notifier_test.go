@@ -0,0 +1,156 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+// chatServer is a stand-in of Slack, Discord and Matrix, recording the requests by path
+type chatServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]*http.Request
+	bodies   map[string]map[string]any
+}
+
+func newChatServer(t *testing.T) *chatServer {
+	t.Helper()
+	s := &chatServer{
+		requests: map[string]*http.Request{},
+		bodies:   map[string]map[string]any{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body := map[string]any{}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&body))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests[req.URL.Path] = req
+		s.bodies[req.URL.Path] = body
+		if req.URL.Path == "/broken" {
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return s
+}
+
+func TestNotifiers(t *testing.T) {
+	defer func() { env.Notifiers = "" }()
+	env.Notifiers = ""
+	notifiers, err := Notifiers()
+	assert.Nil(t, err)
+	assert.Empty(t, notifiers)
+
+	env.Notifiers = `[{"id": "a", "type": "slack", "url": "https://hooks.slack.com/a"}]`
+	notifiers, err = Notifiers()
+	assert.Nil(t, err)
+	assert.Equal(t, []Notifier{{ID: "a", Type: NotifierSlack, URL: "https://hooks.slack.com/a"}}, notifiers)
+
+	for _, invalid := range []string{
+		`{}`,
+		`[{"id": "a", "type": "slack"}]`,
+		`[{"id": "a", "type": "teams", "url": "https://example.com"}]`,
+		`[{"id": "a", "type": "matrix", "url": "https://matrix.example.com"}]`,
+	} {
+		env.Notifiers = invalid
+		_, err = Notifiers()
+		assert.Error(t, err)
+	}
+}
+
+func TestNotifier_Accepts(t *testing.T) {
+	message := &ChatMessage{From: "Alice <alice@example.com>", To: []string{"me@example.com", "Team <Team@Example.org>"}}
+	tests := []struct {
+		notifier Notifier
+		expected bool
+	}{
+		{Notifier{}, true},
+		{Notifier{Recipients: []string{"team@example.org"}}, true},
+		{Notifier{Recipients: []string{"@example.org"}}, true},
+		{Notifier{Recipients: []string{"other@example.com"}}, false},
+		{Notifier{Senders: []string{"alice@example.com"}}, true},
+		{Notifier{Senders: []string{"@example.org"}}, false},
+		{Notifier{Recipients: []string{"me@example.com"}, Senders: []string{"bob@example.com"}}, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.notifier.Accepts(message), test.notifier)
+	}
+}
+
+func TestPublish_Notifiers(t *testing.T) {
+	setupWebhookEnv()
+	defer func() { env.Notifiers = "" }()
+	server := newChatServer(t)
+	defer server.Close()
+	env.Notifiers = `[
+		{"id": "slack", "type": "slack", "url": "` + server.URL + `/slack", "link": "https://mail.example.com/inbox/{id}"},
+		{"id": "discord", "type": "discord", "url": "` + server.URL + `/discord", "recipients": ["@example.com"]},
+		{"id": "matrix", "type": "matrix", "url": "` + server.URL + `/", "roomID": "!room:example.com", "token": "secret"},
+		{"id": "filtered", "type": "slack", "url": "` + server.URL + `/filtered", "senders": ["bob@example.com"]}
+	]`
+
+	client := memory.NewClient()
+	putEmail(t, client)
+	ctx := context.Background()
+
+	// only received emails are notified
+	assert.Nil(t, Publish(ctx, client, &Hook{Event: EventEmail, Action: ActionRead, Email: Email{ID: "123"}}))
+	assert.Empty(t, server.requests)
+
+	h := &Hook{ID: "event-1", Event: EventEmail, Action: ActionReceived, Email: Email{ID: "123"}}
+	assert.Nil(t, Publish(ctx, client, h))
+	assert.Len(t, server.requests, 3)
+	assert.NotContains(t, server.requests, "/filtered")
+
+	slack := server.bodies["/slack"]
+	assert.Equal(t, "New email from a@example.com: Hello", slack["text"])
+	assert.Equal(t, []any{map[string]any{
+		"type": "section",
+		"text": map[string]any{
+			"type": "mrkdwn",
+			"text": "*<https://mail.example.com/inbox/123|Hello>*\nFrom: a@example.com\nHi, how are you?",
+		},
+	}}, slack["blocks"])
+
+	discord := server.bodies["/discord"]
+	assert.Equal(t, []any{map[string]any{
+		"title":       "Hello",
+		"author":      map[string]any{"name": "a@example.com"},
+		"description": "Hi, how are you?",
+	}}, discord["embeds"])
+
+	matrixPath := "/_matrix/client/v3/rooms/!room:example.com/send/m.room.message/event-1"
+	matrix := server.requests[matrixPath]
+	if assert.NotNil(t, matrix) {
+		assert.Equal(t, http.MethodPut, matrix.Method)
+		assert.Equal(t, "Bearer secret", matrix.Header.Get("Authorization"))
+	}
+	assert.Equal(t, map[string]any{
+		"msgtype":        "m.text",
+		"body":           "New email from a@example.com: Hello\nHi, how are you?",
+		"format":         "org.matrix.custom.html",
+		"formatted_body": "<b>Hello</b><br>From: a@example.com<br>Hi, how are you?",
+	}, server.bodies[matrixPath])
+
+	// failures are returned
+	env.Notifiers = `[{"id": "broken", "type": "discord", "url": "` + server.URL + `/broken"}]`
+	assert.ErrorContains(t, Publish(ctx, client, h), "notifier broken failed: unexpected status 404")
+}
+
+func TestChatMessages_Escape(t *testing.T) {
+	m := &ChatMessage{ID: "1", From: "<a@example.com>", Subject: "1 < 2 & 3"}
+	slack := slackMessage(m, "")
+	assert.Equal(t, "*1 &lt; 2 &amp; 3*\nFrom: &lt;a@example.com&gt;",
+		slack["blocks"].([]any)[0].(map[string]any)["text"].(map[string]any)["text"])
+
+	matrix := matrixMessage(m, "https://example.com/?a=1&b=2")
+	assert.Equal(t, `<a href="https://example.com/?a=1&amp;b=2"><b>1 &lt; 2 &amp; 3</b></a><br>From: &lt;a@example.com&gt;`,
+		matrix["formatted_body"])
+}
@@ -0,0 +1,173 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Payload levels, configured by env.EventPayload
+const (
+	// PayloadID only includes the IDs of the email and its thread (default)
+	PayloadID = "id"
+	// PayloadSummary also includes the subject, addresses, a snippet, attachment metadata and the verdict
+	PayloadSummary = "summary"
+	// PayloadFull also includes the text and HTML bodies
+	PayloadFull = "full"
+)
+
+const (
+	// maxPayloadSize keeps payloads under the SQS limit of 256 KiB, leaving room for message attributes
+	maxPayloadSize = 250 * 1024
+	// snippetLength is the maximum number of characters in a snippet
+	snippetLength = 200
+)
+
+// payloadLevel returns the configured payload level, unknown levels are treated as PayloadID
+func payloadLevel() string {
+	switch env.EventPayload {
+	case PayloadSummary, PayloadFull:
+		return env.EventPayload
+	default:
+		return PayloadID
+	}
+}
+
+// emailItem contains the attributes of an email included in payloads
+type emailItem struct {
+	ThreadID    string
+	Subject     string
+	From        []string
+	To          []string
+	Text        string
+	HTML        string
+	Verdict     *Verdict
+	Attachments model.Files
+	Inlines     model.Files
+}
+
+// enrich adds the details of the email to email and draft events, depending on the payload level.
+// Emails that no longer exist, e.g. when they're deleted, only have IDs.
+func enrich(ctx context.Context, client platform.GetItemAPI, h *Hook) error {
+	level := payloadLevel()
+	if level == PayloadID || (h.Event != EventEmail && h.Event != EventDraft) || h.Email.ID == "" {
+		return nil
+	}
+
+	item, err := loadEmail(ctx, client, h.Email.ID)
+	if err != nil || item == nil {
+		return err
+	}
+
+	if h.Email.ThreadID == "" {
+		h.Email.ThreadID = item.ThreadID
+	}
+	h.Email.Subject = item.Subject
+	h.Email.From = item.From
+	h.Email.To = item.To
+	h.Email.Snippet = snippet(item.Text)
+	h.Email.Verdict = item.Verdict
+	for _, file := range append(item.Attachments, item.Inlines...) {
+		h.Email.Attachments = append(h.Email.Attachments, Attachment{
+			Filename:    file.Filename,
+			ContentType: file.ContentType,
+			ContentID:   file.ContentID,
+		})
+	}
+	if level == PayloadFull {
+		h.Email.Text = item.Text
+		h.Email.HTML = item.HTML
+	}
+	return nil
+}
+
+// loadEmail returns the attributes of an email included in payloads, or nil if it doesn't exist
+func loadEmail(ctx context.Context, client platform.GetItemAPI, id string) (*emailItem, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &env.TableName,
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, nil
+	}
+	item := new(emailItem)
+	if err = attributevalue.UnmarshalMap(resp.Item, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// snippet returns the beginning of a text with whitespaces collapsed
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= snippetLength {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:snippetLength]) + "…"
+}
+
+// fit truncates the HTML body, then the text body, then drops attachments, until the payload is at most limit bytes.
+// Truncated is set if anything is removed.
+func fit(h *Hook, limit int) error {
+	for {
+		body, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		over := len(body) - limit
+		if over <= 0 {
+			return nil
+		}
+
+		switch {
+		case h.Email.HTML != "":
+			h.Email.HTML = shorten(h.Email.HTML, over)
+		case h.Email.Text != "":
+			h.Email.Text = shorten(h.Email.Text, over)
+		case len(h.Email.Attachments) > 0:
+			h.Email.Attachments = nil
+		default:
+			return fmt.Errorf("payload of %d bytes exceeds %d bytes", len(body), limit)
+		}
+		h.Email.Truncated = true
+	}
+}
+
+// shorten removes about over bytes from the JSON encoding of s, in proportion as characters may be escaped
+func shorten(s string, over int) string {
+	encoded, _ := json.Marshal(s)
+	size := len(encoded) - 2 // without quotes
+	if size <= over {
+		return ""
+	}
+	return truncate(s, len(s)*(size-over)/size)
+}
+
+// truncate returns at most n bytes of s, without splitting a character
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,123 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func putEmail(t *testing.T, client *memory.Client) {
+	t.Helper()
+	_, err := client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: &env.TableName,
+		Item: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "123"},
+			"ThreadID":  &dynamodbTypes.AttributeValueMemberS{Value: "thread-123"},
+			"Subject":   &dynamodbTypes.AttributeValueMemberS{Value: "Hello"},
+			"From":      &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{&dynamodbTypes.AttributeValueMemberS{Value: "a@example.com"}}},
+			"To":        &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{&dynamodbTypes.AttributeValueMemberS{Value: "b@example.com"}}},
+			"Text":      &dynamodbTypes.AttributeValueMemberS{Value: "Hi,\n\n  how are   you?"},
+			"HTML":      &dynamodbTypes.AttributeValueMemberS{Value: "<p>Hi, how are you?</p>"},
+			"Verdict": &dynamodbTypes.AttributeValueMemberM{Value: map[string]dynamodbTypes.AttributeValue{
+				"Spam": &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+				"DKIM": &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+			}},
+			"Attachments": model.Files{{Filename: "a.pdf", ContentType: "application/pdf"}}.ToAttributeValue(),
+			"Inlines":     model.Files{{Filename: "b.png", ContentType: "image/png", ContentID: "b"}}.ToAttributeValue(),
+		},
+	})
+	assert.Nil(t, err)
+}
+
+func TestEnrich(t *testing.T) {
+	setupWebhookEnv()
+	defer func() { env.EventPayload = "" }()
+	client := memory.NewClient()
+	putEmail(t, client)
+	ctx := context.TODO()
+
+	env.EventPayload = ""
+	h := &Hook{Event: EventEmail, Action: ActionRead, Email: Email{ID: "123"}}
+	assert.Nil(t, enrich(ctx, client, h))
+	assert.Equal(t, Email{ID: "123"}, h.Email, "only IDs by default")
+
+	env.EventPayload = PayloadSummary
+	h = &Hook{Event: EventEmail, Action: ActionRead, Email: Email{ID: "123"}}
+	assert.Nil(t, enrich(ctx, client, h))
+	assert.Equal(t, Email{
+		ID:       "123",
+		ThreadID: "thread-123",
+		Subject:  "Hello",
+		From:     []string{"a@example.com"},
+		To:       []string{"b@example.com"},
+		Snippet:  "Hi, how are you?",
+		Attachments: []Attachment{
+			{Filename: "a.pdf", ContentType: "application/pdf"},
+			{Filename: "b.png", ContentType: "image/png", ContentID: "b"},
+		},
+		Verdict: &Verdict{Spam: true, DKIM: true},
+	}, h.Email)
+
+	env.EventPayload = PayloadFull
+	h = &Hook{Event: EventDraft, Action: ActionSaved, Email: Email{ID: "123"}}
+	assert.Nil(t, enrich(ctx, client, h))
+	assert.Equal(t, "Hi,\n\n  how are   you?", h.Email.Text)
+	assert.Equal(t, "<p>Hi, how are you?</p>", h.Email.HTML)
+
+	// deleted emails and threads only have IDs
+	h = &Hook{Event: EventEmail, Action: ActionDeleted, Email: Email{ID: "456"}}
+	assert.Nil(t, enrich(ctx, client, h))
+	assert.Equal(t, Email{ID: "456"}, h.Email)
+	h = &Hook{Event: EventThread, Action: ActionUpdated, Thread: Thread{ID: "123"}}
+	assert.Nil(t, enrich(ctx, client, h))
+	assert.Zero(t, h.Email)
+}
+
+func TestSnippet(t *testing.T) {
+	assert.Equal(t, "", snippet(""))
+	assert.Equal(t, "a b c", snippet(" a\n b\t\tc "))
+	long := snippet(strings.Repeat("é", 300))
+	assert.Equal(t, snippetLength+1, utf8.RuneCountInString(long))
+	assert.True(t, strings.HasSuffix(long, "…"))
+}
+
+func TestFit(t *testing.T) {
+	h := &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{
+		ID:          "123",
+		Text:        strings.Repeat("日本語", 1000),
+		HTML:        strings.Repeat("<b>&</b>", 1000),
+		Attachments: []Attachment{{Filename: "a.pdf", ContentType: "application/pdf"}},
+	}}
+	assert.Nil(t, fit(h, 100_000))
+	assert.False(t, h.Email.Truncated, "small payloads are kept")
+
+	// the HTML body is truncated first, and escaping is taken into account
+	assert.Nil(t, fit(h, 12_000))
+	assert.True(t, h.Email.Truncated)
+	assert.NotEmpty(t, h.Email.HTML)
+	assert.Len(t, h.Email.Text, 9000)
+	body, _ := json.Marshal(h)
+	assert.LessOrEqual(t, len(body), 12_000)
+
+	assert.Nil(t, fit(h, 2_000))
+	assert.Empty(t, h.Email.HTML)
+	assert.True(t, utf8.ValidString(h.Email.Text))
+	assert.NotEmpty(t, h.Email.Attachments)
+	body, _ = json.Marshal(h)
+	assert.LessOrEqual(t, len(body), 2_000)
+
+	assert.Nil(t, fit(h, 150))
+	assert.Empty(t, h.Email.Text)
+	assert.Empty(t, h.Email.Attachments)
+
+	assert.NotNil(t, fit(h, 10))
+}
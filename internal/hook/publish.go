@@ -0,0 +1,54 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Publish notifies subscribers of a mailbox event, by sending it to SQS (if env.QueueName is set), webhooks and chat notifiers.
+// SQS messages are collected instead if ctx has a batch (see WithBatch).
+// The ID and the timestamp are generated if they're empty, and email details are included according to env.EventPayload.
+func Publish(ctx context.Context, client platform.PublishAPI, h *Hook) error {
+	if h.ID == "" {
+		h.ID = newEventID()
+	}
+	if h.Timestamp == "" {
+		h.Timestamp = now().UTC().Format(time.RFC3339)
+	}
+
+	if err := enrich(ctx, client, h); err != nil {
+		fmt.Printf("failed to include email details in %s event: %v\n", h.Name(), err)
+	}
+	if err := fit(h, maxPayloadSize); err != nil {
+		return err
+	}
+
+	var errs []error
+	if sqsEnabled() {
+		if err := resolveThread(ctx, client, h); err != nil {
+			fmt.Printf("failed to resolve the thread of %s event: %v\n", h.Name(), err)
+		}
+		fmt.Printf("Sending %s event to SQS\n", h.Name())
+		if err := sendSQSEmailNotification(ctx, client, *h); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send event to SQS, %w", err))
+		}
+	}
+	if err := SendWebhook(ctx, client, h); err != nil {
+		errs = append(errs, fmt.Errorf("failed to send webhook, %w", err))
+	}
+	if err := sendNotifications(ctx, client, h); err != nil {
+		errs = append(errs, fmt.Errorf("failed to send chat notifications, %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Notify publishes an event of a change that is already made, so failures are logged instead of returned
+func Notify(ctx context.Context, client platform.PublishAPI, h *Hook) {
+	if err := Publish(ctx, client, h); err != nil {
+		fmt.Printf("failed to publish %s event: %v\n", h.Name(), err)
+	}
+}
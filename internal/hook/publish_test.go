@@ -0,0 +1,65 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	setupWebhookEnv()
+	env.QueueName = "queue-for-publish"
+	defer func() { env.QueueName = "" }()
+	var received Hook
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&received))
+	}))
+	defer server.Close()
+	env.WebhookURL = server.URL
+
+	client := memory.NewClient()
+	err := Publish(context.Background(), client, &Hook{
+		Event:  EventThread,
+		Action: ActionTrashed,
+		Thread: Thread{ID: "thread-123"},
+	})
+	assert.Nil(t, err)
+
+	expected := Hook{
+		Event:     EventThread,
+		Action:    ActionTrashed,
+		Timestamp: "2023-01-01T00:00:00Z",
+		Thread:    Thread{ID: "thread-123"},
+	}
+	assert.Equal(t, expected, received)
+
+	messages := client.Messages(env.QueueName)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "thread", *messages[0].MessageAttributes["Event"].StringValue)
+		assert.Equal(t, "trashed", *messages[0].MessageAttributes["Action"].StringValue)
+		var body Hook
+		assert.Nil(t, json.Unmarshal([]byte(*messages[0].Body), &body))
+		assert.Equal(t, expected, body)
+		assert.NotContains(t, *messages[0].Body, `"Email"`)
+	}
+
+	// a failed webhook is returned after SQS is sent
+	env.WebhookURL = "http://127.0.0.1:0"
+	err = Publish(context.Background(), client, &Hook{Event: EventEmail, Action: ActionRead, Email: Email{ID: "123"}})
+	assert.NotNil(t, err)
+	assert.Len(t, client.Messages(env.QueueName), 2)
+}
+
+func TestNotify(t *testing.T) {
+	setupWebhookEnv()
+	env.WebhookURL = "http://127.0.0.1:0"
+
+	// failures are only logged
+	Notify(context.Background(), memory.NewClient(), &Hook{Event: EventDraft, Action: ActionDeleted, Email: Email{ID: "draft-123"}})
+}
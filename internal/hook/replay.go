@@ -0,0 +1,158 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// maxReplay is the maximum number of deliveries replayed at once
+const maxReplay = 100
+
+var (
+	// ErrEndpointNotFound is returned when replaying to an endpoint that isn't configured
+	ErrEndpointNotFound = errors.New("webhook endpoint not found")
+	// ErrTooManyDeliveries is returned when more than 100 deliveries match a replay
+	ErrTooManyDeliveries = errors.New("too many deliveries to replay")
+)
+
+// Replay sends the payload of a delivery again, as a new delivery to endpointID, or to the original endpoint if it's empty.
+// The original delivery is kept, and refers to the new one by ReplayedBy.
+func Replay(ctx context.Context, client platform.WebhookAPI, id, endpointID string) (*Delivery, error) {
+	original, err := GetDelivery(ctx, client, id)
+	if err != nil {
+		return nil, err
+	}
+	return replay(ctx, client, original, endpointID)
+}
+
+// ReplayRangeInput represents the input of ReplayRange
+type ReplayRangeInput struct {
+	Start    string `json:"start"`    // RFC 3339, inclusive
+	End      string `json:"end"`      // RFC 3339, inclusive, default to now
+	Status   string `json:"status"`   // status of the deliveries to replay, default to failed
+	Endpoint string `json:"endpoint"` // only replay deliveries to the endpoint if set
+	Target   string `json:"target"`   // endpoint to replay to, default to the original endpoint
+}
+
+// ReplayRangeResult represents the result of ReplayRange
+type ReplayRangeResult struct {
+	Count      int         `json:"count"`
+	Deliveries []*Delivery `json:"deliveries"` // the new deliveries, without payloads
+}
+
+// ReplayRange replays the deliveries created in a time range.
+// Deliveries that are already replayed are skipped, so a range can be replayed again after fixing the endpoint.
+func ReplayRange(ctx context.Context, client platform.ReplayWebhookAPI, input ReplayRangeInput) (*ReplayRangeResult, error) {
+	start, err := time.Parse(time.RFC3339, input.Start)
+	if err != nil {
+		return nil, platform.ErrInvalidInput
+	}
+	end := now()
+	if input.End != "" {
+		if end, err = time.Parse(time.RFC3339, input.End); err != nil {
+			return nil, platform.ErrInvalidInput
+		}
+	}
+	start, end = start.UTC(), end.UTC()
+	if end.Before(start) {
+		return nil, platform.ErrInvalidInput
+	}
+	if input.Status == "" {
+		input.Status = DeliveryFailed
+	}
+	if input.Target != "" {
+		if _, ok, err := findEndpoint(input.Target); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrEndpointNotFound
+		}
+	}
+
+	var matched []*Delivery
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(end) {
+		query := deliveryQuery{
+			typeYearMonth: deliveryType + "#" + month.Format("2006-01"),
+			ascending:     true,
+		}
+		if sameMonth(month, start) {
+			query.from = format.DateTime(start)
+		}
+		if sameMonth(month, end) {
+			query.to = format.DateTime(end)
+		}
+
+		for {
+			ids, err := query.next(ctx, client)
+			if err != nil {
+				return nil, err
+			}
+			deliveries, err := getDeliveries(ctx, client, ids)
+			if err != nil {
+				return nil, err
+			}
+			for _, delivery := range deliveries {
+				if delivery.Status == input.Status && delivery.ReplayedBy == "" &&
+					(input.Endpoint == "" || delivery.Endpoint == input.Endpoint) {
+					matched = append(matched, delivery)
+				}
+			}
+			if len(matched) > maxReplay {
+				return nil, ErrTooManyDeliveries
+			}
+			if len(query.startKey) == 0 {
+				break
+			}
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+
+	result := &ReplayRangeResult{Deliveries: []*Delivery{}}
+	for _, original := range matched {
+		delivery, err := replay(ctx, client, original, input.Target)
+		if err != nil {
+			return result, err
+		}
+		delivery.Payload = ""
+		result.Deliveries = append(result.Deliveries, delivery)
+		result.Count++
+	}
+	return result, nil
+}
+
+// replay creates a new delivery with the payload of the original one, and sends it
+func replay(ctx context.Context, client platform.WebhookAPI, original *Delivery, endpointID string) (*Delivery, error) {
+	if endpointID == "" {
+		endpointID = original.Endpoint
+	}
+	endpoint, ok, err := findEndpoint(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrEndpointNotFound
+	}
+
+	delivery := newDelivery(endpoint, original.Event, []byte(original.Payload))
+	delivery.EventID = original.EventID
+	delivery.ReplayOf = original.ID
+	if err = dispatch(ctx, client, endpoint, delivery); err != nil {
+		return nil, err
+	}
+	fmt.Printf("webhook delivery %s is replayed by %s\n", original.ID, delivery.ID)
+
+	original.ReplayedBy = delivery.ID
+	if err = saveDelivery(ctx, client, original); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func sameMonth(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month()
+}
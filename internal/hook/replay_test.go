@@ -0,0 +1,118 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+// setEndpoints configures an endpoint "ok" that succeeds, and "broken" that fails
+func setEndpoints(url string) {
+	env.Webhooks = `[{"id": "ok", "url": "` + url + `/ok"}, {"id": "broken", "url": "` + url + `/broken"}]`
+}
+
+func TestReplay(t *testing.T) {
+	setupWebhookEnv()
+	var broken atomic.Bool
+	broken.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/broken" && broken.Load() {
+			rw.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	setEndpoints(server.URL)
+
+	client := memory.NewClient()
+	sendAt(t, client, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), "123")
+	result, err := ListDeliveries(context.Background(), client, ListDeliveriesInput{
+		Year: "2023", Month: "01", Status: DeliveryFailed,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Count)
+	id := result.Items[0].ID
+
+	ctx := context.Background()
+	broken.Store(false)
+	delivery, err := Replay(ctx, client, id, "")
+	assert.Nil(t, err)
+	assert.Equal(t, DeliverySucceeded, delivery.Status)
+	assert.Equal(t, "broken", delivery.Endpoint)
+	assert.Equal(t, id, delivery.ReplayOf)
+	assert.Contains(t, delivery.Payload, `"id":"123"`)
+
+	original, err := GetDelivery(ctx, client, id)
+	assert.Nil(t, err)
+	assert.Equal(t, DeliveryFailed, original.Status, "the original delivery is kept")
+	assert.Equal(t, delivery.ID, original.ReplayedBy)
+
+	// to another endpoint
+	delivery, err = Replay(ctx, client, id, "ok")
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", delivery.Endpoint)
+
+	_, err = Replay(ctx, client, id, "unknown")
+	assert.Equal(t, ErrEndpointNotFound, err)
+	_, err = Replay(ctx, client, "webhook-unknown", "")
+	assert.Equal(t, ErrDeliveryNotFound, err)
+}
+
+func TestReplayRange(t *testing.T) {
+	setupWebhookEnv()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if req.URL.Path == "/broken" {
+			rw.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	setEndpoints(server.URL)
+
+	client := memory.NewClient()
+	sendAt(t, client, time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC), "before")
+	sendAt(t, client, time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC), "jan")
+	sendAt(t, client, time.Date(2023, 2, 15, 0, 0, 0, 0, time.UTC), "feb")
+	sendAt(t, client, time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC), "after")
+	requests.Store(0)
+
+	// replay failed deliveries to the endpoint that works
+	ctx := context.Background()
+	input := ReplayRangeInput{Start: "2023-01-01T00:00:00Z", End: "2023-02-28T23:59:59Z", Target: "ok"}
+	result, err := ReplayRange(ctx, client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Count)
+	assert.Equal(t, int32(2), requests.Load())
+	for _, delivery := range result.Deliveries {
+		assert.Equal(t, "ok", delivery.Endpoint)
+		assert.Equal(t, DeliverySucceeded, delivery.Status)
+		assert.NotEmpty(t, delivery.ReplayOf)
+	}
+
+	// already replayed
+	result, err = ReplayRange(ctx, client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Count)
+
+	// succeeded deliveries to an endpoint
+	result, err = ReplayRange(ctx, client, ReplayRangeInput{
+		Start: "2023-03-01T00:00:00Z", Status: DeliverySucceeded, Endpoint: "ok",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Count, "the delivery in March, and the replays which are created now")
+
+	_, err = ReplayRange(ctx, client, ReplayRangeInput{Start: "2023-02-01T00:00:00Z", End: "2023-01-01T00:00:00Z"})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+	_, err = ReplayRange(ctx, client, ReplayRangeInput{Start: "yesterday"})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+	_, err = ReplayRange(ctx, client, ReplayRangeInput{Start: "2023-01-01T00:00:00Z", Target: "unknown"})
+	assert.Equal(t, ErrEndpointNotFound, err)
+}
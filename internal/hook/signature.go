@@ -0,0 +1,57 @@
+package hook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of webhook requests
+const (
+	HeaderEvent     = "X-Mailbox-Event"
+	HeaderDelivery  = "X-Mailbox-Delivery"
+	HeaderTimestamp = "X-Mailbox-Timestamp" // unix time in seconds
+	HeaderSignature = "X-Mailbox-Signature" // "sha256=" followed by the hex encoded HMAC-SHA256
+)
+
+const signaturePrefix = "sha256="
+
+// Errors returned by VerifySignature
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredTimestamp = errors.New("webhook timestamp is too old")
+)
+
+// Sign returns the value of the signature header.
+// The signed message is the timestamp and the body joined by ".", so that a signature can't be replayed with another timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature verifies the signature and timestamp headers of a webhook request.
+// Requests older than tolerance are rejected, to prevent replay attacks.
+func VerifySignature(secret, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now().Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrExpiredTimestamp
+	}
+	return nil
+}
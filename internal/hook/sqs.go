@@ -2,8 +2,14 @@ package hook
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -12,11 +18,52 @@ import (
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
+const (
+	// fifoSuffix is the suffix of the names of FIFO queues
+	fifoSuffix = ".fifo"
+	// maxBatchEntries is the maximum number of messages in a SendMessageBatch request
+	maxBatchEntries = 10
+	// maxBatchSize is the maximum total size of the messages in a SendMessageBatch request
+	maxBatchSize = 256 * 1024
+)
+
+// queueURLs caches queue URLs by queue name, since they don't change during the lifetime of a Lambda container
+var queueURLs sync.Map
+
 // sqsEnabled returns true if SQS is enabled
 func sqsEnabled() bool {
 	return env.QueueName != ""
 }
 
+// fifoEnabled returns true if the queue is a FIFO queue, whose messages need group and deduplication IDs
+func fifoEnabled() bool {
+	return strings.HasSuffix(env.QueueName, fifoSuffix)
+}
+
+// queueURL returns the URL of the queue, calling GetQueueUrl only the first time
+func queueURL(ctx context.Context, api platform.SQSGetQueueURLAPI, name string) (*string, error) {
+	if url, ok := queueURLs.Load(name); ok {
+		return aws.String(url.(string)), nil
+	}
+	result, err := api.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: &name,
+	})
+	if err != nil {
+		fmt.Println("Failed to get queue url")
+		return nil, err
+	}
+	queueURLs.Store(name, aws.ToString(result.QueueUrl))
+	return result.QueueUrl, nil
+}
+
+// forgetQueueURL removes the cached URL when the queue doesn't exist anymore, e.g. it's recreated
+func forgetQueueURL(name string, err error) {
+	var notExist *sqsTypes.QueueDoesNotExist
+	if errors.As(err, &notExist) {
+		queueURLs.Delete(name)
+	}
+}
+
 // SendSQS sends an email receipt to SQS, if SQS is enabled.
 // Otherwise, it does nothing.
 func SendSQS(ctx context.Context, api platform.SQSSendMessageAPI, input EmailReceipt) error {
@@ -35,41 +82,238 @@ func SendSQS(ctx context.Context, api platform.SQSSendMessageAPI, input EmailRec
 	})
 }
 
+// sqsMessage is an event encoded as an SQS message
+type sqsMessage struct {
+	body            string
+	attributes      map[string]sqsTypes.MessageAttributeValue
+	groupID         *string
+	deduplicationID *string
+	size            int
+}
+
 // sendSQSEmailNotification notifies about a change of state of an email, categorized by event.
+// The message is added to the batch of ctx if there's one, and sent by Flush.
 func sendSQSEmailNotification(ctx context.Context, api platform.SQSSendMessageAPI, input Hook) error {
-	result, err := api.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
-		QueueName: &env.QueueName,
-	})
+	b := batchFrom(ctx)
+	origin := ""
+	if b != nil {
+		origin = b.origin
+	}
+	message, err := newSQSMessage(input, origin)
 	if err != nil {
-		fmt.Println("Failed to get queue url")
 		return err
 	}
+	if b != nil {
+		b.add(message)
+		return nil
+	}
 
-	body, err := json.Marshal(input)
+	url, err := queueURL(ctx, api, env.QueueName)
 	if err != nil {
-		fmt.Println("Failed to marshal input")
 		return err
 	}
-
 	resp, err := api.SendMessage(ctx, &sqs.SendMessageInput{
-		MessageAttributes: map[string]sqsTypes.MessageAttributeValue{
-			"Event": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String(input.Event),
-			},
-			"Timestamp": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String(input.Timestamp),
-			},
-		},
-		MessageBody: aws.String(string(body)),
-		QueueUrl:    result.QueueUrl,
+		MessageAttributes:      message.attributes,
+		MessageBody:            aws.String(message.body),
+		MessageGroupId:         message.groupID,
+		MessageDeduplicationId: message.deduplicationID,
+		QueueUrl:               url,
 	})
 	if err != nil {
 		fmt.Println("Failed to send message to SQS")
+		forgetQueueURL(env.QueueName, err)
 		return err
 	}
 
 	fmt.Println("Sent message with ID: " + *resp.MessageId)
 	return nil
 }
+
+// newSQSMessage encodes an event as an SQS message.
+// For FIFO queues, origin is used to derive the deduplication ID if it's not empty, otherwise the event ID is used.
+func newSQSMessage(input Hook, origin string) (*sqsMessage, error) {
+	if input.ID == "" {
+		input.ID = newEventID()
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		fmt.Println("Failed to marshal input")
+		return nil, err
+	}
+	body, contentType, cloudEvent, err := encodeEvent(env.QueueFormat, input.ID, payload)
+	if err != nil {
+		fmt.Println("Failed to encode event")
+		return nil, err
+	}
+
+	message := &sqsMessage{
+		body: string(body),
+		attributes: map[string]sqsTypes.MessageAttributeValue{
+			"Event":     stringAttribute(input.Event),
+			"Action":    stringAttribute(input.Action),
+			"Timestamp": stringAttribute(input.Timestamp),
+		},
+	}
+	if env.QueueFormat == FormatCloudEvents || env.QueueFormat == FormatCloudEventsBinary {
+		message.attributes["content-type"] = stringAttribute(contentType)
+	}
+	for name, value := range cloudEvent {
+		message.attributes[cloudEventsPrefix+name] = stringAttribute(value)
+	}
+	if fifoEnabled() {
+		message.groupID = aws.String(messageGroupID(input))
+		message.deduplicationID = aws.String(deduplicationID(input, origin))
+	}
+
+	message.size = len(message.body)
+	for name, value := range message.attributes {
+		message.size += len(name) + len(aws.ToString(value.DataType)) + len(aws.ToString(value.StringValue))
+	}
+	return message, nil
+}
+
+// messageGroupID returns the FIFO message group of an event, so that events of a thread are delivered in order.
+// Emails that are not in a thread are grouped by themselves.
+func messageGroupID(h Hook) string {
+	switch {
+	case h.Thread.ID != "":
+		return h.Thread.ID
+	case h.Email.ThreadID != "":
+		return h.Email.ThreadID
+	case h.Email.ID != "":
+		return h.Email.ID
+	default:
+		return h.ID
+	}
+}
+
+// deduplicationID returns the FIFO deduplication ID of an event.
+// When origin (the SES message ID) is set, the ID is derived from it, the event name and the subject,
+// so that events of a retried invocation are deduplicated.
+func deduplicationID(h Hook, origin string) string {
+	if origin == "" {
+		return h.ID
+	}
+	sum := sha256.Sum256([]byte(origin + "\n" + h.Name() + "\n" + h.Email.ID + "\n" + h.Thread.ID))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveThread sets the thread ID of email events from the stored email,
+// so that FIFO messages are grouped by thread even if the publisher only knows the email ID
+func resolveThread(ctx context.Context, client platform.GetItemAPI, h *Hook) error {
+	if !fifoEnabled() || (h.Event != EventEmail && h.Event != EventDraft) || h.Email.ID == "" || h.Email.ThreadID != "" {
+		return nil
+	}
+	item, err := loadEmail(ctx, client, h.Email.ID)
+	if err != nil || item == nil {
+		return err
+	}
+	h.Email.ThreadID = item.ThreadID
+	return nil
+}
+
+type batchKey struct{}
+
+// batch collects the SQS messages of events published in an invocation
+type batch struct {
+	origin string
+
+	mu       sync.Mutex
+	messages []*sqsMessage
+}
+
+func (b *batch) add(message *sqsMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, message)
+}
+
+// take returns the collected messages and empties the batch
+func (b *batch) take() []*sqsMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	messages := b.messages
+	b.messages = nil
+	return messages
+}
+
+func batchFrom(ctx context.Context) *batch {
+	b, _ := ctx.Value(batchKey{}).(*batch)
+	return b
+}
+
+// WithBatch returns a context in which SQS messages of published events are collected, to be sent together by Flush.
+// origin is the SES message ID of the received email, from which deduplication IDs of FIFO messages are derived,
+// so that a retried invocation doesn't send the events again.
+func WithBatch(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, batchKey{}, &batch{origin: origin})
+}
+
+// Flush sends the SQS messages collected in the batch of ctx, at most 10 messages and 256 KiB per request.
+// It does nothing if ctx has no batch or nothing is collected.
+func Flush(ctx context.Context, api platform.SQSSendMessageBatchAPI) error {
+	b := batchFrom(ctx)
+	if b == nil {
+		return nil
+	}
+	messages := b.take()
+	if len(messages) == 0 {
+		return nil
+	}
+
+	url, err := queueURL(ctx, api, env.QueueName)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for len(messages) > 0 {
+		n, size := 0, 0
+		for n < len(messages) && n < maxBatchEntries && (n == 0 || size+messages[n].size <= maxBatchSize) {
+			size += messages[n].size
+			n++
+		}
+		if err := sendBatch(ctx, api, url, messages[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		messages = messages[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// sendBatch sends messages in a SendMessageBatch request, returning an error if any of them fails
+func sendBatch(ctx context.Context, api platform.SQSSendMessageBatchAPI, url *string, messages []*sqsMessage) error {
+	entries := make([]sqsTypes.SendMessageBatchRequestEntry, len(messages))
+	for i, message := range messages {
+		entries[i] = sqsTypes.SendMessageBatchRequestEntry{
+			Id:                     aws.String(strconv.Itoa(i)),
+			MessageAttributes:      message.attributes,
+			MessageBody:            aws.String(message.body),
+			MessageGroupId:         message.groupID,
+			MessageDeduplicationId: message.deduplicationID,
+		}
+	}
+	resp, err := api.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		Entries:  entries,
+		QueueUrl: url,
+	})
+	if err != nil {
+		fmt.Println("Failed to send message batch to SQS")
+		forgetQueueURL(env.QueueName, err)
+		return err
+	}
+
+	fmt.Printf("Sent %d messages to SQS\n", len(resp.Successful))
+	var errs []error
+	for _, failed := range resp.Failed {
+		errs = append(errs, fmt.Errorf("message %s failed: %s %s", aws.ToString(failed.Id), aws.ToString(failed.Code), aws.ToString(failed.Message)))
+	}
+	return errors.Join(errs...)
+}
+
+func stringAttribute(value string) sqsTypes.MessageAttributeValue {
+	return sqsTypes.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
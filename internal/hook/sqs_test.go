@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/stretchr/testify/assert"
@@ -106,13 +108,18 @@ func TestSendSQSEmailNotification(t *testing.T) {
 						t.Helper()
 						assert.Equal(t, "https://queue.url", *params.QueueUrl)
 
-						assert.Len(t, params.MessageAttributes, 2)
+						assert.Len(t, params.MessageAttributes, 3)
 						assert.Contains(t, params.MessageAttributes, "Event")
+						assert.Contains(t, params.MessageAttributes, "Action")
 						assert.Contains(t, params.MessageAttributes, "Timestamp")
 						assert.Equal(t, sqsTypes.MessageAttributeValue{
 							DataType:    aws.String("String"),
 							StringValue: aws.String("email"),
 						}, params.MessageAttributes["Event"])
+						assert.Equal(t, sqsTypes.MessageAttributeValue{
+							DataType:    aws.String("String"),
+							StringValue: aws.String("received"),
+						}, params.MessageAttributes["Action"])
 						assert.Equal(t, sqsTypes.MessageAttributeValue{
 							DataType:    aws.String("String"),
 							StringValue: aws.String("2022-03-12T10:10:10Z"),
@@ -169,9 +176,121 @@ func TestSendSQSEmailNotification(t *testing.T) {
 
 	for i, test := range tests {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			queueURLs.Clear()
 			ctx := context.Background()
 			err := sendSQSEmailNotification(ctx, test.client(t), test.input)
 			assert.Equal(t, test.expectedErr, err)
 		})
 	}
 }
+
+func TestQueueURL(t *testing.T) {
+	queueURLs.Clear()
+	calls := 0
+	client := mockSQSSendMessageAPI{
+		mockGetQueueURL: func(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+			calls++
+			return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://queue.url/" + *params.QueueName)}, nil
+		},
+	}
+
+	for range 3 {
+		url, err := queueURL(context.Background(), client, "queue-TestQueueURL")
+		assert.Nil(t, err)
+		assert.Equal(t, "https://queue.url/queue-TestQueueURL", *url)
+	}
+	assert.Equal(t, 1, calls)
+
+	forgetQueueURL("queue-TestQueueURL", errors.New("other"))
+	_, _ = queueURL(context.Background(), client, "queue-TestQueueURL")
+	assert.Equal(t, 1, calls)
+	forgetQueueURL("queue-TestQueueURL", &sqsTypes.QueueDoesNotExist{})
+	_, _ = queueURL(context.Background(), client, "queue-TestQueueURL")
+	assert.Equal(t, 2, calls)
+}
+
+func TestMessageGroupID(t *testing.T) {
+	assert.Equal(t, "thread", messageGroupID(Hook{ID: "event", Thread: Thread{ID: "thread"}}))
+	assert.Equal(t, "thread", messageGroupID(Hook{ID: "event", Email: Email{ID: "email", ThreadID: "thread"}}))
+	assert.Equal(t, "email", messageGroupID(Hook{ID: "event", Email: Email{ID: "email"}}))
+	assert.Equal(t, "event", messageGroupID(Hook{ID: "event"}))
+}
+
+func TestFlush(t *testing.T) {
+	env.QueueName = "queue-TestFlush.fifo"
+	defer func() { env.QueueName = "" }()
+	client := memory.NewClient()
+
+	publish := func(origin string) {
+		ctx := WithBatch(context.Background(), origin)
+		sent := len(client.Messages(env.QueueName))
+		for i := range 12 {
+			err := sendSQSEmailNotification(ctx, client, Hook{
+				Event:  EventEmail,
+				Action: ActionReceived,
+				Email:  Email{ID: "email-" + strconv.Itoa(i%3), ThreadID: map[bool]string{true: "thread"}[i%3 == 0]},
+			})
+			assert.Nil(t, err)
+		}
+		assert.Len(t, client.Messages(env.QueueName), sent, "messages are sent by Flush")
+		assert.Nil(t, Flush(ctx, client))
+		assert.Nil(t, Flush(ctx, client), "the batch is empty after Flush")
+	}
+
+	publish("")
+	messages := client.Messages(env.QueueName)
+	assert.Len(t, messages, 12)
+	groups := map[string]int{}
+	for _, message := range messages {
+		groups[message.Attributes["MessageGroupId"]]++
+	}
+	assert.Equal(t, map[string]int{"thread": 4, "email-1": 4, "email-2": 4}, groups)
+
+	// events derived from an SES message are deduplicated when the invocation is retried
+	client = memory.NewClient()
+	publish("ses-message-id")
+	publish("ses-message-id")
+	assert.Len(t, client.Messages(env.QueueName), 3)
+
+	assert.Nil(t, Flush(context.Background(), client), "no batch")
+}
+
+func TestFlush_Size(t *testing.T) {
+	env.QueueName = "queue-TestFlush_Size"
+	defer func() { env.QueueName = "" }()
+	queueURLs.Clear()
+
+	var sizes []int
+	client := mockSQSSendMessageBatchAPI{
+		mockSendMessageBatch: func(_ context.Context, params *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+			sizes = append(sizes, len(params.Entries))
+			for _, entry := range params.Entries {
+				assert.Nil(t, entry.MessageGroupId, "standard queues have no message groups")
+			}
+			return &sqs.SendMessageBatchOutput{
+				Failed: []sqsTypes.BatchResultErrorEntry{{Id: aws.String("0"), Code: aws.String("InternalError")}},
+			}, nil
+		},
+	}
+
+	ctx := WithBatch(context.Background(), "")
+	for range 3 {
+		assert.Nil(t, sendSQSEmailNotification(ctx, nil, Hook{Event: EventEmail, Email: Email{ID: "1", Text: strings.Repeat("a", 100*1024)}}))
+	}
+	err := Flush(ctx, client)
+	assert.Equal(t, []int{2, 1}, sizes)
+	assert.ErrorContains(t, err, "message 0 failed: InternalError")
+}
+
+type mockSQSSendMessageBatchAPI struct {
+	mockSendMessageBatch func(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+//revive:disable:var-naming
+func (m mockSQSSendMessageBatchAPI) GetQueueUrl(_ context.Context, _ *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://queue.url")}, nil
+}
+
+func (m mockSQSSendMessageBatchAPI) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	return m.mockSendMessageBatch(ctx, params, optFns...)
+}
@@ -1,50 +1,50 @@
 package hook
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"time"
 
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
 )
 
-// webhookEnabled returns true if webhook is enabled.
-func webhookEnabled() bool {
-	return env.WebhookURL != ""
-}
-
-// SendWebhook sends a webhook to the configured URL, if webhook is enabled.
-// Otherwise, it does nothing.
-func SendWebhook(ctx context.Context, data *Hook) error {
-	if !webhookEnabled() {
-		return nil
-	}
-
-	client := http.Client{
-		Timeout: 5 * time.Second,
-	}
-
-	body := new(bytes.Buffer)
-	err := json.NewEncoder(body).Encode(data)
+// SendWebhook sends a hook to every configured endpoint subscribing to it, and records each delivery.
+//
+// If env.WebhookQueueName is set, deliveries are handed off to the queue, where failed ones are retried with backoff.
+// Otherwise, each endpoint is called once before SendWebhook returns.
+func SendWebhook(ctx context.Context, client platform.PublishAPI, data *Hook) error {
+	endpoints, err := Endpoints()
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, env.WebhookURL, body)
-	if err != nil {
-		return err
+	if len(endpoints) == 0 {
+		return nil
 	}
 
-	res, err := client.Do(req)
+	if data.ID == "" {
+		data.ID = newEventID()
+	}
+	payload, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		err = res.Body.Close()
-		fmt.Println("error closing object body", err)
-	}()
 
-	return nil
+	var errs []error
+	for _, endpoint := range endpoints {
+		if !endpoint.Accepts(data) {
+			continue
+		}
+
+		delivery := newDelivery(endpoint, data.Name(), payload)
+		delivery.EventID = data.ID
+		err := dispatch(ctx, client, endpoint, delivery)
+		if err == nil && delivery.Status == DeliveryFailed {
+			err = fmt.Errorf("webhook to %s failed: %s", endpoint.ID, delivery.Error)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
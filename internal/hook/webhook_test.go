@@ -3,40 +3,74 @@ package hook
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/stretchr/testify/assert"
 )
 
+func setupWebhookEnv() {
+	env.TableName = "table-for-webhook"
+	env.GsiIndexName = "TimeIndex"
+	env.WebhookURL = ""
+	env.Webhooks = ""
+	env.WebhookQueueName = ""
+	now = func() time.Time { return time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC) }
+}
+
+func deliveries(t *testing.T, client *memory.Client) []*Delivery {
+	t.Helper()
+	var result []*Delivery
+	for _, message := range client.Messages(env.WebhookQueueName) {
+		delivery, err := GetDelivery(context.TODO(), client, *message.Body)
+		assert.Nil(t, err)
+		result = append(result, delivery)
+	}
+	return result
+}
+
 func TestSendWebhook(t *testing.T) {
+	setupWebhookEnv()
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		assert.Nil(t, err)
 		var webhook Hook
-		err := json.NewDecoder(req.Body).Decode(&webhook)
+		err = json.Unmarshal(body, &webhook)
 		assert.Nil(t, err)
 		assert.Equal(t, EventEmail, webhook.Event)
 		assert.Equal(t, ActionReceived, webhook.Action)
 		assert.Equal(t, "123", webhook.Email.ID)
 
+		assert.Equal(t, "email.received", req.Header.Get(HeaderEvent))
+		assert.NotEmpty(t, req.Header.Get(HeaderDelivery))
+		assert.Empty(t, req.Header.Get(HeaderSignature), "unsigned without a secret")
+
 		_, err = rw.Write([]byte("OK"))
 		assert.Nil(t, err)
 	}))
 	defer server.Close()
 
 	env.WebhookURL = server.URL
-	err := SendWebhook(context.Background(), &Hook{
+	client := memory.NewClient()
+	err := SendWebhook(context.Background(), client, &Hook{
 		Event:  EventEmail,
 		Action: ActionReceived,
 		Email:  Email{ID: "123"},
 	})
 	assert.NoError(t, err)
+	assert.Equal(t, 1, client.ItemCount(env.TableName), "the delivery is recorded")
 }
 
 func TestSendWebhook_NoOp(t *testing.T) {
-	env.WebhookURL = ""
-	err := SendWebhook(context.Background(), &Hook{
+	setupWebhookEnv()
+	err := SendWebhook(context.Background(), nil, &Hook{
 		Event:  EventEmail,
 		Action: ActionReceived,
 		Email:  Email{ID: "123"},
@@ -45,11 +79,191 @@ func TestSendWebhook_NoOp(t *testing.T) {
 }
 
 func TestSendWebhook_Error(t *testing.T) {
+	setupWebhookEnv()
 	env.WebhookURL = "invalid-url"
-	err := SendWebhook(context.Background(), &Hook{
+	client := memory.NewClient()
+	err := SendWebhook(context.Background(), client, &Hook{
 		Event:  EventEmail,
 		Action: ActionReceived,
 		Email:  Email{ID: "123"},
 	})
 	assert.Error(t, err)
+	assert.Equal(t, 1, client.ItemCount(env.TableName), "failed deliveries are recorded")
+}
+
+func TestSendWebhook_Queue(t *testing.T) {
+	setupWebhookEnv()
+	env.WebhookQueueName = "queue-for-webhook"
+	env.Webhooks = `[
+		{"id": "all", "url": "https://all.example.com"},
+		{"id": "received", "url": "https://received.example.com", "secret": "s", "events": ["email.received"]},
+		{"id": "sent", "url": "https://sent.example.com", "events": ["email.sent"]}
+	]`
+	client := memory.NewClient()
+
+	err := SendWebhook(context.Background(), client, &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "123"}})
+	assert.NoError(t, err)
+
+	queued := deliveries(t, client)
+	assert.Len(t, queued, 2, "the sent endpoint doesn't subscribe to email.received")
+	assert.Equal(t, "all", queued[0].Endpoint)
+	assert.Equal(t, "received", queued[1].Endpoint)
+	for _, delivery := range queued {
+		assert.Equal(t, DeliveryPending, delivery.Status)
+		assert.Equal(t, "email.received", delivery.Event)
+		assert.Contains(t, delivery.Payload, `"id":"123"`)
+		assert.Equal(t, 0, delivery.Attempts, "nothing is sent before the queue is processed")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	setupWebhookEnv()
+	env.WebhookQueueName = "queue-for-webhook"
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		assert.Nil(t, err)
+		err = VerifySignature("secret", req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body, 5*time.Minute)
+		assert.Nil(t, err)
+
+		if requests.Add(1) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = rw.Write([]byte("try again later"))
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	env.Webhooks = `[{"id": "main", "url": "` + server.URL + `", "secret": "secret"}]`
+
+	client := memory.NewClient()
+	ctx := context.Background()
+	err := SendWebhook(ctx, client, &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "123"}})
+	assert.NoError(t, err)
+	id := *client.Messages(env.WebhookQueueName)[0].Body
+
+	// the worker retries until the endpoint succeeds, enqueuing the delivery again after each failure
+	for i := 1; i <= 3; i++ {
+		err = Deliver(ctx, client, id)
+		assert.NoError(t, err)
+		assert.Len(t, client.Messages(env.WebhookQueueName), min(i+1, 3))
+	}
+	delivery, err := GetDelivery(ctx, client, id)
+	assert.Nil(t, err)
+	assert.Equal(t, DeliverySucceeded, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.StatusCode)
+	assert.Empty(t, delivery.Error)
+	if assert.Len(t, delivery.History, 3, "every attempt is recorded") {
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.History[0].StatusCode)
+		assert.Contains(t, delivery.History[0].Error, "try again later")
+		assert.Equal(t, http.StatusNoContent, delivery.History[2].StatusCode)
+		assert.Empty(t, delivery.History[2].Error)
+	}
+
+	// delivered ones are not sent again
+	err = Deliver(ctx, client, id)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestDeliver_Failed(t *testing.T) {
+	setupWebhookEnv()
+	env.WebhookQueueName = "queue-for-webhook"
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	env.Webhooks = `[{"id": "main", "url": "` + server.URL + `"}]`
+
+	client := memory.NewClient()
+	ctx := context.Background()
+	err := SendWebhook(ctx, client, &Hook{Event: EventEmail, Action: ActionReceived})
+	assert.NoError(t, err)
+	id := *client.Messages(env.WebhookQueueName)[0].Body
+
+	for range maxAttempts {
+		err = Deliver(ctx, client, id)
+		assert.NoError(t, err)
+	}
+	delivery, err := GetDelivery(ctx, client, id)
+	assert.Nil(t, err)
+	assert.Equal(t, DeliveryFailed, delivery.Status)
+	assert.Equal(t, maxAttempts, delivery.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, delivery.StatusCode)
+	assert.Len(t, client.Messages(env.WebhookQueueName), maxAttempts, "not enqueued after the last attempt")
+
+	// deliveries to removed endpoints fail
+	err = SendWebhook(ctx, client, &Hook{Event: EventEmail, Action: ActionReceived})
+	assert.NoError(t, err)
+	messages := client.Messages(env.WebhookQueueName)
+	id = *messages[len(messages)-1].Body
+	env.Webhooks = `[{"id": "other", "url": "` + server.URL + `"}]`
+	err = Deliver(ctx, client, id)
+	assert.NoError(t, err)
+	delivery, err = GetDelivery(ctx, client, id)
+	assert.Nil(t, err)
+	assert.Equal(t, DeliveryFailed, delivery.Status)
+	assert.Equal(t, "endpoint is not configured", delivery.Error)
+
+	_, err = GetDelivery(ctx, client, "inbox-1")
+	assert.Equal(t, ErrDeliveryNotFound, err)
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{6, 15 * time.Minute},
+		{100, 15 * time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.attempts), func(t *testing.T) {
+			assert.Equal(t, test.expected, backoff(test.attempts))
+		})
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	setupWebhookEnv()
+	endpoints, err := Endpoints()
+	assert.Nil(t, err)
+	assert.Empty(t, endpoints)
+
+	env.WebhookURL = "https://example.com"
+	env.Webhooks = `[{"id": "a", "url": "https://a.example.com", "events": ["email"]}]`
+	endpoints, err = Endpoints()
+	assert.Nil(t, err)
+	assert.Equal(t, []Endpoint{
+		{ID: "a", URL: "https://a.example.com", Events: []string{"email"}},
+		{ID: "default", URL: "https://example.com"},
+	}, endpoints)
+	assert.True(t, endpoints[0].Accepts(&Hook{Event: EventEmail, Action: ActionReceived}))
+	assert.False(t, endpoints[0].Accepts(&Hook{Event: "thread", Action: ActionReceived}))
+
+	for _, invalid := range []string{`{}`, `[{"id": "a"}]`, `[{"id": "a", "url": "https://a.example.com", "format": "xml"}]`} {
+		env.Webhooks = invalid
+		_, err = Endpoints()
+		assert.Error(t, err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	setupWebhookEnv()
+	body := []byte(`{"event":"email"}`)
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+	signature := Sign("secret", timestamp, body)
+
+	assert.Nil(t, VerifySignature("secret", timestamp, signature, body, time.Minute))
+	assert.Equal(t, ErrInvalidSignature, VerifySignature("other", timestamp, signature, body, time.Minute))
+	assert.Equal(t, ErrInvalidSignature, VerifySignature("secret", timestamp, signature, []byte("{}"), time.Minute))
+	assert.Equal(t, ErrInvalidSignature, VerifySignature("secret", timestamp, "md5=abc", body, time.Minute))
+
+	old := strconv.FormatInt(now().Add(-time.Hour).Unix(), 10)
+	assert.Equal(t, ErrExpiredTimestamp, VerifySignature("secret", old, Sign("secret", old, body), body, time.Minute))
 }
@@ -0,0 +1,236 @@
+// Package importer imports emails from other providers, given as raw MIME messages (e.g. from mbox or .eml files).
+//
+// Each message is stored like a received or sent email, and threaded with the emails already in the mailbox,
+// so messages should be imported in chronological order for conversations to be linked.
+package importer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/harryzcy/mailbox/internal/util/format"
+	"github.com/jhillyerd/enmime/v2"
+)
+
+// Options controls how messages are imported
+type Options struct {
+	// Addresses are the addresses of the mailbox owner, messages from them are imported as sent emails
+	Addresses []string
+	// Unread marks imported inbox emails as unread, unless the message has a Status header
+	Unread bool
+}
+
+// IDPrefix is the prefix of the IDs of imported emails
+const IDPrefix = "import-"
+
+// Result is the result of importing a message
+type Result struct {
+	MessageID string
+	Type      string
+	Duplicate bool // if true, the message already exists and is not imported
+}
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// Import imports a raw MIME message.
+// Messages whose Message-ID is already in the mailbox are skipped.
+func Import(ctx context.Context, client platform.ImportEmailAPI, raw []byte, opts Options) (*Result, error) {
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	originalMessageID := strings.TrimSpace(envelope.GetHeader("Message-ID"))
+	messageID := generateMessageID(originalMessageID, raw)
+	exists, err := messageExists(ctx, client, originalMessageID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		fmt.Printf("skipping duplicate message %s\n", messageID)
+		return &Result{MessageID: messageID, Duplicate: true}, nil
+	}
+
+	date := MessageDate(envelope)
+	emailType := model.EmailTypeInbox
+	if isFromOwner(envelope.GetHeader("From"), opts.Addresses) {
+		emailType = model.EmailTypeSent
+	}
+
+	// raw emails are stored first, so that stored items always have their raw emails
+	if err = storage.S3.PutEmail(ctx, client, messageID, raw); err != nil {
+		return nil, err
+	}
+
+	item, err := buildItem(envelope, messageID, emailType, date, opts)
+	if err != nil {
+		return nil, err
+	}
+	if originalMessageID != "" {
+		item["OriginalMessageID"] = &dynamodbTypes.AttributeValueMemberS{Value: originalMessageID}
+	}
+
+	err = thread.StoreEmail(ctx, client, &thread.StoreEmailInput{
+		Item:         item,
+		InReplyTo:    strings.TrimSpace(envelope.GetHeader("In-Reply-To")),
+		References:   strings.TrimSpace(envelope.GetHeader("References")),
+		TimeReceived: format.RFC3399(date),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{MessageID: messageID, Type: emailType}, nil
+}
+
+// messageExists checks if an email with the Message-ID is already stored,
+// or, for messages without a Message-ID, if the message has been imported before
+func messageExists(ctx context.Context, client platform.StoreEmailAPI, originalMessageID, messageID string) (bool, error) {
+	if originalMessageID == "" {
+		resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+			},
+		})
+		if err != nil {
+			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return false, platform.ErrTooManyRequests
+			}
+			return false, err
+		}
+		return len(resp.Item) > 0, nil
+	}
+
+	resp, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(env.TableName),
+		IndexName:              aws.String(env.GsiOriginalIndexName),
+		KeyConditionExpression: aws.String("OriginalMessageID = :originalMessageID"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":originalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: originalMessageID},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return false, platform.ErrTooManyRequests
+		}
+		return false, err
+	}
+	return len(resp.Items) > 0, nil
+}
+
+// generateMessageID derives the ID of an imported email from its Message-ID, or its content if there's none,
+// so that importing the same message again results in the same ID
+func generateMessageID(originalMessageID string, raw []byte) string {
+	var sum [sha256.Size]byte
+	if originalMessageID != "" {
+		sum = sha256.Sum256([]byte(originalMessageID))
+	} else {
+		sum = sha256.Sum256(raw)
+	}
+	return IDPrefix + hex.EncodeToString(sum[:16])
+}
+
+// MessageDate returns the time in the Date header, or the current time if it's missing or invalid
+func MessageDate(envelope *enmime.Envelope) time.Time {
+	date, err := mail.ParseDate(envelope.GetHeader("Date"))
+	if err != nil {
+		return now().UTC()
+	}
+	return date.UTC()
+}
+
+// isFromOwner checks if the From address is one of the owner's addresses
+func isFromOwner(from string, addresses []string) bool {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(addresses, func(a string) bool {
+		return strings.EqualFold(a, address.Address)
+	})
+}
+
+// buildItem builds the DynamoDB item of an email, with the same attributes as a received or sent email
+func buildItem(envelope *enmime.Envelope, messageID, emailType string, date time.Time, opts Options) (map[string]dynamodbTypes.AttributeValue, error) {
+	typeYearMonth, err := format.TypeYearMonth(emailType, date)
+	if err != nil {
+		return nil, err
+	}
+
+	input := email.Input{
+		MessageID:  messageID,
+		Subject:    envelope.GetHeader("Subject"),
+		From:       addresses(envelope, "From"),
+		To:         addresses(envelope, "To"),
+		Cc:         addresses(envelope, "Cc"),
+		ReplyTo:    addresses(envelope, "Reply-To"),
+		InReplyTo:  strings.TrimSpace(envelope.GetHeader("In-Reply-To")),
+		References: strings.TrimSpace(envelope.GetHeader("References")),
+		Text:       envelope.Text,
+		HTML:       envelope.HTML,
+	}
+	if emailType == model.EmailTypeSent {
+		input.Bcc = addresses(envelope, "Bcc")
+	}
+	item := input.GenerateAttributes(typeYearMonth, format.DateTime(date))
+	item["Attachments"] = storage.ParseFiles(envelope.Attachments).ToAttributeValue()
+	item["Inlines"] = storage.ParseFiles(envelope.Inlines).ToAttributeValue()
+	item["OtherParts"] = storage.ParseFiles(envelope.OtherParts).ToAttributeValue()
+
+	if emailType == model.EmailTypeInbox {
+		item["DateSent"] = &dynamodbTypes.AttributeValueMemberS{Value: format.Date(envelope.GetHeader("Date"))}
+		returnPath := strings.Trim(strings.TrimSpace(envelope.GetHeader("Return-Path")), "<>")
+		if returnPath != "" {
+			item["Source"] = &dynamodbTypes.AttributeValueMemberS{Value: returnPath}
+			item["ReturnPath"] = &dynamodbTypes.AttributeValueMemberS{Value: returnPath}
+		}
+		if len(input.To) > 0 {
+			item["Destination"] = &dynamodbTypes.AttributeValueMemberSS{Value: input.To}
+		}
+
+		unread := opts.Unread
+		if status := envelope.GetHeader("Status"); status != "" {
+			unread = !strings.Contains(status, "R")
+		}
+		// read emails have no Unread attribute, as email.StoreEmail does
+		if unread {
+			item["Unread"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		}
+	}
+	return item, nil
+}
+
+// addresses returns the unique addresses in a header, since they are stored as a string set
+func addresses(envelope *enmime.Envelope, header string) []string {
+	list, err := envelope.AddressList(header)
+	if err != nil {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, address := range list {
+		if s := format.Address(address); !slices.Contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEnv() {
+	env.TableName = "table-for-import"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiOriginalIndexName = "OriginalMessageIDIndex"
+	env.S3Bucket = "bucket-for-import"
+	now = func() time.Time { return time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC) }
+}
+
+const firstMessage = "From: Sender <sender@example.com>\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"Date: Sun, 01 Jan 2023 10:00:00 +0000\r\n" +
+	"Message-ID: <first@example.com>\r\n" +
+	"Status: RO\r\n" +
+	"\r\n" +
+	"Hello there\r\n"
+
+const replyMessage = "From: Me <me@example.com>\r\n" +
+	"To: sender@example.com\r\n" +
+	"Subject: Re: Hello\r\n" +
+	"Date: Mon, 02 Jan 2023 10:00:00 +0000\r\n" +
+	"Message-ID: <reply@example.com>\r\n" +
+	"In-Reply-To: <first@example.com>\r\n" +
+	"References: <first@example.com>\r\n" +
+	"\r\n" +
+	"Hi\r\n"
+
+func TestImport(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+	opts := Options{Addresses: []string{"ME@example.com"}, Unread: true}
+
+	first, err := Import(ctx, client, []byte(firstMessage), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "inbox", first.Type)
+	assert.False(t, first.Duplicate)
+
+	item := client.Item(env.TableName, first.MessageID)
+	assert.Equal(t, "inbox#2023-01", item["TypeYearMonth"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, "01-10:00:00", item["DateTime"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, "<first@example.com>", item["OriginalMessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	assert.NotContains(t, item, "Unread", "Status header marks it as read")
+	assert.Nil(t, email.Read(ctx, client, first.MessageID, email.ActionUnread), "read emails can be marked as unread")
+	assert.Nil(t, email.Read(ctx, client, first.MessageID, email.ActionRead))
+	raw, ok := client.Object(env.S3Bucket, first.MessageID)
+	assert.True(t, ok)
+	assert.Equal(t, firstMessage, string(raw))
+
+	reply, err := Import(ctx, client, []byte(replyMessage), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "sent", reply.Type)
+
+	item = client.Item(env.TableName, reply.MessageID)
+	assert.Equal(t, "sent#2023-01", item["TypeYearMonth"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	threadID := item["ThreadID"].(*dynamodbTypes.AttributeValueMemberS).Value
+	assert.NotEmpty(t, threadID)
+	assert.Equal(t, threadID, client.Item(env.TableName, first.MessageID)["ThreadID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+
+	th, err := thread.GetThread(ctx, client, threadID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{first.MessageID, reply.MessageID}, th.EmailIDs)
+	assert.Equal(t, "Hello", th.Subject)
+}
+
+func TestImport_Duplicate(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+
+	first, err := Import(ctx, client, []byte(firstMessage), Options{})
+	assert.Nil(t, err)
+	count := client.ItemCount(env.TableName)
+
+	again, err := Import(ctx, client, []byte(firstMessage), Options{})
+	assert.Nil(t, err)
+	assert.True(t, again.Duplicate)
+	assert.Equal(t, first.MessageID, again.MessageID)
+	assert.Equal(t, count, client.ItemCount(env.TableName))
+}
+
+func TestImport_NoHeaders(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+	raw := []byte("From: sender@example.com\r\nSubject: no date\r\n\r\nbody\r\n")
+
+	result, err := Import(ctx, client, raw, Options{Unread: true})
+	assert.Nil(t, err)
+	assert.Equal(t, generateMessageID("", raw), result.MessageID)
+
+	item := client.Item(env.TableName, result.MessageID)
+	assert.Equal(t, "inbox#2023-03", item["TypeYearMonth"].(*dynamodbTypes.AttributeValueMemberS).Value, "missing Date uses the current time")
+	assert.Equal(t, true, item["Unread"].(*dynamodbTypes.AttributeValueMemberBOOL).Value)
+	assert.NotContains(t, item, "OriginalMessageID")
+
+	again, err := Import(ctx, client, raw, Options{})
+	assert.Nil(t, err)
+	assert.True(t, again.Duplicate)
+}
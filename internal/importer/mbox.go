@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// ErrInvalidMbox is returned when the content doesn't start with a "From " line
+var ErrInvalidMbox = errors.New("invalid mbox: missing From line")
+
+var quotedFromRegex = regexp.MustCompile(`^>+From `)
+
+// ReadMbox reads messages from a mbox and calls fn with the raw MIME of each message.
+// Both mboxo and mboxrd are supported, and a level of ">" quoting is removed from "From " lines.
+func ReadMbox(r io.Reader, fn func(raw []byte) error) error {
+	reader := bufio.NewReader(r)
+	var message bytes.Buffer
+	started := false
+
+	flush := func() error {
+		if !started {
+			return nil
+		}
+		// the message is followed by an empty line, which is not part of it
+		raw := message.Bytes()
+		if bytes.HasSuffix(raw, []byte("\r\n\r\n")) {
+			raw = raw[:len(raw)-2]
+		} else if bytes.HasSuffix(raw, []byte("\n\n")) {
+			raw = raw[:len(raw)-1]
+		}
+		err := fn(bytes.Clone(raw))
+		message.Reset()
+		return err
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case bytes.HasPrefix(line, []byte("From ")):
+				if err := flush(); err != nil {
+					return err
+				}
+				started = true
+			case !started:
+				if len(bytes.TrimSpace(line)) > 0 {
+					return ErrInvalidMbox
+				}
+			case quotedFromRegex.Match(line):
+				message.Write(line[1:])
+			default:
+				message.Write(line)
+			}
+		}
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
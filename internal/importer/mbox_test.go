@@ -0,0 +1,53 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMbox(t *testing.T) {
+	mbox := "From sender@example.com Sun Jan  1 10:00:00 2023\n" +
+		"Subject: one\n\n>From here on\n>>From quoted\n\n" +
+		"From sender@example.com Mon Jan  2 10:00:00 2023\n" +
+		"Subject: two\n\nbody\n"
+
+	var messages []string
+	err := ReadMbox(strings.NewReader(mbox), func(raw []byte) error {
+		messages = append(messages, string(raw))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"Subject: one\n\nFrom here on\n>From quoted\n",
+		"Subject: two\n\nbody\n",
+	}, messages)
+}
+
+func TestReadMbox_Empty(t *testing.T) {
+	called := false
+	err := ReadMbox(strings.NewReader("\n"), func([]byte) error {
+		called = true
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.False(t, called)
+}
+
+func TestReadMbox_Invalid(t *testing.T) {
+	err := ReadMbox(strings.NewReader("Subject: one\n\nbody\n"), func([]byte) error { return nil })
+	assert.Equal(t, ErrInvalidMbox, err)
+}
+
+func TestReadMbox_CallbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	count := 0
+	err := ReadMbox(strings.NewReader("From a\n\nx\n\nFrom b\n\ny\n"), func([]byte) error {
+		count++
+		return errStop
+	})
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, 1, count)
+}
@@ -14,6 +14,11 @@ type QueryAPI interface {
 	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
 }
 
+// ScanAPI defines set of API required to read every item in the table
+type ScanAPI interface {
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
 // GetItemAPI defines set of API required to get an email
 type GetItemAPI interface {
 	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
@@ -21,7 +26,15 @@ type GetItemAPI interface {
 
 type GetEmailAPI interface {
 	GetItemAPI
-	UpdateItemAPI
+	UpdateEmailAPI
+	ReadEmailAPI // to mark the email as read
+}
+
+// ReadEmailAPI defines set of API required to mark an email as read or unread, together with UnreadCount of its thread
+type ReadEmailAPI interface {
+	GetItemAPI // to get the thread of the email
+	TransactWriteItemsAPI
+	PublishAPI
 }
 
 // GetItemContentAPI defines set of API required to get attachments or inlines of an email
@@ -29,23 +42,52 @@ type GetItemContentAPI interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 }
 
-// DeleteItemAPI defines DynamoDB DeleteItem and S3 DeleteObject API
+// DeleteItemAPI defines DynamoDB DeleteItem API
 type DeleteItemAPI interface {
 	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
-	storage.S3DeleteObjectAPI
 }
 
-// DeleteEmailAPI defines set of API required to delete an email
+// DeleteEmailAPI defines set of API required to delete an email and its raw objects, and publish the deletion
 type DeleteEmailAPI interface {
 	DeleteItemAPI
 	GetItemAPI // to check if it's part of a thread
+	storage.S3DeleteObjectAPI
+	PublishAPI
 }
 
-// DeleteThreadAPI defines set of API required to delete a thread and its emails
+// DeleteThreadAPI defines set of API required to delete a thread and its emails, and publish the deletion
 type DeleteThreadAPI interface {
-	TransactWriteItemsAPI
-	GetItemAPI // to get emails of the thread
+	GetThreadWithEmailsAPI // to get emails of the thread
+	DeleteItemAPI
 	storage.S3DeleteObjectAPI
+	PublishAPI
+}
+
+// UpdateThreadAPI defines set of API required to update a thread together with its emails, e.g. to read or trash it
+type UpdateThreadAPI interface {
+	GetThreadWithEmailsAPI
+	TransactWriteItemsAPI
+	PublishAPI
+}
+
+// CheckThreadsAPI defines set of API required to check the threads and emails, and repair them
+type CheckThreadsAPI interface {
+	ScanAPI
+	TransactWriteItemsAPI
+}
+
+// WakeSnoozedAPI defines set of API required to find the snoozed emails and threads that are due, and wake them
+type WakeSnoozedAPI interface {
+	QueryAPI
+	UpdateThreadAPI
+}
+
+// PurgeAPI defines set of API required to find the emails and threads past their retention, and delete them
+type PurgeAPI interface {
+	QueryAPI
+	DeleteThreadAPI
+	UpdateThreadAPI // to remove emails from their threads before they're deleted
+	UpdateItemAPI   // to trash emails before they're deleted
 }
 
 // UpdateItemAPI defines set of API required to update an email
@@ -53,6 +95,12 @@ type UpdateItemAPI interface {
 	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 }
 
+// UpdateEmailAPI defines set of API required to update an email or a thread, and publish the change
+type UpdateEmailAPI interface {
+	UpdateItemAPI
+	PublishAPI
+}
+
 // PutItemAPI defines set of API required to create an new email or replaces an existing email
 type PutItemAPI interface {
 	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
@@ -62,6 +110,7 @@ type PutItemAPI interface {
 type SendEmailAPI interface {
 	TransactWriteItemsAPI
 	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+	PublishAPI
 }
 
 // CreateAndSendEmailAPI defines set of API required to create an email and send it
@@ -102,11 +151,97 @@ type TransactWriteItemsAPI interface {
 type StoreEmailAPI interface {
 	QueryAPI
 	GetItemAPI
-	PutItemAPI
 	TransactWriteItemsAPI
+	PublishAPI
+}
+
+// RecordDeliveryAPI defines set of API required to record another delivery of a received email
+type RecordDeliveryAPI interface {
+	QueryAndGetItemAPI
+	UpdateItemAPI
+}
+
+// ReceiveEmailAPI defines set of API required to process a received email
+type ReceiveEmailAPI interface {
+	StoreEmailAPI
+	RecordDeliveryAPI
+	storage.S3GetObjectAPI
+	SendPushAPI
+	SQSSendMessageBatchAPI
 }
 
 type ReparseEmailAPI interface {
 	storage.S3GetObjectAPI
-	UpdateItemAPI
+	UpdateEmailAPI
+}
+
+// ExportEmailAPI defines set of API required to export emails
+type ExportEmailAPI interface {
+	QueryAPI
+	GetItemAPI
+	storage.S3GetObjectAPI
+}
+
+// CreateExportAPI defines set of API required to create an export job
+type CreateExportAPI interface {
+	PutItemAPI
+	SQSSendMessageAPI
+}
+
+// RunExportAPI defines set of API required to run an export job, which writes to S3
+type RunExportAPI interface {
+	ExportEmailAPI
+	PutItemAPI
+	storage.S3PutObjectAPI
+	SQSSendMessageAPI
+}
+
+// ImportEmailAPI defines set of API required to import an email
+type ImportEmailAPI interface {
+	StoreEmailAPI
+	storage.S3PutObjectAPI
+}
+
+// RestoreEmailAPI defines set of API required to rebuild emails from storage
+type RestoreEmailAPI interface {
+	ImportEmailAPI
+	storage.S3GetObjectAPI
+	storage.S3ListObjectsAPI
+}
+
+// PublishAPI defines set of API required to publish events to SQS and webhooks
+type PublishAPI interface {
+	GetItemAPI // to include email details in payloads
+	PutItemAPI // to record webhook deliveries
+	SQSSendMessageAPI
+}
+
+// WebhookAPI defines set of API required to deliver webhooks and record the deliveries
+type WebhookAPI interface {
+	GetItemAPI
+	PublishAPI
+}
+
+// UnsubscribePushAPI defines set of API required to delete a push subscription
+type UnsubscribePushAPI interface {
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// SendPushAPI defines set of API required to send push messages, and delete expired subscriptions
+type SendPushAPI interface {
+	QueryAPI
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	UnsubscribePushAPI
+}
+
+// ListWebhookDeliveriesAPI defines set of API required to list webhook deliveries
+type ListWebhookDeliveriesAPI interface {
+	QueryAPI
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// ReplayWebhookAPI defines set of API required to replay a range of webhook deliveries
+type ReplayWebhookAPI interface {
+	WebhookAPI
+	ListWebhookDeliveriesAPI
 }
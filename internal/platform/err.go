@@ -13,6 +13,18 @@ var (
 	// ErrReadActionFailed is returned when a read action or unread action fails
 	ErrReadActionFailed = errors.New("read action failed")
 
+	// ErrConflict is returned when items are changed concurrently during an operation, which can be retried
+	ErrConflict = errors.New("conflicting changes, please try again")
+
+	// ErrThreadTrashed is returned when merging or splitting a trashed thread
+	ErrThreadTrashed = errors.New("thread is trashed")
+
+	// ErrMultipleDrafts is returned when merging two threads that both have a draft
+	ErrMultipleDrafts = errors.New("both threads have a draft")
+
+	// ErrTooManyEmails is returned when an operation needs to update more emails than a transaction allows
+	ErrTooManyEmails = errors.New("too many emails to update at once")
+
 	// ErrEmailIsNotDraft is returned when expected draft type is not met
 	ErrEmailIsNotDraft = errors.New("email type is not draft")
 )
@@ -49,3 +61,54 @@ func (e *AlreadyTrashedError) Is(target error) bool {
 	}
 	return e.Type == t.Type
 }
+
+// NotArchivedError is returned when trying to unarchive an email/thread that isn't archived
+type NotArchivedError struct {
+	Type string // 'email' or 'thread'
+}
+
+func (e *NotArchivedError) Error() string {
+	return e.Type + " is not archived"
+}
+
+func (e *NotArchivedError) Is(target error) bool {
+	t, ok := target.(*NotArchivedError)
+	if !ok {
+		return false
+	}
+	return e.Type == t.Type
+}
+
+// AlreadyArchivedError is returned when trying to archive an archived email/thread
+type AlreadyArchivedError struct {
+	Type string // 'email' or 'thread'
+}
+
+func (e *AlreadyArchivedError) Error() string {
+	return e.Type + " is already archived"
+}
+
+func (e *AlreadyArchivedError) Is(target error) bool {
+	t, ok := target.(*AlreadyArchivedError)
+	if !ok {
+		return false
+	}
+	return e.Type == t.Type
+}
+
+// NotSnoozedError is returned when trying to unsnooze an email/thread that isn't snoozed
+type NotSnoozedError struct {
+	Type string // 'email' or 'thread'
+}
+
+func (e *NotSnoozedError) Error() string {
+	return e.Type + " is not snoozed"
+}
+
+func (e *NotSnoozedError) Is(target error) bool {
+	t, ok := target.(*NotSnoozedError)
+	if !ok {
+		return false
+	}
+	return e.Type == t.Type
+}
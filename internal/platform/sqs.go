@@ -6,9 +6,20 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
-// SQSSendMessageAPI defines set of API required by SendEmailReceipt and SendEmailNotification functions
-type SQSSendMessageAPI interface {
+// SQSGetQueueURLAPI defines set of API required to resolve queue URLs
+type SQSGetQueueURLAPI interface {
 	//revive:disable:var-naming
 	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+}
+
+// SQSSendMessageAPI defines set of API required by SendEmailReceipt and SendEmailNotification functions
+type SQSSendMessageAPI interface {
+	SQSGetQueueURLAPI
 	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
 }
+
+// SQSSendMessageBatchAPI defines set of API required to send messages collected in an invocation at once
+type SQSSendMessageBatchAPI interface {
+	SQSGetQueueURLAPI
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
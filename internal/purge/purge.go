@@ -0,0 +1,262 @@
+// Package purge deletes trashed emails and threads, and optionally old received emails, after their retention
+package purge
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Policy is the number of days to keep emails, where 0 keeps them forever
+type Policy struct {
+	Trash int `json:"trash"` // days to keep trashed emails and threads, since they're trashed
+	Junk  int `json:"junk"`  // days to keep received emails failing the spam check, since they're received
+	Inbox int `json:"inbox"` // days to keep any received emails, since they're received
+}
+
+// LoadPolicy returns the policy configured by env.Retention
+func LoadPolicy() (Policy, error) {
+	var policy Policy
+	if env.Retention == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(env.Retention), &policy); err != nil {
+		return Policy{}, fmt.Errorf("invalid RETENTION, %w", err)
+	}
+	if policy.Trash < 0 || policy.Junk < 0 || policy.Inbox < 0 {
+		return Policy{}, fmt.Errorf("invalid RETENTION, days must not be negative")
+	}
+	return policy, nil
+}
+
+// Reasons of the candidates, i.e. the policy they're past
+const (
+	ReasonTrash = "trash"
+	ReasonJunk  = "junk"
+	ReasonInbox = "inbox"
+)
+
+// Candidate is an email or a thread past its retention
+type Candidate struct {
+	MessageID string `json:"messageID"`
+	Type      string `json:"type"` // inbox, sent, draft or thread
+	Reason    string `json:"reason"`
+	Time      string `json:"time"` // the time it's trashed, or received for junk and inbox, in RFC3339 format
+
+	trashed  bool
+	threadID string
+}
+
+// Options are the options of Run
+type Options struct {
+	DryRun bool      // only report the candidates without deleting them
+	Now    time.Time // the time the retention is counted to
+}
+
+// Report is the result of Run
+type Report struct {
+	DryRun     bool        `json:"dryRun"`
+	Candidates []Candidate `json:"candidates"`
+	Deleted    int         `json:"deleted"` // number of candidates deleted
+	Failed     []string    `json:"failed"`  // IDs of candidates that failed to delete, which are retried by the next run
+}
+
+// Run deletes the emails and threads past the retention of policy, in the same way as email.Delete and thread.Delete,
+// so their raw emails are deleted from S3 as well. Junk and received emails are trashed before they're deleted.
+//
+// Emails in threads are removed from their threads before they're deleted, unless their threads are trashed,
+// in which case they're deleted together with the threads. Starred emails are kept, unless they're trashed.
+// When ctx is done, Run stops and the rest are deleted by the next run.
+func Run(ctx context.Context, client platform.PurgeAPI, policy Policy, opts Options) (*Report, error) {
+	candidates, err := findCandidates(ctx, client, policy, opts.Now)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{DryRun: opts.DryRun, Candidates: candidates}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for _, c := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		if err = purge(ctx, client, c); err != nil {
+			fmt.Printf("failed to delete %s %s: %v\n", c.Type, c.MessageID, err)
+			report.Failed = append(report.Failed, c.MessageID)
+			continue
+		}
+		report.Deleted++
+	}
+	return report, nil
+}
+
+// purge deletes a candidate, removing it from its thread and trashing it first
+func purge(ctx context.Context, client platform.PurgeAPI, c Candidate) error {
+	if c.Type == model.EmailTypeThread {
+		result, err := thread.Delete(ctx, client, c.MessageID)
+		if err != nil {
+			return err
+		}
+		if !result.Done {
+			return fmt.Errorf("%d emails are not deleted yet", result.Remaining)
+		}
+		return nil
+	}
+
+	if c.threadID != "" {
+		if err := thread.Detach(ctx, client, c.threadID, c.MessageID); err != nil {
+			return err
+		}
+	}
+	if !c.trashed {
+		if err := email.Trash(ctx, client, c.MessageID); err != nil {
+			return err
+		}
+	}
+	return email.Delete(ctx, client, c.MessageID)
+}
+
+// earliestMonth is the first month candidates are looked for in.
+// Imported emails are stored in the months they're sent, so it's long before any mailbox is set up.
+var earliestMonth = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// candidateTypes are the types of the emails looked for in TimeIndex.
+// Drafts are deleted directly instead of being trashed, and threads aren't in TimeIndex,
+// so trashed threads are found by their trashed emails.
+var candidateTypes = []string{model.EmailTypeInbox, model.EmailTypeSent}
+
+// findCandidates queries TimeIndex for the emails and threads past their retention, ordered by time.
+// Emails are trashed or received after they're created, so only the months up to the latest cutoff are queried.
+func findCandidates(ctx context.Context, client platform.QueryAndGetItemAPI, policy Policy, now time.Time) ([]Candidate, error) {
+	cutoff := func(days int) string {
+		if days == 0 {
+			return ""
+		}
+		return now.UTC().AddDate(0, 0, -days).Format(time.RFC3339)
+	}
+	trashBefore, junkBefore, inboxBefore := cutoff(policy.Trash), cutoff(policy.Junk), cutoff(policy.Inbox)
+	if trashBefore == "" && junkBefore == "" && inboxBefore == "" {
+		return nil, nil
+	}
+	due := func(t, before string) bool {
+		return before != "" && t != "" && t <= before
+	}
+	end, err := time.Parse(time.RFC3339, max(trashBefore, junkBefore, inboxBefore))
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	threads := map[string]*thread.Thread{} // threads of the emails that are candidates or trashed
+	for _, emailType := range candidateTypes {
+		for month := earliestMonth; !month.After(end); month = month.AddDate(0, 1, 0) {
+			items, err := queryMonth(ctx, client, emailType, month)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				e, err := email.ParseGetResult(item)
+				if err != nil {
+					return nil, err
+				}
+				c, ok := emailCandidate(e, due, trashBefore, junkBefore, inboxBefore)
+				if ok {
+					candidates = append(candidates, c)
+				}
+				if e.ThreadID != "" && (ok || e.TrashedTime != "") {
+					threads[e.ThreadID] = nil
+				}
+			}
+		}
+	}
+
+	for id := range threads {
+		t, err := thread.GetThread(ctx, client, id)
+		if err != nil {
+			if errors.Is(err, platform.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		threads[id] = t
+		if t.TrashedTime != nil && due(*t.TrashedTime, trashBefore) {
+			candidates = append(candidates, Candidate{MessageID: id, Type: model.EmailTypeThread, Reason: ReasonTrash, Time: *t.TrashedTime, trashed: true})
+		}
+	}
+	// emails in trashed threads are deleted together with their threads
+	candidates = slices.DeleteFunc(candidates, func(c Candidate) bool {
+		t := threads[c.threadID]
+		return t != nil && t.TrashedTime != nil
+	})
+
+	slices.SortFunc(candidates, func(a, b Candidate) int {
+		return cmp.Or(cmp.Compare(a.Time, b.Time), cmp.Compare(a.MessageID, b.MessageID))
+	})
+	return candidates, nil
+}
+
+// queryMonth returns the emails of a type in a month from TimeIndex
+func queryMonth(ctx context.Context, client platform.QueryAPI, emailType string, month time.Time) ([]map[string]dynamodbTypes.AttributeValue, error) {
+	typeYearMonth, err := format.TypeYearMonth(emailType, month)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]dynamodbTypes.AttributeValue
+	var startKey map[string]dynamodbTypes.AttributeValue
+	for {
+		resp, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(env.TableName),
+			IndexName:              aws.String(env.GsiIndexName),
+			ExclusiveStartKey:      startKey,
+			KeyConditionExpression: aws.String("TypeYearMonth = :typeYearMonth"),
+			ProjectionExpression:   aws.String("MessageID, TypeYearMonth, DateTime, ThreadID, TrashedTime, Verdict, Starred"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":typeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+			},
+		})
+		if err != nil {
+			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, platform.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		items = append(items, resp.Items...)
+		startKey = resp.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return items, nil
+		}
+	}
+}
+
+// emailCandidate returns the candidate of an email, if it's past any retention
+func emailCandidate(e *email.GetResult, due func(t, before string) bool, trashBefore, junkBefore, inboxBefore string) (Candidate, bool) {
+	c := Candidate{MessageID: e.MessageID, Type: e.Type, trashed: e.TrashedTime != "", threadID: e.ThreadID}
+	switch {
+	case due(e.TrashedTime, trashBefore):
+		c.Reason, c.Time = ReasonTrash, e.TrashedTime
+	case e.Type != model.EmailTypeInbox || e.Starred:
+		return Candidate{}, false
+	case e.Verdict != nil && !e.Verdict.Spam && due(e.TimeReceived, junkBefore):
+		c.Reason, c.Time = ReasonJunk, e.TimeReceived
+	case due(e.TimeReceived, inboxBefore):
+		c.Reason, c.Time = ReasonInbox, e.TimeReceived
+	default:
+		return Candidate{}, false
+	}
+	return c, true
+}
@@ -0,0 +1,160 @@
+package purge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	defer func() { env.Retention = "" }()
+
+	env.Retention = ""
+	policy, err := LoadPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, Policy{}, policy)
+
+	env.Retention = `{"trash": 30, "junk": 14}`
+	policy, err = LoadPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, Policy{Trash: 30, Junk: 14}, policy)
+
+	env.Retention = `{"trash": -1}`
+	_, err = LoadPolicy()
+	assert.NotNil(t, err)
+	env.Retention = `30`
+	_, err = LoadPolicy()
+	assert.NotNil(t, err)
+}
+
+// putEmail puts an email received or sent at the time, and its raw email in S3
+func putEmail(t *testing.T, client *memory.Client, id, emailType string, at time.Time, attributes map[string]dynamodbTypes.AttributeValue) {
+	t.Helper()
+	ctx := context.TODO()
+	item := map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: id},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: emailType + "#" + at.Format("2006-01")},
+	}
+	if emailType != "thread" {
+		item["DateTime"] = &dynamodbTypes.AttributeValueMemberS{Value: at.Format("02-15:04:05")}
+		assert.Nil(t, storage.S3.PutEmail(ctx, client, id, []byte("Subject: "+id+"\r\n\r\nbody")))
+	}
+	for name, value := range attributes {
+		item[name] = value
+	}
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(env.TableName), Item: item})
+	assert.Nil(t, err)
+}
+
+// exists returns whether the email exists in DynamoDB and S3
+func exists(t *testing.T, client *memory.Client, id string) [2]bool {
+	t.Helper()
+	ctx := context.TODO()
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+		},
+	})
+	assert.Nil(t, err)
+	_, err = storage.S3.GetEmailRaw(ctx, client, id)
+	return [2]bool{len(resp.Item) > 0, err == nil}
+}
+
+func TestRun(t *testing.T) {
+	env.TableName = "table-for-purge"
+	env.S3Bucket = "bucket-for-purge"
+	env.GsiIndexName = "TimeIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	trashed := func(days int) map[string]dynamodbTypes.AttributeValue {
+		return map[string]dynamodbTypes.AttributeValue{
+			"TrashedTime": &dynamodbTypes.AttributeValueMemberS{Value: daysAgo(days).Format(time.RFC3339)},
+		}
+	}
+	spam := func(pass bool) dynamodbTypes.AttributeValue {
+		return &dynamodbTypes.AttributeValueMemberM{Value: map[string]dynamodbTypes.AttributeValue{
+			"Spam": &dynamodbTypes.AttributeValueMemberBOOL{Value: pass},
+		}}
+	}
+
+	putEmail(t, client, "trashed-old", "inbox", daysAgo(50), trashed(40))
+	putEmail(t, client, "trashed-new", "sent", daysAgo(50), trashed(10))
+	putEmail(t, client, "junk-old", "inbox", daysAgo(20), map[string]dynamodbTypes.AttributeValue{"Verdict": spam(false)})
+	putEmail(t, client, "junk-new", "inbox", daysAgo(5), map[string]dynamodbTypes.AttributeValue{"Verdict": spam(false)})
+	putEmail(t, client, "junk-starred", "inbox", daysAgo(20), map[string]dynamodbTypes.AttributeValue{
+		"Verdict": spam(false),
+		"Starred": &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+	})
+	putEmail(t, client, "inbox-old", "inbox", daysAgo(800), map[string]dynamodbTypes.AttributeValue{"Verdict": spam(true)})
+	putEmail(t, client, "sent-old", "sent", daysAgo(800), nil)
+	inThread := func(threadID string) map[string]dynamodbTypes.AttributeValue {
+		return map[string]dynamodbTypes.AttributeValue{
+			"Verdict":  spam(true),
+			"ThreadID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		}
+	}
+	putEmail(t, client, "threaded-old", "inbox", daysAgo(800), inThread("thread"))
+	putEmail(t, client, "threaded-new", "inbox", daysAgo(100), inThread("thread"))
+	putEmail(t, client, "thread", "thread", daysAgo(800), map[string]dynamodbTypes.AttributeValue{
+		"EmailIDs": &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{
+			&dynamodbTypes.AttributeValueMemberS{Value: "threaded-old"},
+			&dynamodbTypes.AttributeValueMemberS{Value: "threaded-new"},
+		}},
+		"TimeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: daysAgo(100).Format(time.RFC3339)},
+	})
+	threadAttributes := trashed(35)
+	threadAttributes["EmailIDs"] = &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{
+		&dynamodbTypes.AttributeValueMemberS{Value: "trashed-in-thread"},
+	}}
+	putEmail(t, client, "trashed-thread", "thread", daysAgo(60), threadAttributes)
+	emailAttributes := trashed(35)
+	emailAttributes["ThreadID"] = &dynamodbTypes.AttributeValueMemberS{Value: "trashed-thread"}
+	putEmail(t, client, "trashed-in-thread", "inbox", daysAgo(60), emailAttributes)
+
+	policy := Policy{Trash: 30, Junk: 14, Inbox: 730}
+	report, err := Run(ctx, client, policy, Options{DryRun: true, Now: now})
+	assert.Nil(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []Candidate{
+		{MessageID: "inbox-old", Type: "inbox", Reason: ReasonInbox, Time: daysAgo(800).Format(time.RFC3339)},
+		{MessageID: "threaded-old", Type: "inbox", Reason: ReasonInbox, Time: daysAgo(800).Format(time.RFC3339), threadID: "thread"},
+		{MessageID: "trashed-old", Type: "inbox", Reason: ReasonTrash, Time: daysAgo(40).Format(time.RFC3339), trashed: true},
+		{MessageID: "trashed-thread", Type: "thread", Reason: ReasonTrash, Time: daysAgo(35).Format(time.RFC3339), trashed: true},
+		{MessageID: "junk-old", Type: "inbox", Reason: ReasonJunk, Time: daysAgo(20).Format(time.RFC3339)},
+	}, report.Candidates)
+	assert.Equal(t, 0, report.Deleted)
+	assert.Equal(t, [2]bool{true, true}, exists(t, client, "trashed-old"), "nothing is deleted in a dry run")
+
+	report, err = Run(ctx, client, policy, Options{Now: now})
+	assert.Nil(t, err)
+	assert.Len(t, report.Candidates, 5)
+	assert.Equal(t, 5, report.Deleted)
+	assert.Empty(t, report.Failed)
+	for _, id := range []string{"inbox-old", "threaded-old", "trashed-old", "trashed-in-thread", "junk-old"} {
+		assert.Equal(t, [2]bool{false, false}, exists(t, client, id), id)
+	}
+	assert.Equal(t, [2]bool{false, false}, exists(t, client, "trashed-thread"))
+	for _, id := range []string{"trashed-new", "junk-new", "junk-starred", "sent-old", "threaded-new"} {
+		assert.Equal(t, [2]bool{true, true}, exists(t, client, id), id)
+	}
+	th, err := thread.GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"threaded-new"}, th.EmailIDs, "purged emails are removed from their threads")
+
+	report, err = Run(ctx, client, Policy{}, Options{Now: now})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Candidates)
+}
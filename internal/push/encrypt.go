@@ -0,0 +1,96 @@
+package push
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// recordSize is the record size of the aes128gcm content coding, a message is always a single record
+	recordSize = 4096
+	// saltLength is the length of the salt in the header
+	saltLength = 16
+	// MaxPayloadSize is the maximum size of a payload, so that the encrypted message fits in a record
+	MaxPayloadSize = recordSize - saltLength - 4 - 1 - 65 - 16 - 1 // header, tag and delimiter
+)
+
+// ErrPayloadTooLarge is returned when a payload doesn't fit in a push message
+var ErrPayloadTooLarge = errors.New("push payload too large")
+
+// encrypt encrypts the payload to the subscription, as defined in RFC 8291 with the aes128gcm content coding of RFC 8188
+func encrypt(payload []byte, keys Keys) ([]byte, error) {
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltLength)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptWith(payload, keys, asPrivate, salt)
+}
+
+// encryptWith encrypts the payload with the key pair of the application server and the salt
+func encryptWith(payload []byte, keys Keys, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+	uaPublic, err := keys.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := keys.authSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public, 32)
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, ecdhSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// header: salt || record size || key ID length || key ID, where the key ID is as_public
+	message := make([]byte, 0, saltLength+4+1+len(asPublic)+len(payload)+1+gcm.Overhead())
+	message = append(message, salt...)
+	message = binary.BigEndian.AppendUint32(message, recordSize)
+	message = append(message, byte(len(asPublic)))
+	message = append(message, asPublic...)
+
+	plaintext := append(append([]byte{}, payload...), 0x02) // delimiter of the last record
+	return gcm.Seal(message, nonce, plaintext, nil), nil
+}
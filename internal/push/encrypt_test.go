@@ -0,0 +1,101 @@
+package push
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decode decodes base64url without padding, and fails the test if it's invalid
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	assert.Nil(t, err)
+	return data
+}
+
+// TestEncrypt_RFC8291 uses the example of RFC 8291, Appendix A
+func TestEncrypt_RFC8291(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(decode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	assert.Nil(t, err)
+	keys := Keys{
+		P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+		Auth:   "BTBZMqHH6r4Tts7J_aSIgg",
+	}
+	salt := decode(t, "DGv6ra1nlYgDCS1FRnbzlw")
+
+	message, err := encryptWith([]byte("When I grow up, I want to be a watermelon"), keys, asPrivate, salt)
+	assert.Nil(t, err)
+	assert.Equal(t, "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN",
+		base64.RawURLEncoding.EncodeToString(message))
+}
+
+// decrypt decrypts a message with the private key of the user agent, as a browser does
+func decrypt(t *testing.T, message []byte, uaPrivate *ecdh.PrivateKey, authSecret []byte) []byte {
+	t.Helper()
+	salt := message[:saltLength]
+	assert.Equal(t, uint32(recordSize), binary.BigEndian.Uint32(message[saltLength:]))
+	idLength := int(message[saltLength+4])
+	asPublic, err := ecdh.P256().NewPublicKey(message[saltLength+5 : saltLength+5+idLength])
+	assert.Nil(t, err)
+	ciphertext := message[saltLength+5+idLength:]
+
+	ecdhSecret, err := uaPrivate.ECDH(asPublic)
+	assert.Nil(t, err)
+	keyInfo := "WebPush: info\x00" + string(uaPrivate.PublicKey().Bytes()) + string(asPublic.Bytes())
+	ikm, _ := hkdf.Key(sha256.New, ecdhSecret, authSecret, keyInfo, 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	assert.Nil(t, err)
+	return []byte(strings.TrimSuffix(string(plaintext), "\x02"))
+}
+
+// newKeys returns the keys of a new subscription, and the private key of the user agent
+func newKeys(t *testing.T) (Keys, *ecdh.PrivateKey, []byte) {
+	t.Helper()
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	authSecret := make([]byte, authSecretLength)
+	_, _ = rand.Read(authSecret)
+	return Keys{
+		P256dh: base64.RawURLEncoding.EncodeToString(uaPrivate.PublicKey().Bytes()),
+		Auth:   base64.URLEncoding.EncodeToString(authSecret), // padded, as some browsers do
+	}, uaPrivate, authSecret
+}
+
+func TestEncrypt(t *testing.T) {
+	keys, uaPrivate, authSecret := newKeys(t)
+	payload := []byte(`{"event":"email","action":"received"}`)
+
+	first, err := encrypt(payload, keys)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, decrypt(t, first, uaPrivate, authSecret))
+
+	second, err := encrypt(payload, keys)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second, "keys and salt are random")
+
+	message, err := encrypt(make([]byte, MaxPayloadSize), keys)
+	assert.Nil(t, err)
+	assert.Len(t, message, recordSize)
+	_, err = encrypt(make([]byte, MaxPayloadSize+1), keys)
+	assert.Equal(t, ErrPayloadTooLarge, err)
+
+	_, err = encrypt(payload, Keys{P256dh: keys.P256dh, Auth: "short"})
+	assert.Error(t, err)
+	_, err = encrypt(payload, Keys{P256dh: "invalid", Auth: keys.Auth})
+	assert.Error(t, err)
+}
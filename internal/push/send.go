@@ -0,0 +1,126 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+const (
+	// ttl is how long push services keep messages of offline browsers
+	ttl = 24 * time.Hour
+	// maxErrorLength is the maximum length of the response body included in errors
+	maxErrorLength = 256
+	// maxSubjectLength is the maximum number of bytes of the subject in a notification
+	maxSubjectLength = 256
+)
+
+// httpClient sends push messages
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// SendResult represents the result of Send
+type SendResult struct {
+	Sent   int // number of messages accepted by push services
+	Pruned int // number of expired subscriptions deleted
+}
+
+// NotifyReceived sends a notification of a received email to every subscription.
+// Nothing is sent if VAPID keys are not configured.
+func NotifyReceived(ctx context.Context, client platform.SendPushAPI, email hook.Email) (*SendResult, error) {
+	if !Enabled() {
+		return &SendResult{}, nil
+	}
+	if len(email.Subject) > maxSubjectLength {
+		email.Subject = strings.ToValidUTF8(email.Subject[:maxSubjectLength], "")
+	}
+	payload, err := json.Marshal(&hook.Hook{
+		Event:     hook.EventEmail,
+		Action:    hook.ActionReceived,
+		Timestamp: now().UTC().Format(time.RFC3339),
+		Email:     email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Send(ctx, client, payload)
+}
+
+// Send encrypts the payload to every subscription and sends it.
+// Subscriptions are deleted when push services respond 404 or 410, i.e. they're expired or unsubscribed.
+func Send(ctx context.Context, client platform.SendPushAPI, payload []byte) (*SendResult, error) {
+	key, err := vapidKey()
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := listSubscriptions(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SendResult{}
+	var errs []error
+	for _, subscription := range subscriptions {
+		statusCode, err := send(ctx, key, subscription, payload)
+		if statusCode == http.StatusNotFound || statusCode == http.StatusGone {
+			fmt.Printf("push subscription %s is expired\n", subscription.ID)
+			if err := Unsubscribe(ctx, client, subscription.ID); err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+				errs = append(errs, err)
+				continue
+			}
+			result.Pruned++
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("push to %s failed: %w", subscription.ID, err))
+			continue
+		}
+		result.Sent++
+	}
+	return result, errors.Join(errs...)
+}
+
+// send sends an encrypted message to the push service of the subscription, returning the status code
+func send(ctx context.Context, key *ecdsa.PrivateKey, subscription *Subscription, payload []byte) (int, error) {
+	body, err := encrypt(payload, subscription.Keys)
+	if err != nil {
+		return 0, err
+	}
+	authorization, err := vapidAuthorization(key, subscription.Endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", authorization)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+		return res.StatusCode, fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,169 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEnv(t *testing.T) {
+	t.Helper()
+	env.TableName = "table-for-push"
+	env.GsiIndexName = "TimeIndex"
+	env.VAPIDSubject = "mailto:admin@example.com"
+	_, private, err := GenerateVAPIDKeys()
+	assert.Nil(t, err)
+	env.VAPIDPrivateKey = private
+	now = func() time.Time { return time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC) }
+}
+
+// verifyVAPID verifies the Authorization header, and returns the claims of the token
+func verifyVAPID(t *testing.T, authorization string) map[string]any {
+	t.Helper()
+	token, key, ok := strings.Cut(strings.TrimPrefix(authorization, "vapid t="), ", k=")
+	assert.True(t, ok)
+	public, err := PublicKey()
+	assert.Nil(t, err)
+	assert.Equal(t, public, key)
+
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 3)
+	publicKey, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), decode(t, key))
+	assert.Nil(t, err)
+	signature := decode(t, parts[2])
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.True(t, ecdsa.Verify(publicKey, hash[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])))
+
+	claims := map[string]any{}
+	assert.Nil(t, json.Unmarshal(decode(t, parts[1]), &claims))
+	return claims
+}
+
+func TestSubscribe(t *testing.T) {
+	setupEnv(t)
+	client := memory.NewClient()
+	ctx := context.Background()
+	keys, _, _ := newKeys(t)
+
+	subscription, err := Subscribe(ctx, client, "https://push.example.com/abc", keys)
+	assert.Nil(t, err)
+	assert.Equal(t, SubscriptionID("https://push.example.com/abc"), subscription.ID)
+	assert.True(t, strings.HasPrefix(subscription.ID, SubscriptionIDPrefix))
+
+	// subscribing again replaces the keys
+	keys, _, _ = newKeys(t)
+	_, err = Subscribe(ctx, client, "https://push.example.com/abc", keys)
+	assert.Nil(t, err)
+	subscriptions, err := listSubscriptions(ctx, client)
+	assert.Nil(t, err)
+	if assert.Len(t, subscriptions, 1) {
+		assert.Equal(t, keys, subscriptions[0].Keys)
+	}
+
+	for _, endpoint := range []string{"http://push.example.com/abc", "not a url", ""} {
+		_, err = Subscribe(ctx, client, endpoint, keys)
+		assert.Equal(t, platform.ErrInvalidInput, err)
+	}
+	_, err = Subscribe(ctx, client, "https://push.example.com/abc", Keys{P256dh: keys.P256dh})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+
+	assert.Nil(t, Unsubscribe(ctx, client, subscription.ID))
+	assert.Equal(t, ErrSubscriptionNotFound, Unsubscribe(ctx, client, subscription.ID))
+	assert.Equal(t, ErrSubscriptionNotFound, Unsubscribe(ctx, client, "webhook-123"))
+}
+
+func TestNotifyReceived(t *testing.T) {
+	setupEnv(t)
+	var mu sync.Mutex
+	received := map[string][]byte{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received[req.URL.Path] = body
+
+		assert.Equal(t, "aes128gcm", req.Header.Get("Content-Encoding"))
+		assert.Equal(t, "86400", req.Header.Get("TTL"))
+		claims := verifyVAPID(t, req.Header.Get("Authorization"))
+		assert.Equal(t, "https://"+req.Host, claims["aud"])
+		assert.Equal(t, "mailto:admin@example.com", claims["sub"])
+		assert.Equal(t, float64(now().Add(12*time.Hour).Unix()), claims["exp"])
+
+		switch req.URL.Path {
+		case "/gone":
+			rw.WriteHeader(http.StatusGone)
+		case "/broken":
+			rw.WriteHeader(http.StatusInternalServerError)
+		default:
+			rw.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	client := memory.NewClient()
+	ctx := context.Background()
+	keys, uaPrivate, authSecret := newKeys(t)
+	for _, path := range []string{"/ok", "/gone", "/broken"} {
+		_, err := Subscribe(ctx, client, server.URL+path, keys)
+		assert.Nil(t, err)
+	}
+
+	result, err := NotifyReceived(ctx, client, hook.Email{ID: "123", Subject: strings.Repeat("s", 1000), From: []string{"a@example.com"}})
+	assert.ErrorContains(t, err, "unexpected status 500")
+	assert.Equal(t, &SendResult{Sent: 1, Pruned: 1}, result)
+
+	payload := hook.Hook{}
+	assert.Nil(t, json.Unmarshal(decrypt(t, received["/ok"], uaPrivate, authSecret), &payload))
+	assert.Equal(t, hook.EventEmail, payload.Event)
+	assert.Equal(t, hook.ActionReceived, payload.Action)
+	assert.Equal(t, "123", payload.Email.ID)
+	assert.Len(t, payload.Email.Subject, maxSubjectLength)
+
+	subscriptions, err := listSubscriptions(ctx, client)
+	assert.Nil(t, err)
+	assert.Len(t, subscriptions, 2, "the expired subscription is deleted")
+
+	// disabled without VAPID keys
+	env.VAPIDPrivateKey = ""
+	result, err = NotifyReceived(ctx, client, hook.Email{ID: "123"})
+	assert.Nil(t, err)
+	assert.Zero(t, *result)
+	_, err = PublicKey()
+	assert.Equal(t, ErrNotConfigured, err)
+}
+
+func TestGenerateVAPIDKeys(t *testing.T) {
+	public, private, err := GenerateVAPIDKeys()
+	assert.Nil(t, err)
+	assert.Len(t, decode(t, public), 65)
+	assert.Len(t, decode(t, private), 32)
+
+	env.VAPIDPrivateKey = private
+	defer func() { env.VAPIDPrivateKey = "" }()
+	derived, err := PublicKey()
+	assert.Nil(t, err)
+	assert.Equal(t, public, derived)
+
+	env.VAPIDPrivateKey = "invalid"
+	_, err = PublicKey()
+	assert.Error(t, err)
+}
@@ -0,0 +1,220 @@
+// Package push sends Web Push notifications of received emails to browser clients.
+//
+// Messages are encrypted as in RFC 8291 and authorized with VAPID (RFC 8292).
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// SubscriptionIDPrefix is the prefix of subscription IDs, which are stored alongside emails
+const SubscriptionIDPrefix = "push-"
+
+// subscriptionType is the type of subscriptions in TimeIndex, where all subscriptions have the same TypeYearMonth
+const subscriptionType = "push"
+
+// batchSize is the maximum number of items in a BatchGetItem request
+const batchSize = 100
+
+// authSecretLength is the length of the authentication secret of a subscription
+const authSecretLength = 16
+
+// ErrSubscriptionNotFound is returned when the push subscription doesn't exist
+var ErrSubscriptionNotFound = errors.New("push subscription not found")
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// Subscription is a push subscription of a browser, in the format of PushSubscription.toJSON()
+type Subscription struct {
+	ID          string `json:"id" dynamodbav:"MessageID"`
+	Endpoint    string `json:"endpoint"`
+	Keys        Keys   `json:"keys"`
+	TimeCreated string `json:"timeCreated"`
+
+	// for TimeIndex, to list all subscriptions
+	TypeYearMonth string `json:"-"`
+	DateTime      string `json:"-"`
+}
+
+// Keys are the keys of a subscription, base64url encoded
+type Keys struct {
+	P256dh string `json:"p256dh"` // public key of the user agent
+	Auth   string `json:"auth"`   // authentication secret
+}
+
+// SubscriptionID returns the ID of the subscription to the push endpoint
+func SubscriptionID(endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint))
+	return SubscriptionIDPrefix + hex.EncodeToString(sum[:16])
+}
+
+// Subscribe saves a push subscription, replacing the keys if the endpoint is already subscribed
+func Subscribe(ctx context.Context, client platform.PutItemAPI, endpoint string, keys Keys) (*Subscription, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, platform.ErrInvalidInput
+	}
+	if _, err = keys.publicKey(); err != nil {
+		return nil, platform.ErrInvalidInput
+	}
+	if _, err = keys.authSecret(); err != nil {
+		return nil, platform.ErrInvalidInput
+	}
+
+	t := now().UTC().Format(time.RFC3339)
+	subscription := &Subscription{
+		ID:            SubscriptionID(endpoint),
+		Endpoint:      endpoint,
+		Keys:          keys,
+		TimeCreated:   t,
+		TypeYearMonth: subscriptionType,
+		DateTime:      t,
+	}
+	item, err := attributevalue.MarshalMap(subscription)
+	if err != nil {
+		return nil, err
+	}
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item:      item,
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, platform.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	fmt.Printf("push subscription %s is saved\n", subscription.ID)
+	return subscription, nil
+}
+
+// Unsubscribe deletes a push subscription
+func Unsubscribe(ctx context.Context, client platform.UnsubscribePushAPI, id string) error {
+	if !strings.HasPrefix(id, SubscriptionIDPrefix) {
+		return ErrSubscriptionNotFound
+	}
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(MessageID)"),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return ErrSubscriptionNotFound
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	fmt.Printf("push subscription %s is deleted\n", id)
+	return nil
+}
+
+// listSubscriptions returns all push subscriptions
+func listSubscriptions(ctx context.Context, client platform.SendPushAPI) ([]*Subscription, error) {
+	var ids []string
+	var startKey map[string]dynamodbTypes.AttributeValue
+	for {
+		resp, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              &env.TableName,
+			IndexName:              &env.GsiIndexName,
+			ExclusiveStartKey:      startKey,
+			KeyConditionExpression: aws.String("#tym = :tym"),
+			ExpressionAttributeNames: map[string]string{
+				"#tym": "TypeYearMonth",
+			},
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":tym": &dynamodbTypes.AttributeValueMemberS{Value: subscriptionType},
+			},
+			ProjectionExpression: aws.String("MessageID"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Items {
+			if id, ok := item["MessageID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+				ids = append(ids, id.Value)
+			}
+		}
+		startKey = resp.LastEvaluatedKey
+		if len(startKey) == 0 {
+			break
+		}
+	}
+
+	// TimeIndex doesn't project the keys, so subscriptions are read from the table
+	var subscriptions []*Subscription
+	for chunk := range slices.Chunk(ids, batchSize) {
+		keys := make([]map[string]dynamodbTypes.AttributeValue, 0, len(chunk))
+		for _, id := range chunk {
+			keys = append(keys, map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+			})
+		}
+		requestItems := map[string]dynamodbTypes.KeysAndAttributes{
+			env.TableName: {Keys: keys},
+		}
+		for len(requestItems) > 0 {
+			resp, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: requestItems})
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range resp.Responses[env.TableName] {
+				subscription := new(Subscription)
+				if err = attributevalue.UnmarshalMap(item, subscription); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal push subscription: %w", err)
+				}
+				subscriptions = append(subscriptions, subscription)
+			}
+			requestItems = resp.UnprocessedKeys
+		}
+	}
+	return subscriptions, nil
+}
+
+// publicKey returns the ECDH public key of the user agent
+func (k Keys) publicKey() (*ecdh.PublicKey, error) {
+	data, err := decodeBase64(k.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.P256().NewPublicKey(data)
+}
+
+// authSecret returns the authentication secret
+func (k Keys) authSecret() ([]byte, error) {
+	data, err := decodeBase64(k.Auth)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != authSecretLength {
+		return nil, fmt.Errorf("auth secret must be %d bytes", authSecretLength)
+	}
+	return data, nil
+}
+
+// decodeBase64 decodes base64url with or without padding, as browsers don't agree on it
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,108 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// vapidExpiration is how long a VAPID token is valid, at most 24 hours
+const vapidExpiration = 12 * time.Hour
+
+// ErrNotConfigured is returned when VAPID keys are not configured
+var ErrNotConfigured = errors.New("web push is not configured")
+
+// Enabled returns true if VAPID keys are configured
+func Enabled() bool {
+	return env.VAPIDPrivateKey != ""
+}
+
+// GenerateVAPIDKeys returns a new VAPID key pair, base64url encoded without padding.
+// The public key is the application server key used by browsers to subscribe.
+func GenerateVAPIDKeys() (publicKey, privateKey string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	private, err := key.Bytes()
+	if err != nil {
+		return "", "", err
+	}
+	public, err := key.PublicKey.Bytes()
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(public), base64.RawURLEncoding.EncodeToString(private), nil
+}
+
+// vapidKey returns the configured VAPID private key
+func vapidKey() (*ecdsa.PrivateKey, error) {
+	if !Enabled() {
+		return nil, ErrNotConfigured
+	}
+	data, err := decodeBase64(env.VAPIDPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+	key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+	return key, nil
+}
+
+// PublicKey returns the VAPID public key, which browsers use as applicationServerKey to subscribe
+func PublicKey() (string, error) {
+	key, err := vapidKey()
+	if err != nil {
+		return "", err
+	}
+	public, err := key.PublicKey.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(public), nil
+}
+
+// vapidAuthorization returns the Authorization header of a request to the push endpoint, as defined in RFC 8292
+func vapidAuthorization(key *ecdsa.PrivateKey, endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now().Add(vapidExpiration).Unix(),
+		"sub": env.VAPIDSubject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	public, err := key.PublicKey.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + base64.RawURLEncoding.EncodeToString(public), nil
+}
@@ -0,0 +1,91 @@
+package restore
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxValueLength is the maximum length of values reported in a Change
+const maxValueLength = 80
+
+// diff returns the changed attributes between two items, sorted by attribute name
+func diff(old, new map[string]dynamodbTypes.AttributeValue) []Change {
+	names := slices.Sorted(maps.Keys(new))
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var changes []Change
+	for _, name := range names {
+		oldValue, newValue := render(old[name]), render(new[name])
+		if oldValue != newValue {
+			changes = append(changes, Change{
+				Attribute: name,
+				Old:       truncate(oldValue),
+				New:       truncate(newValue),
+			})
+		}
+	}
+	return changes
+}
+
+// render returns a comparable representation of an attribute value, or "" if it's nil
+func render(av dynamodbTypes.AttributeValue) string {
+	if av == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // addresses are in <>
+	if err := encoder.Encode(value(av)); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// value converts an attribute value to a plain value, with sets sorted since their order is not preserved
+func value(av dynamodbTypes.AttributeValue) any {
+	switch v := av.(type) {
+	case *dynamodbTypes.AttributeValueMemberS:
+		return v.Value
+	case *dynamodbTypes.AttributeValueMemberN:
+		return v.Value
+	case *dynamodbTypes.AttributeValueMemberBOOL:
+		return v.Value
+	case *dynamodbTypes.AttributeValueMemberB:
+		return v.Value
+	case *dynamodbTypes.AttributeValueMemberSS:
+		return slices.Sorted(slices.Values(v.Value))
+	case *dynamodbTypes.AttributeValueMemberNS:
+		return slices.Sorted(slices.Values(v.Value))
+	case *dynamodbTypes.AttributeValueMemberL:
+		list := make([]any, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = value(item)
+		}
+		return list
+	case *dynamodbTypes.AttributeValueMemberM:
+		m := make(map[string]any, len(v.Value))
+		for k, item := range v.Value {
+			m[k] = value(item)
+		}
+		return m
+	}
+	return nil
+}
+
+func truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxValueLength {
+		return s
+	}
+	return string(runes[:maxValueLength]) + "…"
+}
@@ -0,0 +1,193 @@
+package restore
+
+import (
+	"bytes"
+	"errors"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/util/format"
+	"github.com/jhillyerd/enmime/v2"
+)
+
+// ErrUnknownTime is returned when the time an email is received can't be determined
+var ErrUnknownTime = errors.New("unable to determine the time the email is received")
+
+const statusPass = "PASS"
+
+// derivedAttributes are the attributes rebuilt from the raw email,
+// other attributes of an existing email (e.g. Unread, ThreadID) are kept as they are
+var derivedAttributes = []string{
+	"MessageID", "TypeYearMonth", "DateTime", "OriginalMessageID", "Subject",
+	"Source", "Destination", "From", "To", "ReturnPath", "ReplyTo", "InReplyTo", "References",
+	"DateSent", "Verdict", "Text", "HTML", "Attachments", "Inlines", "OtherParts",
+}
+
+// recipientRegex matches the recipient in the Received header added by SES, e.g. "... for me@example.com; Sun, 01 Jan 2023"
+var recipientRegex = regexp.MustCompile(`\bfor\s+<?([^\s<>;]+@[^\s<>;]+)>?`)
+
+// rebuilt is a received email rebuilt from its raw MIME
+type rebuilt struct {
+	item       map[string]dynamodbTypes.AttributeValue
+	received   time.Time
+	inReplyTo  string
+	references string
+}
+
+// buildEmail rebuilds the item of a received email from its raw MIME, with the same attributes as stored by emailReceive.
+// The time is taken from the Received header added by SES, or fallback if there's none.
+func buildEmail(messageID string, raw []byte, fallback time.Time) (*rebuilt, error) {
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	received, recipient := parseReceived(envelope)
+	if received.IsZero() {
+		received = fallback
+	}
+	if received.IsZero() {
+		return nil, ErrUnknownTime
+	}
+	typeYearMonth, err := format.TypeYearMonth(model.EmailTypeInbox, received)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &rebuilt{
+		received:   received,
+		inReplyTo:  strings.TrimSpace(envelope.GetHeader("In-Reply-To")),
+		references: strings.TrimSpace(envelope.GetHeader("References")),
+	}
+	item := map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+		"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: format.DateTime(received)},
+		"DateSent":      &dynamodbTypes.AttributeValueMemberS{Value: format.Date(envelope.GetHeader("Date"))},
+		"Subject":       &dynamodbTypes.AttributeValueMemberS{Value: envelope.GetHeader("Subject")},
+		"Text":          &dynamodbTypes.AttributeValueMemberS{Value: envelope.Text},
+		"HTML":          &dynamodbTypes.AttributeValueMemberS{Value: envelope.HTML},
+		"Attachments":   storage.ParseFiles(envelope.Attachments).ToAttributeValue(),
+		"Inlines":       storage.ParseFiles(envelope.Inlines).ToAttributeValue(),
+		"OtherParts":    storage.ParseFiles(envelope.OtherParts).ToAttributeValue(),
+	}
+	setString(item, "OriginalMessageID", strings.TrimSpace(envelope.GetHeader("Message-ID")))
+	setString(item, "InReplyTo", e.inReplyTo)
+	setString(item, "References", e.references)
+
+	returnPath := strings.Trim(strings.TrimSpace(envelope.GetHeader("Return-Path")), "<>")
+	setString(item, "Source", returnPath)
+	setString(item, "ReturnPath", returnPath)
+
+	// the envelope recipient is only known from the Received header, To is the best guess without it
+	destination := bareAddresses(envelope, "To")
+	if recipient != "" {
+		destination = []string{recipient}
+	}
+	setStringSet(item, "Destination", destination)
+	setStringSet(item, "From", addresses(envelope, "From"))
+	setStringSet(item, "To", addresses(envelope, "To"))
+	setStringSet(item, "ReplyTo", addresses(envelope, "Reply-To"))
+
+	if verdict := parseVerdict(envelope); verdict != nil {
+		item["Verdict"] = verdict
+	}
+
+	e.item = item
+	return e, nil
+}
+
+// parseReceived returns the time and the recipient in the first Received header, which is added by SES
+func parseReceived(envelope *enmime.Envelope) (time.Time, string) {
+	values := envelope.GetHeaderValues("Received")
+	if len(values) == 0 {
+		return time.Time{}, ""
+	}
+	received := values[0]
+
+	var t time.Time
+	if i := strings.LastIndex(received, ";"); i >= 0 {
+		if date, err := mail.ParseDate(strings.TrimSpace(received[i+1:])); err == nil {
+			t = date.UTC()
+		}
+	}
+	var recipient string
+	if match := recipientRegex.FindStringSubmatch(received); match != nil {
+		recipient = match[1]
+	}
+	return t, recipient
+}
+
+// parseVerdict returns the verdicts in the headers added by SES, or nil if there's none
+func parseVerdict(envelope *enmime.Envelope) dynamodbTypes.AttributeValue {
+	spam := envelope.GetHeader("X-SES-Spam-Verdict")
+	virus := envelope.GetHeader("X-SES-Virus-Verdict")
+	var results string
+	for _, value := range envelope.GetHeaderValues("Authentication-Results") {
+		if strings.HasPrefix(strings.TrimSpace(value), "amazonses.com") {
+			results = strings.ToLower(value)
+			break
+		}
+	}
+	if spam == "" && virus == "" && results == "" {
+		return nil
+	}
+
+	return &dynamodbTypes.AttributeValueMemberM{Value: map[string]dynamodbTypes.AttributeValue{
+		"Spam":  &dynamodbTypes.AttributeValueMemberBOOL{Value: strings.EqualFold(spam, statusPass)},
+		"DKIM":  &dynamodbTypes.AttributeValueMemberBOOL{Value: strings.Contains(results, "dkim=pass")},
+		"DMARC": &dynamodbTypes.AttributeValueMemberBOOL{Value: strings.Contains(results, "dmarc=pass")},
+		"SPF":   &dynamodbTypes.AttributeValueMemberBOOL{Value: strings.Contains(results, "spf=pass")},
+		"Virus": &dynamodbTypes.AttributeValueMemberBOOL{Value: strings.EqualFold(virus, statusPass)},
+	}}
+}
+
+// addresses returns the unique addresses in a header, formatted like SES common headers
+func addresses(envelope *enmime.Envelope, header string) []string {
+	list, err := envelope.AddressList(header)
+	if err != nil {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, address := range list {
+		if s := format.Address(address); !slices.Contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// bareAddresses returns the unique addresses in a header, without names
+func bareAddresses(envelope *enmime.Envelope, header string) []string {
+	list, err := envelope.AddressList(header)
+	if err != nil {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, address := range list {
+		if !slices.Contains(result, address.Address) {
+			result = append(result, address.Address)
+		}
+	}
+	return result
+}
+
+// setString sets a string attribute, unless the value is empty
+func setString(item map[string]dynamodbTypes.AttributeValue, name, value string) {
+	if value != "" {
+		item[name] = &dynamodbTypes.AttributeValueMemberS{Value: value}
+	}
+}
+
+// setStringSet sets a string set attribute, unless the set is empty, which DynamoDB rejects
+func setStringSet(item map[string]dynamodbTypes.AttributeValue, name string, value []string) {
+	if len(value) > 0 {
+		item[name] = &dynamodbTypes.AttributeValueMemberSS{Value: value}
+	}
+}
@@ -0,0 +1,355 @@
+// Package restore rebuilds emails in DynamoDB from the raw emails in storage,
+// e.g. after items are lost or stored incompletely.
+//
+// Emails are rebuilt with the same attributes as stored by emailReceive, and linked to their threads.
+// Attributes that can't be derived from the raw email, such as Unread and ThreadID, are kept for existing emails.
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/importer"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Modes of a restore
+const (
+	ModeApply  = "apply"   // write the changes
+	ModeDryRun = "dry-run" // report which emails would change, without writing
+	ModeDiff   = "diff"    // report which attributes would change, without writing
+)
+
+// Actions taken on an email
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionSkip      = "skip"
+	ActionFail      = "fail"
+)
+
+// Options controls how emails are restored
+type Options struct {
+	Mode string // ModeApply (default), ModeDryRun or ModeDiff
+	// Addresses are the addresses of the mailbox owner, used when imported emails are imported again
+	Addresses []string
+}
+
+// Change is a changed attribute of an email
+type Change struct {
+	Attribute string `json:"attribute"`
+	Old       string `json:"old,omitempty"`
+	New       string `json:"new,omitempty"`
+}
+
+// Entry is what is done to an email
+type Entry struct {
+	MessageID string   `json:"messageID"`
+	Action    string   `json:"action"`
+	Reason    string   `json:"reason,omitempty"`  // why the email is skipped or failed
+	Changes   []Change `json:"changes,omitempty"` // only reported in ModeApply and ModeDiff
+	ThreadID  string   `json:"threadID,omitempty"`
+
+	received time.Time
+	link     bool // whether the email may be linked to a thread
+}
+
+// Report is the result of restoring emails
+type Report struct {
+	Mode      string  `json:"mode"`
+	Scanned   int     `json:"scanned"`
+	Created   int     `json:"created"`
+	Updated   int     `json:"updated"`
+	Unchanged int     `json:"unchanged"`
+	Skipped   int     `json:"skipped"`
+	Failed    int     `json:"failed"`
+	Entries   []Entry `json:"entries"` // entries of the emails that are not unchanged
+}
+
+func (r *Report) add(entry Entry) {
+	switch entry.Action {
+	case ActionCreate:
+		r.Created++
+	case ActionUpdate:
+		r.Updated++
+	case ActionUnchanged:
+		r.Unchanged++
+		return
+	case ActionSkip:
+		r.Skipped++
+	case ActionFail:
+		r.Failed++
+	}
+	r.Entries = append(r.Entries, entry)
+}
+
+// Validate checks the options and fills in the default values
+func (opts *Options) Validate() error {
+	if opts.Mode == "" {
+		opts.Mode = ModeApply
+	}
+	if opts.Mode != ModeApply && opts.Mode != ModeDryRun && opts.Mode != ModeDiff {
+		return platform.ErrInvalidInput
+	}
+	return nil
+}
+
+// All restores every email in storage.
+//
+// Emails are first compared with the table, and then the changed ones are written in the order they are received,
+// so that replies are linked to the threads of the emails they reply to.
+// Failures of individual emails are reported, and the restore continues with the other emails.
+func All(ctx context.Context, client platform.RestoreEmailAPI, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Mode: opts.Mode}
+	var pending []Entry
+	err := storage.S3.ListEmails(ctx, client, func(messageID string) error {
+		report.Scanned++
+		p, err := check(ctx, client, messageID, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			report.add(failed(messageID, err))
+			return nil
+		}
+		if opts.Mode == ModeApply && needsWrite(&p.entry) {
+			// written after all emails are checked, in the order they are received
+			pending = append(pending, p.entry)
+			return nil
+		}
+		report.add(p.entry)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	slices.SortStableFunc(pending, func(a, b Entry) int {
+		return a.received.Compare(b.received)
+	})
+	for _, p := range pending {
+		entry, err := Email(ctx, client, p.MessageID, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report.add(failed(p.MessageID, err))
+			continue
+		}
+		report.add(*entry)
+	}
+	return report, nil
+}
+
+// Email restores an email from storage
+func Email(ctx context.Context, client platform.RestoreEmailAPI, messageID string, opts Options) (*Entry, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	p, err := check(ctx, client, messageID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Mode != ModeApply || !needsWrite(&p.entry) {
+		return &p.entry, nil
+	}
+
+	if err = p.apply(ctx, client, opts); err != nil {
+		return nil, err
+	}
+	return &p.entry, nil
+}
+
+// check rebuilds an email and compares it with the table, without writing
+func check(ctx context.Context, client platform.RestoreEmailAPI, messageID string, opts Options) (*restorePlan, error) {
+	p, err := plan(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Mode == ModeDryRun {
+		p.entry.Changes = nil
+	}
+	return p, nil
+}
+
+func needsWrite(entry *Entry) bool {
+	return entry.Action == ActionCreate || entry.Action == ActionUpdate || entry.link
+}
+
+func failed(messageID string, err error) Entry {
+	fmt.Printf("failed to restore email %s: %v\n", messageID, err)
+	return Entry{MessageID: messageID, Action: ActionFail, Reason: err.Error()}
+}
+
+// restorePlan is what is going to be written for an email
+type restorePlan struct {
+	entry Entry
+	email *rebuilt // nil for imported emails
+	raw   []byte
+}
+
+// plan rebuilds an email and compares it with the existing item
+func plan(ctx context.Context, client platform.RestoreEmailAPI, messageID string) (*restorePlan, error) {
+	p := &restorePlan{entry: Entry{MessageID: messageID}}
+
+	existing, err := getItem(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.raw, err = storage.S3.GetEmailRaw(ctx, client, messageID)
+	if err != nil {
+		if apiErr := new(s3Types.NoSuchKey); errors.As(err, &apiErr) {
+			p.entry.Action = ActionSkip
+			p.entry.Reason = "raw email not found"
+			return p, nil
+		}
+		return nil, err
+	}
+
+	if strings.HasPrefix(messageID, importer.IDPrefix) {
+		// imported emails are rebuilt by importing them again, which only happens if they are missing
+		if existing != nil {
+			p.entry.Action = ActionUnchanged
+		} else {
+			p.entry.Action = ActionCreate
+		}
+		return p, nil
+	}
+
+	var fallback time.Time
+	if existing != nil {
+		emailType, emailTime, err := email.UnmarshalGSI(existing)
+		if err != nil {
+			return nil, err
+		}
+		if emailType != model.EmailTypeInbox {
+			p.entry.Action = ActionSkip
+			p.entry.Reason = "not a received email"
+			return p, nil
+		}
+		fallback, _ = time.Parse(time.RFC3339, emailTime)
+	}
+
+	p.email, err = buildEmail(messageID, p.raw, fallback)
+	if err != nil {
+		return nil, err
+	}
+	p.entry.received = p.email.received
+
+	item := p.email.item
+	if existing == nil {
+		item["Unread"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		p.entry.Action = ActionCreate
+	} else {
+		// keep the attributes that can't be derived from the raw email
+		merged := maps.Clone(existing)
+		for _, name := range derivedAttributes {
+			delete(merged, name)
+		}
+		maps.Copy(merged, item)
+		p.email.item = merged
+		p.entry.Action = ActionUpdate
+	}
+
+	p.entry.Changes = diff(existing, p.email.item)
+	if len(p.entry.Changes) == 0 {
+		p.entry.Action = ActionUnchanged
+	}
+	if existing != nil {
+		if threadID, ok := existing["ThreadID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+			p.entry.ThreadID = threadID.Value
+		}
+	}
+	p.entry.link = p.entry.ThreadID == "" && (p.email.inReplyTo != "" || p.email.references != "")
+	return p, nil
+}
+
+// apply writes the planned email, and links it to its thread
+func (p *restorePlan) apply(ctx context.Context, client platform.RestoreEmailAPI, opts Options) error {
+	if p.email == nil {
+		_, err := importer.Import(ctx, client, p.raw, importer.Options{Addresses: opts.Addresses})
+		return err
+	}
+
+	if p.entry.link {
+		if p.entry.Action == ActionUnchanged {
+			// only write unchanged emails if there's a thread to link to
+			output, err := thread.DetermineThread(ctx, client, &thread.DetermineThreadInput{
+				InReplyTo:  p.email.inReplyTo,
+				References: p.email.references,
+			})
+			if err != nil {
+				return err
+			}
+			if output.ThreadID == "" {
+				return nil
+			}
+		}
+
+		err := thread.StoreEmail(ctx, client, &thread.StoreEmailInput{
+			Item:         p.email.item,
+			InReplyTo:    p.email.inReplyTo,
+			References:   p.email.references,
+			TimeReceived: format.RFC3399(p.email.received),
+		})
+		if err != nil {
+			return err
+		}
+		if threadID, ok := p.email.item["ThreadID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+			p.entry.ThreadID = threadID.Value
+			p.entry.Changes = append(p.entry.Changes, Change{Attribute: "ThreadID", New: threadID.Value})
+			if p.entry.Action == ActionUnchanged {
+				p.entry.Action = ActionUpdate
+			}
+		}
+		return nil
+	}
+
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item:      p.email.item,
+	})
+	return err
+}
+
+// getItem returns the item of an email, or nil if it doesn't exist
+func getItem(ctx context.Context, client platform.GetItemAPI, messageID string) (map[string]dynamodbTypes.AttributeValue, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, platform.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, nil
+	}
+	return resp.Item, nil
+}
@@ -0,0 +1,263 @@
+package restore
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/importer"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/thread"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEnv() {
+	env.Region = "us-west-2"
+	env.TableName = "table-for-restore"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiOriginalIndexName = "OriginalMessageIDIndex"
+	env.S3Bucket = "bucket-for-restore"
+}
+
+const originalEmail = "Return-Path: <sender@example.com>\r\n" +
+	"Received: from mail.example.com by inbound-smtp.us-west-2.amazonaws.com with SMTP id b-original for me@example.com; Sun, 01 Jan 2023 10:00:00 +0000 (UTC)\r\n" +
+	"X-SES-Spam-Verdict: PASS\r\n" +
+	"X-SES-Virus-Verdict: PASS\r\n" +
+	"Authentication-Results: amazonses.com; spf=pass (spfCheck: domain of example.com designates 192.0.2.1 as permitted sender) smtp.mailfrom=sender@example.com; dkim=pass header.i=@example.com; dmarc=fail header.from=example.com;\r\n" +
+	"From: Sender <sender@example.com>\r\n" +
+	"To: Me <me@example.com>, other@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"Date: Sun, 01 Jan 2023 09:59:58 +0000\r\n" +
+	"Message-ID: <original@example.com>\r\n" +
+	"\r\n" +
+	"Hello there\r\n"
+
+const replyEmail = "Return-Path: <sender@example.com>\r\n" +
+	"Received: from mail.example.com by inbound-smtp.us-west-2.amazonaws.com with SMTP id a-reply for me@example.com; Mon, 02 Jan 2023 10:00:00 +0000 (UTC)\r\n" +
+	"From: sender@example.com\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Re: Hello\r\n" +
+	"Date: Mon, 02 Jan 2023 10:00:00 +0000\r\n" +
+	"Message-ID: <reply@example.com>\r\n" +
+	"In-Reply-To: <original@example.com>\r\n" +
+	"\r\n" +
+	"Hi again\r\n"
+
+func putObject(t *testing.T, client *memory.Client, key, raw string) {
+	t.Helper()
+	_, err := client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: &env.S3Bucket,
+		Key:    &key,
+		Body:   strings.NewReader(raw),
+	})
+	assert.Nil(t, err)
+}
+
+func putItem(t *testing.T, client *memory.Client, item map[string]dynamodbTypes.AttributeValue) {
+	t.Helper()
+	_, err := client.PutItem(context.TODO(), &dynamodb.PutItemInput{TableName: &env.TableName, Item: item})
+	assert.Nil(t, err)
+}
+
+func stringValue(item map[string]dynamodbTypes.AttributeValue, name string) string {
+	if v, ok := item[name].(*dynamodbTypes.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func TestAll(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+	// the reply is listed first, but is written after the email it replies to
+	putObject(t, client, "a-reply", replyEmail)
+	putObject(t, client, "b-original", originalEmail)
+	putObject(t, client, "exports/export-1/inbox/2023-01.mbox", "From MAILER-DAEMON")
+
+	report, err := All(ctx, client, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, ModeApply, report.Mode)
+	assert.Equal(t, 2, report.Scanned, "exports are not emails")
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, []string{"b-original", "a-reply"}, []string{report.Entries[0].MessageID, report.Entries[1].MessageID})
+
+	item := client.Item(env.TableName, "b-original")
+	assert.Equal(t, "inbox#2023-01", stringValue(item, "TypeYearMonth"))
+	assert.Equal(t, "01-10:00:00", stringValue(item, "DateTime"))
+	assert.Equal(t, "2023-01-01T09:59:58Z", stringValue(item, "DateSent"))
+	assert.Equal(t, "<original@example.com>", stringValue(item, "OriginalMessageID"))
+	assert.Equal(t, "sender@example.com", stringValue(item, "Source"))
+	assert.Equal(t, "sender@example.com", stringValue(item, "ReturnPath"))
+	assert.Equal(t, []string{"me@example.com"}, item["Destination"].(*dynamodbTypes.AttributeValueMemberSS).Value)
+	assert.Equal(t, []string{"Sender <sender@example.com>"}, item["From"].(*dynamodbTypes.AttributeValueMemberSS).Value)
+	assert.Equal(t, []string{"Me <me@example.com>", "other@example.com"}, item["To"].(*dynamodbTypes.AttributeValueMemberSS).Value)
+	assert.Equal(t, "Hello there\r\n", stringValue(item, "Text"))
+	assert.Equal(t, true, item["Unread"].(*dynamodbTypes.AttributeValueMemberBOOL).Value)
+	verdict := item["Verdict"].(*dynamodbTypes.AttributeValueMemberM).Value
+	for name, expected := range map[string]bool{"Spam": true, "Virus": true, "SPF": true, "DKIM": true, "DMARC": false} {
+		assert.Equal(t, expected, verdict[name].(*dynamodbTypes.AttributeValueMemberBOOL).Value, name)
+	}
+
+	reply := client.Item(env.TableName, "a-reply")
+	assert.Equal(t, "<original@example.com>", stringValue(reply, "InReplyTo"))
+	assert.NotContains(t, reply, "Verdict", "not received by SES")
+	threadID := stringValue(reply, "ThreadID")
+	assert.NotEmpty(t, threadID)
+	assert.Equal(t, threadID, report.Entries[1].ThreadID)
+	th, err := thread.GetThread(ctx, client, threadID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b-original", "a-reply"}, th.EmailIDs)
+
+	// restoring again changes nothing
+	count := client.ItemCount(env.TableName)
+	report, err = All(ctx, client, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, &Report{Mode: ModeApply, Scanned: 2, Unchanged: 2}, report)
+	assert.Equal(t, count, client.ItemCount(env.TableName))
+}
+
+func TestAll_Update(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+	putObject(t, client, "b-original", originalEmail)
+	putObject(t, client, "a-reply", replyEmail)
+	putItem(t, client, map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "b-original"},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2023-01"},
+		"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "01-10:00:00"},
+		"Subject":       &dynamodbTypes.AttributeValueMemberS{Value: "Hello"},
+		"Unread":        &dynamodbTypes.AttributeValueMemberBOOL{Value: false},
+		"TrashedTime":   &dynamodbTypes.AttributeValueMemberS{Value: "2023-01-05T00:00:00Z"},
+	})
+
+	report, err := All(ctx, client, Options{Mode: ModeDryRun})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 1, report.Updated)
+	for _, entry := range report.Entries {
+		assert.Nil(t, entry.Changes)
+	}
+	assert.Equal(t, 1, client.ItemCount(env.TableName), "dry-run doesn't write")
+
+	report, err = All(ctx, client, Options{Mode: ModeDiff})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, client.ItemCount(env.TableName), "diff doesn't write")
+	var updated Entry
+	for _, entry := range report.Entries {
+		if entry.Action == ActionUpdate {
+			updated = entry
+		}
+	}
+	assert.Equal(t, "b-original", updated.MessageID)
+	assert.Contains(t, updated.Changes, Change{Attribute: "OriginalMessageID", New: `"<original@example.com>"`})
+	for _, change := range updated.Changes {
+		assert.NotEqual(t, "Unread", change.Attribute)
+		assert.NotEqual(t, "Subject", change.Attribute)
+	}
+
+	report, err = All(ctx, client, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 1, report.Updated)
+	item := client.Item(env.TableName, "b-original")
+	assert.Equal(t, "<original@example.com>", stringValue(item, "OriginalMessageID"))
+	assert.Equal(t, false, item["Unread"].(*dynamodbTypes.AttributeValueMemberBOOL).Value, "Unread is kept")
+	assert.Equal(t, "2023-01-05T00:00:00Z", stringValue(item, "TrashedTime"))
+	assert.NotEmpty(t, stringValue(client.Item(env.TableName, "a-reply"), "ThreadID"))
+}
+
+func TestAll_LinkExisting(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+	putObject(t, client, "a-reply", replyEmail)
+	_, err := All(ctx, client, Options{})
+	assert.Nil(t, err)
+	assert.Empty(t, stringValue(client.Item(env.TableName, "a-reply"), "ThreadID"), "nothing to link to yet")
+
+	// the reply is unchanged, but is linked to the thread once the original email is restored
+	putObject(t, client, "b-original", originalEmail)
+	report, err := All(ctx, client, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 1, report.Updated)
+	threadID := stringValue(client.Item(env.TableName, "a-reply"), "ThreadID")
+	assert.NotEmpty(t, threadID)
+	assert.Equal(t, threadID, stringValue(client.Item(env.TableName, "b-original"), "ThreadID"))
+}
+
+func TestEmail(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+
+	entry, err := Email(ctx, client, "missing", Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, &Entry{MessageID: "missing", Action: ActionSkip, Reason: "raw email not found"}, entry)
+
+	putObject(t, client, "sent-1", originalEmail)
+	putItem(t, client, map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "sent-1"},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "sent#2023-01"},
+		"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "01-10:00:00"},
+	})
+	entry, err = Email(ctx, client, "sent-1", Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, ActionSkip, entry.Action)
+
+	putObject(t, client, "no-time", "From: sender@example.com\r\nSubject: no time\r\n\r\nbody\r\n")
+	_, err = Email(ctx, client, "no-time", Options{})
+	assert.Equal(t, ErrUnknownTime, err)
+
+	_, err = Email(ctx, client, "no-time", Options{Mode: "unknown"})
+	assert.Equal(t, platform.ErrInvalidInput, err)
+}
+
+func TestEmail_Imported(t *testing.T) {
+	setupEnv()
+	client := memory.NewClient()
+	ctx := context.TODO()
+	raw := "From: me@example.com\r\nTo: sender@example.com\r\nSubject: imported\r\nDate: Sun, 01 Jan 2023 10:00:00 +0000\r\nMessage-ID: <imported@example.com>\r\n\r\nbody\r\n"
+	result, err := importer.Import(ctx, client, []byte(raw), importer.Options{})
+	assert.Nil(t, err)
+	_, err = client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &env.TableName,
+		Key:       map[string]dynamodbTypes.AttributeValue{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: result.MessageID}},
+	})
+	assert.Nil(t, err)
+
+	entry, err := Email(ctx, client, result.MessageID, Options{Addresses: []string{"me@example.com"}})
+	assert.Nil(t, err)
+	assert.Equal(t, ActionCreate, entry.Action)
+	assert.Equal(t, "sent#2023-01", stringValue(client.Item(env.TableName, result.MessageID), "TypeYearMonth"))
+
+	entry, err = Email(ctx, client, result.MessageID, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, ActionUnchanged, entry.Action)
+}
+
+func TestDiff(t *testing.T) {
+	old := map[string]dynamodbTypes.AttributeValue{
+		"To":      &dynamodbTypes.AttributeValueMemberSS{Value: []string{"b", "a"}},
+		"Subject": &dynamodbTypes.AttributeValueMemberS{Value: "old"},
+		"Unread":  &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+	}
+	updated := map[string]dynamodbTypes.AttributeValue{
+		"To":      &dynamodbTypes.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"Subject": &dynamodbTypes.AttributeValueMemberS{Value: strings.Repeat("x", 100)},
+		"Text":    &dynamodbTypes.AttributeValueMemberS{Value: "text"},
+	}
+
+	assert.Equal(t, []Change{
+		{Attribute: "Subject", Old: `"old"`, New: `"` + strings.Repeat("x", 79) + "…"},
+		{Attribute: "Text", New: `"text"`},
+		{Attribute: "Unread", Old: "true"},
+	}, diff(old, updated))
+}
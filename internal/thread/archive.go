@@ -0,0 +1,118 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Archive archives a thread and its received emails.
+// Emails that are already archived are left as they are, and the others are marked with ArchivedByThread,
+// so that Unarchive only restores the emails archived with the thread.
+func Archive(ctx context.Context, client platform.UpdateThreadAPI, threadID string) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	if thread.ArchivedTime != nil {
+		return &platform.AlreadyArchivedError{Type: "thread"}
+	}
+
+	archivedTime := &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	var updates []*dynamodbTypes.Update
+	for _, email := range thread.Emails {
+		if email.MessageID == "" || email.Type != model.EmailTypeInbox || email.ArchivedTime != "" {
+			continue
+		}
+		updates = append(updates, &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: email.MessageID},
+			},
+			UpdateExpression:    aws.String("SET ArchivedTime = :archivedTime, ArchivedByThread = :true"),
+			ConditionExpression: aws.String("attribute_not_exists(ArchivedTime)"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":archivedTime": archivedTime,
+				":true":         &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+			},
+		})
+	}
+
+	err = updateWithEmails(ctx, client, &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+		UpdateExpression:    aws.String("SET ArchivedTime = :archivedTime"),
+		ConditionExpression: aws.String("attribute_not_exists(ArchivedTime)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":archivedTime": archivedTime,
+		},
+	}, updates)
+	if err != nil {
+		if errors.Is(err, errThreadConditionFailed) {
+			return &platform.AlreadyArchivedError{Type: "thread"}
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionArchived, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("archive thread finished successfully")
+	return nil
+}
+
+// Unarchive restores an archived thread, and the emails archived together with it.
+// Emails archived individually before the thread stay archived.
+func Unarchive(ctx context.Context, client platform.UpdateThreadAPI, threadID string) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	if thread.ArchivedTime == nil {
+		return &platform.NotArchivedError{Type: "thread"}
+	}
+
+	var updates []*dynamodbTypes.Update
+	for _, email := range thread.Emails {
+		if email.MessageID == "" || !email.ArchivedByThread {
+			continue
+		}
+		updates = append(updates, &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: email.MessageID},
+			},
+			UpdateExpression:    aws.String("REMOVE ArchivedTime, ArchivedByThread"),
+			ConditionExpression: aws.String("attribute_exists(ArchivedByThread)"),
+		})
+	}
+
+	err = updateWithEmails(ctx, client, &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+		UpdateExpression:    aws.String("REMOVE ArchivedTime"),
+		ConditionExpression: aws.String("attribute_exists(ArchivedTime)"),
+	}, updates)
+	if err != nil {
+		if errors.Is(err, errThreadConditionFailed) {
+			return &platform.NotArchivedError{Type: "thread"}
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUnarchived, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("unarchive thread finished successfully")
+	return nil
+}
@@ -0,0 +1,62 @@
+package thread
+
+import (
+	"context"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+// archiveState returns whether each email is archived, and whether it's archived by its thread
+func archiveState(t *testing.T, client *memory.Client, ids ...string) map[string][2]bool {
+	t.Helper()
+	state := map[string][2]bool{}
+	for _, id := range ids {
+		result, err := email.Get(context.TODO(), client, id)
+		assert.Nil(t, err)
+		state[id] = [2]bool{result.ArchivedTime != "", result.ArchivedByThread}
+	}
+	return state
+}
+
+func TestArchive(t *testing.T) {
+	env.TableName = "table-for-archive-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"inbox-1", "inbox", "01"},
+		[3]string{"inbox-2", "inbox", "01"},
+		[3]string{"sent-1", "sent", "01"},
+	)
+	assert.Nil(t, email.Archive(ctx, client, "inbox-2"))
+
+	assert.Nil(t, Archive(ctx, client, "thread"))
+	thread, err := GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.NotNil(t, thread.ArchivedTime)
+	assert.Nil(t, thread.TrashedTime)
+	assert.Equal(t, map[string][2]bool{
+		"inbox-1": {true, true},
+		"inbox-2": {true, false}, // archived before the thread
+		"sent-1":  {false, false},
+	}, archiveState(t, client, "inbox-1", "inbox-2", "sent-1"))
+	assert.Equal(t, &platform.AlreadyArchivedError{Type: "thread"}, Archive(ctx, client, "thread"))
+
+	assert.Nil(t, Unarchive(ctx, client, "thread"))
+	thread, err = GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Nil(t, thread.ArchivedTime)
+	assert.Equal(t, map[string][2]bool{
+		"inbox-1": {false, false},
+		"inbox-2": {true, false},
+		"sent-1":  {false, false},
+	}, archiveState(t, client, "inbox-1", "inbox-2", "sent-1"))
+
+	assert.Equal(t, &platform.NotArchivedError{Type: "thread"}, Unarchive(ctx, client, "thread"))
+	assert.Equal(t, platform.ErrNotFound, Archive(ctx, client, "not-exist"))
+}
@@ -4,75 +4,179 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
-// Delete deletes a trashed thread as well as its emails from DynamoDB and S3.
-// It will return an error if the thread is not trashed.
-func Delete(ctx context.Context, client platform.DeleteThreadAPI, messageID string) error {
-	thread, err := GetThread(ctx, client, messageID)
+const (
+	// deleteConcurrency is the number of emails deleted at the same time
+	deleteConcurrency = 8
+	// deleteReserve is the time reserved before the deadline of ctx to stop deleting and report the progress
+	deleteReserve = 2 * time.Second
+)
+
+// DeleteResult represents the progress of Delete
+type DeleteResult struct {
+	Deleted   int  `json:"deleted"`   // number of emails deleted by this call
+	Remaining int  `json:"remaining"` // number of emails not deleted yet
+	Done      bool `json:"done"`      // true if the thread itself is deleted
+}
+
+// Delete deletes a trashed thread, its emails and its draft from DynamoDB, as well as their raw emails in S3.
+// Attachments and other parts are extracted from raw emails when requested, so there are no other objects.
+//
+// Each email is deleted from S3 before DynamoDB, and the thread is deleted last,
+// so Delete can be called again to resume if it's interrupted.
+// When ctx is about to expire, Delete stops and returns the progress with Done being false.
+// It will return an error if the thread or any of its emails is not trashed, and nothing is deleted in that case.
+func Delete(ctx context.Context, client platform.DeleteThreadAPI, threadID string) (*DeleteResult, error) {
+	thread, err := GetThread(ctx, client, threadID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if thread.TrashedTime != nil {
-		return &platform.NotTrashedError{Type: "thread"}
+	if thread.TrashedTime == nil {
+		return nil, &platform.NotTrashedError{Type: "thread"}
 	}
 
-	transactWriteItems := make([]dynamodbTypes.TransactWriteItem, len(thread.EmailIDs)+1)
-	// delete thread
-	transactWriteItems[0] = dynamodbTypes.TransactWriteItem{
-		Delete: &dynamodbTypes.Delete{
-			TableName: aws.String(env.TableName),
-			Key: map[string]dynamodbTypes.AttributeValue{
-				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
-			},
-			ConditionExpression: aws.String("(attribute_exists(TrashedTime)"),
-		},
+	ids := thread.EmailIDs
+	if thread.DraftID != "" {
+		ids = append(ids, thread.DraftID)
 	}
-
-	// delete emails
-	for i, emailID := range thread.EmailIDs {
-		transactWriteItems[i+1] = dynamodbTypes.TransactWriteItem{
-			Delete: &dynamodbTypes.Delete{
-				TableName: aws.String(env.TableName),
-				Key: map[string]dynamodbTypes.AttributeValue{
-					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: emailID},
-				},
-				ConditionExpression: aws.String("(attribute_exists(TrashedTime) OR begins_with(TypeYearMonth, :v_type)) AND attribute_exists(ThreadID)"),
-				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
-					":v_type": &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeDraft},
-				},
-			},
+	// emails that no longer exist are deleted by an earlier call, including their raw emails
+	items, err := batchGetItems(ctx, client, ids)
+	if err != nil {
+		return nil, err
+	}
+	var emails []*email.GetResult
+	for _, item := range items {
+		e, err := email.ParseGetResult(item)
+		if err != nil {
+			return nil, err
+		}
+		if e.TrashedTime == "" && e.Type != model.EmailTypeDraft {
+			return nil, &platform.NotTrashedError{Type: "email"}
 		}
+		emails = append(emails, e)
 	}
 
-	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: transactWriteItems,
+	result, err := deleteEmails(ctx, client, threadID, emails)
+	if err != nil || result.Remaining > 0 {
+		fmt.Printf("deleted %d emails of thread %s, %d remaining\n", result.Deleted, threadID, result.Remaining)
+		return result, err
+	}
+
+	_, err = client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+		ConditionExpression: aws.String("attribute_exists(TrashedTime)"),
 	})
 	if err != nil {
-		var condFailedErr *dynamodbTypes.ConditionalCheckFailedException
-		if errors.As(err, &condFailedErr) {
-			// TODO: more specific error checking
-			return &platform.NotTrashedError{Type: "thread"}
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return result, &platform.NotTrashedError{Type: "thread"}
 		}
-		return err
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return result, platform.ErrTooManyRequests
+		}
+		return result, err
 	}
+	result.Done = true
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionDeleted, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("delete thread finished successfully")
+	return result, nil
+}
 
-	err = storage.S3.DeleteEmail(ctx, client, messageID)
+// deleteEmails deletes the emails concurrently, until they're all deleted, an error occurs, or ctx is about to expire
+func deleteEmails(ctx context.Context, client platform.DeleteThreadAPI, threadID string, emails []*email.GetResult) (*DeleteResult, error) {
+	stop := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		stop, cancel = context.WithDeadline(ctx, deadline.Add(-deleteReserve))
+		defer cancel()
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	result := &DeleteResult{Remaining: len(emails)}
+	pending := make(chan *email.GetResult)
+	var wg sync.WaitGroup
+	for range min(deleteConcurrency, len(emails)) {
+		wg.Go(func() {
+			for e := range pending {
+				err := deleteEmail(ctx, client, threadID, e)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					result.Deleted++
+					result.Remaining--
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+feed:
+	for _, e := range emails {
+		mu.Lock()
+		failed := len(errs) > 0
+		mu.Unlock()
+		if failed || stop.Err() != nil {
+			break
+		}
+		select {
+		case pending <- e:
+		case <-stop.Done():
+			break feed
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	return result, errors.Join(errs...)
+}
+
+// deleteEmail deletes the raw emails of all deliveries from S3, then the email from DynamoDB
+func deleteEmail(ctx context.Context, client platform.DeleteThreadAPI, threadID string, e *email.GetResult) error {
+	for _, id := range append([]string{e.MessageID}, e.Deliveries...) {
+		err := storage.S3.DeleteEmail(ctx, client, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete raw email %s: %w", id, err)
+		}
+	}
+
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: e.MessageID},
+		},
+		ConditionExpression: aws.String("(attribute_exists(TrashedTime) OR begins_with(TypeYearMonth, :v_type)) AND ThreadID = :threadID"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":v_type":   &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeDraft},
+			":threadID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+	})
 	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return &platform.NotTrashedError{Type: "email"}
+		}
 		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
 			return platform.ErrTooManyRequests
 		}
 		return err
 	}
-
-	fmt.Println("delete thread finished successfully")
 	return nil
 }
@@ -0,0 +1,111 @@
+package thread
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+// putRawEmails puts the raw emails to S3
+func putRawEmails(t *testing.T, client *memory.Client, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		assert.Nil(t, storage.S3.PutEmail(context.TODO(), client, id, []byte("Subject: "+id+"\r\n\r\nbody")))
+	}
+}
+
+// exists returns whether the email exists in DynamoDB and S3
+func exists(t *testing.T, client *memory.Client, id string) [2]bool {
+	t.Helper()
+	ctx := context.TODO()
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+		},
+	})
+	assert.Nil(t, err)
+	_, err = storage.S3.GetEmailRaw(ctx, client, id)
+	return [2]bool{len(resp.Item) > 0, err == nil}
+}
+
+func TestDelete(t *testing.T) {
+	env.TableName = "table-for-delete-thread"
+	env.S3Bucket = "bucket-for-delete-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"inbox-1", "inbox", "01"},
+		[3]string{"sent-1", "sent", "01"},
+		[3]string{"draft-1", "draft", "01"},
+	)
+	putRawEmails(t, client, "inbox-1", "sent-1")
+
+	_, err := Delete(ctx, client, "thread")
+	assert.Equal(t, &platform.NotTrashedError{Type: "thread"}, err)
+	_, err = Delete(ctx, client, "not-exist")
+	assert.Equal(t, platform.ErrNotFound, err)
+
+	assert.Nil(t, Trash(ctx, client, "thread"))
+	assert.Nil(t, email.Untrash(ctx, client, "sent-1"))
+	_, err = Delete(ctx, client, "thread")
+	assert.Equal(t, &platform.NotTrashedError{Type: "email"}, err)
+	assert.Equal(t, [2]bool{true, true}, exists(t, client, "inbox-1"), "nothing is deleted")
+
+	assert.Nil(t, email.Trash(ctx, client, "sent-1"))
+	result, err := Delete(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Equal(t, &DeleteResult{Deleted: 3, Done: true}, result)
+	for _, id := range []string{"thread", "inbox-1", "sent-1", "draft-1"} {
+		assert.Equal(t, [2]bool{false, false}, exists(t, client, id), id)
+	}
+}
+
+func TestDelete_LargeThread(t *testing.T) {
+	env.TableName = "table-for-delete-large-thread"
+	env.S3Bucket = "bucket-for-delete-large-thread"
+	env.QueueName = ""
+	client := memory.NewClient()
+
+	var ids []string
+	var emails [][3]string
+	for i := range 250 {
+		ids = append(ids, "inbox-"+strconv.Itoa(i))
+		emails = append(emails, [3]string{ids[i], "inbox", "01"})
+	}
+	putEmailsInThread(t, client, "thread", emails...)
+	putRawEmails(t, client, ids...)
+	assert.Nil(t, Trash(context.TODO(), client, "thread"))
+
+	// the deadline is too close to delete anything
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	result, err := Delete(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Equal(t, &DeleteResult{Remaining: 250}, result)
+	assert.True(t, exists(t, client, "thread")[0])
+
+	// delete some emails as if an earlier call is interrupted
+	for _, e := range ids[:100] {
+		assert.Nil(t, deleteEmail(context.TODO(), client, "thread", &email.GetResult{MessageID: e}))
+	}
+
+	result, err = Delete(context.TODO(), client, "thread")
+	assert.Nil(t, err)
+	assert.Equal(t, &DeleteResult{Deleted: 150, Done: true}, result)
+	for _, id := range append(ids, "thread") {
+		assert.Equal(t, [2]bool{false, false}, exists(t, client, id), id)
+	}
+}
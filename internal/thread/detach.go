@@ -0,0 +1,70 @@
+package thread
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Detach removes an email from its thread, so that it can be deleted like an email that isn't in a thread.
+// The thread is deleted if it has no other emails, and its draft is detached as well.
+// All changes are applied in one transaction, which fails with platform.ErrConflict if the thread is changed meanwhile.
+func Detach(ctx context.Context, client platform.UpdateThreadAPI, threadID, emailID string) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	if thread.TrashedTime != nil {
+		return platform.ErrThreadTrashed
+	}
+	i := slices.Index(thread.EmailIDs, emailID)
+	if i < 0 || thread.Emails[i].MessageID == "" {
+		return platform.ErrNotFound
+	}
+	rest := existingEmails(slices.Delete(slices.Clone(thread.Emails), i, i+1))
+
+	items := []dynamodbTypes.TransactWriteItem{{Update: unlinkEmail(&thread.Emails[i])}}
+	action := hook.ActionUpdated
+	if len(rest) == 0 {
+		action = hook.ActionDeleted
+		if thread.Draft != nil {
+			items = append(items, dynamodbTypes.TransactWriteItem{Update: unlinkEmail(thread.Draft)})
+		}
+		deletion := &dynamodbTypes.Delete{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+			},
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{},
+		}
+		deletion.ConditionExpression = aws.String(unchangedCondition(thread, deletion.ExpressionAttributeValues))
+		items = append(items, dynamodbTypes.TransactWriteItem{Delete: deletion})
+	} else {
+		for j, e := range rest {
+			if update := relinkEmail(e, threadID, j == len(rest)-1, nil); update != nil {
+				items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+			}
+		}
+		update, err := threadUpdate(thread, rest, thread.DraftID)
+		if err != nil {
+			return err
+		}
+		items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+	}
+
+	err = transactItems(ctx, client, items)
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: action, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("detach email finished successfully")
+	return nil
+}
@@ -0,0 +1,57 @@
+package thread
+
+import (
+	"context"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetach(t *testing.T) {
+	env.TableName = "table-for-detach-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"email-1", "inbox", "01"},
+		[3]string{"email-2", "inbox", "02"},
+		[3]string{"draft", "draft", "03"},
+	)
+
+	assert.Nil(t, Detach(ctx, client, "thread", "email-2"))
+	thread, err := GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"email-1"}, thread.EmailIDs)
+	assert.Equal(t, "draft", thread.DraftID)
+	assert.Equal(t, 1, thread.UnreadCount)
+	assert.Equal(t, map[string]string{
+		"email-1": "thread latest",
+		"email-2": "",
+	}, threadOf(t, client, "email-1", "email-2"))
+	assert.Equal(t, platform.ErrNotFound, Detach(ctx, client, "thread", "email-2"))
+
+	assert.Nil(t, Detach(ctx, client, "thread", "email-1"))
+	_, err = GetThread(ctx, client, "thread")
+	assert.Equal(t, platform.ErrNotFound, err, "the thread without emails is deleted")
+	draft, err := email.Get(ctx, client, "draft")
+	assert.Nil(t, err)
+	assert.Empty(t, draft.ThreadID)
+}
+
+func TestDetach_Trashed(t *testing.T) {
+	env.TableName = "table-for-detach-thread-trashed"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"email-1", "inbox", "01"},
+		[3]string{"email-2", "inbox", "02"},
+	)
+
+	assert.Nil(t, Trash(ctx, client, "thread"))
+	assert.Equal(t, platform.ErrThreadTrashed, Detach(ctx, client, "thread", "email-1"))
+}
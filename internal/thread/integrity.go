@@ -0,0 +1,383 @@
+package thread
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Kinds of problems found by Check
+const (
+	ProblemDanglingEmail     = "dangling-email"     // EmailIDs has an email that doesn't exist, is a draft, or is listed twice
+	ProblemWrongThread       = "wrong-thread"       // EmailIDs has an email whose ThreadID is another thread
+	ProblemMissingThreadID   = "missing-thread-id"  // EmailIDs or DraftID has an email whose ThreadID isn't set or is a missing thread
+	ProblemUnlistedEmail     = "unlisted-email"     // ThreadID of an email is a thread that doesn't list it
+	ProblemMissingThread     = "missing-thread"     // ThreadID of an email is a thread that doesn't exist
+	ProblemMultipleLatest    = "multiple-latest"    // IsThreadLatest is set on an email that isn't the last one
+	ProblemMissingLatest     = "missing-latest"     // IsThreadLatest isn't set on the last email
+	ProblemDanglingDraft     = "dangling-draft"     // DraftID is a draft that doesn't exist or belongs to another thread
+	ProblemUnreferencedDraft = "unreferenced-draft" // ThreadID of a draft is a thread whose DraftID is another draft or not set
+	ProblemTimeUpdated       = "time-updated"       // TimeUpdated isn't the time of the last email
+	ProblemUnreadCount       = "unread-count"       // UnreadCount isn't the number of unread emails
+	ProblemEmptyThread       = "empty-thread"       // the thread has no email
+)
+
+// CheckOptions controls how threads are checked
+type CheckOptions struct {
+	Repair bool // if true, the problems are fixed
+}
+
+// Problem is an inconsistency between a thread and its emails
+type Problem struct {
+	Kind      string `json:"kind"`
+	ThreadID  string `json:"threadID"`
+	MessageID string `json:"messageID,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// CheckReport is the result of checking threads
+type CheckReport struct {
+	Threads  int       `json:"threads"` // number of threads scanned
+	Emails   int       `json:"emails"`  // number of emails and drafts scanned
+	Problems []Problem `json:"problems"`
+	Repaired int       `json:"repaired"` // number of threads repaired, including missing threads whose emails are unlinked
+	Failed   int       `json:"failed"`   // number of threads failed to repair, which can be checked again
+}
+
+func (r *CheckReport) add(kind, threadID, messageID, detail string) {
+	r.Problems = append(r.Problems, Problem{Kind: kind, ThreadID: threadID, MessageID: messageID, Detail: detail})
+}
+
+// threadState is a thread being checked, and how it should be
+type threadState struct {
+	thread  *Thread
+	emails  []*email.GetResult // emails of the thread, in order
+	draft   *email.GetResult
+	unlink  []*email.GetResult // emails and drafts to be removed from the thread
+	changed bool               // whether the thread item needs to be updated
+}
+
+// Check scans every thread and email, and reports inconsistencies between EmailIDs and DraftID of threads
+// and ThreadID and IsThreadLatest of emails, as well as wrong TimeUpdated and UnreadCount of threads.
+//
+// ThreadID of an email wins over EmailIDs of another thread, and emails missing from their thread are inserted by time.
+// With opts.Repair, every thread with problems is repaired with its emails.
+// A thread that fails to repair, e.g. because it's changed meanwhile, is counted and the others are still repaired.
+func Check(ctx context.Context, client platform.CheckThreadsAPI, opts CheckOptions) (*CheckReport, error) {
+	threads, emails, err := scanThreads(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	report := &CheckReport{Threads: len(threads), Emails: len(emails), Problems: []Problem{}}
+	threadIDs := slices.Sorted(maps.Keys(threads))
+	emailIDs := slices.Sorted(maps.Keys(emails))
+
+	states := make(map[string]*threadState, len(threads))
+	listed := map[string]bool{}
+	for _, id := range threadIDs {
+		state := &threadState{thread: threads[id]}
+		states[id] = state
+		for _, emailID := range state.thread.EmailIDs {
+			e, ok := emails[emailID]
+			switch {
+			case !ok || e.Type == model.EmailTypeDraft:
+				report.add(ProblemDanglingEmail, id, emailID, "")
+				state.changed = true
+			case e.ThreadID != id && threads[e.ThreadID] != nil:
+				report.add(ProblemWrongThread, id, emailID, "in thread "+e.ThreadID)
+				state.changed = true
+			case listed[emailID]:
+				report.add(ProblemDanglingEmail, id, emailID, "listed more than once")
+				state.changed = true
+			default:
+				if e.ThreadID != id {
+					report.add(ProblemMissingThreadID, id, emailID, e.ThreadID)
+				}
+				listed[emailID] = true
+				state.emails = append(state.emails, e)
+			}
+		}
+	}
+
+	orphans := map[string]*threadState{} // emails of missing threads, by the thread IDs
+	for _, emailID := range emailIDs {
+		e := emails[emailID]
+		if e.ThreadID == "" || listed[emailID] {
+			continue
+		}
+		state := states[e.ThreadID]
+		switch {
+		case state == nil:
+			report.add(ProblemMissingThread, e.ThreadID, emailID, "")
+			if orphans[e.ThreadID] == nil {
+				orphans[e.ThreadID] = &threadState{}
+			}
+			orphans[e.ThreadID].unlink = append(orphans[e.ThreadID].unlink, e)
+		case e.Type != model.EmailTypeDraft:
+			report.add(ProblemUnlistedEmail, e.ThreadID, emailID, "")
+			state.emails = insertByTime(state.emails, e)
+			state.changed = true
+		}
+	}
+
+	for _, id := range threadIDs {
+		state := states[id]
+		checkDraft(report, state, emails, emailIDs)
+		checkEmails(report, state)
+	}
+
+	if !opts.Repair {
+		return report, nil
+	}
+	for _, id := range slices.Sorted(maps.Keys(orphans)) {
+		repairThread(ctx, client, report, id, orphans[id])
+	}
+	for _, id := range threadIDs {
+		repairThread(ctx, client, report, id, states[id])
+	}
+	return report, nil
+}
+
+// checkDraft checks DraftID of a thread, and the drafts whose ThreadID is the thread
+func checkDraft(report *CheckReport, state *threadState, emails map[string]*email.GetResult, emailIDs []string) {
+	id := state.thread.MessageID
+	if draftID := state.thread.DraftID; draftID != "" {
+		draft, ok := emails[draftID]
+		switch {
+		case !ok || draft.Type != model.EmailTypeDraft || draft.ThreadID != "" && draft.ThreadID != id:
+			report.add(ProblemDanglingDraft, id, draftID, "")
+			state.changed = true
+		default:
+			if draft.ThreadID == "" {
+				report.add(ProblemMissingThreadID, id, draftID, "")
+			}
+			state.draft = draft
+		}
+	}
+
+	for _, draftID := range emailIDs {
+		draft := emails[draftID]
+		if draft.Type != model.EmailTypeDraft || draft.ThreadID != id || draft == state.draft {
+			continue
+		}
+		report.add(ProblemUnreferencedDraft, id, draftID, "")
+		if state.draft == nil {
+			state.draft = draft
+			state.changed = true
+		} else {
+			state.unlink = append(state.unlink, draft)
+		}
+	}
+}
+
+// checkEmails checks IsThreadLatest of the emails, and the attributes derived from them
+func checkEmails(report *CheckReport, state *threadState) {
+	id := state.thread.MessageID
+	if len(state.emails) == 0 {
+		report.add(ProblemEmptyThread, id, "", "")
+		state.changed = true
+		if state.draft != nil && state.draft.ThreadID != "" {
+			// the draft is kept without the thread
+			state.unlink = append(state.unlink, state.draft)
+		}
+		state.draft = nil
+		return
+	}
+
+	last := len(state.emails) - 1
+	unreadCount := 0
+	for i, e := range state.emails {
+		switch {
+		case i == last && !e.IsThreadLatest:
+			report.add(ProblemMissingLatest, id, e.MessageID, "")
+		case i != last && e.IsThreadLatest:
+			report.add(ProblemMultipleLatest, id, e.MessageID, "")
+		}
+		if e.Unread != nil && *e.Unread {
+			unreadCount++
+		}
+	}
+
+	if timeUpdated := state.emails[last].Time(); state.thread.TimeUpdated != timeUpdated {
+		report.add(ProblemTimeUpdated, id, "", state.thread.TimeUpdated+" -> "+timeUpdated)
+		state.changed = true
+	}
+	if state.thread.UnreadCount != unreadCount {
+		report.add(ProblemUnreadCount, id, "", strconv.Itoa(state.thread.UnreadCount)+" -> "+strconv.Itoa(unreadCount))
+		state.changed = true
+	}
+}
+
+// repairThread repairs a thread and its emails, and counts the result in the report
+func repairThread(ctx context.Context, client platform.TransactWriteItemsAPI, report *CheckReport, id string, state *threadState) {
+	updates := repairUpdates(id, state)
+	if len(updates) == 0 && !state.changed {
+		return
+	}
+	err := repair(ctx, client, state, updates)
+	if err != nil {
+		fmt.Printf("failed to repair thread %s: %v\n", id, err)
+		report.Failed++
+		return
+	}
+	report.Repaired++
+}
+
+// repairUpdates returns the updates of the emails and drafts of a thread
+func repairUpdates(id string, state *threadState) []*dynamodbTypes.Update {
+	var updates []*dynamodbTypes.Update
+	for i, e := range state.emails {
+		if update := relinkEmail(e, id, i == len(state.emails)-1, nil); update != nil {
+			updates = append(updates, update)
+		}
+	}
+	if state.draft != nil {
+		if update := relinkEmail(state.draft, id, false, nil); update != nil {
+			updates = append(updates, update)
+		}
+	}
+	for _, e := range state.unlink {
+		updates = append(updates, unlinkEmail(e))
+	}
+	return updates
+}
+
+// repair applies the updates of emails, and then updates or deletes the thread.
+// The thread must be unchanged since the scan, while it may be trashed.
+func repair(ctx context.Context, client platform.TransactWriteItemsAPI, state *threadState, updates []*dynamodbTypes.Update) error {
+	if !state.changed {
+		return updateWithEmails(ctx, client, nil, updates)
+	}
+
+	if len(state.emails) == 0 {
+		if len(updates) > 0 {
+			if err := updateWithEmails(ctx, client, nil, updates); err != nil {
+				return err
+			}
+		}
+		values := map[string]dynamodbTypes.AttributeValue{}
+		condition := scannedCondition(state.thread, values)
+		if len(state.thread.EmailIDs) == 0 {
+			// EmailIDs may be missing, while adding an email changes TimeUpdated
+			condition = "TimeUpdated = :oldTimeUpdated"
+			values = map[string]dynamodbTypes.AttributeValue{":oldTimeUpdated": values[":oldTimeUpdated"]}
+		}
+		return transactItems(ctx, client, []dynamodbTypes.TransactWriteItem{{Delete: &dynamodbTypes.Delete{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: state.thread.MessageID},
+			},
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
+		}}})
+	}
+
+	return updateWithEmails(ctx, client, repairedThread(state), updates)
+}
+
+// repairedThread returns the update of the attributes of a thread derived from its emails.
+// Unlike threadUpdate, the other attributes, such as Subject, are kept, since they're not scanned.
+func repairedThread(state *threadState) *dynamodbTypes.Update {
+	values := threadAttributes(state.emails)
+	delete(values, ":subject")
+	expression := "SET EmailIDs = :emailIDs, TimeUpdated = :timeUpdated, UnreadCount = :unreadCount"
+	if state.draft != nil {
+		expression += ", DraftID = :draftID"
+		values[":draftID"] = &dynamodbTypes.AttributeValueMemberS{Value: state.draft.MessageID}
+	} else if state.thread.DraftID != "" {
+		expression += " REMOVE DraftID"
+	}
+	return &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: state.thread.MessageID},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String(scannedCondition(state.thread, values)),
+		ExpressionAttributeValues: values,
+	}
+}
+
+// scannedCondition is unchangedCondition without requiring the thread to be not trashed
+func scannedCondition(thread *Thread, values map[string]dynamodbTypes.AttributeValue) string {
+	return strings.TrimPrefix(unchangedCondition(thread, values), "attribute_not_exists(TrashedTime) AND ")
+}
+
+// unlinkEmail returns the update to remove an email or a draft from its thread
+func unlinkEmail(e *email.GetResult) *dynamodbTypes.Update {
+	return &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: e.MessageID},
+		},
+		UpdateExpression:    aws.String("REMOVE ThreadID, IsThreadLatest"),
+		ConditionExpression: aws.String("ThreadID = :oldThreadID"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":oldThreadID": &dynamodbTypes.AttributeValueMemberS{Value: e.ThreadID},
+		},
+	}
+}
+
+// insertByTime inserts an email before the first email that is later than it
+func insertByTime(emails []*email.GetResult, e *email.GetResult) []*email.GetResult {
+	i := slices.IndexFunc(emails, func(other *email.GetResult) bool {
+		return other.Time() > e.Time()
+	})
+	if i < 0 {
+		return append(emails, e)
+	}
+	return slices.Insert(emails, i, e)
+}
+
+// scanThreads returns every thread, and every email and draft, by their IDs
+func scanThreads(ctx context.Context, client platform.ScanAPI) (map[string]*Thread, map[string]*email.GetResult, error) {
+	threads := map[string]*Thread{}
+	emails := map[string]*email.GetResult{}
+	var startKey map[string]dynamodbTypes.AttributeValue
+	for {
+		resp, err := client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:            aws.String(env.TableName),
+			ExclusiveStartKey:    startKey,
+			ProjectionExpression: aws.String("MessageID, TypeYearMonth, DateTime, ThreadID, IsThreadLatest, EmailIDs, DraftID, TimeUpdated, Unread, UnreadCount, TrashedTime"),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, item := range resp.Items {
+			var typeYearMonth string
+			_ = attributevalue.Unmarshal(item["TypeYearMonth"], &typeYearMonth)
+			// other items, e.g. push subscriptions, are skipped
+			itemType, _, _ := strings.Cut(typeYearMonth, "#")
+			switch itemType {
+			case model.EmailTypeThread:
+				thread := &Thread{Type: model.EmailTypeThread}
+				if err = attributevalue.UnmarshalMap(item, thread); err != nil {
+					return nil, nil, err
+				}
+				threads[thread.MessageID] = thread
+			case model.EmailTypeInbox, model.EmailTypeSent, model.EmailTypeDraft:
+				e, err := email.ParseGetResult(item)
+				if err != nil {
+					return nil, nil, err
+				}
+				emails[e.MessageID] = e
+			}
+		}
+		startKey = resp.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return threads, emails, nil
+		}
+	}
+}
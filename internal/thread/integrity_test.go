@@ -0,0 +1,143 @@
+package thread
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	env.TableName = "table-for-check-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	update := func(id, expression string, values map[string]dynamodbTypes.AttributeValue) {
+		t.Helper()
+		_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+			},
+			UpdateExpression:          aws.String(expression),
+			ExpressionAttributeValues: values,
+		})
+		assert.Nil(t, err)
+	}
+	s := func(v string) dynamodbTypes.AttributeValue { return &dynamodbTypes.AttributeValueMemberS{Value: v} }
+	list := func(ids ...string) dynamodbTypes.AttributeValue {
+		l := &dynamodbTypes.AttributeValueMemberL{}
+		for _, id := range ids {
+			l.Value = append(l.Value, s(id))
+		}
+		return l
+	}
+
+	putEmailsInThread(t, client, "thread-a",
+		[3]string{"a-1", "inbox", "01"},
+		[3]string{"a-3", "sent", "02"},
+		[3]string{"a-2", "sent", "03"},
+		[3]string{"a-draft", "draft", "05"},
+	)
+	putEmailsInThread(t, client, "thread-b", [3]string{"b-1", "inbox", "04"})
+	putEmailsInThread(t, client, "thread-c", [3]string{"c-1", "sent", "06"})
+	putEmailsInThread(t, client, "thread-d", [3]string{"d-1", "sent", "07"})
+
+	// consistent threads have no problem
+	report, err := Check(ctx, client, CheckOptions{Repair: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, report.Threads)
+	assert.Equal(t, 7, report.Emails)
+	report, err = Check(ctx, client, CheckOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Problems)
+
+	// a-3 is not listed but latest, a-2 is listed twice, missing is dangling, a-draft-2 is not referenced
+	update("thread-a", "SET EmailIDs = :ids", map[string]dynamodbTypes.AttributeValue{":ids": list("a-1", "a-2", "missing", "a-2")})
+	update("a-3", "SET IsThreadLatest = :true", map[string]dynamodbTypes.AttributeValue{":true": &dynamodbTypes.AttributeValueMemberBOOL{Value: true}})
+	putEmailsInThread(t, client, "thread-x", [3]string{"a-draft-2", "draft", "06"})
+	update("a-draft-2", "SET ThreadID = :id", map[string]dynamodbTypes.AttributeValue{":id": s("thread-a")})
+	update("thread-x", "REMOVE DraftID", nil)
+	// b-1 has no ThreadID, DraftID is dangling, and UnreadCount is wrong
+	update("b-1", "REMOVE ThreadID", nil)
+	update("thread-b", "SET DraftID = :id, UnreadCount = :count", map[string]dynamodbTypes.AttributeValue{
+		":id": s("gone"), ":count": &dynamodbTypes.AttributeValueMemberN{Value: "3"},
+	})
+	// c-1 is in a missing thread, and thread-c is empty
+	update("c-1", "SET ThreadID = :id", map[string]dynamodbTypes.AttributeValue{":id": s("thread-missing")})
+	update("thread-c", "SET EmailIDs = :ids", map[string]dynamodbTypes.AttributeValue{":ids": list()})
+	// thread-d lists an email of thread-a
+	update("thread-d", "SET EmailIDs = :ids, TimeUpdated = :time", map[string]dynamodbTypes.AttributeValue{
+		":ids": list("d-1", "a-1"), ":time": s("2023-02-01T00:00:00Z"),
+	})
+
+	report, err = Check(ctx, client, CheckOptions{})
+	assert.Nil(t, err)
+	kinds := map[string][]string{}
+	for _, problem := range report.Problems {
+		kinds[problem.Kind] = append(kinds[problem.Kind], problem.ThreadID+"/"+problem.MessageID)
+	}
+	assert.Equal(t, map[string][]string{
+		ProblemDanglingEmail:     {"thread-a/missing", "thread-a/a-2"},
+		ProblemUnlistedEmail:     {"thread-a/a-3"},
+		ProblemMultipleLatest:    {"thread-a/a-3"},
+		ProblemUnreferencedDraft: {"thread-a/a-draft-2"},
+		ProblemMissingThreadID:   {"thread-b/b-1"},
+		ProblemDanglingDraft:     {"thread-b/gone"},
+		ProblemUnreadCount:       {"thread-b/"},
+		ProblemEmptyThread:       {"thread-c/", "thread-x/"},
+		ProblemMissingThread:     {"thread-missing/c-1"},
+		ProblemWrongThread:       {"thread-d/a-1"},
+		ProblemTimeUpdated:       {"thread-d/"},
+	}, kinds)
+	assert.Equal(t, 0, report.Repaired)
+
+	// nothing is written without Repair
+	assert.Equal(t, map[string]string{"b-1": " latest", "c-1": "thread-missing latest"}, threadOf(t, client, "b-1", "c-1"))
+
+	report, err = Check(ctx, client, CheckOptions{Repair: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, report.Repaired)
+	assert.Equal(t, 0, report.Failed)
+
+	thread, err := GetThread(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a-1", "a-3", "a-2"}, thread.EmailIDs)
+	assert.Equal(t, "a-draft", thread.DraftID)
+	assert.Equal(t, "subject thread-a", thread.Subject)
+	thread, err = GetThread(ctx, client, "thread-b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b-1"}, thread.EmailIDs)
+	assert.Empty(t, thread.DraftID)
+	assert.Equal(t, 1, thread.UnreadCount)
+	assert.Equal(t, "subject thread-b", thread.Subject)
+	thread, err = GetThread(ctx, client, "thread-d")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d-1"}, thread.EmailIDs)
+	assert.Equal(t, "2023-02-07T00:00:00Z", thread.TimeUpdated)
+	assert.Equal(t, "subject thread-d", thread.Subject)
+	for _, id := range []string{"thread-c", "thread-x"} {
+		_, err = GetThread(ctx, client, id)
+		assert.Equal(t, platform.ErrNotFound, err, id)
+	}
+	assert.Equal(t, map[string]string{
+		"a-1":       "thread-a",
+		"a-3":       "thread-a",
+		"a-2":       "thread-a latest",
+		"a-draft":   "thread-a",
+		"a-draft-2": "",
+		"b-1":       "thread-b latest",
+		"c-1":       "",
+		"d-1":       "thread-d latest",
+	}, threadOf(t, client, "a-1", "a-3", "a-2", "a-draft", "a-draft-2", "b-1", "c-1", "d-1"))
+
+	report, err = Check(ctx, client, CheckOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Problems)
+}
@@ -0,0 +1,334 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Stages of matching an incoming email to a thread, which are tried in order
+const (
+	StageInReplyTo  = "in-reply-to" // the email in In-Reply-To
+	StageReferences = "references"  // any email in References, from the last one
+	StageSubject    = "subject"     // a recent email with the same subject and a common participant
+)
+
+// defaultStages are used when env.Threading is empty.
+// The subject stage is a heuristic, so it has to be enabled explicitly.
+var defaultStages = []string{StageInReplyTo, StageReferences}
+
+// defaultWindow is the default of env.ThreadingWindow
+const defaultWindow = 14 * 24 * time.Hour
+
+// matchConfig is the configuration of thread matching
+type matchConfig struct {
+	stages map[string]bool
+	window time.Duration
+}
+
+// loadMatchConfig returns the configuration of thread matching from env
+func loadMatchConfig() matchConfig {
+	config := matchConfig{stages: map[string]bool{}, window: defaultWindow}
+	stages := defaultStages
+	if env.Threading != "" {
+		stages = strings.Split(env.Threading, ",")
+	}
+	for _, stage := range stages {
+		stage = strings.ToLower(strings.TrimSpace(stage))
+		switch stage {
+		case StageInReplyTo, StageReferences, StageSubject:
+			config.stages[stage] = true
+		case "":
+		default:
+			log.Printf("unknown threading stage %q is ignored\n", stage)
+		}
+	}
+	if env.ThreadingWindow != "" {
+		window, err := time.ParseDuration(env.ThreadingWindow)
+		if err != nil || window <= 0 {
+			log.Printf("invalid THREADING_WINDOW %q, using %s\n", env.ThreadingWindow, defaultWindow)
+		} else {
+			config.window = window
+		}
+	}
+	return config
+}
+
+// match is an email that an incoming email is matched to
+type match struct {
+	email      *email.GetResult
+	stage      string
+	confidence float64 // from 0 to 1
+}
+
+// matchByHeaders finds the email referenced by In-Reply-To, or by References from the last one.
+// It returns nil if none of the referenced emails exists.
+func matchByHeaders(ctx context.Context, client platform.QueryAndGetItemAPI, config matchConfig, input *DetermineThreadInput) (*match, error) {
+	inReplyTo := strings.TrimSpace(input.InReplyTo)
+	references := strings.Fields(input.References)
+	if config.stages[StageInReplyTo] {
+		id := inReplyTo
+		if id == "" && len(references) > 0 {
+			// the last entry of References is the parent when In-Reply-To is missing
+			id = references[len(references)-1]
+		}
+		if id != "" {
+			e, err := findReferenced(ctx, client, id)
+			if err != nil || e != nil {
+				return &match{email: e, stage: StageInReplyTo, confidence: 1}, err
+			}
+		}
+	}
+
+	if config.stages[StageReferences] {
+		// entries further from the end are more distant ancestors, which are less likely in the same thread
+		confidence := 0.9
+		for _, id := range slices.Backward(references) {
+			if id != inReplyTo {
+				e, err := findReferenced(ctx, client, id)
+				if err != nil || e != nil {
+					return &match{email: e, stage: StageReferences, confidence: confidence}, err
+				}
+			}
+			confidence = max(confidence-0.1, 0.5)
+		}
+	}
+	return nil, nil
+}
+
+// findReferenced returns the email with the Message-ID header,
+// which is either a sent email whose ID is in the Message-ID, or a received email, or nil if there's none
+func findReferenced(ctx context.Context, client platform.QueryAndGetItemAPI, originalMessageID string) (*email.GetResult, error) {
+	sesDomain := env.Region + ".amazonses.com"
+	if strings.HasSuffix(originalMessageID, "@"+sesDomain+">") {
+		// If the messageID ends with @<SES domain>, it maybe a messageID of a sent email.
+		// In this case, we need check if there's a corresponding sent email.
+		fmt.Println("checking possible sent email")
+		possibleSentID := strings.TrimSuffix(originalMessageID, "@"+sesDomain+">")
+		possibleSentID = strings.TrimPrefix(possibleSentID, "<")
+		e, err := email.Get(ctx, client, possibleSentID)
+		if err == nil {
+			return e, nil
+		}
+		if !errors.Is(err, platform.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	// If the messageID does not corresponded to a sent email, check if it's a received email
+	fmt.Println("checking original messageID")
+	candidates, err := email.FindByOriginalMessageID(ctx, client, originalMessageID)
+	if err != nil {
+		return nil, err
+	}
+	return chooseReferenced(candidates), nil
+}
+
+// chooseReferenced chooses one of the emails with the same Message-ID deterministically.
+// If the emails in threads are all in the same thread, the newest of them is chosen, otherwise the newest email.
+// It returns nil if there's no email.
+func chooseReferenced(candidates []*email.GetResult) *email.GetResult {
+	var threadID string
+	var threaded []*email.GetResult
+	for _, e := range candidates {
+		if e.ThreadID == "" {
+			continue
+		}
+		if threadID != "" && e.ThreadID != threadID {
+			return email.Newest(candidates)
+		}
+		threadID = e.ThreadID
+		threaded = append(threaded, e)
+	}
+	if len(threaded) > 0 {
+		return email.Newest(threaded)
+	}
+	return email.Newest(candidates)
+}
+
+// subjectPrefix matches a reply or forward prefix, such as "Re:", "Fwd:", "AW:" or "RE[2]:",
+// or a tag added by mailing lists, such as "[list]"
+var subjectPrefix = regexp.MustCompile(`(?i)^(?:(re|fwd?|aw|wg|sv|vs|antw|tr|rif|ref)\s*(?:\[\d+\]|\(\d+\))?\s*[:：]|\[[^\]]*\])\s*`)
+
+// normalizeSubject returns the subject without prefixes, in lower case and with spaces collapsed,
+// and whether it has a reply or forward prefix
+func normalizeSubject(subject string) (string, bool) {
+	s := strings.TrimSpace(subject)
+	replied := false
+	for {
+		m := subjectPrefix.FindStringSubmatch(s)
+		if m == nil || m[0] == "" {
+			break
+		}
+		if m[1] != "" {
+			replied = true
+		}
+		s = s[len(m[0]):]
+	}
+	return strings.ToLower(strings.Join(strings.Fields(s), " ")), replied
+}
+
+// participants returns the lower case addresses in the lists of addresses
+func participants(lists ...[]string) map[string]bool {
+	result := map[string]bool{}
+	for _, list := range lists {
+		for _, s := range list {
+			if address, err := mail.ParseAddress(s); err == nil {
+				s = address.Address
+			}
+			if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+				result[s] = true
+			}
+		}
+	}
+	return result
+}
+
+// matchBySubject finds a recent email with the same normalized subject, which the sender of the incoming email took part in.
+// It only matches replies and forwards, since unrelated emails can have the same subject.
+// The confidence is from 0.4 to 0.9, higher if the participants overlap more and if the email is more recent.
+func matchBySubject(ctx context.Context, client platform.QueryAndGetItemAPI, config matchConfig, input *DetermineThreadInput) (*match, error) {
+	subject, replied := normalizeSubject(input.Subject)
+	if !config.stages[StageSubject] || !replied || subject == "" || len(input.From) == 0 {
+		return nil, nil
+	}
+	end, err := time.Parse(time.RFC3339, input.Time)
+	if err != nil {
+		return nil, nil
+	}
+	start := end.Add(-config.window)
+	senders := participants(input.From)
+	incoming := participants(input.From, input.To)
+
+	var best *match
+	var bestID string
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(end); month = month.AddDate(0, 1, 0) {
+		for _, emailType := range []string{model.EmailTypeInbox, model.EmailTypeSent} {
+			items, err := queryMonth(ctx, client, emailType, month)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				candidate := new(candidate)
+				if err = attributevalue.UnmarshalMap(item, candidate); err != nil {
+					return nil, err
+				}
+				_, emailTime, err := email.UnmarshalGSI(item)
+				if err != nil {
+					return nil, err
+				}
+				candidateTime, err := time.Parse(time.RFC3339, emailTime)
+				if err != nil || candidate.MessageID == input.MessageID || candidateTime.Before(start) || candidateTime.After(end) {
+					continue
+				}
+				if s, _ := normalizeSubject(candidate.Subject); s != subject {
+					continue
+				}
+				others := participants(candidate.From, candidate.To)
+				if !overlaps(senders, others) {
+					continue
+				}
+
+				confidence := 0.4 + 0.3*jaccard(incoming, others) + 0.2*(1-end.Sub(candidateTime).Seconds()/config.window.Seconds())
+				if best == nil || confidence > best.confidence {
+					best = &match{stage: StageSubject, confidence: confidence}
+					bestID = candidate.MessageID
+				}
+			}
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	best.email, err = email.Get(ctx, client, bestID)
+	if err != nil {
+		if errors.Is(err, platform.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return best, nil
+}
+
+// candidate has the attributes of an email used by the subject stage, which are projected to TimeIndex
+type candidate struct {
+	MessageID string
+	Subject   string
+	From      []string
+	To        []string
+}
+
+// queryMonth returns the emails of a type in a month from TimeIndex, except for trashed emails
+func queryMonth(ctx context.Context, client platform.QueryAPI, emailType string, month time.Time) ([]map[string]dynamodbTypes.AttributeValue, error) {
+	typeYearMonth, err := format.TypeYearMonth(emailType, month)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]dynamodbTypes.AttributeValue
+	var startKey map[string]dynamodbTypes.AttributeValue
+	for {
+		resp, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(env.TableName),
+			IndexName:              aws.String(env.GsiIndexName),
+			ExclusiveStartKey:      startKey,
+			KeyConditionExpression: aws.String("TypeYearMonth = :typeYearMonth"),
+			FilterExpression:       aws.String("attribute_not_exists(TrashedTime)"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":typeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+			},
+		})
+		if err != nil {
+			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, platform.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		items = append(items, resp.Items...)
+		startKey = resp.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return items, nil
+		}
+	}
+}
+
+// overlaps returns true if the sets have a common element
+func overlaps(a, b map[string]bool) bool {
+	for key := range a {
+		if b[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// jaccard returns the size of the intersection of the sets divided by the size of their union
+func jaccard(a, b map[string]bool) float64 {
+	intersection := 0
+	for key := range a {
+		if b[key] {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
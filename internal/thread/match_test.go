@@ -0,0 +1,186 @@
+package thread
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/format"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeSubject(t *testing.T) {
+	tests := []struct {
+		subject  string
+		expected string
+		replied  bool
+	}{
+		{"Project plan", "project plan", false},
+		{"Re: Project plan", "project plan", true},
+		{"RE: Fwd: Project  plan ", "project plan", true},
+		{"AW: WG: Projektplan", "projektplan", true},
+		{"Re[2]: Project plan", "project plan", true},
+		{"[team] Re: Project plan", "project plan", true},
+		{"[team] Project plan", "project plan", false},
+		{"Réunion: Project plan", "réunion: project plan", false},
+		{"Re:", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.subject, func(t *testing.T) {
+			subject, replied := normalizeSubject(test.subject)
+			assert.Equal(t, test.expected, subject)
+			assert.Equal(t, test.replied, replied)
+		})
+	}
+}
+
+func TestLoadMatchConfig(t *testing.T) {
+	env.Threading, env.ThreadingWindow = "", ""
+	assert.Equal(t, matchConfig{
+		stages: map[string]bool{StageInReplyTo: true, StageReferences: true},
+		window: defaultWindow,
+	}, loadMatchConfig())
+
+	env.Threading, env.ThreadingWindow = " Subject ,unknown,in-reply-to", "72h"
+	assert.Equal(t, matchConfig{
+		stages: map[string]bool{StageInReplyTo: true, StageSubject: true},
+		window: 72 * time.Hour,
+	}, loadMatchConfig())
+
+	env.Threading, env.ThreadingWindow = "", "invalid"
+	assert.Equal(t, defaultWindow, loadMatchConfig().window)
+}
+
+func TestChooseReferenced(t *testing.T) {
+	unthreadedNewest := &email.GetResult{MessageID: "unthreaded", Type: "inbox", TimeReceived: "2023-02-03T00:00:00Z"}
+	threadA1 := &email.GetResult{MessageID: "a-1", Type: "inbox", TimeReceived: "2023-02-01T00:00:00Z", ThreadID: "a"}
+	threadA2 := &email.GetResult{MessageID: "a-2", Type: "sent", TimeSent: "2023-02-02T00:00:00Z", ThreadID: "a"}
+	threadB := &email.GetResult{MessageID: "b-1", Type: "inbox", TimeReceived: "2023-02-01T12:00:00Z", ThreadID: "b"}
+
+	assert.Nil(t, chooseReferenced(nil))
+	assert.Equal(t, threadA1, chooseReferenced([]*email.GetResult{threadA1}))
+	assert.Equal(t, threadA2, chooseReferenced([]*email.GetResult{unthreadedNewest, threadA1, threadA2}),
+		"the thread they're in is preferred")
+	assert.Equal(t, unthreadedNewest, chooseReferenced([]*email.GetResult{threadB, unthreadedNewest, threadA1}),
+		"the newest is chosen if they're in different threads")
+}
+
+// putReceivedEmail puts a received email without a thread
+func putReceivedEmail(t *testing.T, client *memory.Client, id, originalMessageID, subject, from string, received time.Time) {
+	t.Helper()
+	typeYearMonth, err := format.TypeYearMonth("inbox", received)
+	assert.Nil(t, err)
+	_, err = client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item: map[string]dynamodbTypes.AttributeValue{
+			"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: id},
+			"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: originalMessageID},
+			"TypeYearMonth":     &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+			"DateTime":          &dynamodbTypes.AttributeValueMemberS{Value: format.DateTime(received)},
+			"Subject":           &dynamodbTypes.AttributeValueMemberS{Value: subject},
+			"From":              &dynamodbTypes.AttributeValueMemberSS{Value: []string{from}},
+			"To":                &dynamodbTypes.AttributeValueMemberSS{Value: []string{"Me <me@example.com>"}},
+		},
+	})
+	assert.Nil(t, err)
+}
+
+func TestDetermineThread_References(t *testing.T) {
+	env.TableName = "table-for-determine-thread-references"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiOriginalIndexName = "OriginalMessageIDIndex"
+	env.Threading, env.ThreadingWindow = "", ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putReceivedEmail(t, client, "first", "<first@example.com>", "Project plan", "alice@example.com",
+		time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC))
+
+	input := &DetermineThreadInput{
+		// the parent isn't received, but an earlier entry of References is
+		InReplyTo:  "<second@example.com>",
+		References: "<first@example.com> <second@example.com>",
+	}
+	output, err := DetermineThread(ctx, client, input)
+	assert.Nil(t, err)
+	assert.True(t, output.ShouldCreate)
+	assert.Equal(t, "first", output.CreatingEmailID)
+	assert.Equal(t, StageReferences, output.Stage)
+	assert.InDelta(t, 0.8, output.Confidence, 0.001)
+
+	output, err = DetermineThread(ctx, client, &DetermineThreadInput{InReplyTo: "<first@example.com>"})
+	assert.Nil(t, err)
+	assert.Equal(t, StageInReplyTo, output.Stage)
+	assert.Equal(t, 1.0, output.Confidence)
+
+	env.Threading = StageInReplyTo
+	output, err = DetermineThread(ctx, client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, &DetermineThreadOutput{}, output, "references stage is disabled")
+}
+
+func TestDetermineThread_Subject(t *testing.T) {
+	env.TableName = "table-for-determine-thread-subject"
+	env.GsiIndexName = "TimeIndex"
+	env.GsiOriginalIndexName = "OriginalMessageIDIndex"
+	env.Threading, env.ThreadingWindow = "in-reply-to,references,subject", "240h"
+	defer func() { env.Threading, env.ThreadingWindow = "", "" }()
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putReceivedEmail(t, client, "old", "<old@example.com>", "Project plan", "alice@example.com",
+		time.Date(2023, 1, 20, 0, 0, 0, 0, time.UTC))
+	putReceivedEmail(t, client, "recent", "<recent@example.com>", "Project plan", "Alice <alice@example.com>",
+		time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC))
+	putReceivedEmail(t, client, "other", "<other@example.com>", "Other", "alice@example.com",
+		time.Date(2023, 2, 9, 0, 0, 0, 0, time.UTC))
+
+	input := &DetermineThreadInput{
+		MessageID: "incoming",
+		Subject:   "RE: project  plan",
+		From:      []string{"alice@example.com"},
+		To:        []string{"me@example.com"},
+		Time:      "2023-02-10T00:00:00Z",
+	}
+	output, err := DetermineThread(ctx, client, input)
+	assert.Nil(t, err)
+	assert.True(t, output.ShouldCreate)
+	assert.Equal(t, "recent", output.CreatingEmailID, "old is outside the window")
+	assert.Equal(t, StageSubject, output.Stage)
+	assert.InDelta(t, 0.4+0.3+0.2*0.8, output.Confidence, 0.001)
+
+	tests := []struct {
+		name   string
+		modify func(input DetermineThreadInput) DetermineThreadInput
+	}{
+		{"not a reply", func(input DetermineThreadInput) DetermineThreadInput {
+			input.Subject = "Project plan"
+			return input
+		}},
+		{"different sender", func(input DetermineThreadInput) DetermineThreadInput {
+			input.From = []string{"mallory@example.com"}
+			return input
+		}},
+		{"outside window", func(input DetermineThreadInput) DetermineThreadInput {
+			input.Time = "2023-03-01T00:00:00Z"
+			return input
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modified := test.modify(*input)
+			output, err := DetermineThread(ctx, client, &modified)
+			assert.Nil(t, err)
+			assert.Equal(t, &DetermineThreadOutput{}, output)
+		})
+	}
+
+	env.Threading = ""
+	output, err = DetermineThread(ctx, client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, &DetermineThreadOutput{}, output, "subject stage is disabled by default")
+}
@@ -0,0 +1,312 @@
+package thread
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Merge moves the emails and the draft of the source thread into the thread, and deletes the source thread.
+// Emails are ordered by the time they're received or sent, and the thread takes the subject of the first email.
+// The thread is starred or muted if either thread is, and stays archived or snoozed only if both are.
+// All changes are applied in one transaction, which fails with platform.ErrConflict if either thread is changed meanwhile.
+func Merge(ctx context.Context, client platform.UpdateThreadAPI, threadID, sourceID string) (*Thread, error) {
+	if threadID == sourceID {
+		return nil, platform.ErrInvalidInput
+	}
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := GetThreadWithEmails(ctx, client, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if thread.TrashedTime != nil || source.TrashedTime != nil {
+		return nil, platform.ErrThreadTrashed
+	}
+	if thread.DraftID != "" && source.DraftID != "" {
+		return nil, platform.ErrMultipleDrafts
+	}
+
+	emails := slices.Concat(existingEmails(thread.Emails), existingEmails(source.Emails))
+	slices.SortStableFunc(emails, func(a, b *email.GetResult) int {
+		return cmp.Compare(a.Time(), b.Time())
+	})
+
+	draftID := thread.DraftID
+	if source.Draft != nil {
+		draftID = source.Draft.MessageID
+	}
+	update, err := threadUpdate(thread, emails, draftID)
+	if err != nil {
+		return nil, err
+	}
+	set, remove, state := mergeState(thread, source, update.ExpressionAttributeValues)
+	update.UpdateExpression = aws.String(joinExpression(aws.ToString(update.UpdateExpression), set, remove))
+
+	var items []dynamodbTypes.TransactWriteItem
+	for i, e := range emails {
+		if update := relinkEmail(e, threadID, i == len(emails)-1, &state); update != nil {
+			items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+		}
+	}
+	if source.Draft != nil {
+		items = append(items, dynamodbTypes.TransactWriteItem{Update: relinkEmail(source.Draft, threadID, false, nil)})
+	}
+
+	deletion := &dynamodbTypes.Delete{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: sourceID},
+		},
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{},
+	}
+	deletion.ConditionExpression = aws.String(unchangedCondition(source, deletion.ExpressionAttributeValues))
+	items = append(items,
+		dynamodbTypes.TransactWriteItem{Update: update},
+		dynamodbTypes.TransactWriteItem{Delete: deletion},
+	)
+
+	err = transactItems(ctx, client, items)
+	if err != nil {
+		return nil, err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionDeleted, Thread: hook.Thread{ID: sourceID}})
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUpdated, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("merge thread finished successfully")
+	return GetThreadWithEmails(ctx, client, threadID)
+}
+
+// existingEmails returns the emails of a thread that exist, skipping those that are deleted
+func existingEmails(emails []email.GetResult) []*email.GetResult {
+	result := make([]*email.GetResult, 0, len(emails))
+	for i := range emails {
+		if emails[i].MessageID != "" {
+			result = append(result, &emails[i])
+		}
+	}
+	return result
+}
+
+// byThreadState is the state of a thread that its emails share when they're archived or snoozed with the thread
+type byThreadState struct {
+	archived     bool
+	snoozedUntil string // empty if the thread isn't snoozed
+}
+
+// relinkEmail returns the update to move an email to a thread and set whether it's the latest email of the thread,
+// or nil if the email doesn't change.
+// If state is not nil, the email is unarchived or unsnoozed if it's archived or snoozed with its thread but the new thread isn't,
+// and takes the time the new thread is snoozed until.
+func relinkEmail(e *email.GetResult, threadID string, latest bool, state *byThreadState) *dynamodbTypes.Update {
+	var set, remove []string
+	values := map[string]dynamodbTypes.AttributeValue{}
+	if e.ThreadID != threadID {
+		set = append(set, "ThreadID = :threadID")
+		values[":threadID"] = &dynamodbTypes.AttributeValueMemberS{Value: threadID}
+	}
+	if latest && !e.IsThreadLatest {
+		set = append(set, "IsThreadLatest = :true")
+		values[":true"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+	} else if !latest && e.IsThreadLatest {
+		remove = append(remove, "IsThreadLatest")
+	}
+	if state != nil {
+		if e.ArchivedByThread && !state.archived {
+			remove = append(remove, "ArchivedTime", "ArchivedByThread")
+		}
+		if e.SnoozedByThread && state.snoozedUntil == "" {
+			remove = append(remove, "SnoozedUntil", "SnoozedByThread")
+		} else if e.SnoozedByThread && e.SnoozedUntil != state.snoozedUntil {
+			set = append(set, "SnoozedUntil = :snoozedUntil")
+			values[":snoozedUntil"] = &dynamodbTypes.AttributeValueMemberS{Value: state.snoozedUntil}
+		}
+	}
+	if len(set) == 0 && len(remove) == 0 {
+		return nil
+	}
+
+	// the email must not be moved to another thread meanwhile
+	condition := "attribute_not_exists(ThreadID)"
+	if e.ThreadID != "" {
+		condition = "ThreadID = :oldThreadID"
+		values[":oldThreadID"] = &dynamodbTypes.AttributeValueMemberS{Value: e.ThreadID}
+	}
+	return &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: e.MessageID},
+		},
+		UpdateExpression:          aws.String(joinExpression("", set, remove)),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	}
+}
+
+// mergeState returns the actions to update the state of a thread merged with source, adding their values to values,
+// and the state its emails share with it.
+// The thread is starred or muted if either thread is, and archived or snoozed only if both are, until the earlier time.
+func mergeState(thread, source *Thread, values map[string]dynamodbTypes.AttributeValue) (set, remove []string, state byThreadState) {
+	if source.Starred && !thread.Starred {
+		set = append(set, "Starred = :true", "StarredKey = :starredKey", "StarredTime = :starredTime")
+		values[":true"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		values[":starredKey"] = &dynamodbTypes.AttributeValueMemberS{Value: email.StarredKey}
+		values[":starredTime"] = &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	}
+	if source.Muted && !thread.Muted {
+		set = append(set, "Muted = :true", "MuteAction = :muteAction")
+		values[":true"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		values[":muteAction"] = &dynamodbTypes.AttributeValueMemberS{Value: source.MuteAction}
+	}
+
+	state.archived = thread.ArchivedTime != nil && source.ArchivedTime != nil
+	if thread.ArchivedTime != nil && !state.archived {
+		remove = append(remove, "ArchivedTime")
+	}
+
+	if thread.SnoozedUntil != nil && source.SnoozedUntil != nil {
+		state.snoozedUntil = min(*thread.SnoozedUntil, *source.SnoozedUntil)
+		if state.snoozedUntil != *thread.SnoozedUntil {
+			set = append(set, "SnoozedUntil = :snoozedUntil")
+			values[":snoozedUntil"] = &dynamodbTypes.AttributeValueMemberS{Value: state.snoozedUntil}
+		}
+	} else if thread.SnoozedUntil != nil {
+		remove = append(remove, "SnoozedUntil", "SnoozeKey")
+	}
+	return set, remove, state
+}
+
+// joinExpression adds SET and REMOVE actions to an update expression, which may be empty
+func joinExpression(expression string, set, remove []string) string {
+	setPart, removePart, _ := strings.Cut(expression, " REMOVE ")
+	if strings.HasPrefix(setPart, "REMOVE ") {
+		setPart, removePart = "", strings.TrimPrefix(setPart, "REMOVE ")
+	}
+	setPart = strings.TrimPrefix(setPart, "SET ")
+	if setPart != "" {
+		set = append([]string{setPart}, set...)
+	}
+	if removePart != "" {
+		remove = append([]string{removePart}, remove...)
+	}
+
+	var parts []string
+	if len(set) > 0 {
+		parts = append(parts, "SET "+strings.Join(set, ", "))
+	}
+	if len(remove) > 0 {
+		parts = append(parts, "REMOVE "+strings.Join(remove, ", "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// threadUpdate returns the update to set the emails and the draft of an existing thread, with emails in order
+func threadUpdate(thread *Thread, emails []*email.GetResult, draftID string) (*dynamodbTypes.Update, error) {
+	values := threadAttributes(emails)
+	if len(values) == 0 {
+		return nil, platform.ErrInvalidInput
+	}
+	typeYearMonth, err := threadTypeYearMonth(emails[0])
+	if err != nil {
+		return nil, err
+	}
+	values[":typeYearMonth"] = &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth}
+
+	expression := "SET EmailIDs = :emailIDs, Subject = :subject, TypeYearMonth = :typeYearMonth, TimeUpdated = :timeUpdated, UnreadCount = :unreadCount"
+	if draftID != "" {
+		expression += ", DraftID = :draftID"
+		values[":draftID"] = &dynamodbTypes.AttributeValueMemberS{Value: draftID}
+	} else if thread.DraftID != "" {
+		expression += " REMOVE DraftID"
+	}
+	return &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: thread.MessageID},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String(unchangedCondition(thread, values)),
+		ExpressionAttributeValues: values,
+	}, nil
+}
+
+// threadAttributes returns the values of the attributes of a thread derived from its emails, which are in order.
+// It returns nil if there's no email.
+func threadAttributes(emails []*email.GetResult) map[string]dynamodbTypes.AttributeValue {
+	if len(emails) == 0 {
+		return nil
+	}
+	ids := make([]dynamodbTypes.AttributeValue, 0, len(emails))
+	unreadCount := 0
+	for _, e := range emails {
+		ids = append(ids, &dynamodbTypes.AttributeValueMemberS{Value: e.MessageID})
+		if e.Unread != nil && *e.Unread {
+			unreadCount++
+		}
+	}
+	return map[string]dynamodbTypes.AttributeValue{
+		":emailIDs":    &dynamodbTypes.AttributeValueMemberL{Value: ids},
+		":subject":     &dynamodbTypes.AttributeValueMemberS{Value: emails[0].Subject},
+		":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: emails[len(emails)-1].Time()},
+		":unreadCount": &dynamodbTypes.AttributeValueMemberN{Value: strconv.Itoa(unreadCount)},
+	}
+}
+
+// threadTypeYearMonth returns TypeYearMonth of a thread, which is the month of its first email
+func threadTypeYearMonth(first *email.GetResult) (string, error) {
+	t, err := time.Parse(time.RFC3339, first.Time())
+	if err != nil {
+		return "", err
+	}
+	return format.TypeYearMonth(model.EmailTypeThread, t)
+}
+
+// unchangedCondition returns the condition that a thread is not changed since it's loaded, adding its values to values
+func unchangedCondition(thread *Thread, values map[string]dynamodbTypes.AttributeValue) string {
+	values[":oldSize"] = &dynamodbTypes.AttributeValueMemberN{Value: strconv.Itoa(len(thread.EmailIDs))}
+	values[":oldTimeUpdated"] = &dynamodbTypes.AttributeValueMemberS{Value: thread.TimeUpdated}
+	condition := "attribute_not_exists(TrashedTime) AND size(EmailIDs) = :oldSize AND TimeUpdated = :oldTimeUpdated"
+	if thread.DraftID == "" {
+		return condition + " AND attribute_not_exists(DraftID)"
+	}
+	values[":oldDraftID"] = &dynamodbTypes.AttributeValueMemberS{Value: thread.DraftID}
+	return condition + " AND DraftID = :oldDraftID"
+}
+
+// transactItems writes the items in one transaction
+func transactItems(ctx context.Context, client platform.TransactWriteItemsAPI, items []dynamodbTypes.TransactWriteItem) error {
+	if len(items) > maxTransactItems {
+		return platform.ErrTooManyEmails
+	}
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.TransactionCanceledException); errors.As(err, &apiErr) {
+			return platform.ErrConflict
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
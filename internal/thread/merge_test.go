@@ -0,0 +1,164 @@
+package thread
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+// threadOf returns the thread ID of each email, and which one is the latest in its thread
+func threadOf(t *testing.T, client *memory.Client, ids ...string) map[string]string {
+	t.Helper()
+	result := map[string]string{}
+	for _, id := range ids {
+		e, err := email.Get(context.TODO(), client, id)
+		assert.Nil(t, err)
+		result[id] = e.ThreadID
+		if e.IsThreadLatest {
+			result[id] += " latest"
+		}
+	}
+	return result
+}
+
+func TestMerge(t *testing.T) {
+	env.TableName = "table-for-merge-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a",
+		[3]string{"a-1", "sent", "01"},
+		[3]string{"a-2", "sent", "03"},
+	)
+	putEmailsInThread(t, client, "thread-b",
+		[3]string{"b-1", "inbox", "02"},
+		[3]string{"b-2", "sent", "04"},
+		[3]string{"b-draft", "draft", "05"},
+	)
+
+	thread, err := Merge(ctx, client, "thread-a", "thread-b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a-1", "b-1", "a-2", "b-2"}, thread.EmailIDs)
+	assert.Equal(t, "b-draft", thread.DraftID)
+	assert.Equal(t, "subject a-1", thread.Subject)
+	assert.Equal(t, "2023-02-04T00:00:00Z", thread.TimeUpdated)
+	assert.Equal(t, 1, thread.UnreadCount)
+	assert.Equal(t, map[string]string{
+		"a-1":     "thread-a",
+		"b-1":     "thread-a",
+		"a-2":     "thread-a",
+		"b-2":     "thread-a latest",
+		"b-draft": "thread-a",
+	}, threadOf(t, client, "a-1", "b-1", "a-2", "b-2", "b-draft"))
+
+	_, err = GetThread(ctx, client, "thread-b")
+	assert.Equal(t, platform.ErrNotFound, err)
+	_, err = Merge(ctx, client, "thread-a", "thread-b")
+	assert.Equal(t, platform.ErrNotFound, err)
+	_, err = Merge(ctx, client, "thread-a", "thread-a")
+	assert.Equal(t, platform.ErrInvalidInput, err)
+}
+
+func TestMerge_State(t *testing.T) {
+	env.TableName = "table-for-merge-thread-state"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a",
+		[3]string{"a-1", "inbox", "01"},
+	)
+	putEmailsInThread(t, client, "thread-b",
+		[3]string{"b-1", "inbox", "02"},
+	)
+	later := time.Now().Add(2 * time.Hour).UTC()
+	earlier := time.Now().Add(time.Hour).UTC()
+	assert.Nil(t, Archive(ctx, client, "thread-a"))
+	assert.Nil(t, Snooze(ctx, client, "thread-a", later))
+	assert.Nil(t, Star(ctx, client, "thread-b"))
+	assert.Nil(t, Mute(ctx, client, "thread-b", MuteActionTrash))
+	assert.Nil(t, Snooze(ctx, client, "thread-b", earlier))
+
+	thread, err := Merge(ctx, client, "thread-a", "thread-b")
+	assert.Nil(t, err)
+	assert.True(t, thread.Starred)
+	assert.True(t, thread.Muted)
+	assert.Equal(t, MuteActionTrash, thread.MuteAction)
+	assert.Nil(t, thread.ArchivedTime, "thread-b isn't archived")
+	assert.Equal(t, earlier.Format(time.RFC3339), aws.ToString(thread.SnoozedUntil))
+	for _, e := range thread.Emails {
+		assert.Empty(t, e.ArchivedTime)
+		assert.False(t, e.ArchivedByThread)
+		assert.Equal(t, earlier.Format(time.RFC3339), e.SnoozedUntil)
+		assert.True(t, e.SnoozedByThread)
+	}
+}
+
+func TestMerge_Invalid(t *testing.T) {
+	env.TableName = "table-for-merge-thread-invalid"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a",
+		[3]string{"a-1", "inbox", "01"},
+		[3]string{"a-draft", "draft", "02"},
+	)
+	putEmailsInThread(t, client, "thread-b",
+		[3]string{"b-1", "inbox", "02"},
+		[3]string{"b-draft", "draft", "03"},
+	)
+	putEmailsInThread(t, client, "thread-c",
+		[3]string{"c-1", "inbox", "02"},
+	)
+
+	_, err := Merge(ctx, client, "thread-a", "thread-b")
+	assert.Equal(t, platform.ErrMultipleDrafts, err)
+
+	assert.Nil(t, Trash(ctx, client, "thread-c"))
+	_, err = Merge(ctx, client, "thread-a", "thread-c")
+	assert.Equal(t, platform.ErrThreadTrashed, err)
+}
+
+func TestMerge_Conflict(t *testing.T) {
+	env.TableName = "table-for-merge-thread-conflict"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a",
+		[3]string{"a-1", "inbox", "01"},
+	)
+	putEmailsInThread(t, client, "thread-b",
+		[3]string{"b-1", "inbox", "02"},
+	)
+	thread, err := GetThreadWithEmails(ctx, client, "thread-a")
+	assert.Nil(t, err)
+
+	// a new email is added to thread-a after it's loaded
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "thread-a"},
+		},
+		UpdateExpression: aws.String("SET TimeUpdated = :timeUpdated"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: "2023-03-01T00:00:00Z"},
+		},
+	})
+	assert.Nil(t, err)
+
+	update, err := threadUpdate(thread, existingEmails(thread.Emails), "")
+	assert.Nil(t, err)
+	err = transactItems(ctx, client, []dynamodbTypes.TransactWriteItem{{Update: update}})
+	assert.Equal(t, platform.ErrConflict, err)
+
+	err = transactItems(ctx, client, make([]dynamodbTypes.TransactWriteItem, maxTransactItems+1))
+	assert.Equal(t, platform.ErrTooManyEmails, err)
+}
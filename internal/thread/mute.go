@@ -0,0 +1,79 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Mute actions, applied to the emails received in a muted thread
+const (
+	MuteActionRead  = "read"  // store the emails as read
+	MuteActionTrash = "trash" // store the emails as read and trashed
+)
+
+// Mute mutes a thread, with action being MuteActionRead or MuteActionTrash.
+// Emails received in a muted thread are stored as read, or trashed, without notifications.
+// Emails already in the thread are not changed.
+func Mute(ctx context.Context, client platform.UpdateEmailAPI, threadID, action string) error {
+	if action != MuteActionRead && action != MuteActionTrash {
+		return platform.ErrInvalidInput
+	}
+	err := updateMute(ctx, client, threadID, "SET Muted = :muted, MuteAction = :action", map[string]dynamodbTypes.AttributeValue{
+		":muted":  &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+		":action": &dynamodbTypes.AttributeValueMemberS{Value: action},
+	})
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionMuted, Thread: hook.Thread{ID: threadID}})
+	fmt.Println("mute thread finished successfully")
+	return nil
+}
+
+// Unmute unmutes a thread, so that emails received later are stored and notified as usual
+func Unmute(ctx context.Context, client platform.UpdateEmailAPI, threadID string) error {
+	err := updateMute(ctx, client, threadID, "REMOVE Muted, MuteAction", nil)
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUnmuted, Thread: hook.Thread{ID: threadID}})
+	fmt.Println("unmute thread finished successfully")
+	return nil
+}
+
+func updateMute(ctx context.Context, client platform.UpdateItemAPI, threadID, expression string, values map[string]dynamodbTypes.AttributeValue) error {
+	if values == nil {
+		values = map[string]dynamodbTypes.AttributeValue{}
+	}
+	values[":threadType"] = &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeThread + "#"}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("begins_with(TypeYearMonth, :threadType)"),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return platform.ErrNotFound
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package thread
+
+import (
+	"context"
+	"testing"
+
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMute(t *testing.T) {
+	env.TableName = "table-for-mute-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a", [3]string{"a-1", "inbox", "01"})
+
+	err := Mute(ctx, client, "thread-a", MuteActionTrash)
+	assert.Nil(t, err)
+	thread, err := GetThread(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.True(t, thread.Muted)
+	assert.Equal(t, MuteActionTrash, thread.MuteAction)
+
+	err = Unmute(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	thread, err = GetThread(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.False(t, thread.Muted)
+	assert.Empty(t, thread.MuteAction)
+
+	assert.Equal(t, platform.ErrInvalidInput, Mute(ctx, client, "thread-a", "label"))
+	assert.Equal(t, platform.ErrNotFound, Mute(ctx, client, "missing", MuteActionRead))
+	assert.Equal(t, platform.ErrNotFound, Mute(ctx, client, "a-1", MuteActionRead), "emails can't be muted")
+	assert.Equal(t, platform.ErrNotFound, Unmute(ctx, client, "missing"))
+}
+
+func TestApplyMute(t *testing.T) {
+	env.TableName = "table-for-apply-mute"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a", [3]string{"a-1", "sent", "01"})
+	assert.Nil(t, Mute(ctx, client, "thread-a", MuteActionRead))
+
+	item := map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "a-2"},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2023-02"},
+		"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "02-00:00:00"},
+		"ThreadID":      &dynamodbTypes.AttributeValueMemberS{Value: "thread-a"},
+		"Unread":        &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+	}
+	assert.True(t, applyMute(ctx, client, "thread-a", item))
+	err := StoreEmailWithExistingThread(ctx, client, &StoreEmailWithExistingThreadInput{
+		ThreadID:          "thread-a",
+		Email:             item,
+		TimeReceived:      "2023-02-02T00:00:00Z",
+		PreviousMessageID: "a-1",
+	})
+	assert.Nil(t, err)
+	e, err := email.Get(ctx, client, "a-2")
+	assert.Nil(t, err)
+	assert.False(t, *e.Unread)
+	assert.True(t, e.MutedByThread)
+
+	// the email is read in the same way as other read emails
+	assert.Nil(t, email.Read(ctx, client, "a-2", email.ActionUnread))
+	thread, err := GetThread(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, thread.UnreadCount)
+	assert.Nil(t, email.Read(ctx, client, "a-2", email.ActionRead))
+	assert.Nil(t, Read(ctx, client, "thread-a", email.ActionUnread))
+	thread, err = GetThread(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, thread.UnreadCount)
+}
@@ -0,0 +1,124 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// maxTransactItems is the maximum number of items in a DynamoDB transaction
+const maxTransactItems = 100
+
+// Read marks every received email in a thread as read or unread, with action being email.ActionRead or email.ActionUnread.
+// Emails are updated in transactions together with UnreadCount of the thread,
+// at most 99 emails in each, so the count is correct even if a large thread is partially updated.
+func Read(ctx context.Context, client platform.UpdateThreadAPI, threadID, action string) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+
+	unread := action == email.ActionUnread
+	count := 0
+	var changing []string
+	for _, e := range thread.Emails {
+		if e.Type != model.EmailTypeInbox {
+			continue
+		}
+		isUnread := e.Unread != nil && *e.Unread
+		if isUnread {
+			count++
+		}
+		if isUnread != unread {
+			changing = append(changing, e.MessageID)
+		}
+	}
+
+	for len(changing) > 0 || count != thread.UnreadCount {
+		n := min(len(changing), maxTransactItems-1)
+		if unread {
+			count += n
+		} else {
+			count -= n
+		}
+		err = readEmails(ctx, client, threadID, changing[:n], unread, count)
+		if err != nil {
+			return err
+		}
+		changing = changing[n:]
+		thread.UnreadCount = count
+	}
+
+	hookAction := hook.ActionRead
+	if unread {
+		hookAction = hook.ActionUnread
+	}
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hookAction, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("read thread finished successfully")
+	return nil
+}
+
+// readEmails marks the emails as read or unread, and sets UnreadCount of the thread to count, in a transaction
+func readEmails(ctx context.Context, client platform.TransactWriteItemsAPI, threadID string, emailIDs []string, unread bool, count int) error {
+	items := []dynamodbTypes.TransactWriteItem{
+		{
+			Update: &dynamodbTypes.Update{
+				TableName: aws.String(env.TableName),
+				Key: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+				},
+				UpdateExpression:    aws.String("SET UnreadCount = :count"),
+				ConditionExpression: aws.String("attribute_exists(MessageID)"),
+				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+					":count": &dynamodbTypes.AttributeValueMemberN{Value: strconv.Itoa(count)},
+				},
+			},
+		},
+	}
+	for _, emailID := range emailIDs {
+		update := &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: emailID},
+			},
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":v_type": &dynamodbTypes.AttributeValueMemberS{Value: model.EmailTypeInbox},
+			},
+		}
+		if unread {
+			update.UpdateExpression = aws.String("SET Unread = :unread")
+			update.ConditionExpression = aws.String("attribute_not_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
+			update.ExpressionAttributeValues[":unread"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		} else {
+			update.UpdateExpression = aws.String("REMOVE Unread")
+			update.ConditionExpression = aws.String("attribute_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
+		}
+		items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+	}
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.TransactionCanceledException); errors.As(err, &apiErr) {
+			// an email or the thread is changed concurrently
+			return platform.ErrReadActionFailed
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return platform.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
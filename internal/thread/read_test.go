@@ -0,0 +1,77 @@
+package thread
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	env.TableName = "table-for-read-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	// UnreadCount of the thread is 0, which is out of date
+	putEmailsInThread(t, client, "thread",
+		[3]string{"inbox-1", "inbox", "01"},
+		[3]string{"inbox-2", "inbox", "02"},
+		[3]string{"sent-1", "sent", "03"},
+	)
+
+	unread := func(id string) bool {
+		result, err := email.Get(ctx, client, id)
+		assert.Nil(t, err)
+		return result.Unread != nil && *result.Unread
+	}
+	unreadCount := func() int {
+		thread, err := GetThreadWithEmails(ctx, client, "thread")
+		assert.Nil(t, err)
+		return thread.UnreadCount
+	}
+
+	assert.Nil(t, Read(ctx, client, "thread", email.ActionRead))
+	assert.False(t, unread("inbox-1"))
+	assert.False(t, unread("inbox-2"))
+	assert.Equal(t, 0, unreadCount())
+
+	assert.Nil(t, Read(ctx, client, "thread", email.ActionUnread))
+	assert.True(t, unread("inbox-1"))
+	assert.True(t, unread("inbox-2"))
+	assert.False(t, unread("sent-1"))
+	assert.Equal(t, 2, unreadCount())
+
+	// reading an email in the thread updates the count
+	assert.Nil(t, email.Read(ctx, client, "inbox-1", email.ActionRead))
+	assert.Equal(t, 1, unreadCount())
+	assert.Nil(t, email.Read(ctx, client, "inbox-1", email.ActionUnread))
+	assert.Equal(t, 2, unreadCount())
+
+	assert.Equal(t, platform.ErrNotFound, Read(ctx, client, "not-exist", email.ActionRead))
+}
+
+func TestRead_LargeThread(t *testing.T) {
+	env.TableName = "table-for-read-large-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+
+	emails := make([][3]string, 0, 150)
+	for i := range 150 {
+		emails = append(emails, [3]string{"inbox-" + strconv.Itoa(i), "inbox", "01"})
+	}
+	putEmailsInThread(t, client, "thread", emails...)
+
+	assert.Nil(t, Read(ctx, client, "thread", email.ActionRead), "emails are updated in multiple transactions")
+	thread, err := GetThreadWithEmails(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, thread.UnreadCount)
+	for _, e := range thread.Emails {
+		assert.False(t, e.Unread != nil && *e.Unread)
+	}
+}
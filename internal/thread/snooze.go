@@ -0,0 +1,122 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Snooze hides a thread and its received emails from the inbox until the time, when it's woken by Wake.
+// Emails snoozed individually keep their own time, and the others are marked with SnoozedByThread.
+// Snoozing a snoozed thread changes the time.
+func Snooze(ctx context.Context, client platform.UpdateThreadAPI, threadID string, until time.Time) error {
+	if !until.After(time.Now()) {
+		return platform.ErrInvalidInput
+	}
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	if thread.TrashedTime != nil {
+		return platform.ErrThreadTrashed
+	}
+
+	snoozedUntil := &dynamodbTypes.AttributeValueMemberS{Value: until.UTC().Format(time.RFC3339)}
+	var updates []*dynamodbTypes.Update
+	for _, e := range thread.Emails {
+		if e.MessageID == "" || e.Type != model.EmailTypeInbox || (e.SnoozedUntil != "" && !e.SnoozedByThread) {
+			continue
+		}
+		updates = append(updates, &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: e.MessageID},
+			},
+			UpdateExpression:    aws.String("SET SnoozedUntil = :snoozedUntil, SnoozedByThread = :true"),
+			ConditionExpression: aws.String("attribute_not_exists(SnoozeKey)"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":snoozedUntil": snoozedUntil,
+				":true":         &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+			},
+		})
+	}
+
+	err = updateWithEmails(ctx, client, &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+		UpdateExpression:    aws.String("SET SnoozedUntil = :snoozedUntil, SnoozeKey = :snoozeKey"),
+		ConditionExpression: aws.String("attribute_not_exists(TrashedTime)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":snoozedUntil": snoozedUntil,
+			":snoozeKey":    &dynamodbTypes.AttributeValueMemberS{Value: email.SnoozeKey},
+		},
+	}, updates)
+	if err != nil {
+		if errors.Is(err, errThreadConditionFailed) {
+			return platform.ErrThreadTrashed
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionSnoozed, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("snooze thread finished successfully")
+	return nil
+}
+
+// Unsnooze shows a snoozed thread again, and the emails snoozed together with it, without waking them
+func Unsnooze(ctx context.Context, client platform.UpdateThreadAPI, threadID string) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	if thread.SnoozedUntil == nil {
+		return &platform.NotSnoozedError{Type: "thread"}
+	}
+
+	var updates []*dynamodbTypes.Update
+	for _, e := range thread.Emails {
+		if e.MessageID == "" || !e.SnoozedByThread {
+			continue
+		}
+		updates = append(updates, &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: e.MessageID},
+			},
+			UpdateExpression:    aws.String("REMOVE SnoozedUntil, SnoozedByThread"),
+			ConditionExpression: aws.String("attribute_exists(SnoozedByThread)"),
+		})
+	}
+
+	err = updateWithEmails(ctx, client, &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		},
+		UpdateExpression:    aws.String("REMOVE SnoozedUntil, SnoozeKey"),
+		ConditionExpression: aws.String("attribute_exists(SnoozedUntil)"),
+	}, updates)
+	if err != nil {
+		if errors.Is(err, errThreadConditionFailed) {
+			return &platform.NotSnoozedError{Type: "thread"}
+		}
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUnsnoozed, Thread: hook.Thread{ID: threadID}})
+
+	fmt.Println("unsnooze thread finished successfully")
+	return nil
+}
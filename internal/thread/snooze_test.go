@@ -0,0 +1,148 @@
+package thread
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnooze(t *testing.T) {
+	env.TableName = "table-for-snooze-thread"
+	env.GsiSnoozeIndexName = "SnoozeIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a",
+		[3]string{"a-1", "inbox", "01"},
+		[3]string{"a-2", "sent", "02"},
+		[3]string{"a-3", "inbox", "03"},
+	)
+	until := time.Now().Add(time.Hour)
+	assert.Nil(t, email.Snooze(ctx, client, "a-3", until.Add(time.Hour)))
+
+	assert.Nil(t, Snooze(ctx, client, "thread-a", until))
+	thread, err := GetThreadWithEmails(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	if assert.NotNil(t, thread.SnoozedUntil) {
+		assert.Equal(t, until.UTC().Format(time.RFC3339), *thread.SnoozedUntil)
+	}
+	assert.True(t, thread.Emails[0].SnoozedByThread)
+	assert.Empty(t, thread.Emails[1].SnoozedUntil, "sent emails are not snoozed")
+	assert.False(t, thread.Emails[2].SnoozedByThread, "emails snoozed individually keep their time")
+
+	assert.Nil(t, Unsnooze(ctx, client, "thread-a"))
+	thread, err = GetThreadWithEmails(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.Nil(t, thread.SnoozedUntil)
+	assert.Empty(t, thread.Emails[0].SnoozedUntil)
+	assert.NotEmpty(t, thread.Emails[2].SnoozedUntil)
+	assert.Equal(t, &platform.NotSnoozedError{Type: "thread"}, Unsnooze(ctx, client, "thread-a"))
+
+	assert.Equal(t, platform.ErrInvalidInput, Snooze(ctx, client, "thread-a", time.Now().Add(-time.Minute)))
+	assert.Equal(t, platform.ErrNotFound, Snooze(ctx, client, "missing", until))
+	assert.Nil(t, Trash(ctx, client, "thread-a"))
+	assert.Equal(t, platform.ErrThreadTrashed, Snooze(ctx, client, "thread-a", until))
+}
+
+func TestWake(t *testing.T) {
+	env.TableName = "table-for-wake"
+	env.GsiSnoozeIndexName = "SnoozeIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a",
+		[3]string{"a-1", "inbox", "01"},
+		[3]string{"a-2", "inbox", "02"},
+		[3]string{"a-3", "sent", "03"},
+	)
+	putEmailsInThread(t, client, "thread-b",
+		[3]string{"b-1", "inbox", "04"},
+		[3]string{"b-2", "sent", "05"},
+	)
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item: map[string]dynamodbTypes.AttributeValue{
+			"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "single"},
+			"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2023-02"},
+			"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "06-00:00:00"},
+		},
+	})
+	assert.Nil(t, err)
+	for _, id := range []string{"a-1", "a-2", "b-1"} {
+		assert.Nil(t, email.Read(ctx, client, id, email.ActionRead))
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	assert.Nil(t, Snooze(ctx, client, "thread-a", until))
+	assert.Nil(t, email.Snooze(ctx, client, "b-1", until))
+	assert.Nil(t, email.Snooze(ctx, client, "single", until.Add(time.Hour)))
+
+	result, err := Wake(ctx, client, until.Add(-time.Second))
+	assert.Nil(t, err)
+	assert.Empty(t, result.Woken)
+
+	now := until.Add(time.Minute)
+	result, err = Wake(ctx, client, now)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"thread-a", "b-1"}, result.Woken)
+	assert.Empty(t, result.Failed)
+
+	// the latest received email of thread-a is moved to the end, and the other one is only shown again
+	thread, err := GetThreadWithEmails(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.Nil(t, thread.SnoozedUntil)
+	assert.Equal(t, []string{"a-1", "a-3", "a-2"}, thread.EmailIDs)
+	assert.Equal(t, now.Format(time.RFC3339), thread.TimeUpdated)
+	assert.Equal(t, 1, thread.UnreadCount)
+	assert.Equal(t, map[string]string{
+		"a-1": "thread-a",
+		"a-2": "thread-a latest",
+		"a-3": "thread-a",
+	}, threadOf(t, client, "a-1", "a-2", "a-3"))
+	moved, err := email.Get(ctx, client, "a-2")
+	assert.Nil(t, err)
+	assert.Equal(t, now.Format(time.RFC3339), moved.TimeReceived)
+	assert.True(t, *moved.Unread)
+	assert.Empty(t, moved.SnoozedUntil)
+	shown, err := email.Get(ctx, client, "a-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "2023-02-01T00:00:00Z", shown.TimeReceived)
+	assert.False(t, *shown.Unread)
+	assert.False(t, shown.SnoozedByThread)
+
+	// an email snoozed individually is moved to the end of its thread
+	thread, err = GetThreadWithEmails(ctx, client, "thread-b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b-2", "b-1"}, thread.EmailIDs)
+	assert.Equal(t, 1, thread.UnreadCount)
+	assert.Equal(t, map[string]string{
+		"b-1": "thread-b latest",
+		"b-2": "thread-b",
+	}, threadOf(t, client, "b-1", "b-2"))
+
+	result, err = Wake(ctx, client, until.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"single"}, result.Woken)
+	single, err := email.Get(ctx, client, "single")
+	assert.Nil(t, err)
+	assert.Equal(t, until.Add(2*time.Hour).Format(time.RFC3339), single.TimeReceived)
+	assert.True(t, *single.Unread)
+	assert.Empty(t, single.SnoozedUntil)
+
+	result, err = Wake(ctx, client, until.Add(3*time.Hour))
+	assert.Nil(t, err)
+	assert.Empty(t, result.Woken)
+
+	report, err := Check(ctx, client, CheckOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Problems)
+}
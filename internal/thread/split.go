@@ -0,0 +1,114 @@
+package thread
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/idutil"
+)
+
+// Split moves an email and the emails after it out of a thread, into a new thread which is returned.
+// The draft of the thread replies to the latest email, so it's moved to the new thread as well.
+// The new thread is muted, starred, archived or snoozed as the thread is, so the moved emails keep their state.
+// All changes are applied in one transaction, which fails with platform.ErrConflict if the thread is changed meanwhile.
+func Split(ctx context.Context, client platform.UpdateThreadAPI, threadID, emailID string) (*Thread, error) {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return nil, err
+	}
+	if thread.TrashedTime != nil {
+		return nil, platform.ErrThreadTrashed
+	}
+	i := slices.Index(thread.EmailIDs, emailID)
+	if i < 0 || thread.Emails[i].MessageID == "" {
+		return nil, platform.ErrNotFound
+	}
+	kept := existingEmails(thread.Emails[:i])
+	moved := existingEmails(thread.Emails[i:])
+	if len(kept) == 0 {
+		// splitting at the first email leaves nothing behind
+		return nil, platform.ErrInvalidInput
+	}
+
+	newThreadID := idutil.GenerateThreadID()
+	var items []dynamodbTypes.TransactWriteItem
+	for j, e := range kept {
+		if update := relinkEmail(e, threadID, j == len(kept)-1, nil); update != nil {
+			items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+		}
+	}
+	for j, e := range moved {
+		items = append(items, dynamodbTypes.TransactWriteItem{Update: relinkEmail(e, newThreadID, j == len(moved)-1, nil)})
+	}
+
+	newThread := threadAttributes(moved)
+	typeYearMonth, err := threadTypeYearMonth(moved[0])
+	if err != nil {
+		return nil, err
+	}
+	item := map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: newThreadID},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+		"Subject":       newThread[":subject"],
+		"EmailIDs":      newThread[":emailIDs"],
+		"TimeUpdated":   newThread[":timeUpdated"],
+		"UnreadCount":   newThread[":unreadCount"],
+	}
+	copyState(thread, item)
+	if thread.Draft != nil {
+		item["DraftID"] = &dynamodbTypes.AttributeValueMemberS{Value: thread.Draft.MessageID}
+		items = append(items, dynamodbTypes.TransactWriteItem{Update: relinkEmail(thread.Draft, newThreadID, false, nil)})
+	}
+
+	update, err := threadUpdate(thread, kept, "")
+	if err != nil {
+		return nil, err
+	}
+	items = append(items,
+		dynamodbTypes.TransactWriteItem{Update: update},
+		dynamodbTypes.TransactWriteItem{Put: &dynamodbTypes.Put{
+			TableName:           aws.String(env.TableName),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(MessageID)"),
+		}},
+	)
+
+	err = transactItems(ctx, client, items)
+	if err != nil {
+		return nil, err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUpdated, Thread: hook.Thread{ID: threadID}})
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionCreated, Thread: hook.Thread{ID: newThreadID}})
+
+	fmt.Println("split thread finished successfully")
+	return GetThreadWithEmails(ctx, client, newThreadID)
+}
+
+// copyState copies whether a thread is muted, starred, archived or snoozed to the item of a new thread
+func copyState(thread *Thread, item map[string]dynamodbTypes.AttributeValue) {
+	if thread.Muted {
+		item["Muted"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		item["MuteAction"] = &dynamodbTypes.AttributeValueMemberS{Value: thread.MuteAction}
+	}
+	if thread.Starred {
+		item["Starred"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		item["StarredKey"] = &dynamodbTypes.AttributeValueMemberS{Value: email.StarredKey}
+		item["StarredTime"] = &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	}
+	if thread.ArchivedTime != nil {
+		item["ArchivedTime"] = &dynamodbTypes.AttributeValueMemberS{Value: *thread.ArchivedTime}
+	}
+	if thread.SnoozedUntil != nil {
+		item["SnoozedUntil"] = &dynamodbTypes.AttributeValueMemberS{Value: *thread.SnoozedUntil}
+		item["SnoozeKey"] = &dynamodbTypes.AttributeValueMemberS{Value: email.SnoozeKey}
+	}
+}
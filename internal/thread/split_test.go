@@ -0,0 +1,112 @@
+package thread
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	env.TableName = "table-for-split-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"email-1", "inbox", "01"},
+		[3]string{"email-2", "sent", "02"},
+		[3]string{"email-3", "inbox", "03"},
+		[3]string{"email-4", "sent", "04"},
+		[3]string{"draft", "draft", "05"},
+	)
+
+	newThread, err := Split(ctx, client, "thread", "email-3")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "thread", newThread.MessageID)
+	assert.Equal(t, []string{"email-3", "email-4"}, newThread.EmailIDs)
+	assert.Equal(t, "draft", newThread.DraftID)
+	assert.Equal(t, "subject email-3", newThread.Subject)
+	assert.Equal(t, "2023-02-04T00:00:00Z", newThread.TimeUpdated)
+	assert.Equal(t, 1, newThread.UnreadCount)
+
+	thread, err := GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"email-1", "email-2"}, thread.EmailIDs)
+	assert.Empty(t, thread.DraftID)
+	assert.Equal(t, "2023-02-02T00:00:00Z", thread.TimeUpdated)
+	assert.Equal(t, 1, thread.UnreadCount)
+
+	assert.Equal(t, map[string]string{
+		"email-1": "thread",
+		"email-2": "thread latest",
+		"email-3": newThread.MessageID,
+		"email-4": newThread.MessageID + " latest",
+		"draft":   newThread.MessageID,
+	}, threadOf(t, client, "email-1", "email-2", "email-3", "email-4", "draft"))
+
+	// merging them back restores the thread
+	thread, err = Merge(ctx, client, "thread", newThread.MessageID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"email-1", "email-2", "email-3", "email-4"}, thread.EmailIDs)
+	assert.Equal(t, "draft", thread.DraftID)
+	assert.Equal(t, 2, thread.UnreadCount)
+}
+
+func TestSplit_State(t *testing.T) {
+	env.TableName = "table-for-split-thread-state"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"email-1", "inbox", "01"},
+		[3]string{"email-2", "inbox", "02"},
+	)
+	until := time.Now().Add(time.Hour).UTC()
+	assert.Nil(t, Archive(ctx, client, "thread"))
+	assert.Nil(t, Snooze(ctx, client, "thread", until))
+	assert.Nil(t, Star(ctx, client, "thread"))
+	assert.Nil(t, Mute(ctx, client, "thread", MuteActionRead))
+	thread, err := GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+
+	newThread, err := Split(ctx, client, "thread", "email-2")
+	assert.Nil(t, err)
+	assert.True(t, newThread.Starred)
+	assert.True(t, newThread.Muted)
+	assert.Equal(t, MuteActionRead, newThread.MuteAction)
+	assert.Equal(t, thread.ArchivedTime, newThread.ArchivedTime)
+	assert.Equal(t, until.Format(time.RFC3339), aws.ToString(newThread.SnoozedUntil))
+	assert.Equal(t, email.SnoozeKey, client.Item(env.TableName, newThread.MessageID)["SnoozeKey"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, email.StarredKey, client.Item(env.TableName, newThread.MessageID)["StarredKey"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	assert.True(t, newThread.Emails[0].ArchivedByThread)
+	assert.True(t, newThread.Emails[0].SnoozedByThread)
+}
+
+func TestSplit_Invalid(t *testing.T) {
+	env.TableName = "table-for-split-thread-invalid"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"email-1", "inbox", "01"},
+		[3]string{"email-2", "inbox", "02"},
+	)
+
+	_, err := Split(ctx, client, "thread", "email-1")
+	assert.Equal(t, platform.ErrInvalidInput, err)
+	_, err = Split(ctx, client, "thread", "not-exist")
+	assert.Equal(t, platform.ErrNotFound, err)
+	_, err = Split(ctx, client, "not-exist", "email-2")
+	assert.Equal(t, platform.ErrNotFound, err)
+
+	assert.Nil(t, Trash(ctx, client, "thread"))
+	_, err = Split(ctx, client, "thread", "email-2")
+	assert.Equal(t, platform.ErrThreadTrashed, err)
+}
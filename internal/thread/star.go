@@ -0,0 +1,34 @@
+package thread
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/platform"
+)
+
+// Star marks a thread as starred. The emails in the thread are not changed.
+func Star(ctx context.Context, client platform.UpdateEmailAPI, threadID string) error {
+	err := email.UpdateStarred(ctx, client, threadID, true, "begins_with(TypeYearMonth, :v_type)")
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionStarred, Thread: hook.Thread{ID: threadID}})
+	fmt.Println("star thread finished successfully")
+	return nil
+}
+
+// Unstar marks a thread as not starred
+func Unstar(ctx context.Context, client platform.UpdateEmailAPI, threadID string) error {
+	err := email.UpdateStarred(ctx, client, threadID, false, "begins_with(TypeYearMonth, :v_type)")
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUnstarred, Thread: hook.Thread{ID: threadID}})
+	fmt.Println("unstar thread finished successfully")
+	return nil
+}
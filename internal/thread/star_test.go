@@ -0,0 +1,44 @@
+package thread
+
+import (
+	"context"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStar(t *testing.T) {
+	env.TableName = "table-for-star-thread"
+	env.GsiStarredIndexName = "StarredIndex"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread-a", [3]string{"a-1", "inbox", "01"})
+
+	assert.Nil(t, Star(ctx, client, "thread-a"))
+	thread, err := GetThread(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.True(t, thread.Starred)
+	starred, err := email.ListStarred(ctx, client, email.ListStarredInput{})
+	assert.Nil(t, err)
+	if assert.Len(t, starred.Items, 1) {
+		assert.Equal(t, "thread", starred.Items[0].Type)
+		assert.Equal(t, "thread-a", starred.Items[0].MessageID)
+	}
+	result, err := email.Get(ctx, client, "a-1")
+	assert.Nil(t, err)
+	assert.False(t, result.Starred, "emails in the thread are not starred")
+
+	assert.Nil(t, Unstar(ctx, client, "thread-a"))
+	thread, err = GetThread(ctx, client, "thread-a")
+	assert.Nil(t, err)
+	assert.False(t, thread.Starred)
+
+	assert.Equal(t, platform.ErrNotFound, Star(ctx, client, "missing"))
+	assert.Equal(t, platform.ErrNotFound, Star(ctx, client, "a-1"), "emails are starred by email.Star")
+	assert.Equal(t, platform.ErrNotFound, Unstar(ctx, client, "a-1"))
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,19 +16,27 @@ import (
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/harryzcy/mailbox/internal/util/format"
 	"github.com/harryzcy/mailbox/internal/util/idutil"
 )
 
 type Thread struct {
-	MessageID   string   `json:"messageID"`
-	Type        string   `json:"type"`    // always "thread"
-	Subject     string   `json:"subject"` // The subject of the first email in the thread
-	EmailIDs    []string `json:"emailIDs"`
-	DraftID     string   `json:"draftID,omitempty"`
-	TimeUpdated string   `json:"timeUpdated"`           // The time the last email is received or sent
-	TrashedTime *string  `json:"trashedTime,omitempty"` // Time in RFC3339 format
+	MessageID    string   `json:"messageID"`
+	Type         string   `json:"type"`    // always "thread"
+	Subject      string   `json:"subject"` // The subject of the first email in the thread
+	EmailIDs     []string `json:"emailIDs"`
+	DraftID      string   `json:"draftID,omitempty"`
+	TimeUpdated  string   `json:"timeUpdated"`            // The time the last email is received or sent
+	TrashedTime  *string  `json:"trashedTime,omitempty"`  // Time in RFC3339 format
+	ArchivedTime *string  `json:"archivedTime,omitempty"` // Time in RFC3339 format
+	UnreadCount  int      `json:"unreadCount"`            // The number of unread emails in the thread
+	Muted        bool     `json:"muted,omitempty"`        // If true, emails received in the thread are stored as read without notifications
+	MuteAction   string   `json:"muteAction,omitempty"`   // MuteActionRead or MuteActionTrash
+	Starred      bool     `json:"starred,omitempty"`
+	SnoozedUntil *string  `json:"snoozedUntil,omitempty"` // Time in RFC3339 format
 
 	Emails []email.GetResult `json:"emails,omitempty"`
 	Draft  *email.GetResult  `json:"draft,omitempty"`
@@ -74,29 +84,12 @@ func GetThreadWithEmails(ctx context.Context, client platform.GetThreadWithEmail
 		return nil, err
 	}
 
-	keys := []map[string]dynamodbTypes.AttributeValue{}
-	for _, emailID := range thread.EmailIDs {
-		keys = append(keys, map[string]dynamodbTypes.AttributeValue{
-			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: emailID},
-		})
-	}
+	ids := thread.EmailIDs
 	if thread.DraftID != "" {
-		keys = append(keys, map[string]dynamodbTypes.AttributeValue{
-			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: thread.DraftID},
-		})
+		ids = append(slices.Clip(ids), thread.DraftID)
 	}
-
-	resp, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
-		RequestItems: map[string]dynamodbTypes.KeysAndAttributes{
-			env.TableName: {
-				Keys: keys,
-			},
-		},
-	})
+	items, err := batchGetItems(ctx, client, ids)
 	if err != nil {
-		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
-			return nil, platform.ErrTooManyRequests
-		}
 		return nil, err
 	}
 
@@ -107,7 +100,7 @@ func GetThreadWithEmails(ctx context.Context, client platform.GetThreadWithEmail
 
 	thread.Emails = make([]email.GetResult, len(thread.EmailIDs))
 
-	for _, item := range resp.Responses[env.TableName] {
+	for _, item := range items {
 		email, err := email.ParseGetResult(item)
 		if err != nil {
 			return nil, err
@@ -123,9 +116,47 @@ func GetThreadWithEmails(ctx context.Context, client platform.GetThreadWithEmail
 	return thread, nil
 }
 
+// batchSize is the maximum number of items in a BatchGetItem request
+const batchSize = 100
+
+// batchGetItems gets the items by their IDs, in batches of batchSize. Items may be returned in any order.
+func batchGetItems(ctx context.Context, client platform.GetThreadWithEmailsAPI, ids []string) ([]map[string]dynamodbTypes.AttributeValue, error) {
+	var items []map[string]dynamodbTypes.AttributeValue
+	for chunk := range slices.Chunk(ids, batchSize) {
+		keys := make([]map[string]dynamodbTypes.AttributeValue, 0, len(chunk))
+		for _, id := range chunk {
+			keys = append(keys, map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: id},
+			})
+		}
+		requestItems := map[string]dynamodbTypes.KeysAndAttributes{
+			env.TableName: {Keys: keys},
+		}
+		for len(requestItems) > 0 {
+			resp, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: requestItems})
+			if err != nil {
+				if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+					return nil, platform.ErrTooManyRequests
+				}
+				return nil, err
+			}
+			items = append(items, resp.Responses[env.TableName]...)
+			requestItems = resp.UnprocessedKeys
+		}
+	}
+	return items, nil
+}
+
 type DetermineThreadInput struct {
 	InReplyTo  string
 	References string
+
+	// used by the subject stage
+	MessageID string   // the ID of the incoming email, which is skipped if it's already stored
+	Subject   string   // the subject of the incoming email
+	From      []string // the senders of the incoming email
+	To        []string // the recipients of the incoming email
+	Time      string   // the time the incoming email is received or sent, in RFC3339 format
 }
 
 type DetermineThreadOutput struct {
@@ -137,85 +168,37 @@ type DetermineThreadOutput struct {
 	CreatingEmailID string // If ShouldCreate is true, the messageID of the first email in the thread
 	CreatingSubject string // If ShouldCreate is true, the subject of the first email in the thread
 	CreatingTime    string // If ShouldCreate is true, the time the first email is received
+	CreatingUnread  bool   // If ShouldCreate is true, whether the first email in the thread is unread
+
+	Stage      string  // The stage that matched the email, e.g. StageInReplyTo, if ThreadID is not empty
+	Confidence float64 // How likely the match is correct, from 0 to 1
 }
 
 // DetermineThread determines which thread an incoming email belongs to.
 // If a thread already exists, the ThreadID is returned and Exists is true.
 // If a thread does not exist and a new thread should be created, the ThreadID is randomly generated and ShouldCreate is true.
 //
-// TODO: refactor this function
-//
-//gocyclo:ignore
+// The email is matched by the stages enabled in env.Threading, in the order of
+// In-Reply-To, all References entries, and then the subject and participants within env.ThreadingWindow.
 func DetermineThread(ctx context.Context, client platform.QueryAndGetItemAPI, input *DetermineThreadInput) (*DetermineThreadOutput, error) {
 	fmt.Println("Determining thread...")
-	originalMessageID := ""
-	if len(input.InReplyTo) > 0 {
-		originalMessageID = input.InReplyTo
-	} else if len(input.References) > 0 {
-		references := strings.Split(input.References, " ")
-		originalMessageID = references[len(references)-1] // The last messageID in the References header
-	}
-
-	if originalMessageID == "" {
-		return &DetermineThreadOutput{}, nil
+	config := loadMatchConfig()
+	m, err := matchByHeaders(ctx, client, config, input)
+	if err != nil {
+		return nil, err
 	}
-
-	sesDomain := env.Region + ".amazonses.com"
-	var possibleSentID string
-	if strings.HasSuffix(originalMessageID, "@"+sesDomain+">") {
-		fmt.Println("incoming email is replying to a SES email")
-		// If the messageID ends with @<SES domain>, it maybe a messageID of a sent email.
-		// In this case, we need check if there's a corresponding sent email.
-		possibleSentID = strings.TrimSuffix(originalMessageID, "@"+sesDomain+">")
-		possibleSentID = strings.TrimPrefix(possibleSentID, "<")
-	}
-
-	var previousEmail *email.GetResult
-	var err error
-	isSentEmail := false
-	if possibleSentID != "" {
-		// Check if the messageID is a sent email first
-		fmt.Println("checking possible sent email")
-		previousEmail, err = email.Get(ctx, client, possibleSentID)
-		if err != nil && !errors.Is(err, platform.ErrNotFound) {
-			return nil, err
-		}
-		isSentEmail = true
-	}
-
-	if previousEmail == nil {
-		// If the messageID does not corresponded to a sent email, check if it's a received email
-		fmt.Println("checking original messageID")
-		var resp *dynamodb.QueryOutput
-		resp, err = client.Query(ctx, &dynamodb.QueryInput{
-			TableName:              aws.String(env.TableName),
-			IndexName:              aws.String(env.GsiOriginalIndexName),
-			KeyConditionExpression: aws.String("OriginalMessageID = :originalMessageID"),
-			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
-				":originalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: originalMessageID},
-			},
-		})
-		if err != nil {
-			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
-				return nil, platform.ErrTooManyRequests
-			}
-			return nil, err
-		}
-		// TODO: handle the case where len(resp.Items) > 1
-		if len(resp.Items) == 0 {
-			return &DetermineThreadOutput{}, nil
-		}
-
-		searchMessageID := resp.Items[0]["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value
-		previousEmail, err = email.Get(ctx, client, searchMessageID)
+	if m == nil {
+		m, err = matchBySubject(ctx, client, config, input)
 		if err != nil {
-			if errors.Is(err, platform.ErrNotFound) {
-				return &DetermineThreadOutput{}, nil
-			}
 			return nil, err
 		}
 	}
+	if m == nil {
+		return &DetermineThreadOutput{}, nil
+	}
+	fmt.Printf("matched email %s by %s with confidence %.2f\n", m.email.MessageID, m.stage, m.confidence)
 
+	previousEmail := m.email
 	if previousEmail.ThreadID == "" {
 		// There's no thread for previousEmail, so we need to create a new thread
 		fmt.Println("determining thread finished: new thread should be created")
@@ -226,8 +209,11 @@ func DetermineThread(ctx context.Context, client platform.QueryAndGetItemAPI, in
 			CreatingEmailID: previousEmail.MessageID,
 			CreatingSubject: previousEmail.Subject,
 			CreatingTime:    previousEmail.TimeReceived,
+			CreatingUnread:  previousEmail.Unread != nil && *previousEmail.Unread,
+			Stage:           m.stage,
+			Confidence:      m.confidence,
 		}
-		if isSentEmail {
+		if previousEmail.Type == model.EmailTypeSent {
 			output.CreatingTime = previousEmail.TimeSent
 		}
 		return output, nil
@@ -239,6 +225,8 @@ func DetermineThread(ctx context.Context, client platform.QueryAndGetItemAPI, in
 			ThreadID:          previousEmail.ThreadID,
 			Exists:            true,
 			PreviousMessageID: previousEmail.MessageID,
+			Stage:             m.stage,
+			Confidence:        m.confidence,
 		}, nil
 	}
 
@@ -252,6 +240,8 @@ func DetermineThread(ctx context.Context, client platform.QueryAndGetItemAPI, in
 		ThreadID:          previousEmail.ThreadID,
 		Exists:            true,
 		PreviousMessageID: thread.EmailIDs[len(thread.EmailIDs)-1],
+		Stage:             m.stage,
+		Confidence:        m.confidence,
 	}, nil
 }
 
@@ -265,6 +255,15 @@ type StoreEmailWithExistingThreadInput struct {
 // StoreEmailWithExistingThread stores the email and updates the thread.
 func StoreEmailWithExistingThread(ctx context.Context, client platform.TransactWriteItemsAPI, input *StoreEmailWithExistingThreadInput) error {
 	input.Email["IsThreadLatest"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+	updateExpression := "SET #emails = list_append(#emails, :emails), #timeUpdated = :timeUpdated"
+	values := map[string]dynamodbTypes.AttributeValue{
+		":emails":      &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{input.Email["MessageID"]}},
+		":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: input.TimeReceived},
+	}
+	if isUnread(input.Email) {
+		updateExpression += " ADD UnreadCount :one"
+		values[":one"] = &dynamodbTypes.AttributeValueMemberN{Value: "1"}
+	}
 	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: []dynamodbTypes.TransactWriteItem{
 			{
@@ -281,15 +280,12 @@ func StoreEmailWithExistingThread(ctx context.Context, client platform.TransactW
 					Key: map[string]dynamodbTypes.AttributeValue{
 						"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: input.ThreadID},
 					},
-					UpdateExpression: aws.String("SET #emails = list_append(#emails, :emails), #timeUpdated = :timeUpdated"),
+					UpdateExpression: aws.String(updateExpression),
 					ExpressionAttributeNames: map[string]string{
 						"#emails":      "EmailIDs",
 						"#timeUpdated": "TimeUpdated",
 					},
-					ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
-						":emails":      &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{input.Email["MessageID"]}},
-						":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: input.TimeReceived},
-					},
+					ExpressionAttributeValues: values,
 				},
 			},
 			{
@@ -318,6 +314,7 @@ type StoreEmailWithNewThreadInput struct {
 	CreatingEmailID string
 	CreatingSubject string
 	CreatingTime    string
+	CreatingUnread  bool
 }
 
 // StoreEmailWithNewThread stores the email, creates a new thread, and add ThreadID to previous email
@@ -343,6 +340,13 @@ func StoreEmailWithNewThread(ctx context.Context, client platform.TransactWriteI
 		},
 		"TimeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: input.TimeReceived},
 	}
+	unreadCount := 0
+	for _, unread := range []bool{input.CreatingUnread, isUnread(input.Email)} {
+		if unread {
+			unreadCount++
+		}
+	}
+	thread["UnreadCount"] = &dynamodbTypes.AttributeValueMemberN{Value: strconv.Itoa(unreadCount)}
 
 	input.Email["IsThreadLatest"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
 	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
@@ -392,29 +396,44 @@ type StoreEmailInput struct {
 	TimeReceived string // RFC3339
 }
 
-// StoreEmail attempts to store the email. If error occurs, it will be logged and the function will return.
-func StoreEmail(ctx context.Context, client platform.StoreEmailAPI, input *StoreEmailInput) {
+// StoreEmail stores the email and links it to its thread.
+// If the thread can't be determined, the error is logged and the email is stored without a thread.
+func StoreEmail(ctx context.Context, client platform.StoreEmailAPI, input *StoreEmailInput) error {
+	// attributes that can't be unmarshalled are left empty, which only disables the subject stage
+	var incoming candidate
+	_ = attributevalue.UnmarshalMap(input.Item, &incoming)
 	output, err := DetermineThread(ctx, client, &DetermineThreadInput{
 		InReplyTo:  input.InReplyTo,
 		References: input.References,
+		MessageID:  incoming.MessageID,
+		Subject:    incoming.Subject,
+		From:       incoming.From,
+		To:         incoming.To,
+		Time:       input.TimeReceived,
 	})
 	if err != nil {
 		log.Printf("failed to determine thread, %v\n", err)
 		// continue
-	} else {
+	} else if output.ThreadID != "" {
+		// emails without a thread must not have ThreadID, otherwise they can't be deleted
 		input.Item["ThreadID"] = &dynamodbTypes.AttributeValueMemberS{Value: output.ThreadID}
 	}
 
 	if output != nil && output.Exists {
+		muted := applyMute(ctx, client, output.ThreadID, input.Item)
 		err = StoreEmailWithExistingThread(ctx, client, &StoreEmailWithExistingThreadInput{
 			ThreadID:          output.ThreadID,
 			Email:             input.Item,
+			TimeReceived:      input.TimeReceived,
 			PreviousMessageID: output.PreviousMessageID,
 		})
 		if err != nil {
-			log.Fatalf("failed to store email with existing thread, %v", err)
+			return fmt.Errorf("failed to store email with existing thread, %w", err)
 		}
-		return
+		if !muted {
+			hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUpdated, Thread: hook.Thread{ID: output.ThreadID}})
+		}
+		return nil
 	}
 
 	if output != nil && output.ShouldCreate {
@@ -425,11 +444,13 @@ func StoreEmail(ctx context.Context, client platform.StoreEmailAPI, input *Store
 			CreatingEmailID: output.CreatingEmailID,
 			CreatingSubject: output.CreatingSubject,
 			CreatingTime:    output.CreatingTime,
+			CreatingUnread:  output.CreatingUnread,
 		})
 		if err != nil {
-			log.Fatalf("failed to store email with new thread, %v", err)
+			return fmt.Errorf("failed to store email with new thread, %w", err)
 		}
-		return
+		hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionCreated, Thread: hook.Thread{ID: output.ThreadID}})
+		return nil
 	}
 
 	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
@@ -437,6 +458,39 @@ func StoreEmail(ctx context.Context, client platform.StoreEmailAPI, input *Store
 		Item:      input.Item,
 	})
 	if err != nil {
-		log.Fatalf("failed to store item in DynamoDB, %v", err)
+		return fmt.Errorf("failed to store item in DynamoDB, %w", err)
+	}
+	return nil
+}
+
+// applyMute stores a received email as read, or trashed, if its thread is muted, and returns whether the thread is muted.
+// MutedByThread is set on the email, so that the caller can skip the notifications.
+func applyMute(ctx context.Context, client platform.GetItemAPI, threadID string, item map[string]dynamodbTypes.AttributeValue) bool {
+	typeYearMonth, ok := item["TypeYearMonth"].(*dynamodbTypes.AttributeValueMemberS)
+	if !ok || !strings.HasPrefix(typeYearMonth.Value, model.EmailTypeInbox+"#") {
+		return false
+	}
+	thread, err := GetThread(ctx, client, threadID)
+	if err != nil {
+		// the email is stored as usual
+		log.Printf("failed to get thread, %v\n", err)
+		return false
 	}
+	if !thread.Muted {
+		return false
+	}
+
+	fmt.Println("thread is muted")
+	delete(item, "Unread") // read emails have no Unread attribute
+	item["MutedByThread"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+	if thread.MuteAction == MuteActionTrash {
+		item["TrashedTime"] = &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	}
+	return true
+}
+
+// isUnread returns true if the email item is unread
+func isUnread(item map[string]dynamodbTypes.AttributeValue) bool {
+	unread, ok := item["Unread"].(*dynamodbTypes.AttributeValueMemberBOOL)
+	return ok && unread.Value
 }
@@ -6,9 +6,11 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/smithy-go/middleware"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
@@ -18,6 +20,53 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// putEmailsInThread puts a thread with the emails, given as {id, type, day of February 2023},
+// where the last email is the latest and a draft is attached as DraftID
+func putEmailsInThread(t *testing.T, client *memory.Client, threadID string, emails ...[3]string) {
+	t.Helper()
+	ctx := context.TODO()
+	var emailIDs []string
+	draftID := ""
+	for i, e := range emails {
+		item := map[string]dynamodbTypes.AttributeValue{
+			"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: e[0]},
+			"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: e[1] + "#2023-02"},
+			"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: e[2] + "-00:00:00"},
+			"Subject":       &dynamodbTypes.AttributeValueMemberS{Value: "subject " + e[0]},
+			"ThreadID":      &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		}
+		if e[1] == "draft" {
+			draftID = e[0]
+		} else {
+			emailIDs = append(emailIDs, e[0])
+		}
+		if e[1] == "inbox" {
+			item["Unread"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		}
+		if i == len(emails)-1 || (e[1] != "draft" && i == len(emails)-2 && emails[i+1][1] == "draft") {
+			item["IsThreadLatest"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+		}
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(env.TableName), Item: item})
+		assert.Nil(t, err)
+	}
+
+	ids, err := attributevalue.Marshal(emailIDs)
+	assert.Nil(t, err)
+	item := map[string]dynamodbTypes.AttributeValue{
+		"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+		"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "thread#2023-02"},
+		"Subject":       &dynamodbTypes.AttributeValueMemberS{Value: "subject " + threadID},
+		"EmailIDs":      ids,
+		"TimeUpdated":   &dynamodbTypes.AttributeValueMemberS{Value: "2023-02-28T00:00:00Z"},
+		"UnreadCount":   &dynamodbTypes.AttributeValueMemberN{Value: "0"},
+	}
+	if draftID != "" {
+		item["DraftID"] = &dynamodbTypes.AttributeValueMemberS{Value: draftID}
+	}
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(env.TableName), Item: item})
+	assert.Nil(t, err)
+}
+
 func TestGetThread(t *testing.T) {
 	env.TableName = "table-for-get-thread"
 	tests := []struct {
@@ -371,6 +420,7 @@ func TestStoreEmailWithNewThread(t *testing.T) {
 									},
 									"TimeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: "2023-02-19T01:01:01Z"},
 									"Subject":     &dynamodbTypes.AttributeValueMemberS{Value: "exampleCreatingSubject"},
+									"UnreadCount": &dynamodbTypes.AttributeValueMemberN{Value: "0"},
 								}, item.Put.Item)
 							case "exampleMessageID":
 								assert.Equal(t, map[string]dynamodbTypes.AttributeValue{
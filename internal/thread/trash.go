@@ -10,32 +10,106 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
-func Trash(ctx context.Context, client platform.UpdateItemAPI, threadID string) error {
-	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+// Trash trashes a thread and its emails.
+// Emails that are already trashed are left as they are, and the others are marked with TrashedByThread,
+// so that Untrash only restores the emails trashed with the thread.
+func Trash(ctx context.Context, client platform.UpdateThreadAPI, threadID string) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	if thread.TrashedTime != nil {
+		return &platform.AlreadyTrashedError{Type: "thread"}
+	}
+
+	trashedTime := &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	var updates []*dynamodbTypes.Update
+	for _, email := range thread.Emails {
+		if email.MessageID == "" || email.TrashedTime != "" {
+			continue
+		}
+		updates = append(updates, &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: email.MessageID},
+			},
+			UpdateExpression:    aws.String("SET TrashedTime = :trashedTime, TrashedByThread = :true"),
+			ConditionExpression: aws.String("attribute_not_exists(TrashedTime)"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":trashedTime": trashedTime,
+				":true":        &dynamodbTypes.AttributeValueMemberBOOL{Value: true},
+			},
+		})
+	}
+
+	err = updateWithEmails(ctx, client, &dynamodbTypes.Update{
 		TableName: aws.String(env.TableName),
 		Key: map[string]dynamodbTypes.AttributeValue{
 			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
 		},
-		UpdateExpression:    aws.String("SET TrashedTime = :val1"),
+		UpdateExpression:    aws.String("SET TrashedTime = :trashedTime"),
 		ConditionExpression: aws.String("attribute_not_exists(TrashedTime)"),
 		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
-			":val1": &dynamodbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":trashedTime": trashedTime,
 		},
-	})
+	}, updates)
 	if err != nil {
-		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
-			return &platform.NotTrashedError{Type: "thread"}
-		}
-		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
-			return platform.ErrTooManyRequests
+		if errors.Is(err, errThreadConditionFailed) {
+			return &platform.AlreadyTrashedError{Type: "thread"}
 		}
-
 		return err
 	}
 
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionTrashed, Thread: hook.Thread{ID: threadID}})
+
 	fmt.Println("trash thread finished successfully")
 	return nil
 }
+
+// errThreadConditionFailed is returned by updateWithEmails when the condition of the thread update fails
+var errThreadConditionFailed = errors.New("thread condition failed")
+
+// updateWithEmails applies the updates of emails and the thread in transactions of at most maxTransactItems items.
+// The thread is updated with the last transaction, so that an interrupted operation can be retried,
+// since emails that are already updated are skipped by the callers.
+// If thread is nil, only the emails are updated.
+func updateWithEmails(ctx context.Context, client platform.TransactWriteItemsAPI, thread *dynamodbTypes.Update, emails []*dynamodbTypes.Update) error {
+	for {
+		n := min(len(emails), maxTransactItems-1)
+		last := n == len(emails)
+
+		items := make([]dynamodbTypes.TransactWriteItem, 0, n+1)
+		for _, update := range emails[:n] {
+			items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+		}
+		if last && thread != nil {
+			items = append(items, dynamodbTypes.TransactWriteItem{Update: thread})
+		}
+
+		_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+		if err != nil {
+			if apiErr := new(dynamodbTypes.TransactionCanceledException); errors.As(err, &apiErr) {
+				reasons := apiErr.CancellationReasons
+				if last && thread != nil && len(reasons) == len(items) && aws.ToString(reasons[len(reasons)-1].Code) == "ConditionalCheckFailed" {
+					return errThreadConditionFailed
+				}
+				return platform.ErrConflict
+			}
+			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return platform.ErrTooManyRequests
+			}
+			return err
+		}
+
+		if last {
+			return nil
+		}
+		emails = emails[n:]
+	}
+}
@@ -3,78 +3,78 @@ package thread
 import (
 	"context"
 	"strconv"
-	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/stretchr/testify/assert"
 )
 
-type mockUpdateItemAPI func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
-
-func (m mockUpdateItemAPI) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-	return m(ctx, params, optFns...)
+// trashState returns whether each email is trashed, and whether it's trashed by its thread
+func trashState(t *testing.T, client *memory.Client, ids ...string) map[string][2]bool {
+	t.Helper()
+	state := map[string][2]bool{}
+	for _, id := range ids {
+		result, err := email.Get(context.TODO(), client, id)
+		assert.Nil(t, err)
+		state[id] = [2]bool{result.TrashedTime != "", result.TrashedByThread}
+	}
+	return state
 }
 
 func TestTrash(t *testing.T) {
-	tests := []struct {
-		client      func(t *testing.T) platform.UpdateItemAPI
-		messageID   string
-		expectedErr error
-	}{
-		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					assert.Len(t, params.Key, 1)
-					assert.IsType(t, params.Key["MessageID"], &dynamodbTypes.AttributeValueMemberS{})
-					assert.Equal(t,
-						params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value,
-						"exampleThreadID",
-					)
+	env.TableName = "table-for-trash-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"inbox-1", "inbox", "01"},
+		[3]string{"inbox-2", "inbox", "01"},
+		[3]string{"sent-1", "sent", "01"},
+	)
+	assert.Nil(t, email.Trash(ctx, client, "inbox-2"))
 
-					assert.Contains(t, *params.UpdateExpression, "=")
-					updateExpressionParts := strings.Split(*params.UpdateExpression, "=")
-					assert.Equal(t, "SET TrashedTime", strings.TrimSpace(updateExpressionParts[0]))
-					assert.Contains(t, params.ExpressionAttributeValues, strings.TrimSpace(updateExpressionParts[1]))
+	assert.Nil(t, Trash(ctx, client, "thread"))
+	thread, err := GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.NotNil(t, thread.TrashedTime)
+	assert.Equal(t, map[string][2]bool{
+		"inbox-1": {true, true},
+		"inbox-2": {true, false}, // trashed before the thread
+		"sent-1":  {true, true},
+	}, trashState(t, client, "inbox-1", "inbox-2", "sent-1"))
 
-					assert.Equal(t, "attribute_not_exists(TrashedTime)",
-						*params.ConditionExpression)
+	list, err := email.List(ctx, client, email.ListInput{Type: "inbox", Year: "2023", Month: "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, list.Count)
+
+	assert.Equal(t, &platform.AlreadyTrashedError{Type: "thread"}, Trash(ctx, client, "thread"))
+	assert.Equal(t, platform.ErrNotFound, Trash(ctx, client, "not-exist"))
+}
+
+func TestTrash_LargeThread(t *testing.T) {
+	env.TableName = "table-for-trash-large-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+
+	var ids []string
+	var emails [][3]string
+	for i := range 250 {
+		ids = append(ids, "inbox-"+strconv.Itoa(i))
+		emails = append(emails, [3]string{ids[i], "inbox", "01"})
+	}
+	putEmailsInThread(t, client, "thread", emails...)
 
-					return &dynamodb.UpdateItemOutput{}, nil
-				})
-			},
-			messageID: "exampleThreadID",
-		},
-		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					return &dynamodb.UpdateItemOutput{}, &dynamodbTypes.ConditionalCheckFailedException{}
-				})
-			},
-			messageID:   "",
-			expectedErr: &platform.NotTrashedError{Type: "thread"},
-		},
-		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					return &dynamodb.UpdateItemOutput{}, platform.ErrNotFound
-				})
-			},
-			messageID:   "",
-			expectedErr: platform.ErrNotFound,
-		},
+	assert.Nil(t, Trash(ctx, client, "thread"), "emails are trashed in multiple transactions")
+	for id, state := range trashState(t, client, ids...) {
+		assert.Equal(t, [2]bool{true, true}, state, id)
 	}
 
-	for i, test := range tests {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			ctx := context.TODO()
-			err := Trash(ctx, test.client(t), test.messageID)
-			assert.Equal(t, test.expectedErr, err)
-		})
+	assert.Nil(t, Untrash(ctx, client, "thread"))
+	for id, state := range trashState(t, client, ids...) {
+		assert.Equal(t, [2]bool{false, false}, state, id)
 	}
 }
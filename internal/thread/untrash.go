@@ -6,34 +6,55 @@ import (
 	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/platform"
 )
 
-// Untrash marks an trashed email as not trashed
-func Untrash(ctx context.Context, client platform.UpdateItemAPI, messageID string) error {
-	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+// Untrash restores a trashed thread, and the emails trashed together with it.
+// Emails trashed individually before the thread stay trashed.
+func Untrash(ctx context.Context, client platform.UpdateThreadAPI, threadID string) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	if thread.TrashedTime == nil {
+		return &platform.NotTrashedError{Type: "thread"}
+	}
+
+	var updates []*dynamodbTypes.Update
+	for _, email := range thread.Emails {
+		if email.MessageID == "" || !email.TrashedByThread {
+			continue
+		}
+		updates = append(updates, &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: email.MessageID},
+			},
+			UpdateExpression:    aws.String("REMOVE TrashedTime, TrashedByThread"),
+			ConditionExpression: aws.String("attribute_exists(TrashedByThread)"),
+		})
+	}
+
+	err = updateWithEmails(ctx, client, &dynamodbTypes.Update{
 		TableName: aws.String(env.TableName),
 		Key: map[string]dynamodbTypes.AttributeValue{
-			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
 		},
 		UpdateExpression:    aws.String("REMOVE TrashedTime"),
 		ConditionExpression: aws.String("attribute_exists(TrashedTime)"),
-	})
+	}, updates)
 	if err != nil {
-		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+		if errors.Is(err, errThreadConditionFailed) {
 			return &platform.NotTrashedError{Type: "thread"}
 		}
-
-		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
-			return platform.ErrTooManyRequests
-		}
-
 		return err
 	}
 
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUntrashed, Thread: hook.Thread{ID: threadID}})
+
 	fmt.Println("untrash thread finished successfully")
 	return nil
 }
@@ -2,67 +2,43 @@ package thread
 
 import (
 	"context"
-	"strconv"
 	"testing"
 
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/datasource/memory"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/platform"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestUntrash(t *testing.T) {
-	tests := []struct {
-		client      func(t *testing.T) platform.UpdateItemAPI
-		messageID   string
-		expectedErr error
-	}{
-		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					assert.Len(t, params.Key, 1)
-					assert.IsType(t, params.Key["MessageID"], &dynamodbTypes.AttributeValueMemberS{})
-					assert.Equal(t,
-						params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value,
-						"exampleMessageID",
-					)
-					assert.Equal(t, "REMOVE TrashedTime", *params.UpdateExpression)
-					assert.Equal(t, "attribute_exists(TrashedTime)",
-						*params.ConditionExpression)
+	env.TableName = "table-for-untrash-thread"
+	env.QueueName = ""
+	ctx := context.TODO()
+	client := memory.NewClient()
+	putEmailsInThread(t, client, "thread",
+		[3]string{"inbox-1", "inbox", "01"},
+		[3]string{"inbox-2", "inbox", "01"},
+		[3]string{"inbox-3", "inbox", "01"},
+	)
+	assert.Equal(t, &platform.NotTrashedError{Type: "thread"}, Untrash(ctx, client, "thread"))
 
-					return &dynamodb.UpdateItemOutput{}, nil
-				})
-			},
-			messageID: "exampleMessageID",
-		},
-		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					return &dynamodb.UpdateItemOutput{}, &dynamodbTypes.ConditionalCheckFailedException{}
-				})
-			},
-			messageID:   "",
-			expectedErr: &platform.NotTrashedError{Type: "thread"},
-		},
-		{
-			client: func(t *testing.T) platform.UpdateItemAPI {
-				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
-					t.Helper()
-					return &dynamodb.UpdateItemOutput{}, platform.ErrNotFound
-				})
-			},
-			messageID:   "",
-			expectedErr: platform.ErrNotFound,
-		},
-	}
+	assert.Nil(t, email.Trash(ctx, client, "inbox-2"))
+	assert.Nil(t, Trash(ctx, client, "thread"))
+	// untrashing an email of the trashed thread, then trashing it again by itself
+	assert.Nil(t, email.Untrash(ctx, client, "inbox-3"))
+	assert.Nil(t, email.Trash(ctx, client, "inbox-3"))
 
-	for i, test := range tests {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			ctx := context.TODO()
-			err := Untrash(ctx, test.client(t), test.messageID)
-			assert.Equal(t, test.expectedErr, err)
-		})
-	}
+	assert.Nil(t, Untrash(ctx, client, "thread"))
+	thread, err := GetThread(ctx, client, "thread")
+	assert.Nil(t, err)
+	assert.Nil(t, thread.TrashedTime)
+	assert.Equal(t, map[string][2]bool{
+		"inbox-1": {false, false},
+		"inbox-2": {true, false}, // only emails trashed with the thread are restored
+		"inbox-3": {true, false},
+	}, trashState(t, client, "inbox-1", "inbox-2", "inbox-3"))
+
+	assert.Equal(t, &platform.NotTrashedError{Type: "thread"}, Untrash(ctx, client, "thread"))
+	assert.Equal(t, platform.ErrNotFound, Untrash(ctx, client, "not-exist"))
 }
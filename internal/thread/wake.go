@@ -0,0 +1,258 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/model"
+	"github.com/harryzcy/mailbox/internal/platform"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// WakeResult is the result of Wake
+type WakeResult struct {
+	Woken  []string `json:"woken"`  // IDs of the emails and threads that are woken
+	Failed []string `json:"failed"` // IDs of the emails and threads that failed to wake, which are retried by the next Wake
+}
+
+// errNotDue is returned when an item is unsnoozed or snoozed again after it's found due
+var errNotDue = errors.New("not snoozed or not due")
+
+// Wake wakes the emails and threads snoozed until now or earlier, which are found by the snooze index.
+// A woken email is marked unread and moved to the top of the inbox, i.e. its received time becomes now.
+// When a thread is woken, only its latest email snoozed with the thread is moved,
+// and the other emails snoozed with it are shown again as they are.
+func Wake(ctx context.Context, client platform.WakeSnoozedAPI, now time.Time) (*WakeResult, error) {
+	now = now.UTC().Truncate(time.Second)
+	result := &WakeResult{}
+	var lastEvaluatedKey map[string]dynamodbTypes.AttributeValue
+	for {
+		resp, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(env.TableName),
+			IndexName:              aws.String(env.GsiSnoozeIndexName),
+			KeyConditionExpression: aws.String("SnoozeKey = :snoozeKey AND SnoozedUntil <= :now"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+				":snoozeKey": &dynamodbTypes.AttributeValueMemberS{Value: email.SnoozeKey},
+				":now":       &dynamodbTypes.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, platform.ErrTooManyRequests
+			}
+			return nil, err
+		}
+
+		for _, item := range resp.Items {
+			var snoozed struct {
+				MessageID     string
+				TypeYearMonth string
+				ThreadID      string
+			}
+			if err = attributevalue.UnmarshalMap(item, &snoozed); err != nil {
+				return nil, err
+			}
+
+			switch {
+			case strings.HasPrefix(snoozed.TypeYearMonth, model.EmailTypeThread+"#"):
+				err = wakeThread(ctx, client, snoozed.MessageID, "", now)
+			case snoozed.ThreadID != "":
+				err = wakeThread(ctx, client, snoozed.ThreadID, snoozed.MessageID, now)
+			default:
+				err = wakeEmail(ctx, client, snoozed.MessageID, now)
+			}
+			if errors.Is(err, errNotDue) {
+				continue
+			}
+			if err != nil {
+				fmt.Printf("failed to wake %s: %v\n", snoozed.MessageID, err)
+				result.Failed = append(result.Failed, snoozed.MessageID)
+				continue
+			}
+			result.Woken = append(result.Woken, snoozed.MessageID)
+		}
+
+		lastEvaluatedKey = resp.LastEvaluatedKey
+		if len(lastEvaluatedKey) == 0 {
+			return result, nil
+		}
+	}
+}
+
+// wakeEmail wakes an email that isn't in a thread
+func wakeEmail(ctx context.Context, client platform.WakeSnoozedAPI, messageID string, now time.Time) error {
+	e, err := email.Get(ctx, client, messageID)
+	if err != nil {
+		return err
+	}
+	if e.SnoozedUntil == "" || e.SnoozedUntil > now.Format(time.RFC3339) {
+		return errNotDue
+	}
+
+	update, err := wakeUpdate(e, e.IsThreadLatest, e.TrashedTime == "", now)
+	if err != nil {
+		return err
+	}
+	err = transactItems(ctx, client, []dynamodbTypes.TransactWriteItem{{Update: update}})
+	if err != nil {
+		return err
+	}
+
+	hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionWoken, Email: hook.Email{ID: messageID}})
+	return nil
+}
+
+// wakeThread wakes a snoozed thread if emailID is empty, or else the email snoozed individually in the thread.
+// The woken email is moved to the end of the thread, which is updated accordingly.
+// Emails in a trashed thread are shown again without moving them.
+func wakeThread(ctx context.Context, client platform.WakeSnoozedAPI, threadID, emailID string, now time.Time) error {
+	thread, err := GetThreadWithEmails(ctx, client, threadID)
+	if err != nil {
+		return err
+	}
+	due := now.Format(time.RFC3339)
+	emails := existingEmails(thread.Emails)
+	var snoozed []*email.GetResult
+	if emailID == "" {
+		if thread.SnoozedUntil == nil || *thread.SnoozedUntil > due {
+			return errNotDue
+		}
+		for _, e := range emails {
+			if e.SnoozedByThread {
+				snoozed = append(snoozed, e)
+			}
+		}
+	} else {
+		i := slices.IndexFunc(emails, func(e *email.GetResult) bool { return e.MessageID == emailID })
+		if i < 0 || emails[i].SnoozedUntil == "" || emails[i].SnoozedByThread || emails[i].SnoozedUntil > due {
+			return errNotDue
+		}
+		snoozed = []*email.GetResult{emails[i]}
+	}
+
+	var moved *email.GetResult
+	if len(snoozed) > 0 && thread.TrashedTime == nil {
+		moved = snoozed[len(snoozed)-1]
+		emails = slices.DeleteFunc(emails, func(e *email.GetResult) bool { return e == moved })
+		moved.TimeReceived = due
+		moved.Unread = aws.Bool(true)
+		emails = append(emails, moved)
+	}
+
+	var items []dynamodbTypes.TransactWriteItem
+	for i, e := range emails {
+		latest := e.IsThreadLatest
+		if moved != nil {
+			latest = i == len(emails)-1
+		}
+		if slices.Contains(snoozed, e) {
+			update, err := wakeUpdate(e, latest, e == moved, now)
+			if err != nil {
+				return err
+			}
+			items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+		} else if update := relinkEmail(e, threadID, latest, nil); update != nil {
+			items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+		}
+	}
+
+	var update *dynamodbTypes.Update
+	if moved != nil {
+		update, err = threadUpdate(thread, emails, thread.DraftID)
+		if err != nil {
+			return err
+		}
+	} else if emailID == "" {
+		update = &dynamodbTypes.Update{
+			TableName: aws.String(env.TableName),
+			Key: map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: threadID},
+			},
+			ConditionExpression:       aws.String("attribute_exists(MessageID)"),
+			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{},
+		}
+	}
+	if emailID == "" {
+		// the thread must not be snoozed again meanwhile
+		update.UpdateExpression = aws.String(strings.TrimSpace(aws.ToString(update.UpdateExpression) + " REMOVE SnoozedUntil, SnoozeKey"))
+		update.ConditionExpression = aws.String(aws.ToString(update.ConditionExpression) + " AND SnoozedUntil = :oldSnoozedUntil")
+		update.ExpressionAttributeValues[":oldSnoozedUntil"] = &dynamodbTypes.AttributeValueMemberS{Value: *thread.SnoozedUntil}
+	}
+	if update != nil {
+		items = append(items, dynamodbTypes.TransactWriteItem{Update: update})
+	}
+
+	err = transactItems(ctx, client, items)
+	if err != nil {
+		return err
+	}
+
+	if moved != nil {
+		hook.Notify(ctx, client, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionWoken, Email: hook.Email{ID: moved.MessageID, ThreadID: threadID}})
+	}
+	if emailID == "" {
+		hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionWoken, Thread: hook.Thread{ID: threadID}})
+	} else if moved != nil {
+		hook.Notify(ctx, client, &hook.Hook{Event: hook.EventThread, Action: hook.ActionUpdated, Thread: hook.Thread{ID: threadID}})
+	}
+	return nil
+}
+
+// wakeUpdate returns the update to show a snoozed email again, and to set whether it's the latest email of its thread.
+// If move is true, the email is marked unread and received again at now, which moves it to the top of the inbox.
+func wakeUpdate(e *email.GetResult, latest, move bool, now time.Time) (*dynamodbTypes.Update, error) {
+	var set []string
+	remove := []string{"SnoozedUntil", "SnoozeKey", "SnoozedByThread"}
+	values := map[string]dynamodbTypes.AttributeValue{
+		":oldSnoozedUntil": &dynamodbTypes.AttributeValueMemberS{Value: e.SnoozedUntil},
+	}
+	// the email must not be unsnoozed, snoozed again, or moved to another thread meanwhile
+	condition := "SnoozedUntil = :oldSnoozedUntil"
+	if e.ThreadID != "" {
+		condition += " AND ThreadID = :threadID"
+		values[":threadID"] = &dynamodbTypes.AttributeValueMemberS{Value: e.ThreadID}
+	}
+
+	if move {
+		typeYearMonth, err := format.TypeYearMonth(model.EmailTypeInbox, now)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, "TypeYearMonth = :typeYearMonth", "DateTime = :dateTime", "Unread = :true")
+		values[":typeYearMonth"] = &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth}
+		values[":dateTime"] = &dynamodbTypes.AttributeValueMemberS{Value: format.DateTime(now)}
+		values[":true"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+	}
+	if latest && !e.IsThreadLatest {
+		set = append(set, "IsThreadLatest = :true")
+		values[":true"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+	} else if !latest && e.IsThreadLatest {
+		remove = append(remove, "IsThreadLatest")
+	}
+
+	expression := "REMOVE " + strings.Join(remove, ", ")
+	if len(set) > 0 {
+		expression = "SET " + strings.Join(set, ", ") + " " + expression
+	}
+	return &dynamodbTypes.Update{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: e.MessageID},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	}, nil
+}
@@ -45,6 +45,15 @@ func DateTime(t time.Time) string {
 	return t.UTC().Format("02-15:04:05")
 }
 
+// Address formats an address as "Name <address>", or only the address if there's no name.
+// Unlike mail.Address.String, the name is neither quoted nor encoded, same as SES common headers.
+func Address(address *mail.Address) string {
+	if address.Name == "" {
+		return address.Address
+	}
+	return address.Name + " <" + address.Address + ">"
+}
+
 // RejoinDate converts year-month and date-time to RFC3399
 func RejoinDate(ym string, dt string) string {
 	dt = strings.Replace(dt, "-", "T", 1)
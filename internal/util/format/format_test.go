@@ -1,6 +1,7 @@
 package format
 
 import (
+	"net/mail"
 	"strconv"
 	"testing"
 	"time"
@@ -95,6 +96,28 @@ func TestDateTime(t *testing.T) {
 	}
 }
 
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"First Last <ok@example.com>", "First Last <ok@example.com>"},
+		{"\"Google\" <google@reply.google.com>", "Google <google@reply.google.com>"},
+		{"<register@example.com>", "register@example.com"},
+		{"<REGISTER@example.com>", "REGISTER@example.com"},
+		{"ok@example.com", "ok@example.com"},
+		{"=?UTF-8?Q?J=C3=B6hn?= <john@example.com>", "Jöhn <john@example.com>"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			address, err := mail.ParseAddress(test.input)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, Address(address))
+		})
+	}
+}
+
 func TestRejoinDate(t *testing.T) {
 	tests := []struct {
 		ym       string
@@ -2,10 +2,14 @@ package mockutil
 
 import (
 	"context"
+	"errors"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
+var errUnexpectedCall = errors.New("unexpected call")
+
 type MockGetItemAPI func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
 
 func (m MockGetItemAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
@@ -30,3 +34,24 @@ type MockTransactWriteItemAPI func(ctx context.Context, params *dynamodb.Transac
 func (m MockTransactWriteItemAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 	return m(ctx, params, optFns...)
 }
+
+// MockPublishAPI implements platform.PublishAPI for tests that don't configure SQS or webhooks,
+// in which case events are not published and none of the methods are called
+type MockPublishAPI struct{}
+
+func (MockPublishAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return nil, errUnexpectedCall
+}
+
+func (MockPublishAPI) PutItem(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return nil, errUnexpectedCall
+}
+
+//revive:disable:var-naming
+func (MockPublishAPI) GetQueueUrl(_ context.Context, _ *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return nil, errUnexpectedCall
+}
+
+func (MockPublishAPI) SendMessage(_ context.Context, _ *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	return nil, errUnexpectedCall
+}
@@ -12,9 +12,13 @@ BUILD_VERSION=$(git describe --tags --always)
 ENVIRONMENT="env GOOS=linux GOARCH=amd64 CGO_ENABLED=0"
 
 apiFuncs=(
-  "emails/list" "emails/get" "emails/getRaw" "emails/getContent" "emails/read" "emails/trash" "emails/untrash"
-  "emails/delete" "emails/create" "emails/save" "emails/send" "emails/reparse"
-  "threads/get" "threads/trash" "threads/untrash" "threads/delete"
+  "emails/list" "emails/get" "emails/getRaw" "emails/getContent" "emails/read" "emails/archive" "emails/trash" "emails/untrash"
+  "emails/delete" "emails/create" "emails/save" "emails/send" "emails/reparse" "emails/star" "emails/snooze"
+  "threads/get" "threads/read" "threads/trash" "threads/untrash" "threads/archive" "threads/delete" "threads/merge" "threads/split" "threads/mute" "threads/star" "threads/snooze"
+  "starred/list"
+  "exports/create" "exports/get"
+  "webhooks/list" "webhooks/get" "webhooks/replay" "webhooks/replayRange"
+  "push/subscribe" "push/unsubscribe" "push/publicKey"
 )
 
 for i in "${!apiFuncs[@]}"; do
@@ -37,6 +41,22 @@ zip -j bin/info.zip bin/bootstrap
 ${ENVIRONMENT} go build -ldflags="-s -w" -o bin/functions/email_receive functions/emailReceive/*
 cp bin/functions/email_receive bin/bootstrap
 zip -j bin/email_receive.zip bin/bootstrap
+
+${ENVIRONMENT} go build -ldflags="-s -w" -o bin/functions/email_export functions/emailExport/*
+cp bin/functions/email_export bin/bootstrap
+zip -j bin/email_export.zip bin/bootstrap
+
+${ENVIRONMENT} go build -ldflags="-s -w" -o bin/functions/webhook_deliver functions/webhookDeliver/*
+cp bin/functions/webhook_deliver bin/bootstrap
+zip -j bin/webhook_deliver.zip bin/bootstrap
+
+${ENVIRONMENT} go build -ldflags="-s -w" -o bin/functions/snooze_wake functions/snoozeWake/*
+cp bin/functions/snooze_wake bin/bootstrap
+zip -j bin/snooze_wake.zip bin/bootstrap
+
+${ENVIRONMENT} go build -ldflags="-s -w" -o bin/functions/trash_purge functions/trashPurge/*
+cp bin/functions/trash_purge bin/bootstrap
+zip -j bin/trash_purge.zip bin/bootstrap
 rm bin/bootstrap
 
 if [ $ZIP_ONLY == "true" ]; then